@@ -4,6 +4,10 @@ go 1.21
 
 require (
 	github.com/pierrec/xxHash v0.1.5
+	github.com/tetratelabs/wazero v1.8.2
 	golang.org/x/crypto v0.21.0
 	golang.org/x/mod v0.16.0
+	golang.org/x/term v0.18.0
 )
+
+require golang.org/x/sys v0.18.0 // indirect
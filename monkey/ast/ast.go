@@ -55,6 +55,9 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Name.Type != nil {
+		out.WriteString(": " + ls.Name.Type.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -83,6 +86,32 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// YieldStatement 在生成器函数中产出一个值并挂起
+type YieldStatement struct {
+	Token token.Token // yield
+	Value Expression
+}
+
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+func (ys *YieldStatement) String() string {
+	return ys.TokenLiteral() + " " + ys.Value.String() + ";"
+}
+
+// ForStatement 是 for (x in iterable) { ... } 循环, iterable 可以是数组、字符串或迭代器
+type ForStatement struct {
+	Token    token.Token // for
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	return "for (" + fs.Variable.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -103,6 +132,14 @@ func (es *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	Type  TypeExpr // 可选的类型注解, 只出现在 let 名字和函数参数上
+	Slot  *Slot    // 由 compiler.Resolve 填写, 未解析时为 nil
+}
+
+// Slot 是标识符解析后的存储位置, Scope 与 compiler.SymbolScope 的取值相同
+type Slot struct {
+	Scope string
+	Index int
 }
 
 func (i *Identifier) expressionNode()      {}
@@ -140,6 +177,32 @@ func (s *StringLiteral) expressionNode()      {}
 func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
 func (s *StringLiteral) String() string       { return s.Token.Literal }
 
+// TemplateLiteral 模板字符串 "hello ${name}", Parts 中的字符串片段为 *StringLiteral
+type TemplateLiteral struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(`"`)
+	for _, part := range tl.Parts {
+		if s, ok := part.(*StringLiteral); ok {
+			out.WriteString(s.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	out.WriteString(`"`)
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -163,6 +226,7 @@ func (al *ArrayLiteral) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // Pairs 的键, 按源码中的顺序
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -171,8 +235,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	var pairs []string
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -289,7 +353,15 @@ type FunctionLiteral struct {
 	Name       string
 	Token      token.Token
 	Parameters []*Identifier
+	ReturnType TypeExpr // 可选的返回值类型注解
 	Body       *BlockStatement
+
+	// 函数体中(不含嵌套的函数)出现了 yield, 调用时返回生成器
+	Generator bool
+
+	// 由 compiler.Resolve 填写: 局部变量个数, 以及在外层作用域中捕获的自由变量
+	NumLocals int
+	Free      []Slot
 }
 
 func (fn *FunctionLiteral) expressionNode()      {}
@@ -298,7 +370,11 @@ func (fn *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	var params []string
 	for _, p := range fn.Parameters {
-		params = append(params, p.String())
+		if p.Type != nil {
+			params = append(params, p.String()+": "+p.Type.String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(fn.TokenLiteral())
@@ -307,7 +383,11 @@ func (fn *FunctionLiteral) String() string {
 	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fn.ReturnType != nil {
+		out.WriteString(": " + fn.ReturnType.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(fn.Body.String())
 
 	return out.String()
@@ -390,6 +470,11 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 	case *ReturnStatement:
 		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *YieldStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *ForStatement:
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 	case *LetStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *FunctionLiteral:
@@ -401,12 +486,20 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		for i, element := range node.Elements {
 			node.Elements[i] = Modify(element, modifier).(Expression)
 		}
+	case *TemplateLiteral:
+		// 修改后不是表达式的部分保留原样, 否则会留下 nil 部分
+		for i, part := range node.Parts {
+			if modified, ok := Modify(part, modifier).(Expression); ok {
+				node.Parts[i] = modified
+			}
+		}
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
-		for key, value := range node.Pairs {
+		for i, key := range node.Keys {
 			nKey, _ := Modify(key, modifier).(Expression)
-			nValue, _ := Modify(value, modifier).(Expression)
+			nValue, _ := Modify(node.Pairs[key], modifier).(Expression)
 			newPairs[nKey] = nValue
+			node.Keys[i] = nKey
 		}
 		node.Pairs = newPairs
 	}
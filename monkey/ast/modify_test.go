@@ -116,6 +116,10 @@ func TestModify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&TemplateLiteral{Parts: []Expression{&StringLiteral{Value: "a"}, one()}},
+			&TemplateLiteral{Parts: []Expression{&StringLiteral{Value: "a"}, two()}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -126,3 +130,18 @@ func TestModify(t *testing.T) {
 		}
 	}
 }
+
+func TestModifyTemplatePartToNonExpression(t *testing.T) {
+	part := &IntegerLiteral{Value: 1}
+	toStatement := func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &ReturnStatement{}
+		}
+		return node
+	}
+
+	modified := Modify(&TemplateLiteral{Parts: []Expression{part}}, toStatement).(*TemplateLiteral)
+	if modified.Parts[0] != part {
+		t.Errorf("part not kept. got=%#v", modified.Parts[0])
+	}
+}
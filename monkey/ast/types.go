@@ -0,0 +1,69 @@
+package ast
+
+import (
+	"bytes"
+	"go-example/monkey/token"
+	"strings"
+)
+
+// TypeExpr 是类型注解, 如 int、[string]、{string: int}、fn(int, int): int
+type TypeExpr interface {
+	Node
+	typeNode()
+}
+
+// NamedType 是 int、string、bool、null、any 这样的具名类型
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+type ArrayType struct {
+	Token token.Token
+	Elem  TypeExpr
+}
+
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Elem.String() + "]" }
+
+type HashType struct {
+	Token token.Token
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+type FunctionType struct {
+	Token      token.Token
+	Parameters []TypeExpr
+	Return     TypeExpr // 为 nil 时表示未注解
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	var out bytes.Buffer
+
+	var params []string
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if ft.Return != nil {
+		out.WriteString(": " + ft.Return.String())
+	}
+
+	return out.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"go-example/monkey/object"
+	"testing"
+)
+
+const collectionSize = 100000
+
+// 与脚本中的 push(xs, x) 和 rest(xs) 一样通过内置函数调用
+var (
+	push = object.BuiltinsMap["push"].Fn
+	rest = object.BuiltinsMap["rest"].Fn
+)
+
+func BenchmarkPush(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var array object.Object = object.NewArray(nil)
+		for j := 0; j < collectionSize; j++ {
+			array = push(array, &object.Integer{Value: int64(j)})
+		}
+		if n := array.(*object.Array).Len(); n != collectionSize {
+			b.Fatalf("wrong length %d", n)
+		}
+	}
+}
+
+func BenchmarkRest(b *testing.B) {
+	elements := make([]object.Object, collectionSize)
+	for j := range elements {
+		elements[j] = &object.Integer{Value: int64(j)}
+	}
+	array := object.NewArray(elements)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var xs object.Object = array
+		for j := 0; j < collectionSize; j++ {
+			xs = rest(xs)
+		}
+		if n := xs.(*object.Array).Len(); n != 0 {
+			b.Fatalf("wrong length %d", n)
+		}
+	}
+}
+
+func BenchmarkHashSet(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		hash := &object.Hash{}
+		for j := 0; j < collectionSize; j++ {
+			key := &object.Integer{Value: int64(j)}
+			hash = hash.Set(key.HashKey(), object.HashPair{Key: key, Value: key})
+		}
+		if hash.Len() != collectionSize {
+			b.Fatalf("wrong length %d", hash.Len())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// 闭包: 把 256 个加法器组合成一个函数, 每次调用都穿过各层闭包的自由变量
+// result: 3268950
+let digits = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9];
+let adder = fn(n) { fn(x) { x + n } };
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let chain = fn(lo, hi) {
+	if (hi - lo == 1) {
+		adder(lo)
+	} else {
+		let mid = (lo + hi) / 2;
+		compose(chain(lo, mid), chain(mid, hi))
+	}
+};
+let f = chain(0, 256);
+let results = fn() {
+	for (x in digits) {
+		for (y in digits) {
+			yield f(x * 10 + y);
+		}
+	}
+};
+let sum = fn(xs, lo, hi) {
+	if (hi - lo == 1) {
+		xs[lo]
+	} else {
+		let mid = (lo + hi) / 2;
+		sum(xs, lo, mid) + sum(xs, mid, hi)
+	}
+};
+let xs = collect(results());
+sum(xs, 0, len(xs))
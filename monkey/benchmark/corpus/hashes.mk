@@ -0,0 +1,25 @@
+// 哈希: 每次迭代构造一个小哈希, 再用字符串键和整数键反复查找
+// result: 499500
+let digits = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9];
+let names = {0: "zero", 1: "one", 2: "two", 3: "three", 4: "four", 5: "five", 6: "six", 7: "seven", 8: "eight", 9: "nine"};
+let values = {"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9};
+let numbers = fn() {
+	for (a in digits) {
+		for (b in digits) {
+			for (c in digits) {
+				let h = {"a": names[a], "b": names[b], "c": names[c]};
+				yield values[h["a"]] * 100 + values[h["b"]] * 10 + values[h["c"]];
+			}
+		}
+	}
+};
+let sum = fn(xs, lo, hi) {
+	if (hi - lo == 1) {
+		xs[lo]
+	} else {
+		let mid = (lo + hi) / 2;
+		sum(xs, lo, mid) + sum(xs, mid, hi)
+	}
+};
+let xs = collect(numbers());
+sum(xs, 0, len(xs))
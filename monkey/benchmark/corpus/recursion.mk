@@ -0,0 +1,10 @@
+// 递归调用: 朴素的 fibonacci, 主要是调用、比较和整数运算
+// result: 10946
+let fibonacci = fn(x) {
+	if (x < 2) {
+		x
+	} else {
+		fibonacci(x - 1) + fibonacci(x - 2)
+	}
+};
+fibonacci(21)
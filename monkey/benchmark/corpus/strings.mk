@@ -0,0 +1,13 @@
+// 字符串拼接: 分治地用模板字符串生成 2048 个单词并连接, 再逐个字符遍历
+// result: [11178, 11178, w0 w1 w2 ]
+let words = fn(lo, hi) {
+	if (hi - lo == 1) {
+		"w${lo} "
+	} else {
+		let mid = (lo + hi) / 2;
+		words(lo, mid) + words(mid, hi)
+	}
+};
+let text = words(0, 2048);
+let chars = collect(text);
+[len(text), len(chars), words(0, 3)]
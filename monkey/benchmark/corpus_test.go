@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-example/monkey/conformance"
+	"testing"
+)
+
+func loadCorpusTB(tb testing.TB) []*conformance.Case {
+	cases, err := loadCorpus()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(cases) == 0 {
+		tb.Fatal("empty corpus")
+	}
+	return cases
+}
+
+// 语料中的程序也是一致性测试用例, 每个引擎都要得到标注的结果
+func TestCorpus(t *testing.T) {
+	for _, c := range loadCorpusTB(t) {
+		t.Run(c.Name, func(t *testing.T) {
+			for _, e := range conformance.Engines {
+				t.Run(e.Name, func(t *testing.T) {
+					switch status, detail := c.Check(e); status {
+					case conformance.Fail:
+						t.Error(detail)
+					case conformance.Skip:
+						t.Skip(detail)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	results, err := benchmark(options{programs: []string{"recursion", "strings"}, stages: []string{"parser", "vm-register"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeResults(&out, results, true); err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	expected := []struct{ program, stage string }{
+		{"recursion", "parser"}, {"recursion", "vm-register"}, {"strings", "parser"}, {"strings", "vm-register"},
+	}
+	if len(report.Results) != len(expected) {
+		t.Fatalf("wrong number of results. want=%d, got=%d", len(expected), len(report.Results))
+	}
+	for i, r := range report.Results {
+		if r.Program != expected[i].program || r.Stage != expected[i].stage {
+			t.Errorf("results[%d]: want %s/%s, got %s/%s", i, expected[i].program, expected[i].stage, r.Program, r.Stage)
+		}
+		if r.Runs < 1 || r.NsPerOp <= 0 {
+			t.Errorf("results[%d]: not measured: %+v", i, r)
+		}
+		if r.Stage == "parser" && (r.Instructions != 0 || r.Opcodes != nil) {
+			t.Errorf("results[%d]: parser has opcode counts", i)
+		}
+		if r.Stage == "vm-register" && (r.Instructions == 0 || r.Opcodes["OpRCall"] == 0) {
+			t.Errorf("results[%d]: missing opcode counts: %v", i, r.Opcodes)
+		}
+	}
+
+	if _, err := benchmark(options{programs: []string{"missing"}}); err == nil {
+		t.Error("expected error for unknown program")
+	}
+}
+
+// benchmarkStage 在语料的每个程序上测量一个阶段
+func benchmarkStage(b *testing.B, name string) {
+	var s stage
+	for _, s = range stages {
+		if s.name == name {
+			break
+		}
+	}
+	if s.name != name {
+		b.Fatalf("unknown stage %s", name)
+	}
+	for _, c := range loadCorpusTB(b) {
+		b.Run(c.Name, func(b *testing.B) {
+			run, err := s.prepare(c.Source)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLexer(b *testing.B) { benchmarkStage(b, "lexer") }
+
+func BenchmarkParser(b *testing.B) { benchmarkStage(b, "parser") }
+
+func BenchmarkCompiler(b *testing.B) { benchmarkStage(b, "compiler") }
+
+func BenchmarkStackVM(b *testing.B) { benchmarkStage(b, "vm") }
+
+func BenchmarkRegisterVM(b *testing.B) { benchmarkStage(b, "vm-register") }
+
+func BenchmarkEvaluator(b *testing.B) { benchmarkStage(b, "evaluator") }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/evaluator"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"go-example/monkey/vm"
+	"strings"
+	"testing"
+)
+
+const fibonacci = `
+let fibonacci = fn(x) {
+	if (x == 0) {
+		return 0;
+	} else {
+		if (x == 1) {
+			return 1;
+		} else {
+			fibonacci(x - 1) + fibonacci(x - 2);
+		}
+	}
+};
+`
+
+func parse(tb testing.TB, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		tb.Fatalf("parser errors: %v", p.Errors())
+	}
+	return prog
+}
+
+// 三种执行方式运行同一个程序, 编译时间也计算在内
+func parseFibonacci(b *testing.B) *ast.Program {
+	return parse(b, fibonacci+"fibonacci(20);")
+}
+
+func benchmarkVM(b *testing.B, target compiler.Target) {
+	prog := parseFibonacci(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := runVM(prog, target)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if result.Inspect() != "6765" {
+			b.Fatalf("wrong result %s", result.Inspect())
+		}
+	}
+}
+
+// runVM 编译并在 vm 上运行 prog, 返回最后一个表达式语句的值
+func runVM(prog *ast.Program, target compiler.Target) (object.Object, error) {
+	bytecode, err := compileProgram(prog, target)
+	if err != nil {
+		return nil, err
+	}
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		return nil, fmt.Errorf("vm error: %s", err)
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+func BenchmarkFibonacciStackVM(b *testing.B) { benchmarkVM(b, compiler.StackTarget) }
+
+func BenchmarkFibonacciRegisterVM(b *testing.B) { benchmarkVM(b, compiler.RegisterTarget) }
+
+func BenchmarkFibonacciEval(b *testing.B) {
+	prog := parseFibonacci(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := evaluator.Eval(prog, object.NewEnvironment())
+		if result.Inspect() != "6765" {
+			b.Fatalf("wrong result %s", result.Inspect())
+		}
+	}
+}
+
+// arithmetic 返回包含 n 组整数运算的程序, 中间结果都是较大的整数
+func arithmetic(n int) string {
+	return "let x = 100000; x" + strings.Repeat(" + x * 3 - x / 2", n)
+}
+
+func compile(tb testing.TB, input string, target compiler.Target) *compiler.Bytecode {
+	comp := compiler.New()
+	comp.SetTarget(target)
+	if err := comp.Compile(parse(tb, input)); err != nil {
+		tb.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func runBytecode(tb testing.TB, bytecode *compiler.Bytecode) {
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		tb.Fatalf("vm error: %s", err)
+	}
+}
+
+// vmAllocs 返回在 vm 上运行一次 input 的堆分配次数, 不包括编译
+func vmAllocs(tb testing.TB, input string, target compiler.Target) float64 {
+	bytecode := compile(tb, input, target)
+	return testing.AllocsPerRun(10, func() { runBytecode(tb, bytecode) })
+}
+
+// checkArithmeticAllocs 检查整数运算不分配内存: 分配次数只来自创建 vm, 与运算的次数无关
+func checkArithmeticAllocs(tb testing.TB, target compiler.Target) {
+	small := vmAllocs(tb, arithmetic(10), target)
+	large := vmAllocs(tb, arithmetic(1000), target)
+	if large != small {
+		tb.Fatalf("%s vm: integer arithmetic allocates: %v allocs for 10 operations, %v for 1000", target, small, large)
+	}
+}
+
+func TestArithmeticAllocations(t *testing.T) {
+	for _, target := range []compiler.Target{compiler.StackTarget, compiler.RegisterTarget} {
+		checkArithmeticAllocs(t, target)
+	}
+}
+
+func benchmarkArithmetic(b *testing.B, target compiler.Target) {
+	checkArithmeticAllocs(b, target)
+	bytecode := compile(b, arithmetic(1000), target)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runBytecode(b, bytecode)
+	}
+}
+
+func BenchmarkArithmeticStackVM(b *testing.B) { benchmarkArithmetic(b, compiler.StackTarget) }
+
+func BenchmarkArithmeticRegisterVM(b *testing.B) { benchmarkArithmetic(b, compiler.RegisterTarget) }
+
+// 在栈指令上比较使用和不使用特化指令的 fibonacci
+func BenchmarkSuperinstructions(b *testing.B) {
+	prog := parseFibonacci(b)
+	for _, super := range []bool{false, true} {
+		comp := compiler.New()
+		comp.SetSuperinstructions(super)
+		if err := comp.Compile(prog); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		name := "generic"
+		if super {
+			name = "specialised"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				runBytecode(b, bytecode)
+			}
+		})
+	}
+}
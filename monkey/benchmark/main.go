@@ -1,68 +1,377 @@
+// benchmark 在 corpus 中的程序上分别测量词法分析、语法分析、编译和各个执行引擎的耗时与内存分配,
+// vm 还统计每个操作码的执行次数. 使用 -json 输出机器可读的结果, 便于跟踪性能回归
 package main
 
 import (
+	"embed"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"go-example/monkey/ast"
 	"go-example/monkey/compiler"
+	"go-example/monkey/conformance"
 	"go-example/monkey/evaluator"
 	"go-example/monkey/lexer"
 	"go-example/monkey/object"
 	"go-example/monkey/parser"
+	"go-example/monkey/token"
 	"go-example/monkey/vm"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
 	"time"
 )
 
-var (
-	engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
-	input  = `
-let fibonacci = fn(x) {
-	if (x == 0) {
-		return 0;
-	} else {
-		if (x == 1) {
-			return 1;
-		} else {
-			fibonacci(x - 1) + fibonacci(x - 2);
+// corpus 中的程序用 // result: 标注期望的结果, 格式与一致性测试相同
+//
+//go:embed corpus/*.mk
+var corpus embed.FS
+
+func loadCorpus() ([]*conformance.Case, error) {
+	files, err := fs.Glob(corpus, "corpus/*.mk")
+	if err != nil {
+		return nil, err
+	}
+	var cases []*conformance.Case
+	for _, file := range files {
+		src, err := corpus.ReadFile(file)
+		if err != nil {
+			return nil, err
 		}
+		c, err := conformance.Parse(path.Base(file), string(src))
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
 	}
-};
-fibonacci(35);
-`
-)
+	return cases, nil
+}
 
-func main() {
-	flag.Parse()
+// stage 是被测量的一个阶段. prepare 在计时之前准备好输入, 返回被重复执行的函数,
+// 执行引擎返回程序的结果, 其他阶段返回 nil. opcodes 不为 nil 时统计一次运行中每个操作码的执行次数
+type stage struct {
+	name    string
+	prepare func(src string) (func() (object.Object, error), error)
+	opcodes func(src string) (*vm.OpcodeCounts, error)
+}
 
-	var duration time.Duration
-	var result object.Object
+var stages = []stage{
+	{name: "lexer", prepare: prepareLexer},
+	{name: "parser", prepare: prepareParser},
+	{name: "compiler", prepare: prepareCompiler},
+	vmStage("vm", compiler.StackTarget),
+	vmStage("vm-register", compiler.RegisterTarget),
+	{name: "evaluator", prepare: prepareEvaluator},
+}
 
-	l := lexer.New(input)
-	p := parser.New(l)
+func parseProgram(src string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
 	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(errs, "; "))
+	}
+	return prog, nil
+}
+
+func compileProgram(prog *ast.Program, target compiler.Target) (*compiler.Bytecode, error) {
+	comp := compiler.New()
+	comp.SetTarget(target)
+	if err := comp.Compile(prog); err != nil {
+		return nil, fmt.Errorf("compiler error: %s", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+func prepareLexer(src string) (func() (object.Object, error), error) {
+	return func() (object.Object, error) {
+		l := lexer.New(src)
+		for l.NextToken().Type != token.EOF {
+		}
+		return nil, nil
+	}, nil
+}
+
+func prepareParser(src string) (func() (object.Object, error), error) {
+	return func() (object.Object, error) {
+		_, err := parseProgram(src)
+		return nil, err
+	}, nil
+}
 
-	if *engine == "vm" {
-		comp := compiler.New()
-		err := comp.Compile(prog)
+// prepareCompiler 只解析一次, 之后重复编译同一个语法树
+func prepareCompiler(src string) (func() (object.Object, error), error) {
+	prog, err := parseProgram(src)
+	if err != nil {
+		return nil, err
+	}
+	return func() (object.Object, error) {
+		_, err := compileProgram(prog, compiler.StackTarget)
+		return nil, err
+	}, nil
+}
+
+// vmStage 只计算运行字节码的时间, 不包括解析和编译
+func vmStage(name string, target compiler.Target) stage {
+	bytecode := func(src string) (*compiler.Bytecode, error) {
+		prog, err := parseProgram(src)
 		if err != nil {
-			fmt.Printf("compiler error: %s\n", err)
-			return
+			return nil, err
+		}
+		return compileProgram(prog, target)
+	}
+	return stage{
+		name: name,
+		prepare: func(src string) (func() (object.Object, error), error) {
+			bytecode, err := bytecode(src)
+			if err != nil {
+				return nil, err
+			}
+			return func() (object.Object, error) {
+				machine := vm.New(bytecode)
+				if err := machine.Run(); err != nil {
+					return nil, fmt.Errorf("vm error: %s", err)
+				}
+				return machine.LastPoppedStackElem(), nil
+			}, nil
+		},
+		opcodes: func(src string) (*vm.OpcodeCounts, error) {
+			bytecode, err := bytecode(src)
+			if err != nil {
+				return nil, err
+			}
+			counts := &vm.OpcodeCounts{}
+			machine := vm.New(bytecode)
+			machine.CountOpcodes(counts)
+			if err := machine.Run(); err != nil {
+				return nil, fmt.Errorf("vm error: %s", err)
+			}
+			return counts, nil
+		},
+	}
+}
+
+func prepareEvaluator(src string) (func() (object.Object, error), error) {
+	prog, err := parseProgram(src)
+	if err != nil {
+		return nil, err
+	}
+	return func() (object.Object, error) {
+		result := evaluator.Eval(prog, object.NewEnvironment())
+		if err, ok := result.(*object.Error); ok {
+			return nil, fmt.Errorf("evaluator error: %s", err.Message)
 		}
+		return result, nil
+	}, nil
+}
 
-		machine := vm.New(comp.Bytecode())
+// Result 是一个程序在一个阶段上的测量结果, 每次运行的耗时和分配都取平均值
+type Result struct {
+	Program      string            `json:"program"`
+	Stage        string            `json:"stage"`
+	Runs         int               `json:"runs"`
+	NsPerOp      int64             `json:"ns_per_op"`
+	AllocsPerOp  uint64            `json:"allocs_per_op"`
+	BytesPerOp   uint64            `json:"bytes_per_op"`
+	Instructions uint64            `json:"instructions,omitempty"`
+	Opcodes      map[string]uint64 `json:"opcodes,omitempty"`
+}
+
+// Report 是 -json 输出的内容
+type Report struct {
+	GoVersion string   `json:"go_version"`
+	GOOS      string   `json:"goos"`
+	GOARCH    string   `json:"goarch"`
+	Results   []Result `json:"results"`
+}
+
+// measure 重复执行 run, 每轮的次数翻倍, 直到一轮的耗时达到 benchtime
+func measure(run func() (object.Object, error), benchtime time.Duration) (Result, error) {
+	var before, after runtime.MemStats
+	for n := 1; ; n *= 2 {
+		runtime.ReadMemStats(&before)
 		start := time.Now()
-		err = machine.Run()
+		for i := 0; i < n; i++ {
+			if _, err := run(); err != nil {
+				return Result{}, err
+			}
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= benchtime {
+			return Result{
+				Runs:        n,
+				NsPerOp:     elapsed.Nanoseconds() / int64(n),
+				AllocsPerOp: (after.Mallocs - before.Mallocs) / uint64(n),
+				BytesPerOp:  (after.TotalAlloc - before.TotalAlloc) / uint64(n),
+			}, nil
+		}
+	}
+}
+
+type options struct {
+	programs  []string // 为空时测量全部程序
+	stages    []string // 为空时测量全部阶段
+	benchtime time.Duration
+	json      bool
+}
+
+// selected 检查 names 都存在, 返回 all 中被选中的下标
+func selected(kind string, all, names []string) ([]int, error) {
+	if len(names) == 0 {
+		names = all
+	}
+	var indexes []int
+	for _, name := range names {
+		i := slices.Index(all, name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown %s %q, want one of %s", kind, name, strings.Join(all, ", "))
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+// benchmark 先运行一次每个程序并检查执行引擎的结果, 再测量各个阶段
+func benchmark(opts options) ([]Result, error) {
+	cases, err := loadCorpus()
+	if err != nil {
+		return nil, err
+	}
+	var programs, stageNames []string
+	for _, c := range cases {
+		programs = append(programs, strings.TrimSuffix(c.Name, ".mk"))
+	}
+	for _, s := range stages {
+		stageNames = append(stageNames, s.name)
+	}
+	caseIndexes, err := selected("program", programs, opts.programs)
+	if err != nil {
+		return nil, err
+	}
+	stageIndexes, err := selected("stage", stageNames, opts.stages)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, i := range caseIndexes {
+		c := cases[i]
+		for _, j := range stageIndexes {
+			s := stages[j]
+			run, err := s.prepare(c.Source)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", c.Name, s.name, err)
+			}
+			value, err := run()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", c.Name, s.name, err)
+			}
+			if value != nil && value.Inspect() != c.Result {
+				return nil, fmt.Errorf("%s: %s: want result %s, got %s", c.Name, s.name, c.Result, value.Inspect())
+			}
+
+			r, err := measure(run, opts.benchtime)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", c.Name, s.name, err)
+			}
+			r.Program, r.Stage = programs[i], s.name
+			if s.opcodes != nil {
+				counts, err := s.opcodes(c.Source)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s: %w", c.Name, s.name, err)
+				}
+				r.Instructions, r.Opcodes = counts.Total(), counts.Named()
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func writeResults(w io.Writer, results []Result, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(Report{
+			GoVersion: runtime.Version(),
+			GOOS:      runtime.GOOS,
+			GOARCH:    runtime.GOARCH,
+			Results:   results,
+		})
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "%-12s %-12s %8d %14d ns/op %12d B/op %10d allocs/op",
+			r.Program, r.Stage, r.Runs, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp)
+		if r.Instructions > 0 {
+			fmt.Fprintf(w, " %12d instructions", r.Instructions)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// list 把逗号分隔的参数拆开, 空字符串表示全部
+func list(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func main() {
+	programs := flag.String("programs", "", "comma-separated programs from the corpus, default all")
+	stageList := flag.String("stages", "", "comma-separated stages: lexer, parser, compiler, vm, vm-register, evaluator; default all")
+	benchtime := flag.Duration("benchtime", time.Second, "minimum time to run each program on each stage")
+	asJSON := flag.Bool("json", false, "write results as JSON")
+	cpuprofile := flag.String("cpuprofile", "", "write a CPU profile to `file`")
+	memprofile := flag.String("memprofile", "", "write a heap profile to `file` after all runs")
+	flag.Parse()
+
+	if err := run(options{
+		programs:  list(*programs),
+		stages:    list(*stageList),
+		benchtime: *benchtime,
+		json:      *asJSON,
+	}, *cpuprofile, *memprofile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options, cpuprofile, memprofile string) error {
+	if cpuprofile != "" {
+		f, err := os.Create(cpuprofile)
 		if err != nil {
-			fmt.Printf("vm error: %s\n", err)
-			return
+			return err
 		}
-		duration = time.Since(start)
-		result = machine.LastPoppedStackElem()
-	} else {
-		env := object.NewEnvironment()
-		start := time.Now()
-		result = evaluator.Eval(prog, env)
-		duration = time.Since(start)
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	results, err := benchmark(opts)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("engine=%s, result=%s, duration=%s\n", *engine, result.Inspect(), duration)
+	if memprofile != "" {
+		f, err := os.Create(memprofile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return err
+		}
+	}
+	return writeResults(os.Stdout, results, opts.json)
 }
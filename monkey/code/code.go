@@ -52,8 +52,81 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+
+	OpBuildString
+
+	OpIter
+	OpIterNext
+	OpYield
 )
 
+// 寄存器指令集, 由 compiler.RegisterTarget 生成. 操作数 A、B、C 是当前帧中的寄存器下标,
+// 函数的参数和局部变量按 SymbolTable 中的下标占用前几个寄存器, 之后是临时寄存器.
+// 跳转和无返回值的返回沿用 OpJump 和 OpReturn.
+const (
+	OpRConstant Opcode = iota + OpYield + 1 // A K: R(A) = constants[K]
+	OpRTrue                                 // A: R(A) = true
+	OpRFalse                                // A: R(A) = false
+	OpRNull                                 // A: R(A) = null
+	OpRMove                                 // A B: R(A) = R(B)
+
+	OpRGetGlobal      // A G: R(A) = globals[G]
+	OpRSetGlobal      // G B: globals[G] = R(B)
+	OpRGetBuiltin     // A I: R(A) = 第 I 个内置函数
+	OpRGetFree        // A I: R(A) = 当前闭包的第 I 个自由变量
+	OpRCurrentClosure // A: R(A) = 当前闭包
+
+	OpRAdd         // A B C: R(A) = R(B) + R(C)
+	OpRSub         // A B C: R(A) = R(B) - R(C)
+	OpRMul         // A B C: R(A) = R(B) * R(C)
+	OpRDiv         // A B C: R(A) = R(B) / R(C)
+	OpREqual       // A B C: R(A) = R(B) == R(C)
+	OpRNotEqual    // A B C: R(A) = R(B) != R(C)
+	OpRGreaterThan // A B C: R(A) = R(B) > R(C)
+	OpRMinus       // A B: R(A) = -R(B)
+	OpRBang        // A B: R(A) = !R(B)
+
+	OpRJumpNotTruthy // A T: R(A) 不为真时跳转到 T
+
+	OpRArray       // A B N: R(A) = [R(B), ..., R(B+N-1)]
+	OpRHash        // A B N: R(A) = {R(B): R(B+1), ...}, N 为键和值的总数
+	OpRBuildString // A B N: R(A) = 依次拼接 R(B) 到 R(B+N-1)
+	OpRIndex       // A B C: R(A) = R(B)[R(C)]
+
+	OpRCall        // A B N: R(A) = R(B)(R(B+1), ..., R(B+N)), 被调用函数的寄存器从 R(B+1) 开始
+	OpRReturnValue // A: 返回 R(A)
+	OpRClosure     // A K B N: R(A) = 常量 K 中的函数与自由变量 R(B) 到 R(B+N-1) 组成的闭包
+
+	OpRIter     // A B: R(A) = R(B) 的迭代器
+	OpRIterNext // A B T: 从迭代器 R(A) 取下一个值放入 R(B), 迭代结束时跳转到 T
+	OpRYield    // A: 生成器产出 R(A)
+
+	OpRResult // A: 记录主程序中表达式语句的值, 即 LastPoppedStackElem 的返回值
+)
+
+// 特化指令, 编译器用它们代替栈指令中常见的指令序列
+const (
+	OpGetLocal0 Opcode = iota + OpRResult + 1 // OpGetLocal 0
+	OpGetLocal1                               // OpGetLocal 1
+	OpGetLocal2                               // OpGetLocal 2
+	OpGetLocal3                               // OpGetLocal 3
+
+	OpCall0 // OpCall 0
+	OpCall1 // OpCall 1
+	OpCall2 // OpCall 2
+
+	OpAddConstant // K: OpConstant K; OpAdd
+	OpSubConstant // K: OpConstant K; OpSub
+
+	OpJumpNotEqual   // T: OpEqual; OpJumpNotTruthy T
+	OpJumpEqual      // T: OpNotEqual; OpJumpNotTruthy T
+	OpJumpNotGreater // T: OpGreaterThan; OpJumpNotTruthy T
+)
+
+// OpWide 是前缀指令, 紧跟其后的指令的每个操作数宽度加倍 (1 字节变为 2 字节, 2 字节变为 4 字节).
+// 编译器只在操作数放不下时使用它
+const OpWide Opcode = OpJumpNotGreater + 1
+
 type Definition struct {
 	Name          string
 	OperandWidths []int
@@ -101,6 +174,69 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpBuildString: {"OpBuildString", []int{2}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2}},
+	OpYield:    {"OpYield", []int{}},
+
+	OpRConstant: {"OpRConstant", []int{2, 2}},
+	OpRTrue:     {"OpRTrue", []int{2}},
+	OpRFalse:    {"OpRFalse", []int{2}},
+	OpRNull:     {"OpRNull", []int{2}},
+	OpRMove:     {"OpRMove", []int{2, 2}},
+
+	OpRGetGlobal:      {"OpRGetGlobal", []int{2, 2}},
+	OpRSetGlobal:      {"OpRSetGlobal", []int{2, 2}},
+	OpRGetBuiltin:     {"OpRGetBuiltin", []int{2, 1}},
+	OpRGetFree:        {"OpRGetFree", []int{2, 1}},
+	OpRCurrentClosure: {"OpRCurrentClosure", []int{2}},
+
+	OpRAdd:         {"OpRAdd", []int{2, 2, 2}},
+	OpRSub:         {"OpRSub", []int{2, 2, 2}},
+	OpRMul:         {"OpRMul", []int{2, 2, 2}},
+	OpRDiv:         {"OpRDiv", []int{2, 2, 2}},
+	OpREqual:       {"OpREqual", []int{2, 2, 2}},
+	OpRNotEqual:    {"OpRNotEqual", []int{2, 2, 2}},
+	OpRGreaterThan: {"OpRGreaterThan", []int{2, 2, 2}},
+	OpRMinus:       {"OpRMinus", []int{2, 2}},
+	OpRBang:        {"OpRBang", []int{2, 2}},
+
+	OpRJumpNotTruthy: {"OpRJumpNotTruthy", []int{2, 2}},
+
+	OpRArray:       {"OpRArray", []int{2, 2, 2}},
+	OpRHash:        {"OpRHash", []int{2, 2, 2}},
+	OpRBuildString: {"OpRBuildString", []int{2, 2, 2}},
+	OpRIndex:       {"OpRIndex", []int{2, 2, 2}},
+
+	OpRCall:        {"OpRCall", []int{2, 2, 1}},
+	OpRReturnValue: {"OpRReturnValue", []int{2}},
+	OpRClosure:     {"OpRClosure", []int{2, 2, 2, 1}},
+
+	OpRIter:     {"OpRIter", []int{2, 2}},
+	OpRIterNext: {"OpRIterNext", []int{2, 2, 2}},
+	OpRYield:    {"OpRYield", []int{2}},
+
+	OpRResult: {"OpRResult", []int{2}},
+
+	OpGetLocal0: {"OpGetLocal0", []int{}},
+	OpGetLocal1: {"OpGetLocal1", []int{}},
+	OpGetLocal2: {"OpGetLocal2", []int{}},
+	OpGetLocal3: {"OpGetLocal3", []int{}},
+
+	OpCall0: {"OpCall0", []int{}},
+	OpCall1: {"OpCall1", []int{}},
+	OpCall2: {"OpCall2", []int{}},
+
+	OpAddConstant: {"OpAddConstant", []int{2}},
+	OpSubConstant: {"OpSubConstant", []int{2}},
+
+	OpJumpNotEqual:   {"OpJumpNotEqual", []int{2}},
+	OpJumpEqual:      {"OpJumpEqual", []int{2}},
+	OpJumpNotGreater: {"OpJumpNotGreater", []int{2}},
+
+	OpWide: {"OpWide", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -111,10 +247,52 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
-func Make(op Opcode, operands ...int) []byte {
+// Make 编码一条指令, 操作数个数不对或放不下时返回错误
+func Make(op Opcode, operands ...int) ([]byte, error) {
 	def, ok := definitions[op]
 	if !ok {
-		return []byte{}
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return encode(op, def, operands)
+}
+
+// MakeWide 编码一条带 OpWide 前缀的指令
+func MakeWide(op Opcode, operands ...int) ([]byte, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	if len(def.OperandWidths) == 0 {
+		return nil, fmt.Errorf("%s has no operands to widen", def.Name)
+	}
+	ins, err := encode(op, Wide(def), operands)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(OpWide)}, ins...), nil
+}
+
+// MustMake 与 Make 相同, 出错时 panic, 用于操作数固定的指令和测试
+func MustMake(op Opcode, operands ...int) []byte {
+	ins, err := Make(op, operands...)
+	if err != nil {
+		panic(err)
+	}
+	return ins
+}
+
+// Wide 返回指令在 OpWide 前缀之后的定义
+func Wide(def *Definition) *Definition {
+	widths := make([]int, len(def.OperandWidths))
+	for i, w := range def.OperandWidths {
+		widths[i] = w * 2
+	}
+	return &Definition{Name: def.Name, OperandWidths: widths}
+}
+
+func encode(op Opcode, def *Definition, operands []int) ([]byte, error) {
+	if len(operands) != len(def.OperandWidths) {
+		return nil, fmt.Errorf("%s takes %d operands, got %d", def.Name, len(def.OperandWidths), len(operands))
 	}
 	instructionLen := 1
 	for _, w := range def.OperandWidths {
@@ -127,16 +305,21 @@ func Make(op Opcode, operands ...int) []byte {
 	offset := 1
 	for i, o := range operands {
 		width := def.OperandWidths[i]
+		if o < 0 || uint64(o) >= 1<<(8*width) {
+			return nil, fmt.Errorf("operand %d of %s does not fit in %d bytes", o, def.Name, width)
+		}
 		switch width {
 		case 1:
 			instruction[offset] = byte(o)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		}
 		offset += width
 	}
 
-	return instruction
+	return instruction, nil
 }
 
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
@@ -148,6 +331,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 			operands[i] = int(ReadUint8(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		}
 		offset += width
 	}
@@ -158,6 +343,10 @@ func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint8(ins Instructions) uint8 {
 	return ins[0]
 }
@@ -172,8 +361,17 @@ func (ins Instructions) String() string {
 			continue
 		}
 
+		start, prefix := i, ""
+		if Opcode(ins[i]) == OpWide && i+1 < len(ins) {
+			// 前缀与它修饰的指令显示在同一行
+			if inner, err := Lookup(ins[i+1]); err == nil {
+				def, prefix = Wide(inner), "OpWide "
+				i++
+			}
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
-		out.WriteString(fmt.Sprintf("%04d %s\n", i, ins.fmtInstruction(def, operands)))
+		out.WriteString(fmt.Sprintf("%04d %s%s\n", start, prefix, ins.fmtInstruction(def, operands)))
 
 		i += 1 + read
 	}
@@ -185,13 +383,9 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	if len(operands) != operandCount {
 		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
 	}
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
-	case 2:
-		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
 	}
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return out
 }
@@ -19,10 +19,16 @@ func TestMake(t *testing.T) {
 		{OpSetLocal, []int{255}, []byte{byte(OpSetLocal), 255}},
 		{OpCall, []int{255}, []byte{byte(OpCall), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpBuildString, []int{65534}, []byte{byte(OpBuildString), 255, 254}},
+		{OpRAdd, []int{1, 2, 258}, []byte{byte(OpRAdd), 0, 1, 0, 2, 1, 2}},
+		{OpRClosure, []int{1, 65534, 3, 255}, []byte{byte(OpRClosure), 0, 1, 255, 254, 0, 3, 255}},
 	}
 
 	for _, tt := range tests {
-		instruction := Make(tt.op, tt.operands...)
+		instruction, err := Make(tt.op, tt.operands...)
+		if err != nil {
+			t.Fatalf("Make error: %s", err)
+		}
 
 		if len(instruction) != len(tt.expected) {
 			t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
@@ -36,25 +42,89 @@ func TestMake(t *testing.T) {
 	}
 }
 
+func TestMakeErrors(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+	}{
+		{OpConstant, []int{65536}},
+		{OpConstant, []int{-1}},
+		{OpSetLocal, []int{256}},
+		{OpClosure, []int{1, 256}},
+		{OpConstant, []int{}},
+		{OpAdd, []int{1}},
+		{Opcode(255), []int{}},
+	}
+
+	for _, tt := range tests {
+		if ins, err := Make(tt.op, tt.operands...); err == nil {
+			t.Errorf("expected error for %d %v, got %v", tt.op, tt.operands, ins)
+		}
+	}
+}
+
+func TestMakeWide(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}},
+		{OpSetLocal, []int{256}, []byte{byte(OpWide), byte(OpSetLocal), 1, 0}},
+		{OpClosure, []int{70000, 300}, []byte{byte(OpWide), byte(OpClosure), 0, 1, 17, 112, 1, 44}},
+	}
+
+	for _, tt := range tests {
+		instruction, err := MakeWide(tt.op, tt.operands...)
+		if err != nil {
+			t.Fatalf("MakeWide error: %s", err)
+		}
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("wrong instruction. want=%v, got=%v", tt.expected, instruction)
+		}
+
+		def, _ := Lookup(byte(tt.op))
+		operands, n := ReadOperands(Wide(def), instruction[2:])
+		if n != len(tt.expected)-2 {
+			t.Errorf("n wrong. want=%d, got=%d", len(tt.expected)-2, n)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operands[i])
+			}
+		}
+	}
+
+	if _, err := MakeWide(OpSetLocal, 65536); err == nil {
+		t.Errorf("expected error for operand wider than 2 bytes")
+	}
+}
+
 func TestInstructionsString(t *testing.T) {
 	instructions := []Instructions{
-		Make(OpAdd),
-		Make(OpConstant, 2),
-		Make(OpConstant, 65535),
-		Make(OpPop),
-		Make(OpSub),
-		Make(OpMul),
-		Make(OpDiv),
-		Make(OpTrue),
-		Make(OpFalse),
-		Make(OpEqual),
-		Make(OpNotEqual),
-		Make(OpGreaterThan),
-		Make(OpMinus),
-		Make(OpBang),
-		Make(OpJumpNotTruthy, 13),
-		Make(OpJump, 23),
-		Make(OpClosure, 4, 2),
+		MustMake(OpAdd),
+		MustMake(OpConstant, 2),
+		MustMake(OpConstant, 65535),
+		MustMake(OpPop),
+		MustMake(OpSub),
+		MustMake(OpMul),
+		MustMake(OpDiv),
+		MustMake(OpTrue),
+		MustMake(OpFalse),
+		MustMake(OpEqual),
+		MustMake(OpNotEqual),
+		MustMake(OpGreaterThan),
+		MustMake(OpMinus),
+		MustMake(OpBang),
+		MustMake(OpJumpNotTruthy, 13),
+		MustMake(OpJump, 23),
+		MustMake(OpClosure, 4, 2),
+		MustMake(OpGetLocal2),
+		MustMake(OpAddConstant, 7),
+		MustMake(OpJumpNotGreater, 40),
+		MustMake(OpCall1),
+		must(MakeWide(OpConstant, 70000)),
+		must(MakeWide(OpGetLocal, 300)),
 	}
 
 	expected := `0000 OpAdd
@@ -74,6 +144,12 @@ func TestInstructionsString(t *testing.T) {
 0018 OpJumpNotTruthy 13
 0021 OpJump 23
 0024 OpClosure 4 2
+0028 OpGetLocal2
+0029 OpAddConstant 7
+0032 OpJumpNotGreater 40
+0035 OpCall1
+0036 OpWide OpConstant 70000
+0042 OpWide OpGetLocal 300
 `
 
 	concatted := Instructions{}
@@ -96,10 +172,12 @@ func TestReadOperands(t *testing.T) {
 		{OpSetGlobal, []int{65535}, 2},
 		{OpSetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpRCall, []int{1, 65535, 255}, 5},
+		{OpRClosure, []int{1, 65535, 2, 255}, 7},
 	}
 
 	for _, tt := range tests {
-		instruction := Make(tt.op, tt.operands...)
+		instruction := MustMake(tt.op, tt.operands...)
 
 		def, err := Lookup(byte(tt.op))
 		if err != nil {
@@ -116,3 +194,10 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func must(ins []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return ins
+}
@@ -1,11 +1,11 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"go-example/monkey/ast"
 	"go-example/monkey/code"
 	"go-example/monkey/object"
-	"sort"
 )
 
 type EmittedInstruction struct {
@@ -17,14 +17,47 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// 寄存器指令集中下一个空闲的临时寄存器和用到的寄存器总数
+	nextRegister int
+	numRegisters int
+}
+
+// Target 是编译生成的指令集
+type Target int
+
+const (
+	// StackTarget 生成基于栈的指令, 默认使用
+	StackTarget Target = iota
+	// RegisterTarget 生成 code.OpRConstant 等寄存器指令
+	RegisterTarget
+)
+
+func (t Target) String() string {
+	if t == RegisterTarget {
+		return "register"
+	}
+	return "stack"
 }
 
+// MaxGlobals 是一个程序最多能定义的全局变量个数, 虚拟机按这个大小分配全局变量
+const MaxGlobals = 65536
+
 type Compiler struct {
 	constants   []object.Object
 	symbolTable *SymbolTable
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	target Target
+	// generic 表示不使用特化指令
+	generic bool
+
+	// err 是 emit 等无法直接返回错误的地方遇到的第一个错误, 由 Compile 返回
+	err error
+	// wideJumps 表示所有跳转指令都使用 OpWide 前缀
+	wideJumps bool
 }
 
 func New() *Compiler {
@@ -49,22 +82,59 @@ func New() *Compiler {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+
+	Target Target
+	// 寄存器指令集中主程序使用的寄存器个数
+	NumRegisters int
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Target:       c.target,
+		NumRegisters: c.scopes[0].numRegisters,
 	}
 }
 
+// SetTarget 选择生成的指令集, 需要在编译之前调用
+func (c *Compiler) SetTarget(target Target) {
+	c.target = target
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
 }
 
+// errJumpTooFar 表示跳转的目标超出了 2 字节, 需要使用 OpWide 前缀重新编译
+var errJumpTooFar = errors.New("jump target does not fit in 2 bytes")
+
+var jumps = map[code.Opcode]bool{
+	code.OpJump:           true,
+	code.OpJumpNotTruthy:  true,
+	code.OpIterNext:       true,
+	code.OpJumpNotEqual:   true,
+	code.OpJumpEqual:      true,
+	code.OpJumpNotGreater: true,
+}
+
+func (c *Compiler) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// emit 输出一条指令, 栈指令的操作数放不下时自动加上 OpWide 前缀.
+// 返回的位置是前缀的位置, lastInstruction 记录的是被修饰的指令
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
-	ins := code.Make(op, operands...)
+	ins, err := code.Make(op, operands...)
+	if c.target == StackTarget && (err != nil || c.wideJumps && jumps[op]) {
+		ins, err = code.MakeWide(op, operands...)
+	}
+	if err != nil {
+		c.fail(err)
+	}
 	pos := c.addInstruction(ins)
 
 	c.setLastInstruction(op, pos)
@@ -98,6 +168,10 @@ func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 }
 
 func (c *Compiler) removeLastPop() {
+	c.removeLastInstruction()
+}
+
+func (c *Compiler) removeLastInstruction() {
 	last := c.scopes[c.scopeIndex].lastInstruction
 	previous := c.scopes[c.scopeIndex].previousInstruction
 
@@ -107,10 +181,59 @@ func (c *Compiler) removeLastPop() {
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
+// blockValue 把块中最后一个表达式语句的值留在栈上,
+// 块为空或以 let、for 等语句结尾时值为 null
+func (c *Compiler) blockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
 func (c *Compiler) changeOperand(opPos int, operand int) {
 	op := code.Opcode(c.currentInstructions()[opPos])
-	newIns := code.Make(op, operand)
-	c.replaceInstruction(opPos, newIns)
+	if op == code.OpWide {
+		inner := code.Opcode(c.currentInstructions()[opPos+1])
+		c.replaceInstruction(opPos, c.makeInstruction(code.MakeWide(inner, operand)))
+		return
+	}
+	newIns, err := code.Make(op, operand)
+	if err != nil && jumps[op] && c.target == StackTarget {
+		err = errJumpTooFar
+	}
+	c.replaceInstruction(opPos, c.makeInstruction(newIns, err))
+}
+
+// makeInstruction 记录 code.Make 的错误, 出错时返回 nil
+func (c *Compiler) makeInstruction(ins []byte, err error) []byte {
+	if err != nil {
+		c.fail(err)
+		return nil
+	}
+	return ins
+}
+
+type compilerState struct {
+	symbolTable  SymbolTable
+	numConstants int
+	scope        CompilationScope
+}
+
+func (c *Compiler) save() compilerState {
+	return compilerState{
+		symbolTable:  *c.symbolTable.Clone(),
+		numConstants: len(c.constants),
+		scope:        c.scopes[c.scopeIndex],
+	}
+}
+
+// restore 回到 save 时的状态. 符号表在原处恢复, 因为调用者可能持有它的指针
+func (c *Compiler) restore(state compilerState) {
+	*c.symbolTable = state.symbolTable
+	c.constants = c.constants[:state.numConstants]
+	c.scopes[c.scopeIndex] = state.scope
+	c.err = nil
 }
 
 func (c *Compiler) replaceInstruction(pos int, newIns []byte) {
@@ -122,7 +245,7 @@ func (c *Compiler) replaceInstruction(pos int, newIns []byte) {
 
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
-	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.replaceInstruction(lastPos, code.MustMake(code.OpReturnValue))
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
@@ -145,12 +268,21 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return ins
 }
 
+// define 定义 let 或 for 引入的变量, 全局变量超过 MaxGlobals 个时报错
+func (c *Compiler) define(name string) (Symbol, error) {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == GlobalScope && symbol.Index >= MaxGlobals {
+		return symbol, fmt.Errorf("too many global variables: %s would be global #%d, the limit is %d", name, symbol.Index+1, MaxGlobals)
+	}
+	return symbol, nil
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
 	case LocalScope:
-		c.emit(code.OpGetLocal, s.Index)
+		c.emitGetLocal(s.Index)
 	case BuiltinScope:
 		c.emit(code.OpGetBuiltin, s.Index)
 	case FreeScope:
@@ -163,12 +295,22 @@ func (c *Compiler) loadSymbol(s Symbol) {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
-		for _, stmt := range node.Statements {
-			err := c.Compile(stmt)
-			if err != nil {
-				return err
-			}
+		// 先一次性报告所有无法解析的标识符, 失败时符号表保持不变
+		if err := Resolve(node, c.symbolTable); err != nil {
+			return err
+		}
+		if c.target == RegisterTarget {
+			return c.compileRegisters(node)
 		}
+		// 有跳转超过 64KiB 时, 回到编译之前的状态, 所有跳转都加上 OpWide 前缀重新编译
+		state := c.save()
+		err := c.compileStatements(node.Statements)
+		if errors.Is(err, errJumpTooFar) && !c.wideJumps {
+			c.restore(state)
+			c.wideJumps = true
+			err = c.compileStatements(node.Statements)
+		}
+		return err
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -176,8 +318,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		symbol, err := c.define(node.Name.Value)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
@@ -203,6 +348,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		if (node.Operator == "+" || node.Operator == "-") && c.constantOperation(node) {
+			return nil
+		}
 		err = c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -244,14 +392,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		jumpTruthyPos := c.emit(code.OpJumpNotTruthy, 0)
+		jumpTruthyPos := c.emit(c.conditionJump(node.Condition), 0)
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
+		c.blockValue()
 
 		jumpPos := c.emit(code.OpJump, 0)
 		afterConPos := len(c.currentInstructions())
@@ -264,9 +410,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
-		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
+			c.blockValue()
 		}
 
 		afterAltPos := len(c.currentInstructions())
@@ -287,14 +431,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		var keys []ast.Expression
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-		for _, key := range keys {
+		// 按源码中的顺序求值和插入
+		for _, key := range node.Keys {
 			err := c.Compile(key)
 			if err != nil {
 				return err
@@ -337,6 +475,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  ins,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Generator:     node.Generator,
 		}
 		fnIdx := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIdx, len(freeSymbols))
@@ -346,6 +485,41 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpReturnValue)
+	case *ast.YieldStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpYield)
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		// 循环期间迭代器留在栈顶, 迭代结束时由 OpIterNext 弹出并跳出循环
+		c.emit(code.OpIter)
+		loopPos := c.emit(code.OpIterNext, 0)
+
+		symbol, err := c.define(node.Variable.Value)
+		if err != nil {
+			return err
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loopPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(loopPos, afterLoopPos)
+		// 循环的值是 null. 弹出的迭代器不能成为最后弹出的值
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
@@ -357,7 +531,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		c.emitCall(len(node.Arguments))
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -380,6 +554,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpBuildString, len(node.Parts))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -388,6 +570,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 	}
 
+	return c.err
+}
+
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	for _, stmt := range stmts {
+		err := c.Compile(stmt)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
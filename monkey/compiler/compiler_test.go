@@ -6,6 +6,7 @@ import (
 	"go-example/monkey/lexer"
 	"go-example/monkey/object"
 	"go-example/monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -21,162 +22,192 @@ func TestObjectArithmetic(t *testing.T) {
 			input:             "1 + 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 - 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSub),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 * 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpMul),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 / 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpDiv),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpDiv),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1; 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "true",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "false",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpFalse),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 > 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpGreaterThan),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 < 2",
 			expectedConstants: []any{2, 1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpGreaterThan),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 == 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "1 != 2",
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpNotEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpNotEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "true == false",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpFalse),
-				code.Make(code.OpEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "true != false",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpFalse),
-				code.Make(code.OpNotEqual),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpNotEqual),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "-1",
 			expectedConstants: []any{1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpMinus),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpMinus),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "!true",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpTrue),
-				code.Make(code.OpBang),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpBang),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             `"monkey"`,
 			expectedConstants: []any{"monkey"},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             `"mon" + "key"`,
 			expectedConstants: []any{"mon", "key"},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"${1}"`,
+			expectedConstants: []any{1},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpBuildString, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `"a ${1 + 2} b ${true}"`,
+			expectedConstants: []any{"a ", 1, 2, " b "},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpBuildString, 4),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -190,74 +221,74 @@ func TestComposite(t *testing.T) {
 			input:             "[]",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpArray, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "[1, 2, 3]",
 			expectedConstants: []any{1, 2, 3},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "[1 + 2, 3 - 4, 5 * 6]",
 			expectedConstants: []any{1, 2, 3, 4, 5, 6},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{}",
 			expectedConstants: []any{},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpHash, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpHash, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2, 3: 4, 5: 6}",
 			expectedConstants: []any{1, 2, 3, 4, 5, 6},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpHash, 6),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpHash, 6),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2 + 3, 4: 5 * 6}",
 			expectedConstants: []any{1, 2, 3, 4, 5, 6},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpAdd),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
-				code.Make(code.OpMul),
-				code.Make(code.OpHash, 4),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpMul),
+				code.MustMake(code.OpHash, 4),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -271,29 +302,29 @@ func TestIndexExpr(t *testing.T) {
 			input:             "[1, 2, 3][1 + 1]",
 			expectedConstants: []any{1, 2, 3, 1, 1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpAdd),
-				code.Make(code.OpIndex),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpArray, 3),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
 			expectedConstants: []any{1, 2, 2, 1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpSub),
-				code.Make(code.OpIndex),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpHash, 2),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpSub),
+				code.MustMake(code.OpIndex),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -308,21 +339,21 @@ func TestConditionals(t *testing.T) {
 			expectedConstants: []any{10, 333},
 			expectedIns: []code.Instructions{
 				// 0000
-				code.Make(code.OpTrue),
+				code.MustMake(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpNotTruthy, 10),
+				code.MustMake(code.OpJumpNotTruthy, 10),
 				// 0004
-				code.Make(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 0),
 				// 0007
-				code.Make(code.OpJump, 11),
+				code.MustMake(code.OpJump, 11),
 				// 0010
-				code.Make(code.OpNull),
+				code.MustMake(code.OpNull),
 				// 0011
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 				// 0012
-				code.Make(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 1),
 				// 0015
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -330,21 +361,95 @@ func TestConditionals(t *testing.T) {
 			expectedConstants: []any{10, 20, 333},
 			expectedIns: []code.Instructions{
 				// 0000
-				code.Make(code.OpTrue),
+				code.MustMake(code.OpTrue),
 				// 0001
-				code.Make(code.OpJumpNotTruthy, 10),
+				code.MustMake(code.OpJumpNotTruthy, 10),
 				// 0004
-				code.Make(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 0),
 				// 0007
-				code.Make(code.OpJump, 13),
+				code.MustMake(code.OpJump, 13),
 				// 0010
-				code.Make(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 1),
 				// 0013
-				code.Make(code.OpPop),
+				code.MustMake(code.OpPop),
+				// 0014
+				code.MustMake(code.OpConstant, 2),
+				// 0017
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `if (true) { let x = 1; }`,
+			expectedConstants: []any{1},
+			expectedIns: []code.Instructions{
+				// 0000
+				code.MustMake(code.OpTrue),
+				// 0001
+				code.MustMake(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.MustMake(code.OpConstant, 0),
+				// 0007
+				code.MustMake(code.OpSetGlobal, 0),
+				// 0010
+				code.MustMake(code.OpNull),
+				// 0011
+				code.MustMake(code.OpJump, 15),
 				// 0014
-				code.Make(code.OpConstant, 2),
+				code.MustMake(code.OpNull),
+				// 0015
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `for (x in [1]) { x }`,
+			expectedConstants: []any{1},
+			expectedIns: []code.Instructions{
+				// 0000
+				code.MustMake(code.OpConstant, 0),
+				// 0003
+				code.MustMake(code.OpArray, 1),
+				// 0006
+				code.MustMake(code.OpIter),
+				// 0007
+				code.MustMake(code.OpIterNext, 20),
+				// 0010
+				code.MustMake(code.OpSetGlobal, 0),
+				// 0013
+				code.MustMake(code.OpGetGlobal, 0),
+				// 0016
+				code.MustMake(code.OpPop),
 				// 0017
-				code.Make(code.OpPop),
+				code.MustMake(code.OpJump, 7),
+				// 0020
+				code.MustMake(code.OpNull),
+				// 0021
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn(xs) { for (x in xs) { yield x; } }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpIter),
+					code.MustMake(code.OpIterNext, 14),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpYield),
+					code.MustMake(code.OpJump, 3),
+					code.MustMake(code.OpNull),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -360,10 +465,10 @@ func TestSymbolStatement(t *testing.T) {
 					`,
 			expectedConstants: []any{1, 2},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpSetGlobal, 1),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpSetGlobal, 1),
 			},
 		},
 		{
@@ -373,10 +478,10 @@ func TestSymbolStatement(t *testing.T) {
 					`,
 			expectedConstants: []any{1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -387,12 +492,12 @@ func TestSymbolStatement(t *testing.T) {
 					`,
 			expectedConstants: []any{1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpSetGlobal, 1),
-				code.Make(code.OpGetGlobal, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpSetGlobal, 1),
+				code.MustMake(code.OpGetGlobal, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -466,15 +571,15 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{5, 10,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 2, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -483,15 +588,15 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{5, 10,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 2, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -500,15 +605,15 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{1, 2,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpPop),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 2, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -517,12 +622,12 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{
 				[]code.Instructions{
-					code.Make(code.OpReturn),
+					code.MustMake(code.OpReturn),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 0, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -532,15 +637,15 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{55,
 				[]code.Instructions{
-					code.Make(code.OpGetGlobal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetGlobal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -552,15 +657,15 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{55,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -573,19 +678,19 @@ func TestFunction(t *testing.T) {
 					`,
 			expectedConstants: []any{55, 77,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpSetLocal, 1),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpGetLocal, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpSetLocal, 1),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 2, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -601,14 +706,14 @@ func TestFunctionCall(t *testing.T) {
 					`,
 			expectedConstants: []any{24,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpCall, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpCall, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -618,16 +723,16 @@ func TestFunctionCall(t *testing.T) {
 					`,
 			expectedConstants: []any{24,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpCall, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -637,18 +742,18 @@ func TestFunctionCall(t *testing.T) {
 					`,
 			expectedConstants: []any{
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpReturnValue),
 				},
 				24,
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 0, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpCall, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpCall, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -658,24 +763,24 @@ func TestFunctionCall(t *testing.T) {
 					`,
 			expectedConstants: []any{
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpPop),
-					code.Make(code.OpGetLocal, 1),
-					code.Make(code.OpPop),
-					code.Make(code.OpGetLocal, 2),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 1),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 2),
+					code.MustMake(code.OpReturnValue),
 				},
 				24, 25, 26,
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 1),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpCall, 3),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpCall, 3),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -692,30 +797,30 @@ func TestBuiltins(t *testing.T) {
 					`,
 			expectedConstants: []any{1},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpGetBuiltin, 0),
-				code.Make(code.OpArray, 0),
-				code.Make(code.OpCall, 1),
-				code.Make(code.OpPop),
-				code.Make(code.OpGetBuiltin, 1),
-				code.Make(code.OpArray, 0),
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpCall, 2),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpGetBuiltin, 0),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpCall, 1),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpGetBuiltin, 1),
+				code.MustMake(code.OpArray, 0),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpCall, 2),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
 			input: `fn() { len([]) }`,
 			expectedConstants: []any{
 				[]code.Instructions{
-					code.Make(code.OpGetBuiltin, 0),
-					code.Make(code.OpArray, 0),
-					code.Make(code.OpCall, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetBuiltin, 0),
+					code.MustMake(code.OpArray, 0),
+					code.MustMake(code.OpCall, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 0, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -735,20 +840,20 @@ func TestClosures(t *testing.T) {
 			`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 0, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 0, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -763,28 +868,28 @@ func TestClosures(t *testing.T) {
 			`,
 			expectedConstants: []interface{}{
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetFree, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetFree, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 0, 2),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 0, 2),
+					code.MustMake(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 1, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 1, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 2, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -807,38 +912,38 @@ func TestClosures(t *testing.T) {
 				77,
 				88,
 				[]code.Instructions{
-					code.Make(code.OpConstant, 3),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetGlobal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpAdd),
-					code.Make(code.OpGetFree, 1),
-					code.Make(code.OpAdd),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpAdd),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 3),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetGlobal, 0),
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpGetFree, 1),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpAdd),
+					code.MustMake(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpConstant, 2),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 4, 2),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 2),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetFree, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 4, 2),
+					code.MustMake(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpConstant, 1),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpClosure, 5, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpConstant, 1),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpClosure, 5, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpConstant, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpClosure, 6, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpClosure, 6, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -856,22 +961,22 @@ func TestRecursiveFunctions(t *testing.T) {
 			expectedConstants: []interface{}{
 				1,
 				[]code.Instructions{
-					code.Make(code.OpCurrentClosure),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpCurrentClosure),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSub),
+					code.MustMake(code.OpCall, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 				1,
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpCall, 1),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpCall, 1),
+				code.MustMake(code.OpPop),
 			},
 		},
 		{
@@ -885,29 +990,29 @@ func TestRecursiveFunctions(t *testing.T) {
 			expectedConstants: []interface{}{
 				1,
 				[]code.Instructions{
-					code.Make(code.OpCurrentClosure),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpCurrentClosure),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpSub),
+					code.MustMake(code.OpCall, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 				1,
 				[]code.Instructions{
-					code.Make(code.OpClosure, 1, 0),
-					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
-					code.Make(code.OpReturnValue),
+					code.MustMake(code.OpClosure, 1, 0),
+					code.MustMake(code.OpSetLocal, 0),
+					code.MustMake(code.OpGetLocal, 0),
+					code.MustMake(code.OpConstant, 2),
+					code.MustMake(code.OpCall, 1),
+					code.MustMake(code.OpReturnValue),
 				},
 			},
 			expectedIns: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall, 0),
-				code.Make(code.OpPop),
+				code.MustMake(code.OpClosure, 3, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpCall, 0),
+				code.MustMake(code.OpPop),
 			},
 		},
 	}
@@ -915,6 +1020,75 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestWideOperands(t *testing.T) {
+	// 300 个局部变量, 第 257 个开始需要 OpWide 前缀
+	var body strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&body, "let %s = true; ", localName(i))
+	}
+	body.WriteString(localName(299))
+	bytecode := compileInput(t, StackTarget, "fn() { "+body.String()+" }")
+	fn := bytecode.Constants[0].(*object.CompiledFunction)
+	if fn.NumLocals != 300 {
+		t.Fatalf("wrong NumLocals. want=300, got=%d", fn.NumLocals)
+	}
+	for _, want := range [][]byte{
+		code.MustMake(code.OpSetLocal, 255),
+		must(code.MakeWide(code.OpSetLocal, 256)),
+		must(code.MakeWide(code.OpGetLocal, 299)),
+	} {
+		if !strings.Contains(string(fn.Instructions), string(want)) {
+			t.Errorf("instructions do not contain %q", code.Instructions(want))
+		}
+	}
+
+	// 65537 个常量, 并且 if 的两个分支都超过 64KiB
+	input := "if (true) { " + strings.Repeat("1; ", 65537) + "} else { 2 }"
+	bytecode = compileInput(t, StackTarget, input)
+	ins := bytecode.Instructions
+	if len(ins) <= 65535 {
+		t.Fatalf("program too short to need wide jumps: %d", len(ins))
+	}
+	jump := must(code.MakeWide(code.OpJumpNotTruthy, 0))
+	if string(ins[1:1+len(jump)-4]) != string(jump[:len(jump)-4]) {
+		t.Errorf("expected wide OpJumpNotTruthy, got %q", ins[1:1+len(jump)])
+	}
+	if !strings.Contains(string(ins), string(must(code.MakeWide(code.OpConstant, 65536)))) {
+		t.Errorf("instructions do not contain wide OpConstant 65536")
+	}
+
+	// 寄存器指令没有 OpWide 前缀, 超出范围时报错而不是截断
+	program := parser.New(lexer.New(input)).ParseProgram()
+	c := New()
+	c.SetTarget(RegisterTarget)
+	if err := c.Compile(program); err == nil {
+		t.Errorf("expected register compiler to fail")
+	}
+}
+
+// localName 返回第 i 个只由字母组成的变量名
+func localName(i int) string {
+	return "v" + string(rune('a'+i/26)) + string(rune('a'+i%26))
+}
+
+func compileInput(t *testing.T, target Target, input string) *Bytecode {
+	t.Helper()
+	program := parser.New(lexer.New(input)).ParseProgram()
+	c := New()
+	c.SetTarget(target)
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+func must(ins []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return ins
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 	for _, tt := range tests {
@@ -922,7 +1096,9 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 		p := parser.New(l)
 		prog := p.ParseProgram()
 
+		// 特化指令由 TestSuperinstructions 单独测试
 		compiler := New()
+		compiler.SetSuperinstructions(false)
 		err := compiler.Compile(prog)
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
@@ -0,0 +1,351 @@
+package compiler
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+)
+
+// compileRegisters 为 RegisterTarget 编译整个程序, 标识符已经由 Resolve 解析.
+// 参数和局部变量使用 SymbolTable 分配的下标作为寄存器, 临时寄存器从 FunctionLiteral.NumLocals 开始,
+// 按栈的方式分配和释放: 每个语句和表达式结束时释放它申请的临时寄存器.
+func (c *Compiler) compileRegisters(program *ast.Program) error {
+	for _, stmt := range program.Statements {
+		if err := c.registerStatement(stmt); err != nil {
+			return err
+		}
+	}
+	return c.err
+}
+
+func (c *Compiler) allocRegisters(n int) int {
+	scope := &c.scopes[c.scopeIndex]
+	r := scope.nextRegister
+	scope.nextRegister += n
+	if scope.nextRegister > scope.numRegisters {
+		scope.numRegisters = scope.nextRegister
+	}
+	return r
+}
+
+func (c *Compiler) freeRegisters(mark int) {
+	c.scopes[c.scopeIndex].nextRegister = mark
+}
+
+func (c *Compiler) registerStatement(stmt ast.Statement) error {
+	mark := c.scopes[c.scopeIndex].nextRegister
+	defer c.freeRegisters(mark)
+
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		r, err := c.registerOperand(stmt.Expression)
+		if err != nil {
+			return err
+		}
+		if c.scopeIndex == 0 {
+			c.emit(code.OpRResult, r)
+		}
+	case *ast.LetStatement:
+		symbol, err := c.define(stmt.Name.Value)
+		if err != nil {
+			return err
+		}
+		if symbol.Scope != GlobalScope {
+			return c.registerExpression(stmt.Value, symbol.Index)
+		}
+		r, err := c.registerOperand(stmt.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRSetGlobal, symbol.Index, r)
+	case *ast.ReturnStatement:
+		r, err := c.registerOperand(stmt.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRReturnValue, r)
+	case *ast.YieldStatement:
+		r, err := c.registerOperand(stmt.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRYield, r)
+	case *ast.ForStatement:
+		// 循环期间迭代器一直占用一个临时寄存器
+		it := c.allocRegisters(1)
+		if err := c.registerExpression(stmt.Iterable, it); err != nil {
+			return err
+		}
+		c.emit(code.OpRIter, it, it)
+
+		symbol, err := c.define(stmt.Variable.Value)
+		if err != nil {
+			return err
+		}
+		value := symbol.Index
+		if symbol.Scope == GlobalScope {
+			value = c.allocRegisters(1)
+		}
+		loopPos := c.emit(code.OpRIterNext, it, value, 0)
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpRSetGlobal, symbol.Index, value)
+		}
+		for _, s := range stmt.Body.Statements {
+			if err := c.registerStatement(s); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpJump, loopPos)
+		c.replaceInstruction(loopPos, c.makeInstruction(code.Make(code.OpRIterNext, it, value, len(c.currentInstructions()))))
+		// 与求值器相同, 循环的值是 null, 不能留下循环体中最后一个表达式的值
+		if c.scopeIndex == 0 {
+			c.emit(code.OpRNull, it)
+			c.emit(code.OpRResult, it)
+		}
+	}
+	return nil
+}
+
+// registerOperand 返回保存表达式值的寄存器. 局部变量直接使用它所在的寄存器,
+// 其他表达式求值到新申请的临时寄存器中, 由调用者负责释放
+func (c *Compiler) registerOperand(exp ast.Expression) (int, error) {
+	if ident, ok := exp.(*ast.Identifier); ok {
+		if symbol, ok := c.symbolTable.Resolve(ident.Value); ok && symbol.Scope == LocalScope {
+			return symbol.Index, nil
+		}
+	}
+	r := c.allocRegisters(1)
+	return r, c.registerExpression(exp, r)
+}
+
+// registerBlock 把块的值写入 dst, 与 blockValue 相同, 不以表达式结尾的块的值为 null
+func (c *Compiler) registerBlock(block *ast.BlockStatement, dst int) error {
+	stmts := block.Statements
+	if n := len(stmts); n > 0 {
+		if last, ok := stmts[n-1].(*ast.ExpressionStatement); ok {
+			for _, s := range stmts[:n-1] {
+				if err := c.registerStatement(s); err != nil {
+					return err
+				}
+			}
+			return c.registerExpression(last.Expression, dst)
+		}
+	}
+	for _, s := range stmts {
+		if err := c.registerStatement(s); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpRNull, dst)
+	return nil
+}
+
+func (c *Compiler) loadRegister(s Symbol, dst int) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpRGetGlobal, dst, s.Index)
+	case LocalScope:
+		if s.Index != dst {
+			c.emit(code.OpRMove, dst, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpRGetBuiltin, dst, s.Index)
+	case FreeScope:
+		c.emit(code.OpRGetFree, dst, s.Index)
+	case FunctionScope:
+		c.emit(code.OpRCurrentClosure, dst)
+	}
+}
+
+var registerOperators = map[string]code.Opcode{
+	"+":  code.OpRAdd,
+	"-":  code.OpRSub,
+	"*":  code.OpRMul,
+	"/":  code.OpRDiv,
+	">":  code.OpRGreaterThan,
+	"<":  code.OpRGreaterThan,
+	"==": code.OpREqual,
+	"!=": code.OpRNotEqual,
+}
+
+// registerExpression 把表达式的值写入寄存器 dst
+func (c *Compiler) registerExpression(exp ast.Expression, dst int) error {
+	mark := c.scopes[c.scopeIndex].nextRegister
+	defer c.freeRegisters(mark)
+
+	switch node := exp.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(code.OpRConstant, dst, c.addConstant(&object.Integer{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpRConstant, dst, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpRTrue, dst)
+		} else {
+			c.emit(code.OpRFalse, dst)
+		}
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		c.loadRegister(symbol, dst)
+	case *ast.PrefixExpression:
+		r, err := c.registerOperand(node.Right)
+		if err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emit(code.OpRMinus, dst, r)
+		case "!":
+			c.emit(code.OpRBang, dst, r)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		op, ok := registerOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		// 与栈指令相同, a < b 编译为 b > a
+		left, right := node.Left, node.Right
+		if node.Operator == "<" {
+			left, right = right, left
+		}
+		l, err := c.registerOperand(left)
+		if err != nil {
+			return err
+		}
+		r, err := c.registerOperand(right)
+		if err != nil {
+			return err
+		}
+		c.emit(op, dst, l, r)
+	case *ast.IfExpression:
+		cond, err := c.registerOperand(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpRJumpNotTruthy, cond, 0)
+		if err := c.registerBlock(node.Consequence, dst); err != nil {
+			return err
+		}
+		jumpPos := c.emit(code.OpJump, 0)
+		c.replaceInstruction(jumpNotTruthyPos, c.makeInstruction(code.Make(code.OpRJumpNotTruthy, cond, len(c.currentInstructions()))))
+
+		if node.Alternative == nil {
+			c.emit(code.OpRNull, dst)
+		} else if err := c.registerBlock(node.Alternative, dst); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	case *ast.ArrayLiteral:
+		base, err := c.registerList(node.Elements)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRArray, dst, base, len(node.Elements))
+	case *ast.HashLiteral:
+		// 按源码中的顺序求值和插入
+		var elems []ast.Expression
+		for _, key := range node.Keys {
+			elems = append(elems, key, node.Pairs[key])
+		}
+		base, err := c.registerList(elems)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRHash, dst, base, len(elems))
+	case *ast.TemplateLiteral:
+		base, err := c.registerList(node.Parts)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRBuildString, dst, base, len(node.Parts))
+	case *ast.IndexExpression:
+		l, err := c.registerOperand(node.Left)
+		if err != nil {
+			return err
+		}
+		i, err := c.registerOperand(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRIndex, dst, l, i)
+	case *ast.CallExpression:
+		base, err := c.registerList(append([]ast.Expression{node.Function}, node.Arguments...))
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRCall, dst, base, len(node.Arguments))
+	case *ast.FunctionLiteral:
+		return c.registerFunction(node, dst)
+	}
+	return nil
+}
+
+// registerList 把表达式依次求值到连续的临时寄存器中, 返回第一个寄存器
+func (c *Compiler) registerList(exps []ast.Expression) (int, error) {
+	base := c.allocRegisters(len(exps))
+	for i, exp := range exps {
+		if err := c.registerExpression(exp, base+i); err != nil {
+			return 0, err
+		}
+	}
+	return base, nil
+}
+
+func (c *Compiler) registerFunction(node *ast.FunctionLiteral, dst int) error {
+	c.enterScope()
+	c.scopes[c.scopeIndex].nextRegister = node.NumLocals
+	c.scopes[c.scopeIndex].numRegisters = node.NumLocals
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+	for _, param := range node.Parameters {
+		c.symbolTable.Define(param.Value)
+	}
+
+	stmts := node.Body.Statements
+	var last *ast.ExpressionStatement
+	if n := len(stmts); n > 0 {
+		if stmt, ok := stmts[n-1].(*ast.ExpressionStatement); ok {
+			last = stmt
+			stmts = stmts[:n-1]
+		}
+	}
+	for _, s := range stmts {
+		if err := c.registerStatement(s); err != nil {
+			return err
+		}
+	}
+	if last != nil {
+		r, err := c.registerOperand(last.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpRReturnValue, r)
+	}
+	if !c.lastInstructionIs(code.OpRReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numRegisters := c.scopes[c.scopeIndex].numRegisters
+	ins := c.leaveScope()
+
+	base := c.allocRegisters(len(freeSymbols))
+	for i, s := range freeSymbols {
+		c.loadRegister(s, base+i)
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions:  ins,
+		NumLocals:     numRegisters,
+		NumParameters: len(node.Parameters),
+		Generator:     node.Generator,
+	}
+	c.emit(code.OpRClosure, dst, c.addConstant(compiledFn), base, len(freeSymbols))
+	return nil
+}
@@ -0,0 +1,87 @@
+package compiler
+
+import (
+	"go-example/monkey/code"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestRegisterInstructions(t *testing.T) {
+	tests := []struct {
+		compilerTestCase
+		numRegisters int
+	}{
+		{
+			compilerTestCase{
+				input:             `1 + 2`,
+				expectedConstants: []any{1, 2},
+				expectedIns: []code.Instructions{
+					code.MustMake(code.OpRConstant, 1, 0),
+					code.MustMake(code.OpRConstant, 2, 1),
+					code.MustMake(code.OpRAdd, 0, 1, 2),
+					code.MustMake(code.OpRResult, 0),
+				},
+			},
+			3,
+		},
+		{
+			compilerTestCase{
+				input:             `1 < 2`,
+				expectedConstants: []any{2, 1},
+				expectedIns: []code.Instructions{
+					code.MustMake(code.OpRConstant, 1, 0),
+					code.MustMake(code.OpRConstant, 2, 1),
+					code.MustMake(code.OpRGreaterThan, 0, 1, 2),
+					code.MustMake(code.OpRResult, 0),
+				},
+			},
+			3,
+		},
+		{
+			// 参数 a 直接使用寄存器 0, 不需要 OpRMove
+			compilerTestCase{
+				input: `let f = fn(a) { a + 1 }; f(2)`,
+				expectedConstants: []any{
+					1,
+					[]code.Instructions{
+						code.MustMake(code.OpRConstant, 2, 0),
+						code.MustMake(code.OpRAdd, 1, 0, 2),
+						code.MustMake(code.OpRReturnValue, 1),
+					},
+					2,
+				},
+				expectedIns: []code.Instructions{
+					code.MustMake(code.OpRClosure, 0, 1, 1, 0),
+					code.MustMake(code.OpRSetGlobal, 0, 0),
+					code.MustMake(code.OpRGetGlobal, 1, 0),
+					code.MustMake(code.OpRConstant, 2, 2),
+					code.MustMake(code.OpRCall, 0, 1, 1),
+					code.MustMake(code.OpRResult, 0),
+				},
+			},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		prog := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		compiler := New()
+		compiler.SetTarget(RegisterTarget)
+		if err := compiler.Compile(prog); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		if err := testInstructions(tt.expectedIns, bytecode.Instructions); err != nil {
+			t.Fatalf("%q: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(t, tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%q: testConstants failed: %s", tt.input, err)
+		}
+		if bytecode.Target != RegisterTarget || bytecode.NumRegisters != tt.numRegisters {
+			t.Errorf("%q: wrong bytecode target %s with %d registers", tt.input, bytecode.Target, bytecode.NumRegisters)
+		}
+	}
+}
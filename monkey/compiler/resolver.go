@@ -0,0 +1,163 @@
+package compiler
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/token"
+	"sort"
+	"strings"
+)
+
+type ResolveError struct {
+	Token token.Token
+	Name  string
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%d:%d: identifier not found: %s", e.Token.Line, e.Token.Column, e.Name)
+}
+
+// ResolveErrors 是一次解析中发现的所有错误, 按位置排序
+type ResolveErrors []*ResolveError
+
+func (errs ResolveErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Resolve 在编译或求值之前解析程序中所有的标识符, 把结果写入 ast.Identifier.Slot,
+// 并为函数字面量记录局部变量个数和捕获的自由变量, 规则与编译器使用的 SymbolTable 完全一致.
+// 解析在 table 的副本上进行, 无论成功与否 table 都不会被修改.
+func Resolve(program *ast.Program, table *SymbolTable) error {
+	r := &resolver{table: table.Clone()}
+	r.statements(program.Statements)
+	if len(r.errors) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		ti, tj := r.errors[i].Token, r.errors[j].Token
+		if ti.Line != tj.Line {
+			return ti.Line < tj.Line
+		}
+		return ti.Column < tj.Column
+	})
+	return r.errors
+}
+
+type resolver struct {
+	table  *SymbolTable
+	errors ResolveErrors
+}
+
+func slot(symbol Symbol) *ast.Slot {
+	return &ast.Slot{Scope: string(symbol.Scope), Index: symbol.Index}
+}
+
+func (r *resolver) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.resolve(stmt)
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		// 与编译器一致, 名字在右侧表达式之前定义
+		node.Name.Slot = slot(r.table.Define(node.Name.Value))
+		r.resolve(node.Value)
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+	case *ast.YieldStatement:
+		r.resolve(node.Value)
+	case *ast.ForStatement:
+		// 与编译器一致, 循环变量在可迭代对象之后定义
+		r.resolve(node.Iterable)
+		node.Variable.Slot = slot(r.table.Define(node.Variable.Value))
+		r.resolve(node.Body)
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.BlockStatement:
+		if node != nil {
+			r.statements(node.Statements)
+		}
+	case *ast.Identifier:
+		symbol, ok := r.table.Resolve(node.Value)
+		if !ok {
+			node.Slot = nil
+			r.errors = append(r.errors, &ResolveError{Token: node.Token, Name: node.Value})
+			return
+		}
+		node.Slot = slot(symbol)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		r.resolve(node.Alternative)
+	case *ast.FunctionLiteral:
+		r.function(node)
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" && len(node.Arguments) == 1 {
+			r.quote(node.Arguments[0])
+			return
+		}
+		r.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.ArrayLiteral:
+		for _, elem := range node.Elements {
+			r.resolve(elem)
+		}
+	case *ast.HashLiteral:
+		// 与编译器相同的顺序, 保证自由变量的下标一致
+		for _, k := range node.Keys {
+			r.resolve(k)
+			r.resolve(node.Pairs[k])
+		}
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			r.resolve(part)
+		}
+	}
+	// 宏字面量在展开阶段按名字求值, 不做解析
+}
+
+func (r *resolver) function(fl *ast.FunctionLiteral) {
+	r.table = NewEnclosedSymbolTable(r.table)
+	if fl.Name != "" {
+		r.table.DefineFunctionName(fl.Name)
+	}
+	for _, param := range fl.Parameters {
+		param.Slot = slot(r.table.Define(param.Value))
+	}
+	r.resolve(fl.Body)
+
+	fl.NumLocals = r.table.numDefinitions
+	fl.Free = fl.Free[:0]
+	for _, s := range r.table.FreeSymbols {
+		fl.Free = append(fl.Free, *slot(s))
+	}
+	r.table = r.table.Outer
+}
+
+// quote 的参数是数据, 只有其中 unquote 的参数会在当前作用域中求值
+func (r *resolver) quote(node ast.Node) {
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if ok && call.Function.TokenLiteral() == "unquote" && len(call.Arguments) == 1 {
+			r.resolve(call.Arguments[0])
+		}
+		return node
+	})
+}
@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"errors"
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestResolveErrors(t *testing.T) {
+	input := `let a = b;
+let f = fn(x) { if (x) { c } else { x + a } };
+d(len("ok"));`
+
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	err := Resolve(parser.New(lexer.New(input)).ParseProgram(), global)
+
+	var errs ResolveErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ResolveErrors, got %T (%v)", err, err)
+	}
+	expected := []string{
+		"1:9: identifier not found: b",
+		"2:26: identifier not found: c",
+		"3:1: identifier not found: d",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%v)", len(expected), len(errs), err)
+	}
+	for i, want := range expected {
+		if got := errs[i].Error(); got != want {
+			t.Errorf("wrong error. want=%q, got=%q", want, got)
+		}
+	}
+
+	// 解析失败不会修改调用方的符号表
+	if _, ok := global.Resolve("a"); ok {
+		t.Errorf("symbol table was modified by a failed resolve")
+	}
+}
+
+func TestResolveSlots(t *testing.T) {
+	input := `let g = 1;
+let outer = fn(a) {
+	let b = 2;
+	fn(c) { outer; a + b + c + g; len }
+};`
+
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if err := Resolve(program, global); err != nil {
+		t.Fatalf("resolve error: %s", err)
+	}
+
+	slots := make(map[string]ast.Slot)
+	var literals []*ast.FunctionLiteral
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if node.Slot == nil {
+				t.Errorf("identifier %s was not resolved", node.Value)
+			} else {
+				slots[node.Value] = *node.Slot
+			}
+		case *ast.FunctionLiteral:
+			literals = append(literals, node)
+		}
+		return node
+	})
+
+	expected := map[string]ast.Slot{
+		"g":     {Scope: string(GlobalScope), Index: 0},
+		"outer": {Scope: string(FreeScope), Index: 0},
+		"a":     {Scope: string(FreeScope), Index: 1},
+		"b":     {Scope: string(FreeScope), Index: 2},
+		"c":     {Scope: string(LocalScope), Index: 0},
+		"len":   {Scope: string(BuiltinScope), Index: 0},
+	}
+	for name, want := range expected {
+		if got := slots[name]; got != want {
+			t.Errorf("wrong slot for %s. want=%+v, got=%+v", name, want, got)
+		}
+	}
+
+	if len(literals) != 2 {
+		t.Fatalf("wrong number of function literals. got=%d", len(literals))
+	}
+	inner, outer := literals[0], literals[1]
+	if outer.NumLocals != 2 || len(outer.Free) != 0 {
+		t.Errorf("wrong outer function. NumLocals=%d, Free=%v", outer.NumLocals, outer.Free)
+	}
+	// 与 defineFree 一致, 内层函数引用外层函数自身时也作为自由变量捕获
+	wantFree := []ast.Slot{
+		{Scope: string(FunctionScope), Index: 0},
+		{Scope: string(LocalScope), Index: 0},
+		{Scope: string(LocalScope), Index: 1},
+	}
+	if inner.NumLocals != 1 || len(inner.Free) != len(wantFree) {
+		t.Fatalf("wrong inner function. NumLocals=%d, Free=%v", inner.NumLocals, inner.Free)
+	}
+	for i, want := range wantFree {
+		if inner.Free[i] != want {
+			t.Errorf("wrong free slot %d. want=%+v, got=%+v", i, want, inner.Free[i])
+		}
+	}
+}
+
+func TestCompileResolveErrorKeepsState(t *testing.T) {
+	symbolTable := NewSymbolTable()
+	var constants []object.Object
+
+	compiler := NewWithState(symbolTable, constants)
+	err := compiler.Compile(parser.New(lexer.New("let a = 1; let b = x + y;")).ParseProgram())
+	if err == nil {
+		t.Fatalf("expected compile error")
+	}
+	if err.Error() != "1:20: identifier not found: x\n1:24: identifier not found: y" {
+		t.Errorf("wrong error: %q", err)
+	}
+	if _, ok := symbolTable.Resolve("a"); ok {
+		t.Errorf("symbol table was modified by a failed compile")
+	}
+}
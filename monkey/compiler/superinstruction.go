@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+)
+
+// SetSuperinstructions 选择栈指令中是否使用 code.OpGetLocal0 等特化指令, 默认使用
+func (c *Compiler) SetSuperinstructions(on bool) {
+	c.generic = !on
+}
+
+func (c *Compiler) emitGetLocal(index int) {
+	if !c.generic && index < 4 {
+		c.emit(code.OpGetLocal0 + code.Opcode(index))
+		return
+	}
+	c.emit(code.OpGetLocal, index)
+}
+
+func (c *Compiler) emitCall(numArgs int) {
+	if !c.generic && numArgs < 3 {
+		c.emit(code.OpCall0 + code.Opcode(numArgs))
+		return
+	}
+	c.emit(code.OpCall, numArgs)
+}
+
+// constantOperation 在右操作数是整数字面量时输出 OpAddConstant 或 OpSubConstant,
+// 左操作数已经编译. 只根据语法树判断, 不会把属于其他表达式的 OpConstant 合并进来
+func (c *Compiler) constantOperation(node *ast.InfixExpression) bool {
+	right, ok := node.Right.(*ast.IntegerLiteral)
+	if c.generic || !ok {
+		return false
+	}
+	constant := c.addConstant(&object.Integer{Value: right.Value})
+	switch node.Operator {
+	case "+":
+		c.emit(code.OpAddConstant, constant)
+	case "-":
+		c.emit(code.OpSubConstant, constant)
+	}
+	return true
+}
+
+var comparisonJumps = map[string]code.Opcode{
+	"==": code.OpJumpNotEqual,
+	"!=": code.OpJumpEqual,
+	">":  code.OpJumpNotGreater,
+	"<":  code.OpJumpNotGreater,
+}
+
+// conditionJump 返回 if 条件之后的跳转指令. 条件是比较时, 去掉刚输出的比较指令,
+// 改用比较并跳转的指令, 新指令与比较指令的位置相同, 跳到比较指令的跳转仍然有效
+func (c *Compiler) conditionJump(condition ast.Expression) code.Opcode {
+	infix, ok := condition.(*ast.InfixExpression)
+	if c.generic || !ok {
+		return code.OpJumpNotTruthy
+	}
+	op, ok := comparisonJumps[infix.Operator]
+	if !ok {
+		return code.OpJumpNotTruthy
+	}
+	c.removeLastInstruction()
+	return op
+}
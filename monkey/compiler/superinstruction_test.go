@@ -0,0 +1,135 @@
+package compiler
+
+import (
+	"go-example/monkey/code"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b, c, d, e) { a; e }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal0),
+					code.MustMake(code.OpPop),
+					code.MustMake(code.OpGetLocal, 4),
+					code.MustMake(code.OpReturnValue),
+				},
+			},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpClosure, 0, 0),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `fn(x) { x + 1 }; 1 - 2`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.MustMake(code.OpGetLocal0),
+					code.MustMake(code.OpAddConstant, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpSubConstant, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			// 右操作数不是字面量时仍使用 OpAdd
+			input:             `1 + if (true) { 2 }`,
+			expectedConstants: []any{1, 2},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpJumpNotTruthy, 13),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJump, 14),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpAdd),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `if (1 < 2) { 10 }`,
+			expectedConstants: []any{2, 1, 10},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpJumpNotGreater, 15),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpJump, 16),
+				code.MustMake(code.OpNull),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input:             `if (true != false) { 10 } else { 20 }`,
+			expectedConstants: []any{10, 20},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpTrue),
+				code.MustMake(code.OpFalse),
+				code.MustMake(code.OpJumpEqual, 11),
+				code.MustMake(code.OpConstant, 0),
+				code.MustMake(code.OpJump, 14),
+				code.MustMake(code.OpConstant, 1),
+				code.MustMake(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn() { 1 }; f(); f(1, 2); f(1, 2, 3)`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.MustMake(code.OpConstant, 0),
+					code.MustMake(code.OpReturnValue),
+				},
+				1, 2, 1, 2, 3,
+			},
+			expectedIns: []code.Instructions{
+				code.MustMake(code.OpClosure, 1, 0),
+				code.MustMake(code.OpSetGlobal, 0),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpCall0),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 2),
+				code.MustMake(code.OpConstant, 3),
+				code.MustMake(code.OpCall2),
+				code.MustMake(code.OpPop),
+				code.MustMake(code.OpGetGlobal, 0),
+				code.MustMake(code.OpConstant, 4),
+				code.MustMake(code.OpConstant, 5),
+				code.MustMake(code.OpConstant, 6),
+				code.MustMake(code.OpCall, 3),
+				code.MustMake(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		prog := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		compiler := New()
+		if err := compiler.Compile(prog); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		if err := testInstructions(tt.expectedIns, bytecode.Instructions); err != nil {
+			t.Fatalf("%q: testInstructions failed: %s", tt.input, err)
+		}
+		if err := testConstants(t, tt.expectedConstants, bytecode.Constants); err != nil {
+			t.Fatalf("%q: testConstants failed: %s", tt.input, err)
+		}
+	}
+}
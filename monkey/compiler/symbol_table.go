@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -82,3 +84,34 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	s.store[name] = symbol
 	return symbol
 }
+
+// Symbols 返回当前作用域中定义的符号, 按作用域和下标排序
+func (s *SymbolTable) Symbols() []Symbol {
+	var symbols []Symbol
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Scope != symbols[j].Scope {
+			return symbols[i].Scope < symbols[j].Scope
+		}
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// NumDefinitions 返回当前作用域中已分配的下标个数, 包括被同名定义覆盖的
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// Clone 复制符号表的当前作用域, 外层作用域与原表共享
+func (s *SymbolTable) Clone() *SymbolTable {
+	store := make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		store[name] = symbol
+	}
+	free := make([]Symbol, len(s.FreeSymbols))
+	copy(free, s.FreeSymbols)
+	return &SymbolTable{Outer: s.Outer, store: store, numDefinitions: s.numDefinitions, FreeSymbols: free}
+}
@@ -0,0 +1,333 @@
+// Package conformance 用一组 .mk 程序检查各个执行引擎的行为是否一致.
+//
+// 程序中以 // 开头的注释行标注期望的结果:
+//
+//	// result: [1, 2]     最后一个表达式语句的值, 与 Inspect 的结果比较
+//	// output: hello      print 输出的一行, 可以有多行, 按顺序比较
+//	// error: type        运行时或编译时错误的类别, 见 ErrorClass
+//
+// result 和 error 不能同时出现. 没有 output 注释时期望程序没有输出.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/evaluator"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"go-example/monkey/vm"
+	"go-example/monkey/wasm"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrUnsupported 表示引擎不支持程序用到的特性, 这样的用例被跳过而不算失败
+var ErrUnsupported = errors.New("not supported by this engine")
+
+// Engine 是一个执行引擎. Run 运行宏展开后的程序, print 的输出写入 out,
+// 返回最后一个表达式语句的值的 Inspect 结果
+type Engine struct {
+	Name string
+	Run  func(program *ast.Program, out io.Writer) (string, error)
+}
+
+// Engines 是参与一致性测试的引擎, 新的后端加入这里即可运行全部用例
+var Engines = []Engine{
+	{Name: "evaluator", Run: runEvaluator},
+	{Name: "vm", Run: vmEngine(compiler.StackTarget)},
+	{Name: "vm-register", Run: vmEngine(compiler.RegisterTarget)},
+	{Name: "wasm", Run: runWasm},
+}
+
+func runEvaluator(program *ast.Program, out io.Writer) (string, error) {
+	env := object.NewEnvironment()
+	env.SetOutput(out)
+	return inspect(evaluator.Eval(program, env))
+}
+
+func vmEngine(target compiler.Target) func(*ast.Program, io.Writer) (string, error) {
+	return func(program *ast.Program, out io.Writer) (string, error) {
+		comp := compiler.New()
+		comp.SetTarget(target)
+		if err := comp.Compile(program); err != nil {
+			return "", err
+		}
+		machine := vm.New(comp.Bytecode())
+		machine.SetDeterministic(true)
+		machine.SetOutput(out)
+		if err := machine.Run(); err != nil {
+			return "", err
+		}
+		return inspect(machine.LastPoppedStackElem())
+	}
+}
+
+func runWasm(program *ast.Program, out io.Writer) (string, error) {
+	module, err := wasm.Compile(program)
+	if err != nil {
+		if strings.Contains(err.Error(), "not supported by the wasm backend") {
+			return "", fmt.Errorf("%w: %s", ErrUnsupported, err)
+		}
+		return "", err
+	}
+	result, err := wasm.Run(context.Background(), module, out)
+	if err != nil {
+		return "", err
+	}
+	// 与 inspect 相同, 结果是错误对象时当作错误
+	if result.IsError {
+		return "", errors.New(result.Message)
+	}
+	return result.Inspect, nil
+}
+
+// inspect 把结果中的错误对象当作错误, evaluator 中出错和 vm 中内置函数返回错误都是这种情况
+func inspect(obj object.Object) (string, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return object.NULL.Inspect(), nil
+	case *object.Error:
+		if strings.HasSuffix(obj.Message, "is only supported by the vm") {
+			return "", fmt.Errorf("%w: %s", ErrUnsupported, obj.Message)
+		}
+		return "", errors.New(obj.Message)
+	}
+	return obj.Inspect(), nil
+}
+
+var (
+	position   = regexp.MustCompile(`^\d+:\d+: `)
+	taskPrefix = regexp.MustCompile(`^task \d+: `)
+)
+
+// ErrorClass 把各个引擎措辞不同的错误信息归为同一类:
+// type、index、hash key、call、arity 和 name. 其他错误返回去掉位置后的信息本身
+func ErrorClass(msg string) string {
+	msg, _, _ = strings.Cut(msg, "\n")
+	msg = position.ReplaceAllString(msg, "")
+	msg = taskPrefix.ReplaceAllString(msg, "")
+	classes := []struct{ prefix, class string }{
+		{"unknown operator", "type"},
+		{"type mismatch", "type"},
+		{"unsupported types", "type"},
+		{"unsupport type", "type"},
+		{"unknown string operator", "type"},
+		{"index operator not supported", "index"},
+		{"unusable as hash key", "hash key"},
+		{"not a function", "call"},
+		{"calling non-function", "call"},
+		{"wrong number of arguments:", "arity"},
+		{"identifier not found", "name"},
+	}
+	for _, c := range classes {
+		if strings.HasPrefix(msg, c.prefix) {
+			return c.class
+		}
+	}
+	return msg
+}
+
+// Case 是一个一致性测试用例
+type Case struct {
+	Name   string
+	Source string
+	Output []string
+	Result string
+	Error  string
+
+	hasResult bool
+}
+
+// Parse 读取源码中的注释标注
+func Parse(name, src string) (*Case, error) {
+	c := &Case{Name: name, Source: src}
+	for i, line := range strings.Split(src, "\n") {
+		comment, ok := strings.CutPrefix(strings.TrimSpace(line), "//")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(comment), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "result":
+			if c.hasResult {
+				return nil, fmt.Errorf("%s:%d: duplicate result", name, i+1)
+			}
+			c.Result, c.hasResult = value, true
+		case "output":
+			c.Output = append(c.Output, value)
+		case "error":
+			if c.Error != "" {
+				return nil, fmt.Errorf("%s:%d: duplicate error", name, i+1)
+			}
+			c.Error = value
+		}
+	}
+
+	switch {
+	case c.hasResult && c.Error != "":
+		return nil, fmt.Errorf("%s: both result and error given", name)
+	case !c.hasResult && c.Error == "" && len(c.Output) == 0:
+		return nil, fmt.Errorf("%s: no result, output or error annotation", name)
+	}
+	return c, nil
+}
+
+// Load 读取 dir 中的全部 .mk 用例, 按文件名排序
+func Load(dir string) ([]*Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.mk"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var cases []*Case
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		c, err := Parse(filepath.Base(file), string(src))
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// Status 是用例在一个引擎上的运行结果
+type Status int
+
+const (
+	Pass Status = iota
+	Fail
+	Skip
+)
+
+func (s Status) String() string {
+	return [...]string{"PASS", "FAIL", "SKIP"}[s]
+}
+
+// program 解析并展开宏. 编译会修改语法树, 每个引擎都要用新解析的程序
+func (c *Case) program() (*ast.Program, error) {
+	p := parser.New(lexer.New(c.Source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("parse error: %s", strings.Join(errs, "; "))
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv).(*ast.Program), nil
+}
+
+// Check 在引擎 e 上运行用例, 失败或跳过时返回原因
+func (c *Case) Check(e Engine) (Status, string) {
+	program, err := c.program()
+	if err != nil {
+		return Fail, err.Error()
+	}
+
+	var out bytes.Buffer
+	result, err := e.Run(program, &out)
+	if errors.Is(err, ErrUnsupported) {
+		return Skip, err.Error()
+	}
+
+	var problems []string
+	switch {
+	case c.Error != "" && err == nil:
+		problems = append(problems, fmt.Sprintf("want error %q, got result %s", c.Error, result))
+	case c.Error != "" && ErrorClass(err.Error()) != c.Error:
+		problems = append(problems, fmt.Sprintf("want error %q, got %q", c.Error, err))
+	case c.Error == "" && err != nil:
+		problems = append(problems, fmt.Sprintf("unexpected error: %s", err))
+	case c.hasResult && result != c.Result:
+		problems = append(problems, fmt.Sprintf("want result %s, got %s", c.Result, result))
+	}
+
+	var want string
+	if len(c.Output) > 0 {
+		want = strings.Join(c.Output, "\n") + "\n"
+	}
+	if out.String() != want {
+		problems = append(problems, fmt.Sprintf("want output %q, got %q", want, out.String()))
+	}
+
+	if len(problems) > 0 {
+		return Fail, strings.Join(problems, "; ")
+	}
+	return Pass, ""
+}
+
+// Result 是一个用例在一个引擎上的运行结果
+type Result struct {
+	Case   string
+	Engine string
+	Status Status
+	Detail string
+}
+
+// Run 在每个引擎上运行每个用例
+func Run(cases []*Case, engines []Engine) []Result {
+	var results []Result
+	for _, c := range cases {
+		for _, e := range engines {
+			status, detail := c.Check(e)
+			results = append(results, Result{Case: c.Name, Engine: e.Name, Status: status, Detail: detail})
+		}
+	}
+	return results
+}
+
+// WriteReport 输出每个用例在各个引擎上的结果, 失败和跳过的原因, 以及每个引擎的汇总.
+// 返回失败的个数
+func WriteReport(w io.Writer, results []Result) int {
+	var engines []string
+	counts := map[string]*[3]int{}
+	failed := 0
+	for i, r := range results {
+		if counts[r.Engine] == nil {
+			counts[r.Engine] = &[3]int{}
+			engines = append(engines, r.Engine)
+		}
+		counts[r.Engine][r.Status]++
+
+		if i == 0 || results[i-1].Case != r.Case {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%-28s", r.Case)
+		}
+		fmt.Fprintf(w, " %s:%s", r.Engine, r.Status)
+	}
+	if len(results) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	for _, r := range results {
+		if r.Status != Pass {
+			fmt.Fprintf(w, "%s %s [%s]: %s\n", r.Status, r.Case, r.Engine, r.Detail)
+		}
+		if r.Status == Fail {
+			failed++
+		}
+	}
+	for _, e := range engines {
+		n := counts[e]
+		fmt.Fprintf(w, "%s: %d passed, %d failed, %d skipped\n", e, n[Pass], n[Fail], n[Skip])
+	}
+	return failed
+}
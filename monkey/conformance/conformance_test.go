@@ -0,0 +1,130 @@
+package conformance
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	cases, err := Load("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no cases in testdata")
+	}
+
+	// 各个引擎把输出写入自己的 out, 用例可以并行运行
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+			for _, e := range Engines {
+				t.Run(e.Name, func(t *testing.T) {
+					switch status, detail := c.Check(e); status {
+					case Fail:
+						t.Error(detail)
+					case Skip:
+						t.Skip(detail)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	// 只有整行的注释是标注, 代码后面的注释不是
+	c, err := Parse("a.mk", "// 说明\n//output: a\nprint(\"a\"); // output: b\n  // result:  null \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.Output, ",") != "a" || c.Result != "null" || !c.hasResult || c.Error != "" {
+		t.Errorf("wrong case: %+v", c)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1", "a.mk: no result, output or error annotation"},
+		{"// result: 1\n// error: type\n1", "a.mk: both result and error given"},
+		{"// result: 1\n// result: 2\n1", "a.mk:2: duplicate result"},
+		{"// error: type\n// error: name\n1", "a.mk:2: duplicate error"},
+	}
+	for _, tt := range tests {
+		_, err := Parse("a.mk", tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"type mismatch: integer + boolean", "type"},
+		{"unsupported types for binary operation: integer boolean", "type"},
+		{"unknown operator: -string", "type"},
+		{"unsupport type for negation: string", "type"},
+		{"1:14: identifier not found: foobar\n1:50: identifier not found: barfoo", "name"},
+		{"task 2: calling non-function", "call"},
+		{"wrong number of arguments: want=1, got=2", "arity"},
+		{"wrong number of arguments. got=2, want=1", "wrong number of arguments. got=2, want=1"},
+		{"stack overflow", "stack overflow"},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.input); got != tt.expected {
+			t.Errorf("ErrorClass(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckFailures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// result: 2\n1", "want result 2, got 1"},
+		{"// result: 1\nprint(1); 1", `want output "", got "1\n"`},
+		{"// error: type\n1", `want error "type", got result 1`},
+		{"// error: type\n1[0]", `want error "type", got "index operator not supported: integer"`},
+		{"// output: 1\n1 + true", `unexpected error: type mismatch: integer + boolean; want output "1\n", got ""`},
+	}
+	for _, tt := range tests {
+		c, err := Parse("a.mk", tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, detail := c.Check(Engines[0])
+		if status != Fail || detail != tt.expected {
+			t.Errorf("%q: want FAIL %q, got %s %q", tt.input, tt.expected, status, detail)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	results := []Result{
+		{Case: "a.mk", Engine: "x", Status: Pass},
+		{Case: "a.mk", Engine: "y", Status: Fail, Detail: "want result 2, got 1"},
+		{Case: "b.mk", Engine: "x", Status: Pass},
+		{Case: "b.mk", Engine: "y", Status: Skip, Detail: "not supported"},
+	}
+	var out bytes.Buffer
+	if failed := WriteReport(&out, results); failed != 1 {
+		t.Errorf("wrong number of failures: %d", failed)
+	}
+	expected := `a.mk                         x:PASS y:FAIL
+b.mk                         x:PASS y:SKIP
+FAIL a.mk [y]: want result 2, got 1
+SKIP b.mk [y]: not supported
+x: 2 passed, 0 failed, 0 skipped
+y: 0 passed, 1 failed, 1 skipped
+`
+	if out.String() != expected {
+		t.Errorf("wrong report.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
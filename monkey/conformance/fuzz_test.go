@@ -0,0 +1,476 @@
+package conformance
+
+import (
+	"errors"
+	"go-example/monkey/ast"
+	"go-example/monkey/format"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"go-example/monkey/token"
+	"io"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// FuzzEngines 从输入生成随机的程序, 在每个引擎上运行, 结果或错误类别与 evaluator 不同时报告
+func FuzzEngines(f *testing.F) {
+	f.Add([]byte{})
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 64; i++ {
+		data := make([]byte, 16+r.Intn(256))
+		r.Read(data)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src := format.Node(newProgramGen(data).program())
+		want := outcome(t, Engines[0], src)
+		for _, e := range Engines[1:] {
+			if got := outcome(t, e, src); got != want && got != "" {
+				t.Fatalf("%s differs from %s.\n%s: %s\n%s: %s\nprogram:\n%s",
+					e.Name, Engines[0].Name, Engines[0].Name, want, e.Name, got, src)
+			}
+		}
+	})
+}
+
+// outcome 返回程序的结果, 出错时返回错误类别, 引擎不支持时返回空串
+func outcome(t *testing.T, e Engine, src string) string {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("formatted program does not parse: %v\n%s", p.Errors(), src)
+	}
+	result, err := e.Run(program, io.Discard)
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		return ""
+	case err != nil:
+		return "error: " + ErrorClass(err.Error())
+	}
+	return result
+}
+
+type kind int
+
+const (
+	anyKind kind = iota // 函数以外的任意值, 包括 null
+	intKind
+	boolKind
+	stringKind
+	arrayKind
+	hashKind
+	fnKind
+)
+
+// typ 是生成表达式时期望的类型, 函数类型带有参数和返回值的类型
+type typ struct {
+	kind   kind
+	params []*typ
+	result *typ
+}
+
+var (
+	anyType    = &typ{kind: anyKind}
+	intType    = &typ{kind: intKind}
+	boolType   = &typ{kind: boolKind}
+	stringType = &typ{kind: stringKind}
+	arrayType  = &typ{kind: arrayKind}
+	hashType   = &typ{kind: hashKind}
+)
+
+func (t *typ) equal(other *typ) bool {
+	if t.kind != other.kind || len(t.params) != len(other.params) {
+		return false
+	}
+	for i, p := range t.params {
+		if !p.equal(other.params[i]) {
+			return false
+		}
+	}
+	return t.kind != fnKind || t.result.equal(other.result)
+}
+
+// accepts 报告类型为 other 的值能否用在需要 t 的地方
+func (t *typ) accepts(other *typ) bool {
+	if t.kind == anyKind {
+		return other.kind != fnKind
+	}
+	return t.equal(other)
+}
+
+type variable struct {
+	name string
+	typ  *typ
+}
+
+// programGen 从模糊测试的输入中逐字节读取选择, 生成语法和作用域都正确的程序.
+// 除了至多一处故意的错误外, 程序是类型正确的, 不含递归, 除数都是正数字面量, 因此总会结束.
+// 输入读完后总是选择第一项, 第一项总是最小的, 所以任何输入都生成有限的程序
+type programGen struct {
+	data    []byte
+	names   int
+	scope   []variable
+	results []*typ // 所在函数的返回值类型, 用于生成 return
+	faults  int
+}
+
+func newProgramGen(data []byte) *programGen {
+	return &programGen{data: data, faults: 1}
+}
+
+func (g *programGen) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b) % n
+}
+
+// newName 返回不与其他变量重名的标识符, 标识符中不能有数字
+func (g *programGen) newName() string {
+	n := g.names
+	g.names++
+	name := "v"
+	for {
+		name += string(rune('a' + n%26))
+		n /= 26
+		if n == 0 {
+			return name
+		}
+	}
+}
+
+func (g *programGen) define(name string, t *typ) *ast.Identifier {
+	g.scope = append(g.scope, variable{name: name, typ: t})
+	return ident(name)
+}
+
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func (g *programGen) randomType(depth int) *typ {
+	switch g.choose(8) {
+	case 1:
+		return intType
+	case 2:
+		return boolType
+	case 3:
+		return stringType
+	case 4:
+		return arrayType
+	case 5:
+		return hashType
+	case 6, 7:
+		if depth > 0 {
+			t := &typ{kind: fnKind, result: g.randomType(depth - 1)}
+			for i := g.choose(3); i > 0; i-- {
+				t.params = append(t.params, g.randomType(depth-1))
+			}
+			return t
+		}
+	}
+	return anyType
+}
+
+// valueType 随机选择 anyType 以外的非函数类型
+func (g *programGen) valueType() *typ {
+	return []*typ{intType, boolType, stringType, arrayType, hashType}[g.choose(5)]
+}
+
+func (g *programGen) program() *ast.Program {
+	program := &ast.Program{}
+	for i := g.choose(6); i > 0; i-- {
+		program.Statements = append(program.Statements, g.statement(3))
+	}
+	program.Statements = append(program.Statements, expressionStatement(g.expression(anyType, 3)))
+	return program
+}
+
+func expressionStatement(exp ast.Expression) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Expression: exp}
+}
+
+func (g *programGen) statement(depth int) ast.Statement {
+	if depth <= 0 {
+		return expressionStatement(g.leaf(anyType))
+	}
+	switch g.choose(5) {
+	case 1:
+		t := g.randomType(2)
+		value := g.expression(t, depth)
+		return &ast.LetStatement{Name: g.define(g.newName(), t), Value: value}
+	case 2:
+		return g.forStatement(depth)
+	case 3:
+		if len(g.results) > 0 {
+			// 只在条件成立时返回, 使后面的语句仍有机会执行
+			ret := &ast.ReturnStatement{ReturnValue: g.expression(g.results[len(g.results)-1], depth-1)}
+			return expressionStatement(&ast.IfExpression{
+				Condition:   g.expression(boolType, depth-1),
+				Consequence: &ast.BlockStatement{Statements: []ast.Statement{ret}},
+			})
+		}
+	}
+	return expressionStatement(g.expression(anyType, depth))
+}
+
+func (g *programGen) forStatement(depth int) *ast.ForStatement {
+	var iterable ast.Expression
+	elem := anyType
+	switch g.choose(3) {
+	case 1:
+		iterable = g.expression(stringType, depth-1)
+		elem = stringType
+	case 2:
+		iterable = g.expression(hashType, depth-1)
+	default:
+		iterable = g.expression(arrayType, depth-1)
+	}
+
+	n := len(g.scope)
+	defer func() { g.scope = g.scope[:n] }()
+	variable := g.define(g.newName(), elem)
+	body := &ast.BlockStatement{}
+	for i := g.choose(3); i > 0; i-- {
+		body.Statements = append(body.Statements, g.statement(depth-1))
+	}
+	return &ast.ForStatement{Variable: variable, Iterable: iterable, Body: body}
+}
+
+// block 生成以类型为 t 的表达式结尾的语句块, 块中定义的变量只在块内可见
+func (g *programGen) block(t *typ, depth int) *ast.BlockStatement {
+	n := len(g.scope)
+	defer func() { g.scope = g.scope[:n] }()
+
+	block := &ast.BlockStatement{}
+	for i := g.choose(3); i > 0 && depth > 0; i-- {
+		block.Statements = append(block.Statements, g.statement(depth-1))
+	}
+	block.Statements = append(block.Statements, expressionStatement(g.expression(t, depth)))
+	return block
+}
+
+func (g *programGen) expression(t *typ, depth int) ast.Expression {
+	if depth <= 0 {
+		return g.leaf(t)
+	}
+	if g.faults > 0 && g.choose(32) == 1 {
+		g.faults--
+		return g.fault(depth - 1)
+	}
+
+	switch g.choose(6) {
+	case 1:
+		return &ast.IfExpression{
+			Condition:   g.expression(boolType, depth-1),
+			Consequence: g.block(t, depth-1),
+			Alternative: g.block(t, depth-1),
+		}
+	case 2:
+		if call := g.call(t, depth-1); call != nil {
+			return call
+		}
+	case 3:
+		if t.kind == anyKind {
+			return g.element(depth - 1)
+		}
+	}
+
+	switch t.kind {
+	case anyKind:
+		return g.expression(g.valueType(), depth)
+	case intKind:
+		switch g.choose(4) {
+		case 1:
+			return &ast.PrefixExpression{Operator: "-", Right: g.expression(intType, depth-1)}
+		case 2:
+			return builtinCall("len", g.expression([]*typ{stringType, arrayType}[g.choose(2)], depth-1))
+		case 3:
+			// 除数是正数, 不会除以零, 也不会溢出
+			return infix(g.expression(intType, depth-1), "/", integer(int64(1+g.choose(9))))
+		}
+		return infix(g.expression(intType, depth-1), []string{"+", "-", "*"}[g.choose(3)], g.expression(intType, depth-1))
+	case boolKind:
+		switch g.choose(4) {
+		case 1:
+			return &ast.PrefixExpression{Operator: "!", Right: g.expression(anyType, depth-1)}
+		case 2:
+			operand := []*typ{intType, stringType}[g.choose(2)]
+			return infix(g.expression(operand, depth-1), []string{"<", ">"}[g.choose(2)], g.expression(operand, depth-1))
+		}
+		return infix(g.expression(anyType, depth-1), []string{"==", "!="}[g.choose(2)], g.expression(anyType, depth-1))
+	case stringKind:
+		if g.choose(2) == 1 {
+			return g.template(depth - 1)
+		}
+		return infix(g.expression(stringType, depth-1), "+", g.expression(stringType, depth-1))
+	case arrayKind:
+		if g.choose(3) == 1 {
+			return builtinCall("push", g.expression(arrayType, depth-1), g.expression(anyType, depth-1))
+		}
+		array := &ast.ArrayLiteral{}
+		for i := g.choose(4); i > 0; i-- {
+			array.Elements = append(array.Elements, g.expression(anyType, depth-1))
+		}
+		return array
+	case hashKind:
+		hash := &ast.HashLiteral{Pairs: map[ast.Expression]ast.Expression{}}
+		for i := g.choose(4); i > 0; i-- {
+			key := g.expression([]*typ{intType, boolType, stringType}[g.choose(3)], depth-1)
+			hash.Keys = append(hash.Keys, key)
+			hash.Pairs[key] = g.expression(anyType, depth-1)
+		}
+		return hash
+	case fnKind:
+		return g.function(t, depth-1)
+	}
+	return g.leaf(t)
+}
+
+// element 生成取元素的表达式, 结果可能是 null
+func (g *programGen) element(depth int) ast.Expression {
+	switch g.choose(4) {
+	case 1:
+		return &ast.IndexExpression{Left: g.expression(arrayType, depth), Index: g.expression(intType, depth)}
+	case 2:
+		key := []*typ{intType, boolType, stringType, arrayType}[g.choose(4)]
+		return &ast.IndexExpression{Left: g.expression(hashType, depth), Index: g.expression(key, depth)}
+	case 3:
+		return builtinCall([]string{"first", "last", "rest"}[g.choose(3)], g.expression(arrayType, depth))
+	}
+	return &ast.IfExpression{Condition: g.expression(boolType, depth), Consequence: g.block(anyType, depth)}
+}
+
+func (g *programGen) template(depth int) ast.Expression {
+	tl := &ast.TemplateLiteral{}
+	for i := 1 + g.choose(3); i > 0; i-- {
+		if g.choose(2) == 1 {
+			tl.Parts = append(tl.Parts, &ast.StringLiteral{Value: g.stringValue()})
+		}
+		tl.Parts = append(tl.Parts, g.expression(anyType, depth))
+	}
+	return tl
+}
+
+// call 生成返回值类型为 t 的调用, 被调用的是作用域中的函数或一个新的函数表达式
+func (g *programGen) call(t *typ, depth int) ast.Expression {
+	var fn *typ
+	var callee ast.Expression
+	if v, ok := g.pick(func(v variable) bool { return v.typ.kind == fnKind && t.accepts(v.typ.result) }); ok {
+		fn, callee = v.typ, ident(v.name)
+	} else {
+		if t.kind == anyKind {
+			t = g.valueType()
+		}
+		fn = &typ{kind: fnKind, result: t}
+		for i := g.choose(3); i > 0; i-- {
+			fn.params = append(fn.params, g.randomType(1))
+		}
+		callee = g.expression(fn, depth)
+	}
+
+	call := &ast.CallExpression{Function: callee}
+	for _, p := range fn.params {
+		call.Arguments = append(call.Arguments, g.expression(p, depth))
+	}
+	return call
+}
+
+func (g *programGen) function(t *typ, depth int) *ast.FunctionLiteral {
+	n := len(g.scope)
+	defer func() { g.scope = g.scope[:n] }()
+
+	fn := &ast.FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}}
+	for _, p := range t.params {
+		fn.Parameters = append(fn.Parameters, g.define(g.newName(), p))
+	}
+	g.results = append(g.results, t.result)
+	fn.Body = g.block(t.result, depth)
+	g.results = g.results[:len(g.results)-1]
+	return fn
+}
+
+// pick 在作用域中随机选择满足条件的变量
+func (g *programGen) pick(match func(variable) bool) (variable, bool) {
+	var candidates []variable
+	for _, v := range g.scope {
+		if match(v) {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return variable{}, false
+	}
+	return candidates[g.choose(len(candidates))], true
+}
+
+func (g *programGen) leaf(t *typ) ast.Expression {
+	if g.choose(2) == 1 {
+		if v, ok := g.pick(func(v variable) bool { return t.accepts(v.typ) }); ok {
+			return ident(v.name)
+		}
+	}
+
+	switch t.kind {
+	case anyKind:
+		return g.leaf(g.valueType())
+	case intKind:
+		return integer(int64(g.choose(32)))
+	case boolKind:
+		if g.choose(2) == 1 {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+	case stringKind:
+		return &ast.StringLiteral{Value: g.stringValue()}
+	case arrayKind:
+		return &ast.ArrayLiteral{}
+	case hashKind:
+		return &ast.HashLiteral{Pairs: map[ast.Expression]ast.Expression{}}
+	}
+	return g.function(t, 0)
+}
+
+func (g *programGen) stringValue() string {
+	return []string{"", "a", "monkey", "hé", "a b"}[g.choose(5)]
+}
+
+// fault 生成一个运行时一定出错的表达式
+func (g *programGen) fault(depth int) ast.Expression {
+	switch g.choose(6) {
+	case 1:
+		return &ast.PrefixExpression{Operator: "-", Right: g.expression([]*typ{boolType, stringType, arrayType}[g.choose(3)], depth)}
+	case 2:
+		return infix(g.expression(intType, depth), "+", g.expression(stringType, depth))
+	case 3:
+		return &ast.IndexExpression{Left: g.expression(intType, depth), Index: g.expression(intType, depth)}
+	case 4:
+		key := &ast.ArrayLiteral{Elements: []ast.Expression{g.function(&typ{kind: fnKind, result: intType}, depth)}}
+		return &ast.IndexExpression{Left: g.expression(hashType, depth), Index: key}
+	case 5:
+		// 参数个数不对
+		fn := &typ{kind: fnKind, result: anyType, params: []*typ{intType}}
+		call := &ast.CallExpression{Function: g.function(fn, depth)}
+		for i := g.choose(2) * 2; i > 0; i-- {
+			call.Arguments = append(call.Arguments, g.expression(intType, depth))
+		}
+		return call
+	}
+	return &ast.CallExpression{Function: g.expression(intType, depth)}
+}
+
+func infix(left ast.Expression, operator string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{Left: left, Operator: operator, Right: right}
+}
+
+func integer(n int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(n, 10)}, Value: n}
+}
+
+func builtinCall(name string, args ...ast.Expression) *ast.CallExpression {
+	return &ast.CallExpression{Function: ident(name), Arguments: args}
+}
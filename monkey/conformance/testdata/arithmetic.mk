@@ -0,0 +1,3 @@
+// 整数运算的优先级、结合性和截断除法
+// result: [10, 60, 50, -3, -42, -9223372036854775808]
+[5 + 5 + 5 + 5 - 10, 50 / 2 * 2 + 10, (5 + 10 * 2 + 15 / 3) * 2 + -10, 7 / -2, 0 - 1 * 42, -9223372036854775807 - 1]
@@ -0,0 +1,4 @@
+// 越界的下标得到 null, push 和 rest 不修改原数组
+// result: [1, null, null, 3, [1, 2, 3], [1, 2], [2], 1, 2, null, null]
+let xs = [1, 2];
+[xs[0], xs[2], xs[-1], len(push(xs, 3)), push(xs, 3), xs, rest(xs), first(xs), last(xs), first([]), rest([])]
@@ -0,0 +1,4 @@
+// 块中定义的变量属于所在的函数
+// result: block
+let f = fn(c) { if (c) { let v = "block"; } fn() { v } };
+f(true)()
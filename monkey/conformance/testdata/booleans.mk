@@ -0,0 +1,3 @@
+// 只有 false 和 null 为假, 比较运算支持整数和字符串
+// result: [true, false, true, true, false, true, false, true, true, false]
+[1 < 2, 1 > 2, "a" < "b", "b" > "a", !5, !!5, !0, !if (false) { 1 }, true == true, true != true]
@@ -0,0 +1,2 @@
+// result: [0, 4, 3, 1, 2, [2, 3], [1, 2, 3]]
+[len(""), len("four"), len([1, 2, 3]), first([1, 2]), last([1, 2]), rest([1, 2, 3]), push([1, 2], 3)]
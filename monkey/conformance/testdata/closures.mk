@@ -0,0 +1,23 @@
+// 多层嵌套的闭包看到全局变量、各层的参数和局部变量
+// output: [1, 2, 3, 4, 5]
+// output: 42
+// output: [2, 11, 3]
+// output: [10, 20, 30]
+let a = 1;
+let f = fn(b) { let c = 3; fn(d) { fn(e) { fn() { [a, b, c, d, e] } } } };
+print(f(2)(4)(5)());
+
+// 自由变量的自由变量
+let twice = fn(x) { fn() { fn() { fn() { x * 2 } } } };
+print(twice(21)()()());
+
+// 每次调用都有各自的局部变量
+let adder = fn(x) { fn(y) { x + y } };
+let one = adder(1);
+let ten = adder(10);
+print([one(1), ten(1), one(2)]);
+
+// 每个闭包捕获创建时的参数
+let collect = fn(xs, acc) { if (len(xs) == 0) { acc } else { collect(rest(xs), push(acc, fn() { first(xs) * 10 })) } };
+let fs = collect([1, 2, 3], []);
+print([fs[0](), fs[1](), fs[2]()]);
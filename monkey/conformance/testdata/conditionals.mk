@@ -0,0 +1,3 @@
+// 没有 else 且条件不成立时值为 null
+// result: [10, 20, null, 10, [a]]
+[if (true) { 10 }, if (1 > 2) { 10 } else { 20 }, if (false) { 10 }, if (1) { 10 }, if ("") { ["a"] } else { ["b"] }]
@@ -0,0 +1,3 @@
+// 数组和哈希按结构比较, 哈希的比较与键的顺序无关
+// result: [true, false, true, false, false, true]
+[[1, [2]] == [1, [2]], [1] == [1, 2], {"a": 1, "b": 2} == {"b": 2, "a": 1}, {"a": 1} == {"a": 2}, 1 == "1", [] != {}]
@@ -0,0 +1,3 @@
+// error: arity
+let f = fn(a) { a };
+f(1, 2)
@@ -0,0 +1,3 @@
+// 内置函数的错误
+// error: argument to `len` not supported, got integer
+len(1)
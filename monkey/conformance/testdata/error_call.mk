@@ -0,0 +1,3 @@
+// error: call
+let f = 5;
+f()
@@ -0,0 +1,2 @@
+// error: hash key
+{"a": 1}[fn() { 1 }]
@@ -0,0 +1,2 @@
+// error: index
+1[0]
@@ -0,0 +1,2 @@
+// error: cannot iterate over boolean
+for (x in true) { x }
@@ -0,0 +1,3 @@
+// 未定义的名字在运行之前报告, 即使在不会执行的分支中
+// error: name
+if (false) { undefined }
@@ -0,0 +1,2 @@
+// error: type
+"hello" - "world"
@@ -0,0 +1,6 @@
+// 出错之前的输出保留
+// output: before
+// error: type
+print("before");
+5 + true;
+print("after");
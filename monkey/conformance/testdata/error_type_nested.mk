@@ -0,0 +1,3 @@
+// error: type
+let f = fn(x) { fn(y) { if (x > 1) { return -y; } y } };
+f(2)("a")
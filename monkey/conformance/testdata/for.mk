@@ -0,0 +1,10 @@
+// for 遍历数组的元素、字符串的字符和哈希的键
+// output: 1
+// output: 2
+// output: h
+// output: é
+// output: b
+// output: a
+for (x in [1, 2]) { print(x) }
+for (c in "hé") { print(c) }
+for (k in {"b": 1, "a": 2}) { print(k) }
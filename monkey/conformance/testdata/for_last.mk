@@ -0,0 +1,4 @@
+// 循环的值是 null, 作为最后一条语句时结果不是迭代器或循环体中的值
+// result: null
+let xs = [1, 2];
+for (x in xs) { x }
@@ -0,0 +1,6 @@
+// 含有 yield 的函数返回生成器, 闭包捕获每次迭代的值
+// result: [[2, 4, 6], 10, 30]
+let gen = fn(n) { for (i in [1, 2, 3]) { yield i * n; } };
+let mk = fn() { for (i in [1, 2, 3]) { yield fn() { i * 10 }; } };
+let fs = collect(mk());
+[collect(gen(2)), fs[0](), fs[2]()]
@@ -0,0 +1,15 @@
+// yield 可以出现在表达式中的 if 分支里, 恢复后继续计算外层的表达式
+// result: [[a, 1, b, c, [2, {k: 3}, 4]], [x, 10], 2]
+let gen = fn() {
+	let n = 1 + if (true) { yield "a"; 0 };
+	yield n;
+	yield [n + 1, {"k": if (n > 0) { yield "b"; 3 }}, "${if (true) { yield "c"; 4 }}"];
+};
+let early = fn() {
+	for (x in gen()) {
+		if (x == "b") { return ["x", 10]; }
+	}
+};
+let nums = fn() { for (i in [1, 2, 3]) { yield i; } };
+let second = fn() { for (x in nums()) { if (x > 1) { return x; } } };
+[collect(gen()), early(), second()]
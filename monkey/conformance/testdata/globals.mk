@@ -0,0 +1,6 @@
+// 重新 let 同名变量得到新的变量, 之前创建的闭包仍看到原来的变量
+// result: [1, 2]
+let x = 1;
+let f = fn() { x };
+let x = 2;
+[f(), x]
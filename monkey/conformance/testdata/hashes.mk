@@ -0,0 +1,4 @@
+// 键可以是整数、布尔值、字符串以及由它们组成的数组和哈希, 哈希按插入顺序输出
+// result: [{a: 1, 2: two, true: [1, 2], [1, 2]: {x: 1}}, 1, two, [1, 2], {x: 1}, null, {b: 3, a: 2}]
+let h = {"a": 1, 2: "two", true: [1, 2], [1, 2]: {"x": 1}};
+[h, h["a"], h[2], h[true], h[[1, 2]], h["missing"], {"b": 1, "a": 2, "b": 3}]
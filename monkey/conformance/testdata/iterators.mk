@@ -0,0 +1,5 @@
+// iter 创建迭代器, next 取下一个值, 结束后得到 null
+// result: [1, [2, 3], null, [b, a], [h, é]]
+let it = iter([1, 2, 3]);
+let a = next(it);
+[a, collect(it), next(it), collect({"b": 1, "a": 2}), collect("hé")]
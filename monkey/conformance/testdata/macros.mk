@@ -0,0 +1,5 @@
+// 宏在运行之前展开
+// result: [not greater, 1]
+let unless = macro(cond, then, otherwise) { quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) }) };
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) };
+[unless(10 > 5, "greater", "not greater"), reverse(2 + 2, 10 - 5)]
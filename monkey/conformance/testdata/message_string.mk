@@ -0,0 +1,5 @@
+// 以 "Message: " 开头的字符串是普通的结果, 不是错误对象
+// output: Message: printed
+// result: Message: not an error
+print("Message: printed");
+"Message: not an error"
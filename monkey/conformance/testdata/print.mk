@@ -0,0 +1,6 @@
+// print 把每个参数输出为一行, 返回 null
+// output: 1
+// output: a
+// output: [true, {k: null}]
+// result: null
+print(1, "a", [true, {"k": if (false) { 1 }}])
@@ -0,0 +1,7 @@
+// 函数在自己的函数体和内层闭包中引用自己的名字
+// result: [55, 4, done, 0]
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let count = fn(n) { let step = fn() { if (n == 0) { 0 } else { 1 + count(n - 1) } }; step() };
+let outer = fn() { let inner = fn(n) { fn() { if (n > 0) { inner(n - 1)() } else { "done" } } }; inner(3)() };
+let wrapper = fn() { let down = fn(x) { if (x == 0) { 0 } else { down(x - 1) } }; down(100) };
+[fib(10), count(4), outer(), wrapper()]
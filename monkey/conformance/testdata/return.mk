@@ -0,0 +1,7 @@
+// return 从嵌套的块和循环中返回, 以语句结尾的函数返回 null
+// result: [big, medium, small, 2, null, null]
+let size = fn(a) { if (a > 10) { if (a > 5) { return "big"; } } if (a > 5) { "medium" } else { "small" } };
+let find = fn(xs) { for (x in xs) { if (x > 1) { return x; } } };
+let f = fn() { let x = 1; };
+let g = fn() { };
+[size(20), size(7), size(1), find([1, 2, 3]), f(), g()]
@@ -0,0 +1,5 @@
+// 循环中的 return 直接结束函数, 分号可以省略, 后面的语句不再执行
+// result: [20, 99, 3, 0]
+let f = fn(n) { for (x in [1, 2, 3]) { if (x == n) { return x * 10 } }; 99 };
+let nested = fn(k) { for (xs in [[1], [2, 3]]) { for (x in xs) { if (x == k) { return x } } } 0 };
+[f(2), f(5), nested(3), nested(4)]
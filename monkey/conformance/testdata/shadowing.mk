@@ -0,0 +1,18 @@
+// 内层的参数和局部变量遮蔽外层的同名变量, 内置函数也可以被遮蔽
+// output: [[param, local], global]
+// output: [2, 1]
+// output: [1, 2]
+// output: [7, 2]
+let x = "global";
+let f = fn(x) { let g = fn() { let x = "local"; x }; [x, g()] };
+print([f("param"), x]);
+
+let y = 1;
+let h = fn() { let g = fn(y) { fn() { y } }; g(2)() };
+print([h(), y]);
+
+let k = fn(n) { let g = fn() { n }; let m = n + 1; let n = m; [g(), n] };
+print(k(1));
+
+let wrap = fn(len) { fn() { len } };
+print([wrap(7)(), len("ab")]);
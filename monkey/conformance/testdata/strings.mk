@@ -0,0 +1,4 @@
+// 字符串拼接和模板字符串, 模板中的值按 Inspect 输出
+// result: sum 3 [1, a] {k: true} null hé!
+let name = "hé";
+"sum ${1 + 2} ${[1, "a"]} ${{"k": true}} ${if (false) { 1 }} " + name + "!"
@@ -0,0 +1,6 @@
+// 任务和通道只有 vm 支持
+// result: [42, [1, 2]]
+let ch = channel(2);
+send(ch, 1);
+send(ch, 2);
+[recv(spawn(fn(x) { x * 2 }, 21)), [recv(ch), recv(ch)]]
@@ -1,13 +1,18 @@
 package evaluator
 
 import (
+	"bytes"
 	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
 	"go-example/monkey/object"
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
+		if err := resolve(node, env); err != nil {
+			return object.NewError("%s", err)
+		}
 		return evalStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
@@ -16,7 +21,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if object.IsError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		setIdentifier(node.Name, val, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
@@ -43,6 +48,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
+	case *ast.YieldStatement:
+		// 生成器中的 yield 由 generator.step 处理, 不会到达这里
+		return object.NewError("yield outside generator")
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.CallExpression:
@@ -58,7 +68,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && object.IsError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(fn, args)
+		return applyFunction(fn, args, env)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if object.IsError(left) {
@@ -72,13 +82,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		fn := &object.Function{Parameters: params, Body: body, Env: env, NumLocals: node.NumLocals, Generator: node.Generator}
+		for _, slot := range node.Free {
+			fn.Free = append(fn.Free, evalSlot(slot, env))
+		}
+		return fn
 	case *ast.ArrayLiteral:
 		elems := evalExpressions(node.Elements, env)
 		if len(elems) == 1 && object.IsError(elems[0]) {
 			return elems[0]
 		}
-		return &object.Array{Elements: elems}
+		return object.NewArray(elems)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	case *ast.IntegerLiteral:
@@ -87,6 +101,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	}
 	return nil
 }
@@ -159,11 +175,20 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(object.Equal(left, right))
+	case "!=":
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case "<", ">":
+		if result, ok := object.Compare(left, right); ok {
+			return nativeBoolToBooleanObject(operator == "<" && result < 0 || operator == ">" && result > 0)
+		}
+	}
+
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return evalBooleanInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
@@ -187,22 +212,21 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	num := len(arrayObj.Elements) - 1
-	if idx < 0 || idx > int64(num) {
+	if idx < 0 || idx >= int64(arrayObj.Len()) {
 		return object.NULL
 	}
-	return arrayObj.Elements[idx]
+	return arrayObj.At(int(idx))
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
 		return object.NewError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
+	pair, ok := hashObj.Get(key, index)
 	if !ok {
 		return object.NULL
 	}
@@ -210,7 +234,57 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+// resolve 用 env 中已有的全局变量重建符号表, 再解析整个程序
+func resolve(program *ast.Program, env *object.Environment) error {
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+	for _, name := range env.GlobalNames() {
+		table.Define(name)
+	}
+	return compiler.Resolve(program, table)
+}
+
+func evalSlot(slot ast.Slot, env *object.Environment) object.Object {
+	switch compiler.SymbolScope(slot.Scope) {
+	case compiler.GlobalScope:
+		return env.Global(slot.Index)
+	case compiler.LocalScope:
+		return env.Local(slot.Index)
+	case compiler.FreeScope:
+		return env.Free(slot.Index)
+	case compiler.BuiltinScope:
+		return object.Builtins[slot.Index].Builtin
+	case compiler.FunctionScope:
+		if fn := env.Function(); fn != nil {
+			return fn
+		}
+	}
+	return nil
+}
+
+// setIdentifier 绑定 let 名字或函数参数, 未解析的标识符(宏展开时)按名字绑定
+func setIdentifier(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	switch {
+	case ident.Slot == nil:
+		env.Set(ident.Value, val)
+	case ident.Slot.Scope == string(compiler.GlobalScope):
+		env.SetGlobal(ident.Slot.Index, ident.Value, val)
+	default:
+		env.SetLocal(ident.Slot.Index, val)
+	}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if node.Slot != nil {
+		// 已解析但尚未赋值, 如跳过的分支中定义的变量
+		if val := evalSlot(*node.Slot, env); val != nil {
+			return val
+		}
+		return object.NewError("identifier not found: " + node.Value)
+	}
+
 	val, ok := env.Get(node.Value)
 	if ok {
 		return val
@@ -226,16 +300,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case object.TRUE:
-		return object.FALSE
-	case object.FALSE:
-		return object.TRUE
-	case object.NULL:
-		return object.TRUE
-	default:
-		return object.FALSE
-	}
+	return nativeBoolToBooleanObject(!isTruthy(right))
 }
 
 func evalMinusOperatorExpression(right object.Object) object.Object {
@@ -259,28 +324,6 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
 		return &object.Integer{Value: leftVal / rightVal}
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return object.NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalBooleanInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Boolean).Value
-	rightVal := right.(*object.Boolean).Value
-
-	switch operator {
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
 		return object.NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -298,38 +341,67 @@ func evalStringInfixExpression(operator string, left object.Object, right object
 	}
 }
 
+func evalTemplateLiteral(node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	parts := evalExpressions(node.Parts, env)
+	if len(parts) == 1 && object.IsError(parts[0]) {
+		return parts[0]
+	}
+	return templateString(parts)
+}
+
+// templateString 拼接模板字符串各部分的值
+func templateString(parts []object.Object) object.Object {
+	var out bytes.Buffer
+	for _, value := range parts {
+		if value == nil {
+			value = object.NULL
+		}
+		out.WriteString(value.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
-	for keyNode, valNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if object.IsError(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(key)
 		if !ok {
 			return object.NewError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if object.IsError(value) {
 			return value
 		}
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash = hash.Set(hashKey, object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return object.NewError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+		}
+		if function.Generator {
+			return newGenerator(function, args)
+		}
 		extendedEnv := extendFunctionEnv(function, args)
 		evaluated := Eval(function.Body, extendedEnv)
+		// 函数体以 let、for 等语句结尾时返回 null
+		if evaluated == nil {
+			return object.NULL
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if result := function.Fn(args...); result != nil {
+		if result := function.Call(env.Output(), args...); result != nil {
 			return result
 		}
 		return object.NULL
@@ -339,9 +411,9 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewFunctionEnvironment(fn)
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, args[i])
+		setIdentifier(param, args[i], env)
 	}
 	return env
 }
@@ -361,14 +433,5 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 func isTruthy(obj object.Object) bool {
-	switch obj {
-	case object.NULL:
-		return false
-	case object.TRUE:
-		return true
-	case object.FALSE:
-		return false
-	default:
-		return true
-	}
+	return object.IsTruthy(obj)
 }
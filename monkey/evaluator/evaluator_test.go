@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"fmt"
 	"go-example/monkey/lexer"
 	"go-example/monkey/object"
 	"go-example/monkey/parser"
+	"runtime"
 	"testing"
 )
 
@@ -188,12 +190,25 @@ func TestErrorHandling(t *testing.T) {
 		},
 		{
 			"foobar",
-			"identifier not found: foobar",
+			"1:1: identifier not found: foobar",
+		},
+		{
+			// 未执行的分支中的未定义名字同样在求值之前报告
+			"if (false) { foobar } else { 1 }; let f = fn() { barfoo };",
+			"1:14: identifier not found: foobar\n1:50: identifier not found: barfoo",
 		},
 		{
 			`"hello" - "world"`,
 			"unknown operator: string - string",
 		},
+		{
+			"fn(a) { a }()",
+			"wrong number of arguments: want=1, got=0",
+		},
+		{
+			"fn(a) { a }(1, 2)",
+			"wrong number of arguments: want=1, got=2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -271,6 +286,45 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3);", 5},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3);", 6},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10);", 55},
+		{
+			"let wrapper = fn() { let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } }; countDown(3) }; wrapper();",
+			0,
+		},
+		// 与 VM 一致, 自由变量在创建闭包时按值捕获
+		{"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f();", 1},
+		{"let x = 1; let g = fn() { x }; let x = 2; g();", 1},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestGlobalsAcrossPrograms(t *testing.T) {
+	env := object.NewEnvironment()
+	inputs := []string{
+		"let a = 1; let add = fn(x) { x + a };",
+		"let b = undefined;",
+		"let a = 10; add(a);",
+	}
+	for _, input := range inputs[:2] {
+		Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	testObject(t, Eval(parser.New(lexer.New(inputs[2])).ParseProgram(), env), 11)
+	if names := env.GlobalNames(); len(names) != 3 || names[2] != "a" {
+		t.Errorf("wrong global names: %v", names)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -294,6 +348,20 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be array, got integer"},
+		{`channel(-1)`, "argument to `channel` must be a non-negative integer, got -1"},
+		{`spawn(fn() { 1 })`, "`spawn` is only supported by the vm"},
+		{`json_parse("[1, 2]")`, []int{1, 2}},
+		{`json_parse("{\"a\": [true]}")["a"][0] == true`, true},
+		{`if (json_parse("false")) { 1 } else { 2 }`, 2},
+		{`!json_parse("null")`, true},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }})`, `{"b":[1,"x"],"a":null}`},
+		{`json_stringify([1], 1)`, "[\n 1\n]"},
+		{`json_parse(1)`, "argument to `json_parse` must be string, got integer"},
+		{`json_parse("{")`, "json_parse: invalid json: unexpected end of JSON input"},
+		{`json_parse("{\"price\": 1.5}")["price"]`, "1.5"},
+		{`json_stringify(json_parse("[1.5, 2]"))`, `["1.5",2]`},
+		{`json_stringify(fn() { 1 })`, "json_stringify: cannot serialize value of type function"},
+		{`json_stringify([], true)`, "json_stringify: indent must be integer or string, got boolean"},
 	}
 
 	for _, tt := range tests {
@@ -302,6 +370,41 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"${1}"`, "1"},
+		{`let name = "monkey"; "hello ${name}!"`, "hello monkey!"},
+		{`let items = [1, 2]; "you have ${len(items)} items: ${items}"`, "you have 2 items: [1, 2]"},
+		{`"${true} ${if (false) { 1 }} ${"nested ${1 + 1}"}"`, "true null nested 2"},
+		{`"${1 + true}"`, "type mismatch: integer + boolean"},
+		{`"${unknown}"`, "1:4: identifier not found: unknown"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let x: int = 5; x", 5},
+		{"let add = fn(a: int, b: int): int { a + b }; add(1, 2)", 3},
+		{`let apply: fn(fn(string): string, string): string = fn(f, s) { f(s) }; apply(fn(s) { s + "!" }, "hi")`, "hi!"},
+		// 注解不参与求值
+		{`let x: string = 1; x + 1`, 2},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -311,14 +414,14 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
+	if result.Len() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.At(0), 1)
+	testIntegerObject(t, result.At(1), 4)
+	testIntegerObject(t, result.At(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -405,14 +508,15 @@ func TestHashLiterals(t *testing.T) {
 		object.FALSE.HashKey():                     6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Ordered() {
+		key, _ := object.HashKeyOf(pair.Key)
+		expectedValue, ok := expected[key]
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Errorf("unexpected key %s in Pairs", pair.Key.Inspect())
 		}
 
 		testIntegerObject(t, pair.Value, expectedValue)
@@ -465,6 +569,127 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let gen = fn() { yield 1; yield 2; }; collect(gen())`, []int{1, 2}},
+		{`let squares = fn(xs) { for (x in xs) { yield x * x; } }; collect(squares([1, 2, 3]))`, []int{1, 4, 9}},
+		{`let gen = fn(a, b) { yield a; yield b; }; let it = gen(1, 2); next(it); next(it)`, 2},
+		{`let gen = fn() { yield 1; }; let it = gen(); next(it); next(it); next(it)`, nil},
+		{`
+		let upTo = fn(n) {
+			if (n > 0) {
+				for (x in upTo(n - 1)) { yield x; }
+				yield n;
+			}
+		};
+		collect(upTo(4))
+		`, []int{1, 2, 3, 4}},
+		{`let it = iter([1, 2]); next(it); collect(it)`, []int{2}},
+		{`let it = iter("ab"); next(it)`, "a"},
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()`, 20},
+		{`let f = fn() { for (x in []) { x } }; f()`, nil},
+		{`for (x in 1) { x }`, "cannot iterate over integer"},
+		{`let gen = fn() { yield 1; 1 + true }; collect(gen())`, "type mismatch: integer + boolean"},
+		{`next(1)`, "argument to `next` must be iterator, got integer"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if msg, ok := tt.expected.(string); ok {
+			if err, ok := evaluated.(*object.Error); ok {
+				if err.Message != msg {
+					t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, msg, err.Message)
+				}
+				continue
+			}
+		}
+		testObject(t, evaluated, tt.expected)
+	}
+}
+
+// 生成器不使用 goroutine, 提前结束的循环和没有取完的生成器不会留下任何东西
+func TestGeneratorsDoNotLeakGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		input := fmt.Sprintf(`
+		let gen = fn() { yield 1; yield 2; yield 3; };
+		let first = fn() { for (x in gen()) { return x; } };
+		let it = gen();
+		next(it) + first() + %d`, i)
+		testIntegerObject(t, testEval(input), int64(i+2))
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, after)
+	}
+}
+
+func TestHashOrderAndStructuralKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, `{b: 1, a: 2, c: 3}`},
+		{`{3: 1, 1: 2, "b": 3, true: 4, 2: 5}`, `{3: 1, 1: 2, b: 3, true: 4, 2: 5}`},
+		{`{"x": 1, "y": 2, "x": 3}`, `{x: 3, y: 2}`},
+		{`collect({"z": 1, "a": 2, "m": 3})`, `[z, a, m]`},
+		{`{[1, "a"]: "x"}[[1, "a"]]`, `x`},
+		{`{[1, 2]: "x"}[[2, 1]]`, `null`},
+		{`{{"a": 1, "b": [2]}: "x"}[{"b": [2], "a": 1}]`, `x`},
+		{`{[fn() { 1 }]: 1}`, `unusable as hash key: array`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, `true`},
+		{`[1, 2] == [2, 1]`, `false`},
+		{`[1, 2] != [1, 2, 3]`, `true`},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, `true`},
+		{`{"a": 1} == {"a": 2}`, `false`},
+		{`if (false) { 1 } == if (false) { 2 }`, `true`},
+		{`if (false) { 1 } == 0`, `false`},
+		{`1 == "1"`, `false`},
+		{`1 != true`, `true`},
+		{`[1 > 0] == [true]`, `true`},
+		{`let f = fn() { 1 }; [f == f, f == fn() { 1 }]`, `[true, false]`},
+		{`["a" < "b", "b" < "a", "ab" > "a", "a" > "a"]`, `[true, false, true, false]`},
+		{`"a" < 1`, `type mismatch: string < integer`},
+		{`[1] < [2]`, `unknown operator: array < array`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if err, ok := evaluated.(*object.Error); ok {
+			if err.Message != tt.expected {
+				t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func testObject(t *testing.T, evaluated object.Object, expected any) bool {
 	t.Helper()
 
@@ -484,12 +709,12 @@ func testObject(t *testing.T, evaluated object.Object, expected any) bool {
 			t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
 			return false
 		}
-		if len(array.Elements) != len(expected) {
-			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		if array.Len() != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), array.Len())
 			return false
 		}
 		for i, expectedElem := range expected {
-			testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			testIntegerObject(t, array.At(i), int64(expectedElem))
 		}
 		return true
 	default:
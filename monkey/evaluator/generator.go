@@ -0,0 +1,342 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/object"
+)
+
+// generator 是调用生成器函数得到的迭代器. 函数体不在单独的 goroutine 中运行, 而是由 resume 逐步求值:
+// 包含 yield 的节点的求值状态保存在 frames 中, yield 时直接返回, 下次 Next 从保存的位置继续.
+// 不包含 yield 的子树仍然用 Eval 求值. 没有取完的生成器与其他对象一样被回收
+type generator struct {
+	fn   *object.Function
+	args []object.Object
+
+	env    *object.Environment
+	frames []*frame
+	yields map[ast.Node]bool // containsYield 的结果
+
+	started bool
+	running bool
+	done    bool
+}
+
+// frame 是一个包含 yield 的节点的求值状态. pc 是已经开始求值的子节点个数,
+// values 是已经求出的操作数
+type frame struct {
+	node   ast.Node
+	pc     int
+	values []object.Object
+	result object.Object   // 块语句中上一个语句的值
+	it     object.Iterator // for 语句正在遍历的迭代器
+}
+
+// action 是 step 的结果: 求值子节点 child, 产出 value, 或者以 value 结束当前节点
+type action struct {
+	child ast.Node
+	value object.Object
+	yield bool
+}
+
+func newGenerator(fn *object.Function, args []object.Object) *generator {
+	return &generator{fn: fn, args: args}
+}
+
+func (g *generator) Type() object.ObjectType { return object.GENERATOR_OBJ }
+func (g *generator) Inspect() string         { return fmt.Sprintf("Generator[%p]", g) }
+
+func (g *generator) Next() (object.Object, bool, error) {
+	if g.done {
+		return nil, false, nil
+	}
+	if g.running {
+		return nil, false, fmt.Errorf("generator is already running")
+	}
+	if !g.started {
+		g.started = true
+		g.env = extendFunctionEnv(g.fn, g.args)
+		g.frames = []*frame{{node: g.fn.Body}}
+	}
+
+	g.running = true
+	value, yielded := g.resume()
+	g.running = false
+	if yielded {
+		return value, true, nil
+	}
+
+	g.done = true
+	g.env, g.frames, g.yields = nil, nil, nil
+	if err, ok := value.(*object.Error); ok {
+		return nil, false, errors.New(err.Message)
+	}
+	return nil, false, nil
+}
+
+// resume 从保存的位置继续求值函数体, 直到产出一个值或者函数体结束. 结束时返回函数体的值
+func (g *generator) resume() (object.Object, bool) {
+	var value object.Object // 刚求出的子节点的值, 交给栈顶的节点
+	for {
+		a := g.step(g.frames[len(g.frames)-1], value)
+		switch {
+		case a.yield:
+			return a.value, true
+		case a.child != nil && g.containsYield(a.child):
+			g.frames = append(g.frames, &frame{node: a.child})
+			value = nil
+		case a.child != nil:
+			value = Eval(a.child, g.env)
+		default:
+			g.frames = g.frames[:len(g.frames)-1]
+			if len(g.frames) == 0 {
+				return a.value, false
+			}
+			value = a.value
+		}
+	}
+}
+
+// step 把子节点的值 value 交给 f, 返回下一步. 每种节点的处理与 Eval 相同
+func (g *generator) step(f *frame, value object.Object) action {
+	if f.pc > 0 && object.IsError(value) {
+		return action{value: value}
+	}
+
+	switch node := f.node.(type) {
+	case *ast.BlockStatement:
+		if f.pc > 0 {
+			if value != nil && value.Type() == object.RETURN_VALUE_OBJ {
+				return action{value: value}
+			}
+			f.result = value
+		}
+		if f.pc == len(node.Statements) {
+			return action{value: f.result}
+		}
+		f.pc++
+		return action{child: node.Statements[f.pc-1]}
+	case *ast.ExpressionStatement:
+		if f.pc == 0 {
+			f.pc++
+			return action{child: node.Expression}
+		}
+		return action{value: value}
+	case *ast.LetStatement:
+		if f.pc == 0 {
+			f.pc++
+			return action{child: node.Value}
+		}
+		setIdentifier(node.Name, value, g.env)
+		return action{}
+	case *ast.ReturnStatement:
+		if f.pc == 0 {
+			f.pc++
+			return action{child: node.ReturnValue}
+		}
+		return action{value: &object.ReturnValue{Value: value}}
+	case *ast.YieldStatement:
+		switch f.pc {
+		case 0:
+			f.pc++
+			return action{child: node.Value}
+		case 1:
+			f.pc++
+			return action{value: value, yield: true}
+		}
+		return action{}
+	case *ast.ForStatement:
+		switch f.pc {
+		case 0:
+			f.pc++
+			return action{child: node.Iterable}
+		case 1:
+			it, err := object.Iterate(value)
+			if err != nil {
+				return action{value: object.NewError("%s", err)}
+			}
+			f.it = it
+			f.pc++
+		default:
+			if value != nil && value.Type() == object.RETURN_VALUE_OBJ {
+				return action{value: value}
+			}
+		}
+		next, ok, err := f.it.Next()
+		if err != nil {
+			return action{value: object.NewError("%s", err)}
+		}
+		if !ok {
+			return action{}
+		}
+		setIdentifier(node.Variable, next, g.env)
+		return action{child: node.Body}
+	case *ast.IfExpression:
+		switch f.pc {
+		case 0:
+			f.pc++
+			return action{child: node.Condition}
+		case 1:
+			f.pc++
+			if isTruthy(value) {
+				return action{child: node.Consequence}
+			} else if node.Alternative != nil {
+				return action{child: node.Alternative}
+			}
+			return action{value: object.NULL}
+		}
+		return action{value: value}
+	case *ast.PrefixExpression:
+		if f.pc == 0 {
+			f.pc++
+			return action{child: node.Right}
+		}
+		return action{value: evalPrefixExpression(node.Operator, value)}
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return action{value: quote(node.Arguments[0], g.env)}
+		}
+	case *ast.HashLiteral:
+		// 与 evalHashLiteral 一样, 在求值对应的值之前检查键
+		if f.pc%2 == 1 {
+			if _, ok := object.HashKeyOf(value); !ok {
+				return action{value: object.NewError("unusable as hash key: %s", value.Type())}
+			}
+		}
+	}
+
+	// 其余节点依次求值全部操作数, 再与 Eval 一样计算结果
+	if f.pc > 0 {
+		f.values = append(f.values, value)
+	}
+	if operands := operands(f.node); f.pc < len(operands) {
+		f.pc++
+		return action{child: operands[f.pc-1]}
+	}
+	return action{value: combine(f.node, f.values, g.env)}
+}
+
+// operands 返回按求值顺序排列的操作数, 哈希字面量依次是每个键和值
+func operands(node ast.Node) []ast.Expression {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return []ast.Expression{node.Left, node.Right}
+	case *ast.IndexExpression:
+		return []ast.Expression{node.Left, node.Index}
+	case *ast.CallExpression:
+		return append([]ast.Expression{node.Function}, node.Arguments...)
+	case *ast.ArrayLiteral:
+		return node.Elements
+	case *ast.TemplateLiteral:
+		return node.Parts
+	case *ast.HashLiteral:
+		var exprs []ast.Expression
+		for _, key := range node.Keys {
+			exprs = append(exprs, key, node.Pairs[key])
+		}
+		return exprs
+	}
+	return nil
+}
+
+func combine(node ast.Node, values []object.Object, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return evalInfixExpression(node.Operator, values[0], values[1])
+	case *ast.IndexExpression:
+		return evalIndexExpression(values[0], values[1])
+	case *ast.CallExpression:
+		return applyFunction(values[0], values[1:], env)
+	case *ast.ArrayLiteral:
+		return object.NewArray(values)
+	case *ast.TemplateLiteral:
+		return templateString(values)
+	case *ast.HashLiteral:
+		hash := &object.Hash{}
+		for i := 0; i < len(values); i += 2 {
+			key, _ := object.HashKeyOf(values[i])
+			hash = hash.Set(key, object.HashPair{Key: values[i], Value: values[i+1]})
+		}
+		return hash
+	}
+	return object.NewError("unsupported node in generator: %T", node)
+}
+
+// containsYield 判断 node 中是否有属于这个生成器的 yield, 不进入嵌套的函数字面量
+func (g *generator) containsYield(node ast.Node) bool {
+	if contains, ok := g.yields[node]; ok {
+		return contains
+	}
+
+	var children []ast.Node
+	switch node := node.(type) {
+	case *ast.YieldStatement:
+		return true
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			children = append(children, stmt)
+		}
+	case *ast.ExpressionStatement:
+		children = append(children, node.Expression)
+	case *ast.LetStatement:
+		children = append(children, node.Value)
+	case *ast.ReturnStatement:
+		children = append(children, node.ReturnValue)
+	case *ast.ForStatement:
+		children = append(children, node.Iterable, node.Body)
+	case *ast.IfExpression:
+		children = append(children, node.Condition, node.Consequence)
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+	case *ast.PrefixExpression:
+		children = append(children, node.Right)
+	default:
+		for _, operand := range operands(node) {
+			children = append(children, operand)
+		}
+	}
+
+	contains := false
+	for _, child := range children {
+		if g.containsYield(child) {
+			contains = true
+			break
+		}
+	}
+	if g.yields == nil {
+		g.yields = map[ast.Node]bool{}
+	}
+	g.yields[node] = contains
+	return contains
+}
+
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if object.IsError(iterable) {
+		return iterable
+	}
+	it, err := object.Iterate(iterable)
+	if err != nil {
+		return object.NewError("%s", err)
+	}
+
+	for {
+		value, ok, err := it.Next()
+		if err != nil {
+			return object.NewError("%s", err)
+		}
+		if !ok {
+			return nil
+		}
+		setIdentifier(node.Variable, value, env)
+
+		result := evalBlockStatement(node.Body, env)
+		if result != nil {
+			if rt := result.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+}
@@ -88,6 +88,15 @@ func TestExpandMacro(t *testing.T) {
 			`,
 			`if (!(10 > 5)) { print("not greater") } else { print("greater") }`,
 		},
+		{`
+				let nested = macro(a) {
+					let f = fn(x) { fn(y) { fn(z) { quote(unquote(a) * unquote(x + y + z)) } } };
+					f(1)(2)(3)
+				};
+				nested(5 - 1)
+			`,
+			"(5 - 1) * 6",
+		},
 	}
 	for _, tt := range tests {
 		program := testParseProgram(t, tt.input)
@@ -0,0 +1,288 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"strings"
+)
+
+const indent = "\t"
+
+// 与 parser 中的优先级保持一致, 用于决定是否需要补充括号
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+// Source 解析并重新格式化 Monkey 源码. 语法树中没有注释, 含有注释的源码不做格式化
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return "", fmt.Errorf("parse error: %s", strings.Join(errs, "; "))
+	}
+	if l.Comments() != 0 {
+		return "", fmt.Errorf("cannot format source with comments")
+	}
+	return Node(prog), nil
+}
+
+// Node 把语法树打印为规范格式的源码
+func Node(node ast.Node) string {
+	pr := &printer{}
+	pr.node(node)
+	return pr.out.String()
+}
+
+type printer struct {
+	out   bytes.Buffer
+	level int
+}
+
+func (pr *printer) write(s string) {
+	pr.out.WriteString(s)
+}
+
+func (pr *printer) newline() {
+	pr.write("\n")
+	pr.write(strings.Repeat(indent, pr.level))
+}
+
+func (pr *printer) node(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for i, stmt := range node.Statements {
+			if i > 0 {
+				pr.write("\n")
+			}
+			pr.statement(stmt)
+			pr.separate(node.Statements, i)
+		}
+		if len(node.Statements) > 0 {
+			pr.write("\n")
+		}
+	case ast.Statement:
+		pr.statement(node)
+	case ast.Expression:
+		pr.expression(node, lowest)
+	}
+}
+
+func (pr *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.write("let ")
+		pr.write(stmt.Name.Value)
+		pr.typeAnnotation(stmt.Name.Type)
+		pr.write(" = ")
+		pr.expression(stmt.Value, lowest)
+		pr.write(";")
+	case *ast.ReturnStatement:
+		pr.write("return ")
+		pr.expression(stmt.ReturnValue, lowest)
+		pr.write(";")
+	case *ast.YieldStatement:
+		pr.write("yield ")
+		pr.expression(stmt.Value, lowest)
+		pr.write(";")
+	case *ast.ForStatement:
+		pr.write("for (")
+		pr.write(stmt.Variable.Value)
+		pr.write(" in ")
+		pr.expression(stmt.Iterable, lowest)
+		pr.write(") ")
+		pr.block(stmt.Body)
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression, lowest)
+		if _, ok := stmt.Expression.(*ast.IfExpression); !ok {
+			pr.write(";")
+		}
+	}
+}
+
+// separate 在 if 表达式语句后补上分号, 如果下一条语句以 ( [ - 开头,
+// 否则会被解析为对 if 表达式的调用、下标或减法
+func (pr *printer) separate(stmts []ast.Statement, i int) {
+	stmt, ok := stmts[i].(*ast.ExpressionStatement)
+	if !ok || i+1 == len(stmts) {
+		return
+	}
+	if _, ok := stmt.Expression.(*ast.IfExpression); ok && strings.ContainsAny(Node(stmts[i+1])[:1], "([-") {
+		pr.write(";")
+	}
+}
+
+func (pr *printer) block(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		pr.write("{}")
+		return
+	}
+
+	pr.write("{")
+	pr.level++
+	for i, stmt := range block.Statements {
+		pr.newline()
+		pr.statement(stmt)
+		pr.separate(block.Statements, i)
+	}
+	pr.level--
+	pr.newline()
+	pr.write("}")
+}
+
+func (pr *printer) expression(exp ast.Expression, parent int) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		pr.write(exp.Value)
+	case *ast.IntegerLiteral:
+		pr.write(exp.String())
+	case *ast.Boolean:
+		pr.write(exp.String())
+	case *ast.StringLiteral:
+		pr.write(`"`)
+		pr.write(escape(exp.Value))
+		pr.write(`"`)
+	case *ast.TemplateLiteral:
+		pr.write(`"`)
+		for _, part := range exp.Parts {
+			if s, ok := part.(*ast.StringLiteral); ok {
+				pr.write(escape(s.Value))
+				continue
+			}
+			pr.write("${")
+			pr.expression(part, lowest)
+			pr.write("}")
+		}
+		pr.write(`"`)
+	case *ast.PrefixExpression:
+		// 作为下标或调用的左侧时需要括号, 否则 (-a)[0] 会变成 -a[0]
+		if prefix < parent {
+			pr.write("(")
+			defer pr.write(")")
+		}
+		pr.write(exp.Operator)
+		pr.expression(exp.Right, prefix)
+	case *ast.InfixExpression:
+		prec := precedences[exp.Operator]
+		if prec < parent {
+			pr.write("(")
+			defer pr.write(")")
+		}
+		pr.expression(exp.Left, prec)
+		pr.write(" " + exp.Operator + " ")
+		// 运算符左结合, 右侧同级的表达式需要括号
+		pr.expression(exp.Right, prec+1)
+	case *ast.ArrayLiteral:
+		pr.write("[")
+		pr.expressions(exp.Elements)
+		pr.write("]")
+	case *ast.HashLiteral:
+		pr.hash(exp)
+	case *ast.IndexExpression:
+		pr.expression(exp.Left, call)
+		pr.write("[")
+		pr.expression(exp.Index, lowest)
+		pr.write("]")
+	case *ast.CallExpression:
+		pr.expression(exp.Function, call)
+		pr.write("(")
+		pr.expressions(exp.Arguments)
+		pr.write(")")
+	case *ast.IfExpression:
+		pr.write("if (")
+		pr.expression(exp.Condition, lowest)
+		pr.write(") ")
+		pr.block(exp.Consequence)
+		if exp.Alternative != nil {
+			pr.write(" else ")
+			pr.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		pr.write("fn(")
+		pr.identifiers(exp.Parameters)
+		pr.write(")")
+		pr.typeAnnotation(exp.ReturnType)
+		pr.write(" ")
+		pr.block(exp.Body)
+	case *ast.MacroLiteral:
+		pr.write("macro(")
+		pr.identifiers(exp.Parameters)
+		pr.write(") ")
+		pr.block(exp.Body)
+	case *ast.BlockStatement:
+		pr.block(exp)
+	}
+}
+
+func (pr *printer) expressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			pr.write(", ")
+		}
+		pr.expression(exp, lowest)
+	}
+}
+
+func (pr *printer) identifiers(idents []*ast.Identifier) {
+	for i, ident := range idents {
+		if i > 0 {
+			pr.write(", ")
+		}
+		pr.write(ident.Value)
+		pr.typeAnnotation(ident.Type)
+	}
+}
+
+func (pr *printer) typeAnnotation(t ast.TypeExpr) {
+	if t != nil {
+		pr.write(": " + t.String())
+	}
+}
+
+func (pr *printer) hash(hash *ast.HashLiteral) {
+	// 哈希保持插入顺序, 不能重排键
+	pr.write("{")
+	for i, key := range hash.Keys {
+		if i > 0 {
+			pr.write(", ")
+		}
+		pr.expression(key, lowest)
+		pr.write(": ")
+		pr.expression(hash.Pairs[key], lowest)
+	}
+	pr.write("}")
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\t", `\t`,
+	"\r", `\r`,
+	"${", `\${`,
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,95 @@
+package format
+
+import (
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"(1 + 2) * 3; 1 - (2 - 3); (1 - 2) - 3", "(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(1 + 2); !true; -a[0]", "-(1 + 2);\n!true;\n-a[0];\n"},
+		{
+			"let add = fn(a,b){ return a+b; }; add(1, 2)",
+			"let add = fn(a, b) {\n\treturn a + b;\n};\nadd(1, 2);\n",
+		},
+		{
+			"if (x > 1) { if (y) { 1 } } else { 2 }",
+			"if (x > 1) {\n\tif (y) {\n\t\t1;\n\t}\n} else {\n\t2;\n}\n",
+		},
+		{"fn() {}; if (x) {}", "fn() {};\nif (x) {}\n"},
+		{"if (x) { 1 }; [2]; if (x) { 3 }; -4", "if (x) {\n\t1;\n};\n[2];\nif (x) {\n\t3;\n};\n-4;\n"},
+		{`{"b": 2, "a": [1, "x"]}`, "{\"b\": 2, \"a\": [1, \"x\"]};\n"},
+		{`"a\"b\\c\${d}"`, "\"a\\\"b\\\\c\\${d}\";\n"},
+		{`"hi ${name + "!"} ok"`, "\"hi ${name + \"!\"} ok\";\n"},
+		{"let m = macro(a) { quote(unquote(a)) };", "let m = macro(a) {\n\tquote(unquote(a));\n};\n"},
+		{"(fn(x) { x })(1)", "fn(x) {\n\tx;\n}(1);\n"},
+		{
+			"let f:fn(int,[string]):{string:bool}=fn(a:int,b){ {} }",
+			"let f: fn(int, [string]): {string: bool} = fn(a: int, b) {\n\t{};\n};\n",
+		},
+		{"fn(x):int{x}", "fn(x): int {\n\tx;\n};\n"},
+		{
+			"let g = fn(xs){ for(x in xs){ yield x*2 } }",
+			"let g = fn(xs) {\n\tfor (x in xs) {\n\t\tyield x * 2;\n\t}\n};\n",
+		},
+		{"for (c in \"ab\") {}", "for (c in \"ab\") {}\n"},
+		{"(-a)[0]; (!f)(1); -f(1); !(-a)[0]", "(-a)[0];\n(!f)(1);\n-f(1);\n!(-a)[0];\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) error: %s", tt.input, err)
+		}
+		if formatted != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatalf("Source(%q) error: %s", formatted, err)
+		}
+		if again != formatted {
+			t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", formatted, again)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let = 1;")
+	if err == nil {
+		t.Fatalf("expected error for invalid source")
+	}
+}
+
+func TestSourceWithComments(t *testing.T) {
+	if _, err := Source("// 注释会丢失\nlet x = 1;"); err == nil {
+		t.Fatalf("expected error for source with comments")
+	}
+}
+
+// 格式化不能改变程序的含义: 重新解析得到的语法树与原来的相同
+func TestSourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"(-a)[0]", "(!f)(1)", "-a[0]", "!f(1)", "(-f)(1)[2]", "-(-a)", "!(!a)[0]",
+		"(a + b)[0]", "(1 - 2) * -3", "-(a * b)(c)",
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source(input)
+		if err != nil {
+			t.Fatalf("Source(%q) error: %s", input, err)
+		}
+		want := parser.New(lexer.New(input)).ParseProgram().String()
+		got := parser.New(lexer.New(formatted)).ParseProgram().String()
+		if got != want {
+			t.Errorf("Source(%q) = %q changes the program.\nwant=%s\ngot=%s", input, formatted, want, got)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/object"
+	"go-example/monkey/token"
+	"go/format"
+	"strconv"
+	"strings"
+)
+
+// Options 控制生成的 Go 包
+type Options struct {
+	// Package 是生成的包名, 默认为 main. main 包额外包含运行程序的 main 函数,
+	// 可以直接 go build, 也可以用 -buildmode=plugin 构建为 hot_switch 插件
+	Package string
+	// Source 是源文件名, 只用于生成文件开头的注释
+	Source string
+}
+
+// unsupported 是依赖 vm 调度器的内置函数, 生成的代码中没有任务和通道的调度
+var unsupported = map[string]bool{
+	"spawn":  true,
+	"send":   true,
+	"recv":   true,
+	"select": true,
+}
+
+// Generate 把宏已经展开的程序转换为 Go 源码. 生成的代码与 vm 的语义相同:
+// 求值顺序与栈指令一致, 闭包在创建时按值捕获自由变量, 哈希按插入顺序保存键值对.
+// 每个函数字面量生成一个 Go 函数, 局部变量和全局变量按 compiler.Resolve 给出的下标保存在数组中
+func Generate(program *ast.Program, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "main"
+	}
+
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+	if err := compiler.Resolve(program, table); err != nil {
+		return nil, err
+	}
+
+	g := &generator{constantIndex: map[string]int{}, globals: map[int]string{}}
+	main := &function{}
+	for _, stmt := range program.Statements {
+		if v := g.statement(main, stmt); v != "" {
+			main.printf("last = %s", v)
+		}
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	src, err := format.Source(g.file(opts, main))
+	if err != nil {
+		return nil, fmt.Errorf("gogen: formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	constants     []string
+	constantIndex map[string]int
+
+	funcs []*function
+	// globals 是全局变量的下标到名字, 同名变量重新定义时下标不同
+	globals    map[int]string
+	numGlobals int
+
+	err error
+}
+
+// function 是一个正在生成的 Go 函数, 表达式的值依次保存在临时变量中, 保证求值顺序与 vm 相同
+type function struct {
+	out       bytes.Buffer
+	temps     int
+	generator bool
+}
+
+func (f *function) printf(format string, a ...any) {
+	fmt.Fprintf(&f.out, format, a...)
+	f.out.WriteByte('\n')
+}
+
+func (f *function) temp(format string, a ...any) string {
+	name := fmt.Sprintf("t%d", f.temps)
+	f.temps++
+	f.printf("%s := "+format, append([]any{name}, a...)...)
+	return name
+}
+
+func (f *function) declare() string {
+	name := fmt.Sprintf("t%d", f.temps)
+	f.temps++
+	f.printf("var %s object.Object", name)
+	return name
+}
+
+func (g *generator) fail(tok token.Token, format string, a ...any) {
+	if g.err == nil {
+		g.err = fmt.Errorf("%d:%d: %s", tok.Line, tok.Column, fmt.Sprintf(format, a...))
+	}
+}
+
+func (g *generator) constant(expr string) string {
+	index, ok := g.constantIndex[expr]
+	if !ok {
+		index = len(g.constants)
+		g.constants = append(g.constants, expr)
+		g.constantIndex[expr] = index
+	}
+	return fmt.Sprintf("k[%d]", index)
+}
+
+// statements 生成一组语句, 返回最后一个语句的值. 与 blockValue 相同,
+// 最后一个语句不是表达式语句时值为 null
+func (g *generator) statements(f *function, stmts []ast.Statement) string {
+	value := "object.NULL"
+	for i, stmt := range stmts {
+		v := g.statement(f, stmt)
+		switch {
+		case v == "":
+			value = "object.NULL"
+		case i == len(stmts)-1:
+			value = v
+		default:
+			f.printf("_ = %s", v)
+		}
+	}
+	return value
+}
+
+// statement 生成一个语句, 表达式语句返回表达式的值, 其他语句返回空字符串
+func (g *generator) statement(f *function, stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return g.expression(f, stmt.Expression)
+	case *ast.LetStatement:
+		g.store(f, stmt.Name, g.expression(f, stmt.Value))
+	case *ast.ReturnStatement:
+		f.printf("return %s", g.expression(f, stmt.ReturnValue))
+	case *ast.YieldStatement:
+		value := g.expression(f, stmt.Value)
+		if !f.generator {
+			g.fail(stmt.Token, "yield outside generator")
+		}
+		f.printf("yield(%s)", value)
+	case *ast.ForStatement:
+		it := f.temp("rt.Iterate(%s)", g.expression(f, stmt.Iterable))
+		f.printf("for {")
+		value, ok := fmt.Sprintf("t%d", f.temps), fmt.Sprintf("t%d", f.temps+1)
+		f.temps += 2
+		f.printf("%s, %s := rt.Next(%s)", value, ok, it)
+		f.printf("if !%s {\nbreak\n}", ok)
+		g.store(f, stmt.Variable, value)
+		for _, s := range stmt.Body.Statements {
+			if v := g.statement(f, s); v != "" {
+				f.printf("_ = %s", v)
+			}
+		}
+		f.printf("}")
+	}
+	return ""
+}
+
+func (g *generator) store(f *function, ident *ast.Identifier, value string) {
+	switch compiler.SymbolScope(ident.Slot.Scope) {
+	case compiler.GlobalScope:
+		g.globals[ident.Slot.Index] = ident.Value
+		if ident.Slot.Index >= g.numGlobals {
+			g.numGlobals = ident.Slot.Index + 1
+		}
+		f.printf("g[%d] = %s", ident.Slot.Index, value)
+	default:
+		f.printf("l[%d] = %s", ident.Slot.Index, value)
+	}
+}
+
+func (g *generator) load(slot ast.Slot) string {
+	switch compiler.SymbolScope(slot.Scope) {
+	case compiler.GlobalScope:
+		return fmt.Sprintf("g[%d]", slot.Index)
+	case compiler.LocalScope:
+		return fmt.Sprintf("l[%d]", slot.Index)
+	case compiler.BuiltinScope:
+		return fmt.Sprintf("rt.Builtins[%d]", slot.Index)
+	case compiler.FreeScope:
+		return fmt.Sprintf("cl.Free[%d]", slot.Index)
+	default:
+		return "cl"
+	}
+}
+
+var infixFuncs = map[string]string{
+	"+":  "rt.Add",
+	"-":  "rt.Sub",
+	"*":  "rt.Mul",
+	"/":  "rt.Div",
+	">":  "rt.Greater",
+	"==": "rt.Equal",
+	"!=": "rt.NotEqual",
+}
+
+// expression 生成计算 expr 的语句, 返回保存结果的临时变量或常量
+func (g *generator) expression(f *function, expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return g.constant(fmt.Sprintf("&object.Integer{Value: %d}", expr.Value))
+	case *ast.StringLiteral:
+		return g.constant(fmt.Sprintf("&object.String{Value: %s}", strconv.Quote(expr.Value)))
+	case *ast.Boolean:
+		if expr.Value {
+			return "object.True"
+		}
+		return "object.False"
+	case *ast.Identifier:
+		if expr.Slot == nil {
+			g.fail(expr.Token, "undefined variable %s", expr.Value)
+			return "object.NULL"
+		}
+		if expr.Slot.Scope == string(compiler.BuiltinScope) && unsupported[expr.Value] {
+			g.fail(expr.Token, "`%s` is only supported by the vm", expr.Value)
+		}
+		return f.temp("%s", g.load(*expr.Slot))
+	case *ast.PrefixExpression:
+		right := g.expression(f, expr.Right)
+		switch expr.Operator {
+		case "-":
+			return f.temp("rt.Negate(%s)", right)
+		case "!":
+			return f.temp("rt.Bang(%s)", right)
+		}
+		g.fail(expr.Token, "unknown operator %s", expr.Operator)
+	case *ast.InfixExpression:
+		// 与编译器相同, a < b 先求值 b, 再求值 a, 然后比较 b > a
+		if expr.Operator == "<" {
+			right := g.expression(f, expr.Right)
+			left := g.expression(f, expr.Left)
+			return f.temp("rt.Greater(%s, %s)", right, left)
+		}
+		left := g.expression(f, expr.Left)
+		right := g.expression(f, expr.Right)
+		if fn, ok := infixFuncs[expr.Operator]; ok {
+			return f.temp("%s(%s, %s)", fn, left, right)
+		}
+		g.fail(expr.Token, "unknown operator %s", expr.Operator)
+	case *ast.IfExpression:
+		cond := g.expression(f, expr.Condition)
+		result := f.declare()
+		f.printf("if rt.Truthy(%s) {", cond)
+		f.printf("%s = %s", result, g.statements(f, expr.Consequence.Statements))
+		f.printf("} else {")
+		if expr.Alternative != nil {
+			f.printf("%s = %s", result, g.statements(f, expr.Alternative.Statements))
+		} else {
+			f.printf("%s = object.NULL", result)
+		}
+		f.printf("}")
+		return result
+	case *ast.ArrayLiteral:
+		return f.temp("rt.Array(%s)", g.expressions(f, expr.Elements))
+	case *ast.HashLiteral:
+		var elems []ast.Expression
+		for _, key := range expr.Keys {
+			elems = append(elems, key, expr.Pairs[key])
+		}
+		return f.temp("rt.Hash(%s)", g.expressions(f, elems))
+	case *ast.TemplateLiteral:
+		return f.temp("rt.Template(%s)", g.expressions(f, expr.Parts))
+	case *ast.IndexExpression:
+		left := g.expression(f, expr.Left)
+		index := g.expression(f, expr.Index)
+		return f.temp("rt.Index(%s, %s)", left, index)
+	case *ast.CallExpression:
+		callee := g.expression(f, expr.Function)
+		args := g.expressions(f, expr.Arguments)
+		if args != "" {
+			args = ", " + args
+		}
+		return f.temp("program.Call(%s%s)", callee, args)
+	case *ast.FunctionLiteral:
+		// 与 OpClosure 相同, 先在外层函数中取出自由变量的值
+		free := make([]string, len(expr.Free))
+		for i, slot := range expr.Free {
+			free[i] = f.temp("%s", g.load(slot))
+		}
+		name := g.function(expr)
+		args := []string{name, strconv.Itoa(len(expr.Parameters)), strconv.FormatBool(expr.Generator)}
+		return f.temp("rt.NewClosure(%s)", strings.Join(append(args, free...), ", "))
+	case *ast.MacroLiteral:
+		g.fail(expr.Token, "macros must be expanded before generating Go code")
+	default:
+		g.fail(token.Token{}, "unsupported expression %T", expr)
+	}
+	return "object.NULL"
+}
+
+func (g *generator) expressions(f *function, exprs []ast.Expression) string {
+	values := make([]string, len(exprs))
+	for i, expr := range exprs {
+		values[i] = g.expression(f, expr)
+	}
+	return strings.Join(values, ", ")
+}
+
+// function 为函数字面量生成一个 Go 函数, 返回函数名
+func (g *generator) function(fl *ast.FunctionLiteral) string {
+	name := fmt.Sprintf("fn%d", len(g.funcs))
+	f := &function{generator: fl.Generator}
+	g.funcs = append(g.funcs, f)
+
+	if fl.NumLocals > 0 {
+		f.printf("var l [%d]object.Object", fl.NumLocals)
+		f.printf("copy(l[:], args)")
+	}
+	value := g.statements(f, fl.Body.Statements)
+	f.printf("return %s", value)
+	return name
+}
+
+func (g *generator) file(opts Options, main *function) []byte {
+	var out bytes.Buffer
+	w := func(format string, a ...any) {
+		fmt.Fprintf(&out, format, a...)
+		out.WriteByte('\n')
+	}
+
+	source := ""
+	if opts.Source != "" {
+		source = " from " + opts.Source
+	}
+	w("// Code generated by monkey gogen%s. DO NOT EDIT.", source)
+	w("")
+	w("package %s", opts.Package)
+	w("")
+	w("import (")
+	if opts.Package == "main" {
+		w(`"fmt"`)
+		w(`"os"`)
+	}
+	w(`"go-example/monkey/gogen/rt"`)
+	w(`"go-example/monkey/object"`)
+	w(`"io"`)
+	w(")")
+	w("")
+
+	w("var g [%d]object.Object", g.numGlobals)
+	w("")
+	w("var k = [...]object.Object{")
+	for _, c := range g.constants {
+		w("%s,", c)
+	}
+	w("}")
+	w("")
+	// 生成的函数通过 program 调用函数, 在 init 中赋值以避免初始化循环
+	w("var program *rt.Program")
+	w("")
+	w("func init() {")
+	w("program = rt.NewProgram(run, g[:], map[string]int{")
+	for i := 0; i < g.numGlobals; i++ {
+		// 同名变量以最后一次定义为准
+		if name, ok := g.globals[i]; ok && !g.redefined(name, i) {
+			w("%s: %d,", strconv.Quote(name), i)
+		}
+	}
+	w("})")
+	w("}")
+	w("")
+
+	w("// Run 运行程序的顶层语句, 返回最后一个顶层表达式语句的值. 顶层语句只运行一次")
+	w("func Run() (object.Object, error) {")
+	w("return program.Run()")
+	w("}")
+	w("")
+	w("// InvokeFunc 按名字调用全局函数, 与 hot_switch 插件的 InvokeFunc 签名相同")
+	w("func InvokeFunc(name string, params ...any) ([]any, error) {")
+	w("return program.Invoke(name, params...)")
+	w("}")
+	w("")
+	w("// SetOutput 让 print 的输出写入 out 而不是 object.Stdout")
+	w("func SetOutput(out io.Writer) {")
+	w("program.SetOutput(out)")
+	w("}")
+	w("")
+	if opts.Package == "main" {
+		w("func main() {")
+		w("if _, err := Run(); err != nil {")
+		w("fmt.Fprintln(os.Stderr, err)")
+		w("os.Exit(1)")
+		w("}")
+		w("}")
+		w("")
+	}
+
+	w("func run() object.Object {")
+	w("last := object.Object(object.NULL)")
+	out.Write(main.out.Bytes())
+	w("return last")
+	w("}")
+	for i, f := range g.funcs {
+		w("")
+		w("func fn%d(cl *rt.Closure, args []object.Object, yield func(object.Object)) object.Object {", i)
+		out.Write(f.out.Bytes())
+		w("}")
+	}
+	return out.Bytes()
+}
+
+func (g *generator) redefined(name string, index int) bool {
+	for i := index + 1; i < g.numGlobals; i++ {
+		if g.globals[i] == name {
+			return true
+		}
+	}
+	return false
+}
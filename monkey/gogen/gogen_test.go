@@ -0,0 +1,176 @@
+package gogen
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"go-example/monkey/vm"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 与 vm 结果对照的程序, 结果中不能包含闭包等带地址的对象
+var programs = []string{
+	`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+	`let adder = fn(x) { fn(y) { x + y } }; let addTwo = adder(2); [addTwo(1), adder(10)(5)]`,
+	// 自由变量在创建闭包时按值捕获
+	`let f = fn() { let x = 1; let g = fn() { x }; let x = 2; [g(), x] }; f()`,
+	`let x = 1; let g = fn() { x }; let x = 2; [g(), x]`,
+	`let mk = fn() { for (i in [1, 2, 3]) { yield fn() { i * 10 }; } }; let fs = collect(mk()); [fs[0](), fs[2]()]`,
+	`let h = {"a": 1, 2: "two", true: [1, 2], [1, 2]: {"x": 1}};
+	 [h, h["a"], h[2], h[true], h[[1, 2]], h["missing"], h == {true: [1, 2], 2: "two", "a": 1, [1, 2]: {"x": 1}}]`,
+	`let countdown = fn(n) { let loop = fn(k) { if (k == 0) { 0 } else { k + loop(k - 1) } }; loop(n) }; countdown(100)`,
+	`let gen = fn(n) { for (i in [1, 2, 3]) { yield i * n; } }; let g = gen(2); [next(g), collect(g), next(g)]`,
+	`let s = fn(x) { let out = collect(x); for (k in {"b": 1, "a": 2}) { k } [out, collect({"b": 1, "a": 2})] }; s("hé")`,
+	`"sum ${1 + 2} ${[1, "a"]} ${{"k": true}}"`,
+	`[1 < 2, 2 > 1, "a" < "b", [1] == [1], 1 == "1", !0, !if (false) { 1 }, -(-5), 7 / 2, "a" + "b"]`,
+	`let f = fn(a) { if (a > 10) { return "big"; } if (a > 5) { "medium" } else { "small" } }; [f(20), f(7), f(1)]`,
+	`let f = fn() { let x = 1; }; let g = fn() { }; [f(), g(), if (false) { 1 }, [1, 2][5], [1, 2][-1]]`,
+	`json_stringify(json_parse("{\"a\": [1, 2], \"b\": null}"))`,
+	`first(rest([1, 2, 3]))`,
+	`1 + "a"`,
+	`1 < "a"`,
+	`let f = fn(a) { a }; f(1, 2)`,
+	`let f = 5; f()`,
+	`let bad = fn() { yield 1; 1 + true }; collect(bad())`,
+	`let gen = fn() { for (i in [1, 2, 3]) { yield i; } }; let first = fn() { for (x in gen()) { return x; } }; [first(), first()]`,
+}
+
+func runVM(t *testing.T, program *ast.Program) string {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(c.Bytecode())
+	if err := machine.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+	return machine.LastPoppedStackElem().Inspect()
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// TestMatchesVM 把每个程序生成为一个包, 由同一个 main 包依次运行, 与 vm 的结果对照
+func TestMatchesVM(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds generated code with the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	// 生成的代码导入 go-example/monkey/gogen/rt, 临时目录中的模块用 replace 指向当前模块
+	gomod, err := exec.Command(goCmd, "env", "GOMOD").Output()
+	if err != nil {
+		t.Fatalf("go env GOMOD: %s", err)
+	}
+	root := filepath.Dir(strings.TrimSpace(string(gomod)))
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	mod := fmt.Sprintf("module gogentest\n\ngo 1.21\n\nrequire go-example v0.0.0\n\nreplace go-example => %q\n", root)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var imports, calls strings.Builder
+	expected := make([]string, len(programs))
+	for i, input := range programs {
+		expected[i] = runVM(t, parse(t, input))
+
+		pkg := fmt.Sprintf("case%d", i)
+		src, err := Generate(parse(t, input), Options{Package: pkg})
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pkg, pkg+".go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&imports, "%q\n", "gogentest/"+pkg)
+		fmt.Fprintf(&calls, "show(%s.Run())\n", pkg)
+	}
+
+	driver := fmt.Sprintf(`package main
+
+import (
+	"fmt"
+	"go-example/monkey/object"
+	%s
+)
+
+func show(result object.Object, err error) {
+	if err != nil {
+		fmt.Printf("error: %%s\x00", err)
+		return
+	}
+	fmt.Printf("%%s\x00", result.Inspect())
+}
+
+func main() {
+	%s
+}
+`, imports.String(), calls.String())
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(driver), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %s\n%s", err, out)
+	}
+	results := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(results) != len(programs) {
+		t.Fatalf("expected %d results, got %d: %q", len(programs), len(results), out)
+	}
+	for i, got := range results {
+		if got != expected[i] {
+			t.Errorf("%q:\nvm:    %s\ngogen: %s", programs[i], expected[i], got)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let ch = channel(); send(ch, 1)`, "1:21: `send` is only supported by the vm"},
+		{`spawn(fn() { 1 })`, "1:1: `spawn` is only supported by the vm"},
+		{`let x = y;`, "1:9: identifier not found: y"},
+		{`let m = macro(a) { a };`, "1:9: macros must be expanded before generating Go code"},
+	}
+
+	for _, tt := range tests {
+		_, err := Generate(parse(t, tt.input), Options{})
+		if err == nil {
+			t.Errorf("%q: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
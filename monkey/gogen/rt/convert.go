@@ -0,0 +1,114 @@
+package rt
+
+import (
+	"fmt"
+	"go-example/monkey/object"
+	"sort"
+)
+
+// FromGo 把 Invoke 的参数转换为对象, 支持整数、字符串、布尔值、nil、[]any 和 map, 对象原样返回
+func FromGo(v any) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return object.NULL, nil
+	case object.Object:
+		return v, nil
+	case bool:
+		return Bool(v), nil
+	case string:
+		return &object.String{Value: v}, nil
+	case int:
+		return &object.Integer{Value: int64(v)}, nil
+	case int8:
+		return &object.Integer{Value: int64(v)}, nil
+	case int16:
+		return &object.Integer{Value: int64(v)}, nil
+	case int32:
+		return &object.Integer{Value: int64(v)}, nil
+	case int64:
+		return &object.Integer{Value: v}, nil
+	case uint8:
+		return &object.Integer{Value: int64(v)}, nil
+	case uint16:
+		return &object.Integer{Value: int64(v)}, nil
+	case uint32:
+		return &object.Integer{Value: int64(v)}, nil
+	case []any:
+		elems := make([]object.Object, len(v))
+		for i, elem := range v {
+			obj, err := FromGo(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = obj
+		}
+		return object.NewArray(elems), nil
+	case map[string]any:
+		m := make(map[any]any, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return FromGo(m)
+	case map[any]any:
+		// 按键排序, 插入顺序与 Go 的 map 遍历顺序无关
+		keys := make([]any, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+
+		hash := &object.Hash{}
+		for _, key := range keys {
+			value := v[key]
+			k, err := FromGo(key)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := object.HashKeyOf(k)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", k.Type())
+			}
+			val, err := FromGo(value)
+			if err != nil {
+				return nil, err
+			}
+			hash = hash.Set(hashKey, object.HashPair{Key: k, Value: val})
+		}
+		return hash, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a monkey value", v)
+}
+
+// ToGo 把 Invoke 的返回值转换为 Go 的值: 整数为 int64, 数组为 []any, 哈希为 map[any]any,
+// null 为 nil, 函数、迭代器等其他对象原样返回
+func ToGo(obj object.Object) any {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		out := make([]any, obj.Len())
+		for i := range out {
+			out[i] = ToGo(obj.At(i))
+		}
+		return out
+	case *object.Hash:
+		out := make(map[any]any, obj.Len())
+		for _, pair := range obj.Ordered() {
+			// 数组和哈希也可以作为键, 在 Go 中用它们的字符串表示
+			key := ToGo(pair.Key)
+			switch pair.Key.(type) {
+			case *object.Array, *object.Hash:
+				key = pair.Key.Inspect()
+			}
+			out[key] = ToGo(pair.Value)
+		}
+		return out
+	}
+	return obj
+}
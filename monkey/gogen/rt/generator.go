@@ -0,0 +1,120 @@
+package rt
+
+import (
+	"fmt"
+	"go-example/monkey/object"
+	"runtime"
+)
+
+// generator 是返回给程序的句柄. 生成的 Go 函数不能在中途挂起, 所以函数体在单独的
+// goroutine 中运行, 状态保存在 coroutine 中. goroutine 只引用 coroutine,
+// 句柄不可达时由 finalizer 取消挂起的 goroutine
+type generator struct {
+	co *coroutine
+}
+
+// coroutine 的 goroutine 每次 yield 把值交给调用 Next 的一方后挂起, 两边从不同时运行
+type coroutine struct {
+	program *Program
+	cl      *Closure
+	args    []object.Object
+
+	resume chan struct{}
+	cancel chan struct{}
+	values chan object.Object
+	err    error // 在关闭 values 之前写入
+
+	started bool
+	running bool
+	done    bool
+}
+
+// cancelled 是取消时在生成器的 goroutine 中引发的 panic, 由 run 恢复
+type cancelled struct{}
+
+func newGenerator(p *Program, cl *Closure, args []object.Object) *generator {
+	g := &generator{co: &coroutine{
+		program: p,
+		cl:      cl,
+		args:    args,
+		resume:  make(chan struct{}),
+		cancel:  make(chan struct{}),
+		values:  make(chan object.Object),
+	}}
+	runtime.SetFinalizer(g, func(g *generator) { g.co.stop() })
+	return g
+}
+
+func (g *generator) Type() object.ObjectType { return object.GENERATOR_OBJ }
+func (g *generator) Inspect() string         { return fmt.Sprintf("Generator[%p]", g) }
+
+func (g *generator) Next() (object.Object, bool, error) {
+	return g.co.next()
+}
+
+func (co *coroutine) next() (object.Object, bool, error) {
+	if co.done {
+		return nil, false, nil
+	}
+	if co.running {
+		return nil, false, fmt.Errorf("generator is already running")
+	}
+	if !co.started {
+		co.started = true
+		go co.run()
+	}
+
+	co.running = true
+	saved := co.program.depth
+	co.resume <- struct{}{}
+	value, ok := <-co.values
+	co.program.depth = saved
+	co.running = false
+	if !ok {
+		co.done = true
+		return nil, false, co.err
+	}
+	return value, true, nil
+}
+
+// stop 让挂起的 goroutine 退出. 只在句柄不可达之后调用, 此时没有人会再调用 next
+func (co *coroutine) stop() {
+	close(co.cancel)
+}
+
+func (co *coroutine) run() {
+	defer close(co.values)
+	defer func() {
+		// 与 catch 相同, 另外忽略取消
+		switch r := recover().(type) {
+		case nil, cancelled:
+		case *Error:
+			co.err = r
+		default:
+			panic(r)
+		}
+	}()
+	if !co.wait() {
+		return
+	}
+
+	// 与 vm 一样, 生成器有自己的调用帧
+	co.program.depth = 1
+	co.cl.Fn(co.cl, co.args, func(value object.Object) {
+		co.values <- value
+		if !co.wait() {
+			panic(cancelled{})
+		}
+		co.program.depth = 1
+	})
+}
+
+// wait 等待下一次 Next, 取消时返回 false
+func (co *coroutine) wait() bool {
+	select {
+	case <-co.resume:
+		return true
+	case <-co.cancel:
+		return false
+	}
+}
@@ -0,0 +1,355 @@
+package rt
+
+import (
+	"bytes"
+	"fmt"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+	"io"
+	"sync"
+)
+
+// MaxFrames 与 vm.MaxFrames 相同, 调用层数超过它时报告 stack overflow
+const MaxFrames = 1024
+
+// Error 是生成的代码中的运行时错误, 以 panic 的形式向上传递, 由 Program 转换为 error
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func Fail(format string, a ...any) {
+	panic(&Error{Message: fmt.Sprintf(format, a...)})
+}
+
+// catch 把 Error 类型的 panic 写入 err, 其他 panic 继续向上传递
+func catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+// Func 是由函数字面量生成的 Go 函数, 非生成器函数的 yield 为 nil
+type Func func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object
+
+// Closure 对应 vm 中的 *object.Closure, 自由变量在创建时按值捕获
+type Closure struct {
+	Fn            Func
+	NumParameters int
+	Generator     bool
+	Free          []object.Object
+}
+
+func (c *Closure) Type() object.ObjectType { return object.CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+func NewClosure(fn Func, numParameters int, generator bool, free ...object.Object) *Closure {
+	return &Closure{Fn: fn, NumParameters: numParameters, Generator: generator, Free: free}
+}
+
+// Call 调用函数. 出错时 panic 直接中止整个程序, 由 run 和 Invoke 重置调用层数,
+// 所以这里不需要用 defer 恢复
+func (p *Program) Call(callee object.Object, args ...object.Object) object.Object {
+	switch callee := callee.(type) {
+	case *Closure:
+		if len(args) != callee.NumParameters {
+			Fail("wrong number of arguments: want=%d, got=%d", callee.NumParameters, len(args))
+		}
+		if callee.Generator {
+			return newGenerator(p, callee, args)
+		}
+		if p.depth >= MaxFrames {
+			Fail("stack overflow")
+		}
+		p.depth++
+		result := callee.Fn(callee, args, nil)
+		p.depth--
+		return result
+	case *object.Builtin:
+		if result := callee.Call(p.out, args...); result != nil {
+			return result
+		}
+		return object.NULL
+	default:
+		Fail("calling non-function")
+		return nil
+	}
+}
+
+func Bool(b bool) object.Object {
+	if b {
+		return object.True
+	}
+	return object.False
+}
+
+func Truthy(obj object.Object) bool {
+	return object.IsTruthy(obj)
+}
+
+func Bang(obj object.Object) object.Object {
+	return Bool(!object.IsTruthy(obj))
+}
+
+func Negate(obj object.Object) object.Object {
+	i, ok := obj.(*object.Integer)
+	if !ok {
+		Fail("unsupport type for negation: %s", obj.Type())
+	}
+	return &object.Integer{Value: -i.Value}
+}
+
+func Add(left, right object.Object) object.Object { return binary(code.OpAdd, left, right) }
+func Sub(left, right object.Object) object.Object { return binary(code.OpSub, left, right) }
+func Mul(left, right object.Object) object.Object { return binary(code.OpMul, left, right) }
+func Div(left, right object.Object) object.Object { return binary(code.OpDiv, left, right) }
+
+// binary 与 vm 的 binaryOperation 相同, 整数做四则运算, 字符串只支持 +
+func binary(op code.Opcode, left, right object.Object) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		switch op {
+		case code.OpAdd:
+			return &object.Integer{Value: l.Value + r.Value}
+		case code.OpSub:
+			return &object.Integer{Value: l.Value - r.Value}
+		case code.OpMul:
+			return &object.Integer{Value: l.Value * r.Value}
+		default:
+			return &object.Integer{Value: l.Value / r.Value}
+		}
+	}
+
+	ls, lok := left.(*object.String)
+	rs, rok := right.(*object.String)
+	if lok && rok {
+		if op != code.OpAdd {
+			Fail("unknown string operator: %d", op)
+		}
+		return &object.String{Value: ls.Value + rs.Value}
+	}
+	Fail("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+	return nil
+}
+
+func Equal(left, right object.Object) object.Object {
+	return Bool(object.Equal(left, right))
+}
+
+func NotEqual(left, right object.Object) object.Object {
+	return Bool(!object.Equal(left, right))
+}
+
+// Greater 是 > 的语义, 与编译器相同, a < b 生成为 Greater(b, a)
+func Greater(left, right object.Object) object.Object {
+	result, ok := object.Compare(left, right)
+	if !ok {
+		Fail("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+	}
+	return Bool(result > 0)
+}
+
+func Array(elems ...object.Object) object.Object {
+	return object.NewArray(elems)
+}
+
+// Hash 按参数顺序插入键值对, elems 依次是键和值
+func Hash(elems ...object.Object) object.Object {
+	hash := &object.Hash{}
+	for i := 0; i < len(elems); i += 2 {
+		key, ok := object.HashKeyOf(elems[i])
+		if !ok {
+			Fail("unusable as hash key: %s", elems[i].Type())
+		}
+		hash = hash.Set(key, object.HashPair{Key: elems[i], Value: elems[i+1]})
+	}
+	return hash
+}
+
+// Template 拼接模板字符串的各个部分
+func Template(parts ...object.Object) object.Object {
+	var out bytes.Buffer
+	for _, part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
+func Index(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+		if i.Value < 0 || i.Value >= int64(left.Len()) {
+			return object.NULL
+		}
+		return left.At(int(i.Value))
+	case *object.Hash:
+		key, ok := object.HashKeyOf(index)
+		if !ok {
+			Fail("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.Get(key, index)
+		if !ok {
+			return object.NULL
+		}
+		return pair.Value
+	}
+	Fail("index operator not supported: %s", left.Type())
+	return nil
+}
+
+func Iterate(obj object.Object) object.Iterator {
+	it, err := object.Iterate(obj)
+	if err != nil {
+		Fail("%s", err)
+	}
+	return it
+}
+
+// Next 取迭代器的下一个值, 生成器中的运行时错误会中止整个程序
+func Next(it object.Iterator) (object.Object, bool) {
+	value, ok, err := it.Next()
+	if err != nil {
+		Fail("%s", err)
+	}
+	return value, ok
+}
+
+// Builtins 与 object.Builtins 下标相同. next 和 collect 与 vm 一样, 生成器中的错误会中止程序
+var Builtins = make([]object.Object, len(object.Builtins))
+
+func init() {
+	for i, b := range object.Builtins {
+		Builtins[i] = b.Builtin
+		switch b.Name {
+		case "next":
+			Builtins[i] = &object.Builtin{Fn: next}
+		case "collect":
+			Builtins[i] = &object.Builtin{Fn: collect}
+		}
+	}
+}
+
+func next(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	it, ok := args[0].(object.Iterator)
+	if !ok {
+		return object.NewError("argument to `next` must be iterator, got %s", args[0].Type())
+	}
+	value, ok := Next(it)
+	if !ok {
+		return object.NULL
+	}
+	return value
+}
+
+func collect(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return object.NewError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	it, err := object.Iterate(args[0])
+	if err != nil {
+		return object.NewError("argument to `collect` not supported, got %s", args[0].Type())
+	}
+	array, err := object.Collect(it)
+	if err != nil {
+		Fail("%s", err)
+	}
+	return array
+}
+
+// Program 是生成的包中的整个程序. 顶层语句只运行一次, 之后 Invoke 按名字调用全局函数.
+// 所有入口持有同一把锁, 生成的代码不需要考虑并发
+type Program struct {
+	main    func() object.Object
+	globals []object.Object
+	names   map[string]int
+
+	// depth 是当前的调用层数, 生成器运行时也使用所属程序的 depth
+	depth int
+	// out 是 print 的输出目标, 为 nil 时写入 object.Stdout
+	out io.Writer
+
+	mu     sync.Mutex
+	ran    bool
+	result object.Object
+	err    error
+}
+
+func NewProgram(main func() object.Object, globals []object.Object, names map[string]int) *Program {
+	return &Program{main: main, globals: globals, names: names}
+}
+
+// SetOutput 让 print 的输出写入 out 而不是 object.Stdout
+func (p *Program) SetOutput(out io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = out
+}
+
+// Run 运行顶层语句, 返回最后一个顶层表达式语句的值
+func (p *Program) Run() (object.Object, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.run()
+	return p.result, p.err
+}
+
+func (p *Program) run() {
+	if p.ran {
+		return
+	}
+	p.ran = true
+	p.depth = 0
+	func() {
+		defer catch(&p.err)
+		p.result = p.main()
+	}()
+}
+
+// Invoke 调用名为 name 的全局函数, 参数和返回值按 FromGo 和 ToGo 转换.
+// 不是函数的全局变量在没有参数时直接返回它的值
+func (p *Program) Invoke(name string, params ...any) (result []any, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.run(); p.err != nil {
+		return nil, p.err
+	}
+
+	index, ok := p.names[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined global %s", name)
+	}
+	callee := p.globals[index]
+	args := make([]object.Object, len(params))
+	for i, param := range params {
+		if args[i], err = FromGo(param); err != nil {
+			return nil, err
+		}
+	}
+
+	switch callee.(type) {
+	case *Closure, *object.Builtin:
+	default:
+		if len(args) == 0 {
+			return []any{ToGo(callee)}, nil
+		}
+	}
+
+	defer catch(&err)
+	p.depth = 0
+	return []any{ToGo(p.Call(callee, args...))}, nil
+}
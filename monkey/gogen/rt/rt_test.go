@@ -0,0 +1,185 @@
+package rt
+
+import (
+	"bytes"
+	"go-example/monkey/object"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInvoke(t *testing.T) {
+	globals := make([]object.Object, 3)
+	var p *Program
+	main := func() object.Object {
+		globals[0] = NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+			return Hash(args[0], Add(args[1], args[1]))
+		}, 2, false)
+		globals[1] = Array(&object.Integer{Value: 1}, &object.String{Value: "a"}, object.NULL)
+		// 无限递归
+		globals[2] = NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+			return p.Call(cl)
+		}, 0, false)
+		return globals[1]
+	}
+	p = NewProgram(main, globals, map[string]int{"double": 0, "xs": 1, "loop": 2})
+
+	result, err := p.Run()
+	if err != nil || result.Inspect() != "[1, a, null]" {
+		t.Fatalf("wrong result: %v, %v", result, err)
+	}
+
+	tests := []struct {
+		name     string
+		params   []any
+		expected []any
+		err      string
+	}{
+		{"double", []any{"k", 21}, []any{map[any]any{"k": int64(42)}}, ""},
+		{"double", []any{[]any{1, true}, "s"}, []any{map[any]any{"[1, true]": "ss"}}, ""},
+		{"double", []any{&Closure{}, "s"}, nil, "unusable as hash key: closure"},
+		{"xs", nil, []any{[]any{int64(1), "a", nil}}, ""},
+		{"double", []any{1}, nil, "wrong number of arguments: want=2, got=1"},
+		{"xs", []any{1}, nil, "calling non-function"},
+		{"loop", nil, nil, "stack overflow"},
+		{"missing", nil, nil, "undefined global missing"},
+		{"double", []any{1.5, 1}, nil, "cannot convert float64 to a monkey value"},
+	}
+
+	for _, tt := range tests {
+		got, err := p.Invoke(tt.name, tt.params...)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s%v: wrong error. want=%q, got=%v", tt.name, tt.params, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s%v: unexpected error %s", tt.name, tt.params, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s%v: wrong result. want=%#v, got=%#v", tt.name, tt.params, tt.expected, got)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	// 与 vm 一样, 生成器中的运行时错误在取值时报告
+	gen := NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+		yield(args[0])
+		yield(Mul(args[0], args[0]))
+		return Add(args[0], object.True)
+	}, 1, true)
+
+	p := NewProgram(nil, nil, nil)
+	it := p.Call(gen, &object.Integer{Value: 3}).(object.Iterator)
+	for _, want := range []string{"3", "9"} {
+		value, ok, err := it.Next()
+		if err != nil || !ok || value.Inspect() != want {
+			t.Fatalf("wrong value. want=%s, got=%v %v %v", want, value, ok, err)
+		}
+	}
+	if _, _, err := it.Next(); err == nil || err.Error() != "unsupported types for binary operation: integer boolean" {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, ok, err := it.Next(); ok || err != nil {
+		t.Errorf("finished generator returned %v, %v", ok, err)
+	}
+}
+
+func TestGeneratorsDoNotLeakGoroutines(t *testing.T) {
+	gen := NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+		for {
+			yield(args[0])
+		}
+	}, 1, true)
+	p := NewProgram(nil, nil, nil)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		// 取了一部分值之后丢弃的生成器
+		it := p.Call(gen, &object.Integer{Value: int64(i)}).(object.Iterator)
+		if _, _, err := it.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// finalizer 在 GC 之后才运行, goroutine 退出也需要时间
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("leaked %d goroutines", after-before)
+	}
+}
+
+// 调用层数属于各自的 Program, 并发运行的程序互不影响, 用 -race 运行时检查数据竞争
+func TestConcurrentPrograms(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			globals := make([]object.Object, 1)
+			var p *Program
+			p = NewProgram(func() object.Object {
+				// countdown(n) 递归 n 层
+				globals[0] = NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+					if !Truthy(Greater(args[0], &object.Integer{Value: 0})) {
+						return args[0]
+					}
+					return p.Call(cl, Sub(args[0], &object.Integer{Value: 1}))
+				}, 1, false)
+				return object.NULL
+			}, globals, map[string]int{"countdown": 0})
+
+			for j := 0; j < 50; j++ {
+				if _, err := p.Invoke("countdown", MaxFrames-1); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := p.Invoke("countdown", MaxFrames); err == nil || err.Error() != "stack overflow" {
+					t.Errorf("expected stack overflow, got %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// 内置函数通过 Program 调用, print 写入 SetOutput 设置的输出而不是 object.Stdout
+func TestOutput(t *testing.T) {
+	var print object.Object
+	for i, b := range object.Builtins {
+		if b.Name == "print" {
+			print = Builtins[i]
+		}
+	}
+
+	globals := make([]object.Object, 1)
+	var p *Program
+	p = NewProgram(func() object.Object {
+		globals[0] = NewClosure(func(cl *Closure, args []object.Object, yield func(object.Object)) object.Object {
+			return p.Call(print, args[0], Add(args[0], args[0]))
+		}, 1, false)
+		return p.Call(globals[0], &object.Integer{Value: 1})
+	}, globals, map[string]int{"show": 0})
+
+	var out bytes.Buffer
+	p.SetOutput(&out)
+	if result, err := p.Run(); err != nil || result != object.NULL {
+		t.Fatalf("wrong result: %v, %v", result, err)
+	}
+	if _, err := p.Invoke("show", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "1\n2\na\naa\n" {
+		t.Errorf("wrong output: %q", got)
+	}
+}
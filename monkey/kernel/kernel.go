@@ -0,0 +1,293 @@
+package kernel
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"go-example/monkey/session"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type handler func(k *Kernel, req *message) error
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"kernel_info_request": (*Kernel).kernelInfo,
+		"execute_request":     (*Kernel).execute,
+		"complete_request":    (*Kernel).complete,
+		"shutdown_request":    (*Kernel).shutdown,
+	}
+}
+
+// errShutdown 表示收到了不重启的 shutdown_request
+var errShutdown = errors.New("shutdown")
+
+// Kernel 是 Monkey 的 notebook 内核, 多次执行共享同一个 vm 会话
+type Kernel struct {
+	out     io.Writer
+	id      string
+	session *session.Session
+
+	executionCount int
+	nextMsgID      int
+}
+
+func New() *Kernel {
+	return &Kernel{id: "monkey-kernel", session: session.New()}
+}
+
+// Serve 处理来自 in 的消息, 直到收到 shutdown_request 或输入结束.
+// 返回 true 表示内核应当退出, 否则可以继续服务下一个连接.
+func (k *Kernel) Serve(in io.Reader, out io.Writer) (bool, error) {
+	k.out = out
+	r := bufio.NewReader(in)
+
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			// 无法解析的行没有 header, 不能回复, 直接跳过
+			if errors.Is(err, errInvalidMessage) {
+				continue
+			}
+			return false, err
+		}
+
+		h, ok := handlers[msg.Header.MsgType]
+		if !ok {
+			err := k.reply(msg, replyType(msg.Header.MsgType), &errorReply{Status: "error", errorContent: &errorContent{
+				EName:     "UnknownMessage",
+				EValue:    "unknown message type: " + msg.Header.MsgType,
+				Traceback: []string{},
+			}})
+			if err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err := h(k, msg); err != nil {
+			if err == errShutdown {
+				return true, nil
+			}
+			return false, err
+		}
+	}
+}
+
+func replyType(msgType string) string {
+	return strings.TrimSuffix(msgType, "_request") + "_reply"
+}
+
+func (k *Kernel) reply(req *message, msgType string, content any) error {
+	return k.send(channelShell, req, msgType, content)
+}
+
+func (k *Kernel) publish(req *message, msgType string, content any) error {
+	return k.send(channelIOPub, req, msgType, content)
+}
+
+func (k *Kernel) send(channel string, req *message, msgType string, content any) error {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	k.nextMsgID++
+	parent := req.Header
+	return writeMessage(k.out, &message{
+		Channel: channel,
+		Header: header{
+			MsgID:   k.id + "-" + strconv.Itoa(k.nextMsgID),
+			Session: k.id,
+			MsgType: msgType,
+			Version: protocolVersion,
+		},
+		ParentHeader: &parent,
+		Metadata:     map[string]any{},
+		Content:      body,
+	})
+}
+
+func (k *Kernel) kernelInfo(req *message) error {
+	return k.reply(req, "kernel_info_reply", &kernelInfoReply{
+		Status:                "ok",
+		ProtocolVersion:       protocolVersion,
+		Implementation:        "monkey",
+		ImplementationVersion: "0.1",
+		LanguageInfo: languageInfo{
+			Name:          "monkey",
+			MimeType:      "text/x-monkey",
+			FileExtension: ".mk",
+		},
+		Banner: "Monkey",
+	})
+}
+
+func (k *Kernel) shutdown(req *message) error {
+	var params shutdownRequest
+	if err := json.Unmarshal(req.Content, &params); err != nil {
+		return k.reply(req, "shutdown_reply", &shutdownReply{Status: "error"})
+	}
+	if params.Restart {
+		k.session = session.New()
+		k.executionCount = 0
+	}
+	if err := k.reply(req, "shutdown_reply", &shutdownReply{Status: "ok", Restart: params.Restart}); err != nil {
+		return err
+	}
+	if params.Restart {
+		return nil
+	}
+	return errShutdown
+}
+
+// execute 依次发布 busy、execute_input、输出和结果, 回复 execute_reply 后发布 idle
+func (k *Kernel) execute(req *message) error {
+	var params executeRequest
+	if err := json.Unmarshal(req.Content, &params); err != nil {
+		return k.reply(req, "execute_reply", &executeReply{Status: "error", errorContent: &errorContent{
+			EName: "InvalidRequest", EValue: err.Error(), Traceback: []string{},
+		}})
+	}
+
+	if err := k.publish(req, "status", &status{ExecutionState: "busy"}); err != nil {
+		return err
+	}
+	if !params.Silent {
+		k.executionCount++
+		if err := k.publish(req, "execute_input", &executeInput{Code: params.Code, ExecutionCount: k.executionCount}); err != nil {
+			return err
+		}
+	}
+
+	result, errContent := k.run(req, params.Code)
+
+	reply := &executeReply{Status: "ok", ExecutionCount: k.executionCount}
+	switch {
+	case errContent != nil:
+		reply.Status = "error"
+		reply.errorContent = errContent
+		if err := k.publish(req, "error", errContent); err != nil {
+			return err
+		}
+	case result != nil && !params.Silent:
+		err := k.publish(req, "execute_result", &executeResult{
+			ExecutionCount: k.executionCount,
+			Data:           map[string]string{"text/plain": result.Inspect()},
+			Metadata:       map[string]any{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := k.reply(req, "execute_reply", reply); err != nil {
+		return err
+	}
+	return k.publish(req, "status", &status{ExecutionState: "idle"})
+}
+
+// run 在会话中执行代码, print 的输出作为 stream 消息发布
+func (k *Kernel) run(req *message, code string) (object.Object, *errorContent) {
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, &errorContent{EName: "ParseError", EValue: strings.Join(errs, "\n"), Traceback: errs}
+	}
+
+	tx, err := k.session.Compile(program)
+	if err != nil {
+		return nil, &errorContent{EName: "CompileError", EValue: err.Error(), Traceback: strings.Split(err.Error(), "\n")}
+	}
+
+	tx.SetOutput(&streamWriter{k: k, req: req})
+	result, err := tx.Run()
+	if err != nil {
+		return nil, &errorContent{EName: "RuntimeError", EValue: err.Error(), Traceback: []string{err.Error()}}
+	}
+	if !endsWithExpression(program) {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// 只有以表达式结尾的代码才有结果, let 留在栈上的值不算
+func endsWithExpression(program *ast.Program) bool {
+	n := len(program.Statements)
+	if n == 0 {
+		return false
+	}
+	_, ok := program.Statements[n-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+type streamWriter struct {
+	k   *Kernel
+	req *message
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if err := w.k.publish(w.req, "stream", &stream{Name: "stdout", Text: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// complete 补全光标前的标识符, 候选为会话中的全局变量和内置函数
+func (k *Kernel) complete(req *message) error {
+	var params completeRequest
+	if err := json.Unmarshal(req.Content, &params); err != nil {
+		return k.reply(req, "complete_reply", &completeReply{Status: "error", Matches: []string{}})
+	}
+
+	// cursor_pos 按 unicode 字符计数
+	code := []rune(params.Code)
+	end := params.CursorPos
+	if end < 0 || end > len(code) {
+		end = len(code)
+	}
+	start := end
+	for start > 0 && isIdentChar(code[start-1]) {
+		start--
+	}
+	prefix := string(code[start:end])
+
+	seen := make(map[string]bool)
+	matches := []string{}
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	for _, binding := range k.session.Globals() {
+		add(binding.Name)
+	}
+	for _, builtin := range object.Builtins {
+		add(builtin.Name)
+	}
+	sort.Strings(matches)
+
+	return k.reply(req, "complete_reply", &completeReply{
+		Status:      "ok",
+		Matches:     matches,
+		CursorStart: start,
+		CursorEnd:   end,
+		Metadata:    map[string]any{},
+	})
+}
+
+// 与 lexer 的规则一致, 标识符只由字母和下划线组成
+func isIdentChar(ch rune) bool {
+	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+}
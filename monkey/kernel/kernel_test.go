@@ -0,0 +1,241 @@
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func request(msgID, msgType, content string) string {
+	return `{"header": {"msg_id": "` + msgID + `", "session": "client", "msg_type": "` + msgType + `", "version": "5.3"}, "parent_header": {}, "content": ` + content + "}\n"
+}
+
+type reply struct {
+	channel, msgType, parent string
+	content                  map[string]any
+}
+
+func serve(t *testing.T, k *Kernel, input string) ([]reply, bool) {
+	t.Helper()
+	var out bytes.Buffer
+	done, err := k.Serve(strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatalf("Serve failed: %s", err)
+	}
+	return decode(t, &out), done
+}
+
+func decode(t *testing.T, out *bytes.Buffer) []reply {
+	t.Helper()
+	var replies []reply
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid output %q: %s", scanner.Text(), err)
+		}
+		var content map[string]any
+		if err := json.Unmarshal(msg.Content, &content); err != nil {
+			t.Fatalf("invalid content %q: %s", msg.Content, err)
+		}
+		if msg.Header.Session != "monkey-kernel" || msg.Header.Version != protocolVersion {
+			t.Errorf("wrong header: %+v", msg.Header)
+		}
+		replies = append(replies, reply{msg.Channel, msg.Header.MsgType, msg.ParentHeader.MsgID, content})
+	}
+	return replies
+}
+
+func types(replies []reply) string {
+	var names []string
+	for _, r := range replies {
+		names = append(names, r.channel+":"+r.msgType)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestKernelInfo(t *testing.T) {
+	replies, done := serve(t, New(), request("1", "kernel_info_request", "{}"))
+	if done || len(replies) != 1 {
+		t.Fatalf("wrong replies: %+v", replies)
+	}
+	r := replies[0]
+	if r.channel != "shell" || r.msgType != "kernel_info_reply" || r.parent != "1" {
+		t.Errorf("wrong reply: %+v", r)
+	}
+	info := r.content["language_info"].(map[string]any)
+	if info["name"] != "monkey" || info["file_extension"] != ".mk" {
+		t.Errorf("wrong language_info: %v", info)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	k := New()
+	input := request("1", "execute_request", `{"code": "let x = 20; print(\"hi\", x); x + 1"}`) +
+		request("2", "execute_request", `{"code": "let y = 1;"}`) +
+		request("3", "execute_request", `{"code": "x * 2", "silent": true}`)
+	replies, _ := serve(t, k, input)
+
+	want := "iopub:status iopub:execute_input iopub:stream iopub:stream iopub:execute_result shell:execute_reply iopub:status " +
+		"iopub:status iopub:execute_input shell:execute_reply iopub:status " +
+		"iopub:status shell:execute_reply iopub:status"
+	if got := types(replies); got != want {
+		t.Fatalf("wrong messages.\nwant=%s\ngot= %s", want, got)
+	}
+
+	if replies[0].content["execution_state"] != "busy" || replies[6].content["execution_state"] != "idle" {
+		t.Errorf("wrong status messages: %v %v", replies[0].content, replies[6].content)
+	}
+	if replies[2].content["text"] != "hi\n" || replies[3].content["text"] != "20\n" {
+		t.Errorf("wrong stream output: %v %v", replies[2].content, replies[3].content)
+	}
+	result := replies[4].content
+	if result["data"].(map[string]any)["text/plain"] != "21" || result["execution_count"] != 1.0 {
+		t.Errorf("wrong execute_result: %v", result)
+	}
+	if replies[5].content["status"] != "ok" || replies[5].parent != "1" {
+		t.Errorf("wrong execute_reply: %+v", replies[5])
+	}
+	// let 语句没有结果, silent 的执行不增加计数也不发布结果
+	if replies[9].content["execution_count"] != 2.0 || replies[12].content["execution_count"] != 2.0 {
+		t.Errorf("wrong execution counts: %v %v", replies[9].content, replies[12].content)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	tests := []struct {
+		code  string
+		ename string
+		value string
+	}{
+		{`let = 1`, "ParseError", "expected next token to be IDENT"},
+		{`let b = 1; b + c`, "CompileError", "identifier not found: c"},
+		{`let b = 1; b + true`, "RuntimeError", "unsupported types for binary operation"},
+	}
+
+	for _, tt := range tests {
+		k := New()
+		code, _ := json.Marshal(tt.code)
+		input := request("1", "execute_request", `{"code": `+string(code)+`}`) +
+			request("2", "complete_request", `{"code": "b", "cursor_pos": 1}`)
+		replies, _ := serve(t, k, input)
+
+		var errMsg, execReply reply
+		for _, r := range replies {
+			switch r.msgType {
+			case "error":
+				errMsg = r
+			case "execute_reply":
+				execReply = r
+			}
+		}
+		if errMsg.content["ename"] != tt.ename || !strings.Contains(errMsg.content["evalue"].(string), tt.value) {
+			t.Errorf("%s: wrong error: %v", tt.code, errMsg.content)
+		}
+		if execReply.content["status"] != "error" || execReply.content["ename"] != tt.ename {
+			t.Errorf("%s: wrong execute_reply: %v", tt.code, execReply.content)
+		}
+		// 失败的输入不会留下全局变量
+		complete := replies[len(replies)-1].content
+		if matches := complete["matches"].([]any); len(matches) != 0 {
+			t.Errorf("%s: bindings of failed input survived: %v", tt.code, matches)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	k := New()
+	input := request("1", "execute_request", `{"code": "let first_item = 1; let firstly = 2; let other = 3;"}`) +
+		request("2", "complete_request", `{"code": "1 + fir", "cursor_pos": 7}`) +
+		request("3", "complete_request", `{"code": "pu(x)", "cursor_pos": 2}`) +
+		request("4", "complete_request", `{"code": "é + le", "cursor_pos": 6}`)
+	replies, _ := serve(t, k, input)
+	replies = replies[len(replies)-3:]
+
+	tests := []struct {
+		matches    string
+		start, end float64
+	}{
+		{"first first_item firstly", 4, 7},
+		{"push", 0, 2},
+		{"len", 4, 6},
+	}
+	for i, tt := range tests {
+		c := replies[i].content
+		var matches []string
+		for _, m := range c["matches"].([]any) {
+			matches = append(matches, m.(string))
+		}
+		if strings.Join(matches, " ") != tt.matches || c["cursor_start"] != tt.start || c["cursor_end"] != tt.end {
+			t.Errorf("complete %d: wrong reply: %v", i, c)
+		}
+	}
+}
+
+func TestShutdownAndUnknown(t *testing.T) {
+	k := New()
+	input := request("1", "execute_request", `{"code": "let a = 1;"}`) +
+		"not json\n" +
+		request("2", "history_request", "{}") +
+		request("3", "shutdown_request", `{"restart": true}`) +
+		request("4", "complete_request", `{"code": "a", "cursor_pos": 1}`) +
+		request("5", "shutdown_request", `{"restart": false}`) +
+		request("6", "kernel_info_request", "{}")
+	replies, done := serve(t, k, input)
+	if !done {
+		t.Errorf("kernel did not stop after shutdown_request")
+	}
+
+	replies = replies[4:]
+	want := "shell:history_reply shell:shutdown_reply shell:complete_reply shell:shutdown_reply"
+	if got := types(replies); got != want {
+		t.Fatalf("wrong messages.\nwant=%s\ngot= %s", want, got)
+	}
+	if replies[0].content["ename"] != "UnknownMessage" {
+		t.Errorf("wrong reply to unknown message: %v", replies[0].content)
+	}
+	// 重启后会话被清空
+	if matches := replies[2].content["matches"].([]any); len(matches) != 0 {
+		t.Errorf("session survived restart: %v", matches)
+	}
+}
+
+// 同时运行的内核各自把 print 的输出发布到自己的 stream 消息中, 不经过全局的 object.Stdout
+func TestExecuteOutputPerKernel(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	outs := make([]bytes.Buffer, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		i, name := i, name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := `let loop = fn(n) { if (n > 0) { print(\"` + name + `\"); loop(n - 1) } }; loop(500)`
+			_, errs[i] = New().Serve(strings.NewReader(request("1", "execute_request", `{"code": "`+code+`"}`)), &outs[i])
+		}()
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] != nil {
+			t.Fatalf("Serve failed: %s", errs[i])
+		}
+		streams := 0
+		for _, r := range decode(t, &outs[i]) {
+			if r.msgType != "stream" {
+				continue
+			}
+			streams++
+			if r.content["text"] != name+"\n" {
+				t.Fatalf("kernel %s: wrong stream output %v", name, r.content["text"])
+			}
+		}
+		if streams != 500 {
+			t.Errorf("kernel %s: expected 500 stream messages, got %d", name, streams)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const protocolVersion = "5.3"
+
+// 消息按 Jupyter 消息协议组织, 但不使用 ZeroMQ:
+// 每条消息是一行 JSON, channel 字段代替 ZeroMQ 的 shell/iopub 套接字.
+type message struct {
+	Channel      string          `json:"channel,omitempty"`
+	Header       header          `json:"header"`
+	ParentHeader *header         `json:"parent_header"`
+	Metadata     map[string]any  `json:"metadata"`
+	Content      json.RawMessage `json:"content"`
+}
+
+type header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username,omitempty"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+const (
+	channelShell = "shell"
+	channelIOPub = "iopub"
+)
+
+type executeRequest struct {
+	Code   string `json:"code"`
+	Silent bool   `json:"silent"`
+}
+
+type executeReply struct {
+	Status         string `json:"status"`
+	ExecutionCount int    `json:"execution_count"`
+	*errorContent
+}
+
+type errorReply struct {
+	Status string `json:"status"`
+	*errorContent
+}
+
+type errorContent struct {
+	EName     string   `json:"ename"`
+	EValue    string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+}
+
+type executeInput struct {
+	Code           string `json:"code"`
+	ExecutionCount int    `json:"execution_count"`
+}
+
+type executeResult struct {
+	ExecutionCount int               `json:"execution_count"`
+	Data           map[string]string `json:"data"`
+	Metadata       map[string]any    `json:"metadata"`
+}
+
+type stream struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+type status struct {
+	ExecutionState string `json:"execution_state"`
+}
+
+type completeRequest struct {
+	Code      string `json:"code"`
+	CursorPos int    `json:"cursor_pos"`
+}
+
+type completeReply struct {
+	Status      string         `json:"status"`
+	Matches     []string       `json:"matches"`
+	CursorStart int            `json:"cursor_start"`
+	CursorEnd   int            `json:"cursor_end"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+type kernelInfoReply struct {
+	Status                string       `json:"status"`
+	ProtocolVersion       string       `json:"protocol_version"`
+	Implementation        string       `json:"implementation"`
+	ImplementationVersion string       `json:"implementation_version"`
+	LanguageInfo          languageInfo `json:"language_info"`
+	Banner                string       `json:"banner"`
+}
+
+type languageInfo struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	MimeType      string `json:"mimetype"`
+	FileExtension string `json:"file_extension"`
+}
+
+type shutdownRequest struct {
+	Restart bool `json:"restart"`
+}
+
+type shutdownReply struct {
+	Status  string `json:"status"`
+	Restart bool   `json:"restart"`
+}
+
+var errInvalidMessage = errors.New("invalid message")
+
+func readMessage(r *bufio.Reader) (*message, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var msg message
+		if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidMessage, jsonErr)
+		}
+		return &msg, nil
+	}
+}
+
+func writeMessage(w io.Writer, msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -10,15 +10,24 @@ type Lexer struct {
 	position     int  //当前字符
 	readPosition int  //当前字符的下一个字符
 	ch           byte //当前正在查看的字符
+	line         int  //当前字符所在行
+	column       int  //当前字符所在列
+
+	templates []int //每层未结束的模板插值中尚未闭合的 '{' 数量
+	comments  int   //已跳过的注释个数
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -26,6 +35,7 @@ func (l *Lexer) readChar() {
 	}
 	l.position = l.readPosition
 	l.readPosition += 1
+	l.column++
 }
 
 func (l *Lexer) peekChar() byte {
@@ -37,9 +47,18 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespace()
+	line, column := l.line, l.column
+
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -82,16 +101,28 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.templates)
+		if n > 0 && l.templates[n-1] == 0 {
+			// 插值表达式结束, 继续读取模板字符串的下一段
+			l.templates = l.templates[:n-1]
+			tok = l.readStringToken(token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+		} else {
+			if n > 0 {
+				l.templates[n-1]--
+			}
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringToken(token.TEMPLATE_HEAD, token.STRING)
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
@@ -129,21 +160,49 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
+// skipWhitespace 跳过空白和 // 开始到行尾的注释
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.comments++
+			for l.ch != '\n' && l.position < len(l.input) {
+				l.readChar()
+			}
+		default:
+			return
+		}
 	}
 }
 
+// Comments 返回已经跳过的注释个数
+func (l *Lexer) Comments() int {
+	return l.comments
+}
+
 var escapeChMap = map[byte]byte{
 	't':  '\t',
 	'n':  '\n',
 	'"':  '"',
 	'\\': '\\',
 	'r':  '\r',
+	'$':  '$',
+}
+
+func (l *Lexer) readStringToken(interpolated, plain token.TokenType) token.Token {
+	literal, ok := l.readString()
+	if !ok {
+		return token.Token{Type: plain, Literal: literal}
+	}
+	l.templates = append(l.templates, 0)
+	return token.Token{Type: interpolated, Literal: literal}
 }
 
-func (l *Lexer) readString() string {
+// readString 读取字符串字面量, 遇到 "${" 时停在 '{' 上并返回 true,
+// 表示这是模板字符串的一段, 后面紧跟着插值表达式
+func (l *Lexer) readString() (string, bool) {
 	var out bytes.Buffer
 	l.readChar()
 	for {
@@ -155,6 +214,9 @@ func (l *Lexer) readString() string {
 			} else {
 				break
 			}
+		} else if l.ch == '$' && l.peekChar() == '{' {
+			l.readChar()
+			return out.String(), true
 		} else if l.ch != '"' {
 			out.WriteByte(l.ch)
 			l.readChar()
@@ -163,7 +225,7 @@ func (l *Lexer) readString() string {
 			break
 		}
 	}
-	return out.String()
+	return out.String(), false
 }
 
 func isLetter(ch byte) bool {
@@ -220,3 +220,135 @@ func TestStringToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateToken(t *testing.T) {
+	input := `"hello ${name}, you have ${len({"a": "${x}"})} items" "${a}" "\${a}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_HEAD, "hello "},
+		{token.IDENT, "name"},
+		{token.TEMPLATE_MIDDLE, ", you have "},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.RPAREN, ")"},
+		{token.TEMPLATE_TAIL, " items"},
+		{token.TEMPLATE_HEAD, ""},
+		{token.IDENT, "a"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.STRING, "${a}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  \"a ${y}\"\n}"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.TEMPLATE_HEAD, 2, 3},
+		{token.IDENT, 2, 8},
+		{token.TEMPLATE_TAIL, 2, 9},
+		{token.RBRACE, 3, 1},
+		{token.EOF, 3, 2},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong, expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// result: 2\nlet x = 1 / 2; // 行尾注释\n\"// 不是注释\" //"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 2, 1},
+		{token.IDENT, 2, 5},
+		{token.ASSIGN, 2, 7},
+		{token.INT, 2, 9},
+		{token.SLASH, 2, 11},
+		{token.INT, 2, 13},
+		{token.SEMICOLON, 2, 14},
+		{token.STRING, 3, 1},
+		{token.EOF, 3, 21},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong, expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+	if l.Comments() != 3 {
+		t.Errorf("wrong number of comments. want=3, got=%d", l.Comments())
+	}
+}
+
+// FuzzNextToken 检查任意输入都不会让词法分析出错或停不下来
+func FuzzNextToken(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5; let add = fn(x, y) { x + y; };",
+		`"a ${x + "b ${y}"} c" "\"\\\${" "unterminated`,
+		"!-/*5 < > == != [1, 2]: {\"k\": v} for (c in s) { yield c }",
+		"let x: fn(int, [string]): {string: bool} = macro(a) { quote(unquote(a)) };",
+		"\x00\xff é ${ } \"${",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		// 除了模板字符串的片段, 每个词法单元至少消耗一个字节
+		for i := 0; i <= 2*len(input)+1; i++ {
+			if l.NextToken().Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens for %q", 2*len(input)+2, input)
+	})
+}
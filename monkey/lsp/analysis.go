@@ -0,0 +1,204 @@
+package lsp
+
+import (
+	"errors"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"sort"
+)
+
+// analysis 是对一份文档做语法分析和名字解析后的结果
+type analysis struct {
+	program *ast.Program
+	errors  []parser.ParseError // 语法错误, 没有语法错误时为无法解析的标识符
+
+	// 文档中出现的所有标识符(定义和引用), 按出现顺序排列
+	idents []*ast.Identifier
+	// 标识符到其 let/参数 定义处的映射, 定义处映射到自身
+	defs map[*ast.Identifier]*ast.Identifier
+	// 标识符在所处位置被 compiler.SymbolTable 解析出的符号
+	symbols map[*ast.Identifier]compiler.Symbol
+	// 顶层 let 定义的名字
+	globals []*ast.Identifier
+}
+
+type scope struct {
+	table *compiler.SymbolTable
+	defs  map[string]*ast.Identifier
+	outer *scope
+}
+
+func newScope(table *compiler.SymbolTable, outer *scope) *scope {
+	return &scope{table: table, defs: make(map[string]*ast.Identifier), outer: outer}
+}
+
+func (s *scope) lookup(name string) *ast.Identifier {
+	for sc := s; sc != nil; sc = sc.outer {
+		if def, ok := sc.defs[name]; ok {
+			return def
+		}
+	}
+	return nil
+}
+
+func analyze(text string) *analysis {
+	p := parser.New(lexer.New(text))
+	a := &analysis{
+		program: p.ParseProgram(),
+		defs:    make(map[*ast.Identifier]*ast.Identifier),
+		symbols: make(map[*ast.Identifier]compiler.Symbol),
+	}
+	a.errors = p.ParseErrors()
+
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+	if len(a.errors) == 0 {
+		var errs compiler.ResolveErrors
+		if errors.As(compiler.Resolve(a.program, table), &errs) {
+			for _, err := range errs {
+				a.errors = append(a.errors, parser.ParseError{Message: "identifier not found: " + err.Name, Token: err.Token})
+			}
+		}
+	}
+	global := newScope(table, nil)
+	for _, stmt := range a.program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Name != nil {
+			a.globals = append(a.globals, let.Name)
+		}
+		a.walk(stmt, global)
+	}
+
+	sort.SliceStable(a.idents, func(i, j int) bool {
+		ti, tj := a.idents[i].Token, a.idents[j].Token
+		if ti.Line != tj.Line {
+			return ti.Line < tj.Line
+		}
+		return ti.Column < tj.Column
+	})
+	return a
+}
+
+// define 与编译器的行为一致: let 的名字在编译右侧表达式之前就已定义
+func (a *analysis) define(ident *ast.Identifier, sc *scope) {
+	a.symbols[ident] = sc.table.Define(ident.Value)
+	a.defs[ident] = ident
+	a.idents = append(a.idents, ident)
+	sc.defs[ident.Value] = ident
+}
+
+func (a *analysis) resolve(ident *ast.Identifier, sc *scope) {
+	a.idents = append(a.idents, ident)
+	if symbol, ok := sc.table.Resolve(ident.Value); ok {
+		a.symbols[ident] = symbol
+	}
+	if def := sc.lookup(ident.Value); def != nil {
+		a.defs[ident] = def
+	}
+}
+
+func (a *analysis) walk(node ast.Node, sc *scope) {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		if node.Name != nil {
+			a.define(node.Name, sc)
+		}
+		a.walk(node.Value, sc)
+	case *ast.ReturnStatement:
+		a.walk(node.ReturnValue, sc)
+	case *ast.YieldStatement:
+		a.walk(node.Value, sc)
+	case *ast.ForStatement:
+		a.walk(node.Iterable, sc)
+		a.define(node.Variable, sc)
+		a.walk(node.Body, sc)
+	case *ast.ExpressionStatement:
+		a.walk(node.Expression, sc)
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, stmt := range node.Statements {
+			a.walk(stmt, sc)
+		}
+	case *ast.Identifier:
+		if node != nil {
+			a.resolve(node, sc)
+		}
+	case *ast.PrefixExpression:
+		a.walk(node.Right, sc)
+	case *ast.InfixExpression:
+		a.walk(node.Left, sc)
+		a.walk(node.Right, sc)
+	case *ast.IfExpression:
+		a.walk(node.Condition, sc)
+		a.walk(node.Consequence, sc)
+		if node.Alternative != nil {
+			a.walk(node.Alternative, sc)
+		}
+	case *ast.FunctionLiteral:
+		inner := newScope(compiler.NewEnclosedSymbolTable(sc.table), sc)
+		if node.Name != "" {
+			inner.table.DefineFunctionName(node.Name)
+			if def := sc.lookup(node.Name); def != nil {
+				inner.defs[node.Name] = def
+			}
+		}
+		for _, param := range node.Parameters {
+			a.define(param, inner)
+		}
+		a.walk(node.Body, inner)
+	case *ast.MacroLiteral:
+		inner := newScope(compiler.NewEnclosedSymbolTable(sc.table), sc)
+		for _, param := range node.Parameters {
+			a.define(param, inner)
+		}
+		a.walk(node.Body, inner)
+	case *ast.CallExpression:
+		a.walk(node.Function, sc)
+		for _, arg := range node.Arguments {
+			a.walk(arg, sc)
+		}
+	case *ast.IndexExpression:
+		a.walk(node.Left, sc)
+		a.walk(node.Index, sc)
+	case *ast.ArrayLiteral:
+		for _, elem := range node.Elements {
+			a.walk(elem, sc)
+		}
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			a.walk(key, sc)
+			a.walk(node.Pairs[key], sc)
+		}
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			a.walk(part, sc)
+		}
+	}
+}
+
+// identAt 返回覆盖 (line, column) 的标识符, 行列均从 1 开始
+func (a *analysis) identAt(line, column int) *ast.Identifier {
+	for _, ident := range a.idents {
+		tok := ident.Token
+		if tok.Line == line && tok.Column <= column && column <= tok.Column+len(ident.Value) {
+			return ident
+		}
+	}
+	return nil
+}
+
+func (a *analysis) references(def *ast.Identifier) []*ast.Identifier {
+	var refs []*ast.Identifier
+	for _, ident := range a.idents {
+		if a.defs[ident] == def {
+			refs = append(refs, ident)
+		}
+	}
+	return refs
+}
@@ -0,0 +1,89 @@
+package lsp
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// document 是客户端打开的一份 .mk 文件
+type document struct {
+	uri      string
+	text     string
+	lines    []string
+	analysis *analysis
+}
+
+func newDocument(uri, text string) *document {
+	return &document{
+		uri:      uri,
+		text:     text,
+		lines:    strings.Split(text, "\n"),
+		analysis: analyze(text),
+	}
+}
+
+// position 把词法单元的 行/字节列(从 1 开始) 转换为 LSP 的 行/UTF-16 列(从 0 开始)
+func (d *document) position(line, column int) Position {
+	pos := Position{Line: line - 1}
+	if line < 1 || line > len(d.lines) {
+		return pos
+	}
+	text := d.lines[line-1]
+	offset := column - 1
+	if offset > len(text) {
+		offset = len(text)
+	}
+	for _, r := range text[:max(offset, 0)] {
+		pos.Character += utf16Len(r)
+	}
+	return pos
+}
+
+// column 是 position 的逆运算, 返回从 1 开始的行和字节列
+func (d *document) column(pos Position) (int, int) {
+	line := pos.Line + 1
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return line, 1
+	}
+	units := 0
+	for offset, r := range d.lines[pos.Line] {
+		if units >= pos.Character {
+			return line, offset + 1
+		}
+		units += utf16Len(r)
+	}
+	return line, len(d.lines[pos.Line]) + 1
+}
+
+func (d *document) tokenRange(tok token.Token, length int) Range {
+	return Range{
+		Start: d.position(tok.Line, tok.Column),
+		End:   d.position(tok.Line, tok.Column+length),
+	}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	return d.tokenRange(ident.Token, len(ident.Value))
+}
+
+func (d *document) fullRange() Range {
+	last := len(d.lines)
+	return Range{
+		Start: Position{},
+		End:   d.position(last, len(d.lines[last-1])+1),
+	}
+}
+
+func (d *document) identAt(pos Position) *ast.Identifier {
+	line, column := d.column(pos)
+	return d.analysis.identAt(line, column)
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 && utf8.ValidRune(r) {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-example/monkey/compiler"
+	"go-example/monkey/format"
+	"go-example/monkey/object"
+	"io"
+	"sync"
+)
+
+type handler func(s *Server, params json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"initialize":              (*Server).initialize,
+	"initialized":             nop,
+	"shutdown":                (*Server).shutdown,
+	"textDocument/didOpen":    (*Server).didOpen,
+	"textDocument/didChange":  (*Server).didChange,
+	"textDocument/didClose":   (*Server).didClose,
+	"textDocument/definition": (*Server).definition,
+	"textDocument/references": (*Server).references,
+	"textDocument/hover":      (*Server).hover,
+	"textDocument/completion": (*Server).completion,
+	"textDocument/formatting": (*Server).formatting,
+}
+
+func nop(*Server, json.RawMessage) (any, error) { return nil, nil }
+
+// Server 是 Monkey 语言服务器, 通过 stdio 上的 JSON-RPC 与编辑器通信
+type Server struct {
+	out  io.Writer
+	mu   sync.Mutex // 保护 out 上的写入
+	docs map[string]*document
+
+	shuttingDown bool
+}
+
+func NewServer() *Server {
+	return &Server{docs: make(map[string]*document)}
+}
+
+// Serve 处理来自 in 的消息直到收到 exit 通知或输入结束
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var rpcErr *ResponseError
+			if errors.As(err, &rpcErr) {
+				s.replyError(nil, rpcErr)
+				continue
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shuttingDown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *Server) handle(msg *message) {
+	h, ok := handlers[msg.Method]
+	if !ok {
+		if msg.isRequest() {
+			s.replyError(msg.ID, &ResponseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+		}
+		return
+	}
+	if !msg.isRequest() && !msg.isNotification() {
+		s.replyError(msg.ID, &ResponseError{Code: codeInvalidRequest, Message: "invalid request"})
+		return
+	}
+
+	result, err := h(s, msg.Params)
+	if msg.isNotification() {
+		return
+	}
+	if err != nil {
+		var rpcErr *ResponseError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &ResponseError{Code: codeInternalError, Message: err.Error()}
+		}
+		s.replyError(msg.ID, rpcErr)
+		return
+	}
+	s.write(&response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *ResponseError) {
+	s.write(&errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (s *Server) notify(method string, params any) {
+	body, _ := json.Marshal(params)
+	s.write(&message{JSONRPC: "2.0", Method: method, Params: body})
+}
+
+func (s *Server) write(v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = writeMessage(s.out, v)
+}
+
+func unmarshalParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &ResponseError{Code: codeInvalidParams, Message: "unknown document: " + uri}
+	}
+	return doc, nil
+}
+
+func (s *Server) initialize(json.RawMessage) (any, error) {
+	result := InitializeResult{}
+	result.Capabilities.TextDocumentSync = 1 // 全量同步
+	result.Capabilities.DefinitionProvider = true
+	result.Capabilities.ReferencesProvider = true
+	result.Capabilities.HoverProvider = true
+	result.Capabilities.DocumentFormattingProvider = true
+	result.ServerInfo.Name = "monkey-lsp"
+	return result, nil
+}
+
+func (s *Server) shutdown(json.RawMessage) (any, error) {
+	s.shuttingDown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (any, error) {
+	var p DidOpenTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	s.open(p.TextDocument.URI, p.TextDocument.Text)
+	return nil, nil
+}
+
+func (s *Server) didChange(params json.RawMessage) (any, error) {
+	var p DidChangeTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	if n := len(p.ContentChanges); n > 0 {
+		s.open(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+	}
+	return nil, nil
+}
+
+func (s *Server) didClose(params json.RawMessage) (any, error) {
+	var p DidCloseTextDocumentParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	return nil, nil
+}
+
+func (s *Server) open(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+
+	diagnostics := []Diagnostic{}
+	for _, err := range doc.analysis.errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.tokenRange(err.Token, max(len(err.Token.Literal), 1)),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  err.Message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) definition(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := doc.identAt(p.Position)
+	if ident == nil {
+		return nil, nil
+	}
+	def, ok := doc.analysis.defs[ident]
+	if !ok {
+		return nil, nil
+	}
+	return Location{URI: doc.uri, Range: doc.identRange(def)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (any, error) {
+	var p ReferenceParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []Location{}
+	ident := doc.identAt(p.Position)
+	if ident == nil {
+		return locations, nil
+	}
+	def, ok := doc.analysis.defs[ident]
+	if !ok {
+		return locations, nil
+	}
+	for _, ref := range doc.analysis.references(def) {
+		if ref == def && !p.Context.IncludeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: doc.uri, Range: doc.identRange(ref)})
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := doc.identAt(p.Position)
+	if ident == nil {
+		return nil, nil
+	}
+	symbol, ok := doc.analysis.symbols[ident]
+	if !ok {
+		return nil, nil
+	}
+
+	var value string
+	switch symbol.Scope {
+	case compiler.BuiltinScope, compiler.FunctionScope:
+		value = fmt.Sprintf("**%s**: %s", symbol.Name, symbol.Scope)
+	default:
+		value = fmt.Sprintf("**%s**: %s (index %d)", symbol.Name, symbol.Scope, symbol.Index)
+	}
+	r := doc.identRange(ident)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}, nil
+}
+
+func (s *Server) completion(params json.RawMessage) (any, error) {
+	var p TextDocumentPositionParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []CompletionItem{}
+	for _, builtin := range object.Builtins {
+		items = append(items, CompletionItem{Label: builtin.Name, Kind: CompletionFunction, Detail: "builtin"})
+	}
+	seen := make(map[string]bool)
+	for _, global := range doc.analysis.globals {
+		if seen[global.Value] {
+			continue
+		}
+		seen[global.Value] = true
+		items = append(items, CompletionItem{Label: global.Value, Kind: CompletionVariable, Detail: "global"})
+	}
+	return items, nil
+}
+
+func (s *Server) formatting(params json.RawMessage) (any, error) {
+	var p DocumentFormattingParams
+	if err := unmarshalParams(params, &p); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := format.Source(doc.text)
+	if err != nil || formatted == doc.text {
+		// 存在语法错误时不做格式化, 错误已经通过诊断信息上报
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{Range: doc.fullRange(), NewText: formatted}}, nil
+}
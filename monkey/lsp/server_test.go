@@ -0,0 +1,321 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+)
+
+const testURI = "file:///test.mk"
+
+// fakeClient 在进程内通过管道与 Server 通信
+type fakeClient struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	nextID int
+	done   chan error
+
+	notifications []*message
+}
+
+func newFakeClient(t *testing.T) *fakeClient {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &fakeClient{t: t, w: clientOut, r: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer().Serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	c.call("initialize", map[string]any{}, nil)
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *fakeClient) notify(method string, params any) {
+	c.t.Helper()
+	body, _ := json.Marshal(params)
+	if err := writeMessage(c.w, &message{JSONRPC: "2.0", Method: method, Params: body}); err != nil {
+		c.t.Fatalf("write %s: %s", method, err)
+	}
+}
+
+func (c *fakeClient) call(method string, params any, result any) *ResponseError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	body, _ := json.Marshal(params)
+	if err := writeMessage(c.w, &message{JSONRPC: "2.0", ID: &id, Method: method, Params: body}); err != nil {
+		c.t.Fatalf("write %s: %s", method, err)
+	}
+
+	for {
+		msg := c.read()
+		if msg.isNotification() {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("unexpected response id %s, want %s", *msg.ID, id)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("decode %s result: %s", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *fakeClient) read() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("read message: %s", err)
+	}
+	return msg
+}
+
+// diagnostics 返回下一条 publishDiagnostics 通知
+func (c *fakeClient) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	var msg *message
+	if len(c.notifications) > 0 {
+		msg, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		msg = c.read()
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected publishDiagnostics, got %q", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatalf("decode diagnostics: %s", err)
+	}
+	return params
+}
+
+func (c *fakeClient) open(text string) {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "monkey", Version: 1, Text: text},
+	})
+}
+
+func (c *fakeClient) close() {
+	c.t.Helper()
+	c.call("shutdown", nil, nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("server error: %s", err)
+	}
+}
+
+func at(line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+const program = `let total = 10;
+let add = fn(a, b) {
+	let sum = a + b;
+	fn() { sum + total }
+};
+add(1, len("ab"));
+`
+
+func TestDiagnostics(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+
+	c.open("let x = ;\nlet = 1;")
+	diags := c.diagnostics()
+	if diags.URI != testURI {
+		t.Errorf("wrong uri. want=%q, got=%q", testURI, diags.URI)
+	}
+	if len(diags.Diagnostics) != 3 {
+		t.Fatalf("wrong number of diagnostics. want=3, got=%d (%+v)", len(diags.Diagnostics), diags.Diagnostics)
+	}
+	first := diags.Diagnostics[0]
+	if first.Message != "no prefix parse function for ';' found." {
+		t.Errorf("wrong message: %q", first.Message)
+	}
+	if first.Range.Start != (Position{Line: 0, Character: 8}) {
+		t.Errorf("wrong range start: %+v", first.Range.Start)
+	}
+	if second := diags.Diagnostics[1]; second.Range.Start != (Position{Line: 1, Character: 4}) {
+		t.Errorf("wrong range start: %+v", second.Range.Start)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: program}},
+	})
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", diags.Diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = y;\nfn() { z }"}},
+	})
+	diags = c.diagnostics()
+	if len(diags.Diagnostics) != 2 {
+		t.Fatalf("wrong number of diagnostics. want=2, got=%d (%+v)", len(diags.Diagnostics), diags.Diagnostics)
+	}
+	if d := diags.Diagnostics[1]; d.Message != "identifier not found: z" || d.Range.Start != (Position{Line: 1, Character: 7}) {
+		t.Errorf("wrong diagnostic: %+v", d)
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+	c.open(program)
+	c.diagnostics()
+
+	tests := []struct {
+		line, character int
+		want            Range
+	}{
+		// sum + total 中的 sum
+		{3, 8, Range{Position{2, 5}, Position{2, 8}}},
+		// sum + total 中的 total
+		{3, 15, Range{Position{0, 4}, Position{0, 9}}},
+		// a + b 中的 b
+		{2, 15, Range{Position{1, 16}, Position{1, 17}}},
+		// 定义处本身
+		{5, 0, Range{Position{1, 4}, Position{1, 7}}},
+	}
+	for _, tt := range tests {
+		var loc *Location
+		c.call("textDocument/definition", at(tt.line, tt.character), &loc)
+		if loc == nil {
+			t.Errorf("no definition at %d:%d", tt.line, tt.character)
+			continue
+		}
+		if loc.URI != testURI || loc.Range != tt.want {
+			t.Errorf("wrong definition at %d:%d. want=%+v, got=%+v", tt.line, tt.character, tt.want, loc.Range)
+		}
+	}
+
+	var loc *Location
+	c.call("textDocument/definition", at(5, 10), &loc)
+	if loc != nil {
+		t.Errorf("builtin should have no definition, got %+v", loc)
+	}
+
+	params := ReferenceParams{TextDocumentPositionParams: at(0, 6)}
+	params.Context.IncludeDeclaration = true
+	var refs []Location
+	c.call("textDocument/references", params, &refs)
+	if len(refs) != 2 {
+		t.Fatalf("wrong number of references. want=2, got=%d", len(refs))
+	}
+	if refs[1].Range.Start != (Position{Line: 3, Character: 14}) {
+		t.Errorf("wrong reference: %+v", refs[1].Range)
+	}
+
+	params.Context.IncludeDeclaration = false
+	c.call("textDocument/references", params, &refs)
+	if len(refs) != 1 {
+		t.Fatalf("wrong number of references. want=1, got=%d", len(refs))
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+	c.open(program)
+	c.diagnostics()
+
+	tests := []struct {
+		line, character int
+		want            string
+	}{
+		{0, 5, "**total**: Global (index 0)"},
+		{2, 12, "**a**: Local (index 0)"},
+		{3, 8, "**sum**: Free (index 0)"},
+		{3, 15, "**total**: Global (index 0)"},
+		{5, 9, "**len**: Builtin"},
+	}
+	for _, tt := range tests {
+		var hover *Hover
+		c.call("textDocument/hover", at(tt.line, tt.character), &hover)
+		if hover == nil {
+			t.Errorf("no hover at %d:%d", tt.line, tt.character)
+			continue
+		}
+		if hover.Contents.Value != tt.want {
+			t.Errorf("wrong hover at %d:%d. want=%q, got=%q", tt.line, tt.character, tt.want, hover.Contents.Value)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+	c.open(program)
+	c.diagnostics()
+
+	var items []CompletionItem
+	c.call("textDocument/completion", at(5, 0), &items)
+
+	labels := make(map[string]CompletionItemKind)
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	for _, name := range []string{"len", "push", "first", "last", "rest", "print"} {
+		if labels[name] != CompletionFunction {
+			t.Errorf("missing builtin completion %q", name)
+		}
+	}
+	for _, name := range []string{"total", "add"} {
+		if labels[name] != CompletionVariable {
+			t.Errorf("missing global completion %q", name)
+		}
+	}
+	if _, ok := labels["sum"]; ok {
+		t.Errorf("local binding should not be completed at top level")
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+	c.open("let  x=1+2;\nx")
+	c.diagnostics()
+
+	var edits []TextEdit
+	c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &edits)
+	if len(edits) != 1 {
+		t.Fatalf("wrong number of edits. want=1, got=%d", len(edits))
+	}
+	if edits[0].NewText != "let x = 1 + 2;\nx;\n" {
+		t.Errorf("wrong formatted text: %q", edits[0].NewText)
+	}
+	if edits[0].Range.End != (Position{Line: 1, Character: 1}) {
+		t.Errorf("wrong edit range: %+v", edits[0].Range)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	c := newFakeClient(t)
+	defer c.close()
+
+	err := c.call("workspace/unknown", nil, nil)
+	if err == nil || err.Code != codeMethodNotFound {
+		t.Fatalf("expected method not found error, got %v", err)
+	}
+}
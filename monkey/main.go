@@ -1,13 +1,54 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/conformance"
+	"go-example/monkey/evaluator"
+	"go-example/monkey/gogen"
+	"go-example/monkey/kernel"
+	"go-example/monkey/lexer"
+	"go-example/monkey/lsp"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
 	"go-example/monkey/repl"
+	"go-example/monkey/types"
+	"go-example/monkey/vet"
+	"go-example/monkey/wasm"
+	"net"
 	"os"
 	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lsp":
+			if err := lsp.NewServer().Serve(os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "monkey lsp: %s\n", err)
+				os.Exit(1)
+			}
+			return
+		case "vet":
+			os.Exit(runVet(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "kernel":
+			os.Exit(runKernel(os.Args[2:]))
+		case "gogen":
+			os.Exit(runGogen(os.Args[2:]))
+		case "wasm":
+			os.Exit(runWasm(os.Args[2:]))
+		case "conformance":
+			os.Exit(runConformance(os.Args[2:]))
+		}
+	}
+
 	u, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,3 +57,282 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// runVet 实现 `monkey vet [-disable=rule,...] file.mk...`
+// 没有问题时返回 0, 发现问题时返回 1, 出错时返回 2
+func runVet(args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	disable := fs.String("disable", "", "comma-separated list of rules to disable")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: monkey vet [-disable=rule,...] file.mk...\n\nrules:\n")
+		for _, rule := range vet.Rules {
+			fmt.Fprintf(fs.Output(), "  %-14s %s\n", rule.Name, rule.Doc)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	disabled, err := vet.ParseRules(*disable)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey vet: %s\n", err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, file := range fs.Args() {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey vet: %s\n", err)
+			return 2
+		}
+
+		p := parser.New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) != 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", file, e.Token.Line, e.Token.Column, e.Message)
+			}
+			return 2
+		}
+
+		for _, d := range vet.Check(program, vet.Config{Disabled: disabled}) {
+			fmt.Printf("%s:%s\n", file, d)
+			status = 1
+		}
+	}
+	return status
+}
+
+// runCheck 实现 `monkey check file.mk...`, 对带类型注解的程序做静态类型检查
+// 没有问题时返回 0, 发现类型错误时返回 1, 出错时返回 2
+func runCheck(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: monkey check file.mk...\n")
+		return 2
+	}
+
+	status := 0
+	for _, file := range args {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey check: %s\n", err)
+			return 2
+		}
+
+		p := parser.New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		if errs := p.ParseErrors(); len(errs) != 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", file, e.Token.Line, e.Token.Column, e.Message)
+			}
+			return 2
+		}
+
+		for _, err := range types.Check(program) {
+			fmt.Printf("%s:%s\n", file, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// runKernel 实现 `monkey kernel [-listen addr]`, 默认通过 stdio 通信.
+// 使用 TCP 时依次接受连接, 所有连接共享同一个会话, 直到收到 shutdown_request
+func runKernel(args []string) int {
+	fs := flag.NewFlagSet("kernel", flag.ContinueOnError)
+	listen := fs.String("listen", "", "serve on a TCP address instead of stdio, e.g. 127.0.0.1:9100")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	k := kernel.New()
+	if *listen == "" {
+		if _, err := k.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+		return 1
+	}
+	defer ln.Close()
+	fmt.Fprintf(os.Stderr, "monkey kernel listening on %s\n", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+			return 1
+		}
+		done, err := k.Serve(conn, conn)
+		conn.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+		}
+		if done {
+			return 0
+		}
+	}
+}
+
+// runGogen 实现 `monkey gogen [-o out.go] [-pkg name] file.mk`, 把程序转换为 Go 源码.
+// 默认生成可以直接 go build 的 main 包, 也可以构建为 hot_switch 插件
+func runGogen(args []string) int {
+	fs := flag.NewFlagSet("gogen", flag.ContinueOnError)
+	out := fs.String("o", "", "write the generated code to this file instead of stdout")
+	pkg := fs.String("pkg", "main", "name of the generated package")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: monkey gogen [-o out.go] [-pkg name] file.mk\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	file := fs.Arg(0)
+	expanded, ok := loadExpanded("gogen", file)
+	if !ok {
+		return 2
+	}
+
+	code, err := gogen.Generate(expanded, gogen.Options{Package: *pkg, Source: filepath.Base(file)})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+		return 1
+	}
+	if *out == "" {
+		os.Stdout.Write(code)
+		return 0
+	}
+	if err := os.WriteFile(*out, code, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey gogen: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loadExpanded 读取并解析 file, 展开其中的宏, 出错时把错误写到 stderr
+func loadExpanded(cmd, file string) (*ast.Program, bool) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey %s: %s\n", cmd, err)
+		return nil, false
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.ParseErrors(); len(errs) != 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", file, e.Token.Line, e.Token.Column, e.Message)
+		}
+		return nil, false
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv).(*ast.Program), true
+}
+
+// runWasm 实现 `monkey wasm [-o out.wasm] [-run] file.mk`, 把程序编译为 WebAssembly 模块.
+// 默认写入与源文件同名的 .wasm 文件, -run 时不写文件, 直接用 wazero 运行并输出结果
+func runWasm(args []string) int {
+	fs := flag.NewFlagSet("wasm", flag.ContinueOnError)
+	out := fs.String("o", "", "write the module to this file instead of file.wasm")
+	run := fs.Bool("run", false, "run the module instead of writing it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: monkey wasm [-o out.wasm] [-run] file.mk\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	file := fs.Arg(0)
+	expanded, ok := loadExpanded("wasm", file)
+	if !ok {
+		return 2
+	}
+	module, err := wasm.Compile(expanded)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+		return 1
+	}
+
+	if *run {
+		result, err := wasm.Run(context.Background(), module, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			return 1
+		}
+		fmt.Println(result.Inspect)
+		return 0
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(file, filepath.Ext(file)) + ".wasm"
+	}
+	if err := os.WriteFile(*out, module, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey wasm: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runConformance 实现 `monkey conformance [-engines=name,...] dir...`, 在各个引擎上运行目录中的 .mk 用例.
+// 全部通过时返回 0, 有用例失败时返回 1, 出错时返回 2
+func runConformance(args []string) int {
+	fs := flag.NewFlagSet("conformance", flag.ContinueOnError)
+	only := fs.String("engines", "", "comma-separated list of engines to run (default all)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: monkey conformance [-engines=name,...] dir...\n\nengines:\n")
+		for _, e := range conformance.Engines {
+			fmt.Fprintf(fs.Output(), "  %s\n", e.Name)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	engines := conformance.Engines
+	if *only != "" {
+		engines = nil
+		for _, name := range strings.Split(*only, ",") {
+			i := slices.IndexFunc(conformance.Engines, func(e conformance.Engine) bool { return e.Name == name })
+			if i < 0 {
+				fmt.Fprintf(os.Stderr, "monkey conformance: unknown engine %q\n", name)
+				return 2
+			}
+			engines = append(engines, conformance.Engines[i])
+		}
+	}
+
+	var cases []*conformance.Case
+	for _, dir := range fs.Args() {
+		loaded, err := conformance.Load(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkey conformance: %s\n", err)
+			return 2
+		}
+		cases = append(cases, loaded...)
+	}
+	if conformance.WriteReport(os.Stdout, conformance.Run(cases, engines)) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,13 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Stdout 是 print 的输出目标
+var Stdout io.Writer = os.Stdout
 
 var Builtins = []struct {
 	Name    string
@@ -17,7 +24,7 @@ var Builtins = []struct {
 				case *String:
 					return &Integer{Value: int64(len(arg.Value))}
 				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
+					return &Integer{Value: int64(arg.Len())}
 				default:
 					return NewError("argument to `len` not supported, got %s", arg.Type())
 				}
@@ -34,13 +41,7 @@ var Builtins = []struct {
 				if args[0].Type() != ARRAY_OBJ {
 					return NewError("argument to `push` must be array, got %s", args[0].Type())
 				}
-				array := args[0].(*Array)
-				length := len(array.Elements)
-
-				newElems := make([]Object, length+1)
-				copy(newElems, array.Elements)
-				newElems[length] = args[1]
-				return &Array{Elements: newElems}
+				return args[0].(*Array).Push(args[1])
 			},
 		},
 	},
@@ -56,8 +57,8 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				if len(arr.Elements) > 0 {
-					return arr.Elements[0]
+				if arr.Len() > 0 {
+					return arr.At(0)
 				}
 				return nil
 			},
@@ -75,9 +76,9 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				length := len(arr.Elements)
+				length := arr.Len()
 				if length > 0 {
-					return arr.Elements[length-1]
+					return arr.At(length - 1)
 				}
 				return nil
 			},
@@ -95,11 +96,8 @@ var Builtins = []struct {
 				}
 
 				arr := args[0].(*Array)
-				length := len(arr.Elements)
-				if length > 0 {
-					newElements := make([]Object, length-1, length-1)
-					copy(newElements, arr.Elements[1:length])
-					return &Array{Elements: newElements}
+				if arr.Len() > 0 {
+					return arr.Rest()
 				}
 				return nil
 			},
@@ -109,13 +107,139 @@ var Builtins = []struct {
 		"print",
 		&Builtin{
 			Fn: func(args ...Object) Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
+				return printTo(Stdout, args...)
+			},
+			Output: printTo,
+		},
+	},
+	{
+		"channel",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) > 1 {
+					return NewError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 0 {
+					return &Channel{}
+				}
+				capacity, ok := args[0].(*Integer)
+				if !ok || capacity.Value < 0 {
+					return NewError("argument to `channel` must be a non-negative integer, got %s", args[0].Inspect())
+				}
+				return &Channel{Capacity: int(capacity.Value)}
+			},
+		},
+	},
+	{
+		"iter",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				it, err := Iterate(args[0])
+				if err != nil {
+					return NewError("argument to `iter` not supported, got %s", args[0].Type())
+				}
+				return it
+			},
+		},
+	},
+	{
+		"next",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				it, ok := args[0].(Iterator)
+				if !ok {
+					return NewError("argument to `next` must be iterator, got %s", args[0].Type())
+				}
+				// 迭代结束后返回 null
+				value, ok, err := it.Next()
+				if err != nil {
+					return NewError("%s", err)
+				}
+				if !ok {
+					return NULL
+				}
+				return value
+			},
+		},
+	},
+	{
+		"collect",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				it, err := Iterate(args[0])
+				if err != nil {
+					return NewError("argument to `collect` not supported, got %s", args[0].Type())
+				}
+				array, err := Collect(it)
+				if err != nil {
+					return NewError("%s", err)
 				}
-				return NULL
+				return array
 			},
 		},
 	},
+	{
+		"json_parse",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return NewError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return NewError("argument to `json_parse` must be string, got %s", args[0].Type())
+				}
+				obj, err := ParseJSON(str.Value)
+				if err != nil {
+					return NewError("json_parse: %s", err)
+				}
+				return obj
+			},
+		},
+	},
+	{
+		"json_stringify",
+		&Builtin{
+			// json_stringify(obj, indent?), indent 为空格个数或缩进字符串
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return NewError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				indent := ""
+				if len(args) == 2 {
+					var err error
+					if indent, err = jsonIndent(args[1]); err != nil {
+						return NewError("json_stringify: %s", err)
+					}
+				}
+				str, err := StringifyJSON(args[0], indent)
+				if err != nil {
+					return NewError("json_stringify: %s", err)
+				}
+				return &String{Value: str}
+			},
+		},
+	},
+	// 以下内置函数需要挂起任务, 由 vm 实现
+	{"spawn", &Builtin{Fn: vmOnly("spawn")}},
+	{"send", &Builtin{Fn: vmOnly("send")}},
+	{"recv", &Builtin{Fn: vmOnly("recv")}},
+	{"select", &Builtin{Fn: vmOnly("select")}},
+}
+
+func vmOnly(name string) BuiltinFunction {
+	return func(args ...Object) Object {
+		return NewError("`%s` is only supported by the vm", name)
+	}
 }
 
 var BuiltinsMap = make(map[string]*Builtin)
@@ -125,3 +249,10 @@ func init() {
 		BuiltinsMap[item.Name] = item.Builtin
 	}
 }
+
+func printTo(out io.Writer, args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(out, arg.Inspect())
+	}
+	return NULL
+}
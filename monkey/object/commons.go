@@ -2,9 +2,11 @@ package object
 
 import "fmt"
 
+// True 和 False 是 vm 使用的名字, 与求值器的 TRUE 和 FALSE 是同一对值,
+// 内置函数返回的布尔值在两个引擎中都可以按指针比较
 var (
-	True  = &Boolean{Value: true}
-	False = &Boolean{Value: false}
+	True  = TRUE
+	False = FALSE
 )
 
 func NewError(format string, a ...any) *Error {
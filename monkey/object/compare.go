@@ -0,0 +1,73 @@
+package object
+
+import "strings"
+
+// Equal 是 == 和 != 的语义, 求值器和 vm 共用.
+// 整数、布尔值和字符串按值比较, 数组按元素顺序、哈希按键值对比较 (与插入顺序无关),
+// null 只等于 null, 类型不同的值总是不相等, 函数和通道等其他对象比较是否为同一个对象.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !Equal(a.At(i), b.At(i)) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for _, e := range a.entries.slice() {
+			pair, ok := b.Get(e.key, e.pair.Key)
+			if !ok || !Equal(e.pair.Value, pair.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// Compare 是 < 和 > 的语义, 整数按大小、字符串按字节顺序比较.
+// 返回 -1、0 或 1, 其他类型或类型不同时 ok 为 false
+func Compare(a, b Object) (result int, ok bool) {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a.Value < b.Value:
+			return -1, true
+		case a.Value > b.Value:
+			return 1, true
+		}
+		return 0, true
+	case *String:
+		b, ok := b.(*String)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	}
+	return 0, false
+}
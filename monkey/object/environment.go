@@ -1,29 +1,121 @@
 package object
 
+import "io"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// 以下按 compiler.Resolve 分配的下标访问
+	global *Environment // 最外层环境, 保存全局变量
+	slots  []Object     // 全局变量或函数的局部变量
+	names  []string     // 全局变量的名字, 与 slots 下标对应
+	fn     *Function    // 当前调用的函数, 提供自由变量和函数自身
+	out    io.Writer    // 最外层环境中 print 的输出目标, 为 nil 时写入 Stdout
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{store: make(map[string]Object), outer: nil}
+	env := &Environment{store: make(map[string]Object), outer: nil}
+	env.global = env
+	return env
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.global = outer.global
 	return env
 }
 
+// NewFunctionEnvironment 创建调用 fn 时使用的环境
+func NewFunctionEnvironment(fn *Function) *Environment {
+	env := NewEnclosedEnvironment(fn.Env)
+	env.slots = make([]Object, fn.NumLocals)
+	env.fn = fn
+	return env
+}
+
+// Get 按名字查找未经 compiler.Resolve 解析的绑定(如宏展开时), 由内向外查找整条外层链,
+// 内层的绑定遮蔽外层的同名绑定
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.store[name]
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.store[name]; ok {
+			return obj, true
+		}
 	}
-	return obj, ok
+	return nil, false
 }
 
+// Set 在当前环境中绑定名字, 不影响外层的同名绑定
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+func (e *Environment) Global(index int) Object {
+	return slotAt(e.global.slots, index)
+}
+
+func (e *Environment) SetGlobal(index int, name string, val Object) Object {
+	g := e.global
+	for len(g.slots) <= index {
+		g.slots = append(g.slots, nil)
+		g.names = append(g.names, "")
+	}
+	g.slots[index] = val
+	g.names[index] = name
+	return val
+}
+
+// GlobalNames 按下标顺序返回已定义的全局变量名, 依次 Define 即可重建相同的符号表
+func (e *Environment) GlobalNames() []string {
+	return e.global.names
+}
+
+// TruncateGlobals 删除下标不小于 n 的全局变量, 用于回滚一次失败的求值
+func (e *Environment) TruncateGlobals(n int) {
+	g := e.global
+	if n < len(g.slots) {
+		g.slots = g.slots[:n]
+		g.names = g.names[:n]
+	}
+}
+
+// SetOutput 让在这个环境中求值的程序把 print 的输出写入 out
+func (e *Environment) SetOutput(out io.Writer) {
+	e.global.out = out
+}
+
+func (e *Environment) Output() io.Writer {
+	return e.global.out
+}
+
+func (e *Environment) Local(index int) Object {
+	return slotAt(e.slots, index)
+}
+
+func (e *Environment) SetLocal(index int, val Object) Object {
+	for len(e.slots) <= index {
+		e.slots = append(e.slots, nil)
+	}
+	e.slots[index] = val
+	return val
+}
+
+func (e *Environment) Free(index int) Object {
+	if e.fn == nil {
+		return nil
+	}
+	return slotAt(e.fn.Free, index)
+}
+
+func (e *Environment) Function() *Function {
+	return e.fn
+}
+
+func slotAt(slots []Object, index int) Object {
+	if index < 0 || index >= len(slots) {
+		return nil
+	}
+	return slots[index]
+}
@@ -0,0 +1,76 @@
+package object
+
+import "testing"
+
+func TestEnvironmentGet(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("a", &Integer{Value: 1})
+	global.Set("b", &Integer{Value: 2})
+	outer := NewEnclosedEnvironment(global)
+	outer.Set("b", &Integer{Value: 20})
+	outer.Set("c", &Integer{Value: 30})
+	inner := NewEnclosedEnvironment(NewEnclosedEnvironment(outer))
+	inner.Set("d", &Integer{Value: 400})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected int64
+	}{
+		{inner, "a", 1},
+		{inner, "b", 20},
+		{inner, "c", 30},
+		{inner, "d", 400},
+		{outer, "b", 20},
+		{global, "b", 2},
+	}
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if !ok {
+			t.Errorf("%s not found", tt.name)
+			continue
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("wrong value for %s. want=%d, got=%s", tt.name, tt.expected, obj.Inspect())
+		}
+	}
+
+	for _, name := range []string{"e", "d"} {
+		if _, ok := outer.Get(name); ok {
+			t.Errorf("%s should not be visible in outer environment", name)
+		}
+	}
+}
+
+// 按下标访问时, 全局变量在任意深度的环境中共享, 局部变量只属于各自的调用,
+// 自由变量来自创建闭包时捕获的值, 与 compiler.SymbolTable 的作用域划分一致
+func TestEnvironmentSlots(t *testing.T) {
+	global := NewEnvironment()
+	global.SetGlobal(0, "a", &Integer{Value: 1})
+
+	outer := NewFunctionEnvironment(&Function{Env: global, NumLocals: 1})
+	outer.SetLocal(0, &Integer{Value: 10})
+	fn := &Function{Env: outer, NumLocals: 1, Free: []Object{outer.Local(0)}}
+	inner := NewFunctionEnvironment(fn)
+	inner.SetLocal(0, &Integer{Value: 100})
+	inner.SetGlobal(1, "b", &Integer{Value: 2})
+
+	if got := inner.Global(0); got.(*Integer).Value != 1 {
+		t.Errorf("wrong global 0: %s", got.Inspect())
+	}
+	if got := global.Global(1); got == nil || got.(*Integer).Value != 2 {
+		t.Errorf("global defined in a nested environment is not shared: %v", got)
+	}
+	if got := outer.Local(0); got.(*Integer).Value != 10 {
+		t.Errorf("inner local overwrote outer local: %s", got.Inspect())
+	}
+	if got := inner.Free(0); got.(*Integer).Value != 10 {
+		t.Errorf("wrong free variable: %s", got.Inspect())
+	}
+	if inner.Function() != fn || global.Function() != nil {
+		t.Errorf("wrong current function")
+	}
+	if names := global.GlobalNames(); len(names) != 2 || names[1] != "b" {
+		t.Errorf("wrong global names: %v", names)
+	}
+}
@@ -0,0 +1,166 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math/bits"
+	"slices"
+)
+
+// hashSeed 在每个进程中随机生成, 脚本无法构造出固定冲突的键
+var hashSeed = maphash.MakeSeed()
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+type hashEntry struct {
+	key  HashKey
+	pair HashPair
+}
+
+// Hash 是不可变的哈希, Set 返回与原哈希共享节点的新哈希, 零值为空哈希.
+// 键值对按插入顺序保存在 entries 中, root 是以 HashKey.Value 为散列值的 HAMT,
+// 叶子中记录散列值相同的条目在 entries 中的下标, 查找时逐个比较原始的键,
+// 不同的键即使散列值冲突也不会互相覆盖.
+type Hash struct {
+	root    *hamtNode
+	entries vector[*hashEntry]
+}
+
+// hamtNode 的 bitmap 记录 slots 占用了 32 个分支中的哪几个.
+// indexes 不为空的节点是叶子, 不再向下分支
+type hamtNode struct {
+	bitmap uint32
+	slots  []*hamtNode
+
+	hash    uint64
+	indexes []int
+}
+
+func (h *Hash) Len() int { return h.entries.len() }
+
+// Set 返回写入键值对之后的哈希, key 为 HashKeyOf(pair.Key). 已有的键保持原来的位置, 只替换值
+func (h *Hash) Set(key HashKey, pair HashPair) *Hash {
+	entry := &hashEntry{key: key, pair: pair}
+	if i, ok := h.find(key, pair.Key); ok {
+		return &Hash{root: h.root, entries: h.entries.set(i, entry)}
+	}
+	return &Hash{
+		root:    h.root.insert(0, key.Value, h.entries.len()),
+		entries: h.entries.push(entry),
+	}
+}
+
+// Get 查找键 obj, key 为 HashKeyOf(obj)
+func (h *Hash) Get(key HashKey, obj Object) (HashPair, bool) {
+	if i, ok := h.find(key, obj); ok {
+		return h.entries.at(i).pair, true
+	}
+	return HashPair{}, false
+}
+
+func (h *Hash) find(key HashKey, obj Object) (int, bool) {
+	node := h.root
+	for shift := uint(0); node != nil; shift += hamtBits {
+		if node.indexes != nil {
+			if node.hash != key.Value {
+				return 0, false
+			}
+			for _, i := range node.indexes {
+				e := h.entries.at(i)
+				if e.key == key && Equal(e.pair.Key, obj) {
+					return i, true
+				}
+			}
+			return 0, false
+		}
+		bit := uint32(1) << ((key.Value >> shift) & hamtMask)
+		if node.bitmap&bit == 0 {
+			return 0, false
+		}
+		node = node.slots[bits.OnesCount32(node.bitmap&(bit-1))]
+	}
+	return 0, false
+}
+
+// insert 返回加入下标 index 之后的新节点, n 为 nil 时新建叶子
+func (n *hamtNode) insert(shift uint, hash uint64, index int) *hamtNode {
+	if n == nil {
+		return &hamtNode{hash: hash, indexes: []int{index}}
+	}
+	if n.indexes != nil {
+		if n.hash == hash {
+			return &hamtNode{hash: hash, indexes: append(slices.Clone(n.indexes), index)}
+		}
+		// 散列值不同, 把叶子下移一层后再插入, 64 位的散列值总会在某一层分开
+		bit := uint32(1) << ((n.hash >> shift) & hamtMask)
+		return (&hamtNode{bitmap: bit, slots: []*hamtNode{n}}).insert(shift, hash, index)
+	}
+
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	pos := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit != 0 {
+		slots := slices.Clone(n.slots)
+		slots[pos] = slots[pos].insert(shift+hamtBits, hash, index)
+		return &hamtNode{bitmap: n.bitmap, slots: slots}
+	}
+	slots := make([]*hamtNode, len(n.slots)+1)
+	copy(slots, n.slots[:pos])
+	slots[pos] = &hamtNode{hash: hash, indexes: []int{index}}
+	copy(slots[pos+1:], n.slots[pos:])
+	return &hamtNode{bitmap: n.bitmap | bit, slots: slots}
+}
+
+// Ordered 按插入顺序返回所有键值对
+func (h *Hash) Ordered() []HashPair {
+	entries := h.entries.slice()
+	pairs := make([]HashPair, len(entries))
+	for i, e := range entries {
+		pairs[i] = e.pair
+	}
+	return pairs
+}
+
+// HashKeyOf 返回 obj 作为哈希键时的 HashKey. 数组和哈希按结构计算,
+// 内容相同的数组(或键值对相同的哈希, 与插入顺序无关)得到相同的 HashKey.
+// obj 或其中的元素不能作为键时返回 false.
+func HashKeyOf(obj Object) (HashKey, bool) {
+	switch obj := obj.(type) {
+	case Hashable:
+		return obj.HashKey(), true
+	case *Array:
+		var h maphash.Hash
+		h.SetSeed(hashSeed)
+		for _, elem := range obj.Elements() {
+			key, ok := HashKeyOf(elem)
+			if !ok {
+				return HashKey{}, false
+			}
+			writeHashKey(&h, key)
+		}
+		return HashKey{Type: obj.Type(), Value: h.Sum64()}, true
+	case *Hash:
+		// 各个键值对的散列值相加, 结果与顺序无关
+		var sum uint64
+		for _, e := range obj.entries.slice() {
+			value, ok := HashKeyOf(e.pair.Value)
+			if !ok {
+				return HashKey{}, false
+			}
+			var h maphash.Hash
+			h.SetSeed(hashSeed)
+			writeHashKey(&h, e.key)
+			writeHashKey(&h, value)
+			sum += h.Sum64()
+		}
+		return HashKey{Type: obj.Type(), Value: sum}, true
+	}
+	return HashKey{}, false
+}
+
+func writeHashKey(h *maphash.Hash, key HashKey) {
+	h.WriteString(string(key.Type))
+	h.Write(binary.BigEndian.AppendUint64(nil, key.Value))
+}
@@ -0,0 +1,66 @@
+package object
+
+import "fmt"
+
+// Iterator 是可以逐个取值的对象, 由生成器函数和 iter 返回, 可以用于 for ... in
+type Iterator interface {
+	Object
+	// Next 返回下一个值, 没有更多值时 ok 为 false
+	Next() (value Object, ok bool, err error)
+}
+
+// Iterate 返回遍历 obj 的迭代器, 数组按元素、字符串按字符、哈希按插入顺序遍历键
+func Iterate(obj Object) (Iterator, error) {
+	switch obj := obj.(type) {
+	case Iterator:
+		return obj, nil
+	case *Array:
+		return &sliceIterator{elements: obj.Elements()}, nil
+	case *String:
+		var elements []Object
+		for _, r := range obj.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+		return &sliceIterator{elements: elements}, nil
+	case *Hash:
+		pairs := obj.Ordered()
+		keys := make([]Object, len(pairs))
+		for i, pair := range pairs {
+			keys[i] = pair.Key
+		}
+		return &sliceIterator{elements: keys}, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", obj.Type())
+}
+
+// Collect 取出迭代器中剩下的所有值
+func Collect(it Iterator) (*Array, error) {
+	var elements []Object
+	for {
+		value, ok, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return NewArray(elements), nil
+		}
+		elements = append(elements, value)
+	}
+}
+
+type sliceIterator struct {
+	elements []Object
+	pos      int
+}
+
+func (it *sliceIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *sliceIterator) Inspect() string  { return fmt.Sprintf("Iterator[%p]", it) }
+
+func (it *sliceIterator) Next() (Object, bool, error) {
+	if it.pos >= len(it.elements) {
+		return nil, false, nil
+	}
+	value := it.elements[it.pos]
+	it.pos++
+	return value, true, nil
+}
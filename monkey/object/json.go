@@ -0,0 +1,172 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseJSON 把 JSON 文档转换为对象: 对象为 Hash(保持文档中键的顺序), 数组为 Array, null 为 NULL.
+// 没有浮点数类型, 超出 int64 范围或带小数、指数的数字保留文档中的原文, 转换为 String.
+func ParseJSON(data string) (Object, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	obj, err := decodeJSON(dec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json: %s", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid json: unexpected data after top-level value")
+	}
+	return obj, nil
+}
+
+// decodeJSON 逐个读取 token, encoding/json 解码到 map 时会丢失键的顺序
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("unexpected end of JSON input")
+		}
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		if tok {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case json.Number:
+		i, err := strconv.ParseInt(string(tok), 10, 64)
+		if err != nil {
+			return &String{Value: string(tok)}, nil
+		}
+		return &Integer{Value: i}, nil
+	case string:
+		return &String{Value: tok}, nil
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				elem, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, elem)
+			}
+			_, err := dec.Token()
+			return NewArray(elements), err
+		}
+
+		hash := &Hash{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := &String{Value: keyTok.(string)}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash = hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+		}
+		_, err := dec.Token()
+		return hash, err
+	}
+	return nil, fmt.Errorf("unexpected token %v", tok)
+}
+
+// StringifyJSON 把对象编码为 JSON, 哈希按插入顺序输出.
+// indent 为空时输出紧凑格式. 哈希的键必须是字符串, 函数等值无法编码.
+func StringifyJSON(obj Object, indent string) (string, error) {
+	var out bytes.Buffer
+	if err := encodeJSON(&out, obj); err != nil {
+		return "", err
+	}
+	if indent == "" {
+		return out.String(), nil
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, out.Bytes(), "", indent); err != nil {
+		return "", err
+	}
+	return indented.String(), nil
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object) error {
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *String:
+		encodeJSONString(out, obj.Value)
+	case *Array:
+		out.WriteByte('[')
+		for i, elem := range obj.Elements() {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := encodeJSON(out, elem); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case *Hash:
+		out.WriteByte('{')
+		for i, pair := range obj.Ordered() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return fmt.Errorf("cannot serialize hash key %s of type %s", pair.Key.Inspect(), pair.Key.Type())
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			encodeJSONString(out, key.Value)
+			out.WriteByte(':')
+			if err := encodeJSON(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot serialize value of type %s", obj.Type())
+	}
+	return nil
+}
+
+// encodeJSONString 与 encoding/json 的转义规则相同, 但不转义 <、> 和 &
+func encodeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	out.Truncate(out.Len() - 1) // Encode 在末尾加了换行
+}
+
+func jsonIndent(arg Object) (string, error) {
+	switch arg := arg.(type) {
+	case *Integer:
+		if arg.Value < 0 || arg.Value > 10 {
+			return "", fmt.Errorf("indent must be between 0 and 10, got %d", arg.Value)
+		}
+		return strings.Repeat(" ", int(arg.Value)), nil
+	case *String:
+		if strings.Trim(arg.Value, " \t") != "" {
+			return "", fmt.Errorf("indent must contain only spaces and tabs, got %q", arg.Value)
+		}
+		return arg.Value, nil
+	}
+	return "", fmt.Errorf("indent must be integer or string, got %s", arg.Type())
+}
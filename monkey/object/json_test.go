@@ -0,0 +1,124 @@
+package object
+
+import "testing"
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`null`, "null"},
+		{`true`, "true"},
+		{` 42 `, "42"},
+		{`-9223372036854775808`, "-9223372036854775808"},
+		{`"a\nb"`, "a\nb"},
+		{`[1, "x", [false]]`, `[1, x, [false]]`},
+		{`{"a": {"b": [null]}}`, `{a: {b: [null]}}`},
+		{`{"b": 1, "a": 2, "b": 3}`, `{b: 3, a: 2}`},
+	}
+
+	for _, tt := range tests {
+		obj, err := ParseJSON(tt.input)
+		if err != nil {
+			t.Fatalf("ParseJSON(%q) error: %s", tt.input, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("ParseJSON(%q) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	// 无法表示为整数的数字保留原文
+	for _, input := range []string{`9223372036854775808`, `1.5`, `1e3`, `-0.25`} {
+		obj, err := ParseJSON(input)
+		if err != nil {
+			t.Fatalf("ParseJSON(%q) error: %s", input, err)
+		}
+		if str, ok := obj.(*String); !ok || str.Value != input {
+			t.Errorf("ParseJSON(%q) wrong. got=%T (%+v)", input, obj, obj)
+		}
+	}
+	obj, err := ParseJSON(`{"price": 1.5, "qty": 2}`)
+	if err != nil {
+		t.Fatalf("ParseJSON error: %s", err)
+	}
+	if got := obj.Inspect(); got != "{price: 1.5, qty: 2}" {
+		t.Errorf("wrong object: %s", got)
+	}
+
+	if obj, _ := ParseJSON(`[true, false]`); obj.(*Array).At(0) != TRUE || obj.(*Array).At(1) != FALSE {
+		t.Errorf("booleans are not the shared TRUE and FALSE")
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{``, "invalid json: unexpected end of JSON input"},
+		{`{"a": }`, "invalid json: missing value after object key"},
+		{`[1] [2]`, "invalid json: unexpected data after top-level value"},
+		{`[1, 2`, "invalid json: unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseJSON(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ParseJSON(%q) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestStringifyJSON(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(pairs); i += 2 {
+			h = h.Set(pairs[i].(Hashable).HashKey(), HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	str := func(s string) *String { return &String{Value: s} }
+	doc := hash(
+		str("z"), NewArray([]Object{&Integer{Value: 1}, NULL, TRUE}),
+		str("a"), hash(str("<b>"), str("x\"y")),
+		str("m"), &Array{},
+	)
+
+	tests := []struct {
+		obj      Object
+		indent   string
+		expected string
+	}{
+		{doc, "", `{"z":[1,null,true],"a":{"<b>":"x\"y"},"m":[]}`},
+		{doc, "  ", "{\n  \"z\": [\n    1,\n    null,\n    true\n  ],\n  \"a\": {\n    \"<b>\": \"x\\\"y\"\n  },\n  \"m\": []\n}"},
+		{&Integer{Value: -3}, "", `-3`},
+	}
+
+	for _, tt := range tests {
+		// 多次编码结果相同, 哈希按插入顺序输出
+		for i := 0; i < 5; i++ {
+			got, err := StringifyJSON(tt.obj, tt.indent)
+			if err != nil {
+				t.Fatalf("StringifyJSON error: %s", err)
+			}
+			if got != tt.expected {
+				t.Fatalf("StringifyJSON wrong.\nwant=%q\ngot= %q", tt.expected, got)
+			}
+		}
+	}
+
+	errTests := []struct {
+		obj      Object
+		expected string
+	}{
+		{NewArray([]Object{&Closure{Fn: &CompiledFunction{}}}), "cannot serialize value of type closure"},
+		{hash(&Integer{Value: 1}, NULL), "cannot serialize hash key 1 of type integer"},
+		{&Channel{}, "cannot serialize value of type channel"},
+	}
+	for _, tt := range errTests {
+		_, err := StringifyJSON(tt.obj, "")
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("StringifyJSON(%s) wrong error. want=%q, got=%v", tt.obj.Inspect(), tt.expected, err)
+		}
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"go-example/monkey/ast"
 	"go-example/monkey/code"
-	"hash/fnv"
+	"hash/maphash"
+	"io"
 	"strconv"
 	"strings"
 )
@@ -27,6 +28,9 @@ const (
 	CLOSURE_OBJ           = "closure"
 	QUOTE_OBJ             = "quote"
 	MACRO_OBJ             = "macro"
+	CHANNEL_OBJ           = "channel"
+	ITERATOR_OBJ          = "iterator"
+	GENERATOR_OBJ         = "generator"
 )
 
 var (
@@ -80,14 +84,16 @@ func (n *Null) Inspect() string  { return "null" }
 
 type String struct {
 	Value string
+	hash  uint64 // 缓存的散列值, 0 表示尚未计算
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	if s.hash == 0 {
+		s.hash = maphash.String(hashSeed, s.Value)
+	}
+	return HashKey{Type: s.Type(), Value: s.hash}
 }
 
 type ReturnValue struct {
@@ -104,16 +110,34 @@ type Error struct {
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return fmt.Sprintf("Message: %s", e.Message) }
 
+// Array 是不可变的数组, Push 和 Rest 返回与原数组共享节点的新数组
 type Array struct {
-	Elements []Object
+	elements vector[Object]
+}
+
+// NewArray 返回包含 elements 中元素的数组, 之后修改 elements 不影响数组
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
 }
 
+func (a *Array) Len() int { return a.elements.len() }
+
+func (a *Array) At(i int) Object { return a.elements.at(i) }
+
+// Elements 返回所有元素的副本
+func (a *Array) Elements() []Object { return a.elements.slice() }
+
+func (a *Array) Push(obj Object) *Array { return &Array{elements: a.elements.push(obj)} }
+
+// Rest 返回去掉第一个元素的数组, a 不能为空
+func (a *Array) Rest() *Array { return &Array{elements: a.elements.rest()} }
+
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
 func (a *Array) Inspect() string {
 	var out bytes.Buffer
 
 	var elems []string
-	for _, element := range a.Elements {
+	for _, element := range a.Elements() {
 		elems = append(elems, element.Inspect())
 	}
 
@@ -129,16 +153,12 @@ type HashPair struct {
 	Value Object
 }
 
-type Hash struct {
-	Pairs map[HashKey]HashPair
-}
-
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Ordered() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -154,6 +174,16 @@ type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// Output 是会输出的内置函数 (print) 把输出写入 out 的版本, 其他内置函数为 nil
+	Output func(out io.Writer, args ...Object) Object
+}
+
+// Call 调用内置函数, out 不为 nil 时输出写入 out 而不是 Stdout
+func (b *Builtin) Call(out io.Writer, args ...Object) Object {
+	if out != nil && b.Output != nil {
+		return b.Output(out, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -163,6 +193,9 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	NumLocals  int
+	Free       []Object // 与 OpClosure 一致, 创建函数时按值捕获的自由变量
+	Generator  bool
 }
 
 func (fn *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -187,6 +220,7 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Generator     bool
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -204,6 +238,17 @@ func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
 
+// Channel 是任务之间传递值的通道, 等待中的发送者和接收者由 vm 的调度器管理
+type Channel struct {
+	Capacity int
+	Buffer   []Object
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string {
+	return fmt.Sprintf("Channel[%p]", c)
+}
+
 type Quote struct {
 	Node ast.Node
 }
@@ -58,3 +58,158 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestHashInsertionOrder(t *testing.T) {
+	h := &Hash{}
+	for _, k := range []string{"b", "a", "c", "a"} {
+		key := &String{Value: k}
+		h = h.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: int64(h.Len())}})
+	}
+	// 重复的键保持第一次插入的位置
+	if got := h.Inspect(); got != "{b: 0, a: 3, c: 2}" {
+		t.Errorf("wrong order. got=%s", got)
+	}
+}
+
+func TestStructuralHashKey(t *testing.T) {
+	array := func(elems ...Object) *Array { return NewArray(elems) }
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(pairs); i += 2 {
+			key, _ := HashKeyOf(pairs[i])
+			h = h.Set(key, HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	a, b := &String{Value: "a"}, &String{Value: "b"}
+
+	same := [][2]Object{
+		{array(one, a), array(&Integer{Value: 1}, &String{Value: "a"})},
+		{array(), array()},
+		{hash(a, one, b, array(two)), hash(b, array(two), a, one)},
+	}
+	for _, tt := range same {
+		k1, ok1 := HashKeyOf(tt[0])
+		k2, ok2 := HashKeyOf(tt[1])
+		if !ok1 || !ok2 || k1 != k2 {
+			t.Errorf("%s and %s have different hash keys", tt[0].Inspect(), tt[1].Inspect())
+		}
+	}
+
+	different := [][2]Object{
+		{array(one, two), array(two, one)},
+		{array(one), array(array(one))},
+		{array(), hash()},
+		{hash(a, one), hash(b, one)},
+		{hash(a, one), hash(a, two)},
+	}
+	for _, tt := range different {
+		k1, _ := HashKeyOf(tt[0])
+		k2, _ := HashKeyOf(tt[1])
+		if k1 == k2 {
+			t.Errorf("%s and %s have same hash key", tt[0].Inspect(), tt[1].Inspect())
+		}
+	}
+
+	for _, obj := range []Object{&Closure{}, array(one, &Closure{}), hash(a, &Closure{}), NULL} {
+		if _, ok := HashKeyOf(obj); ok {
+			t.Errorf("%s is usable as hash key", obj.Inspect())
+		}
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	// 让不同的键使用同一个 HashKey, 模拟散列冲突
+	collision := HashKey{Type: STRING_OBJ, Value: 42}
+	a, b, c := &String{Value: "a"}, &String{Value: "b"}, &String{Value: "c"}
+
+	h := &Hash{}
+	h = h.Set(collision, HashPair{Key: a, Value: &Integer{Value: 1}})
+	h = h.Set(collision, HashPair{Key: b, Value: &Integer{Value: 2}})
+	h = h.Set(collision, HashPair{Key: c, Value: &Integer{Value: 3}})
+	h = h.Set(collision, HashPair{Key: &String{Value: "b"}, Value: &Integer{Value: 20}})
+
+	if got := h.Inspect(); got != "{a: 1, b: 20, c: 3}" {
+		t.Errorf("colliding keys overwrote each other: %s", got)
+	}
+	for key, want := range map[*String]string{a: "1", b: "20", c: "3"} {
+		pair, ok := h.Get(collision, key)
+		if !ok || pair.Value.Inspect() != want {
+			t.Errorf("Get(%s) wrong. got=%v, %t", key.Value, pair.Value, ok)
+		}
+	}
+	if _, ok := h.Get(collision, &String{Value: "d"}); ok {
+		t.Errorf("Get found a key that was never set")
+	}
+	if _, ok := h.Get(collision, &Integer{Value: 1}); ok {
+		t.Errorf("Get matched keys of different types")
+	}
+}
+
+func TestStringHashKeyCache(t *testing.T) {
+	s := &String{Value: "cached"}
+	key := s.HashKey()
+	if s.hash == 0 || s.hash != key.Value {
+		t.Fatalf("hash was not cached")
+	}
+	if s.HashKey() != key || (&String{Value: "cached"}).HashKey() != key {
+		t.Errorf("cached hash differs from computed hash")
+	}
+}
+
+func TestEqualAndCompare(t *testing.T) {
+	str := func(s string) Object { return &String{Value: s} }
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(pairs); i += 2 {
+			key, _ := HashKeyOf(pairs[i])
+			h = h.Set(key, HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	builtin := BuiltinsMap["len"]
+
+	equal := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{TRUE, True, true},
+		{FALSE, True, false},
+		{NULL, &Null{}, true},
+		{NULL, FALSE, false},
+		{&Integer{Value: 1}, str("1"), false},
+		{NewArray([]Object{str("a"), NULL}), NewArray([]Object{str("a"), NULL}), true},
+		{hash(str("a"), TRUE, str("b"), NULL), hash(str("b"), NULL, str("a"), True), true},
+		{hash(str("a"), TRUE), hash(str("a"), FALSE), false},
+		{builtin, builtin, true},
+		{builtin, BuiltinsMap["push"], false},
+	}
+	for i, tt := range equal {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("equal %d: Equal(%s, %s) = %t", i, tt.a.Inspect(), tt.b.Inspect(), got)
+		}
+		if got := Equal(tt.b, tt.a); got != tt.expected {
+			t.Errorf("equal %d: Equal(%s, %s) = %t", i, tt.b.Inspect(), tt.a.Inspect(), got)
+		}
+	}
+
+	compare := []struct {
+		a, b     Object
+		expected int
+		ok       bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 2}, -1, true},
+		{&Integer{Value: 2}, &Integer{Value: 2}, 0, true},
+		{str("b"), str("ab"), 1, true},
+		{str("a"), &Integer{Value: 1}, 0, false},
+		{TRUE, FALSE, 0, false},
+		{&Array{}, &Array{}, 0, false},
+	}
+	for i, tt := range compare {
+		got, ok := Compare(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("compare %d: want=(%d, %t), got=(%d, %t)", i, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
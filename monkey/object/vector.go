@@ -0,0 +1,146 @@
+package object
+
+import "slices"
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vectorNode 是 vector 中的节点, 内部节点只有 children, 叶子节点只有 values
+type vectorNode[T any] struct {
+	children []*vectorNode[T]
+	values   []T
+}
+
+// vector 是不可变的 32 叉前缀树 (与 Clojure 的 PersistentVector 相同), 最后至多 32 个元素放在 tail 中.
+// 修改时只复制从根到叶子路径上的节点, 其余节点由新旧两个版本共享.
+// start 是 rest 丢弃的前缀长度, 被丢弃的元素仍在树中, 下标都要加上 start.
+type vector[T any] struct {
+	root  *vectorNode[T]
+	tail  []T
+	shift uint
+	size  int
+	start int
+}
+
+func newVector[T any](values []T) vector[T] {
+	var v vector[T]
+	for i := 0; i < len(values); i += vectorWidth {
+		if len(v.tail) == vectorWidth {
+			v.flushTail()
+		}
+		chunk := values[i:min(i+vectorWidth, len(values))]
+		v.tail = slices.Clone(chunk)
+		v.size += len(chunk)
+	}
+	return v
+}
+
+func (v vector[T]) len() int { return v.size - v.start }
+
+func (v vector[T]) at(i int) T { return v.chunk(i + v.start)[0] }
+
+// chunk 返回绝对下标 i 所在的叶子 (或 tail) 中从 i 开始的部分
+func (v vector[T]) chunk(i int) []T {
+	if off := v.size - len(v.tail); i >= off {
+		return v.tail[i-off:]
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values[i&vectorMask:]
+}
+
+func (v vector[T]) slice() []T {
+	out := make([]T, 0, v.len())
+	for i := v.start; i < v.size; {
+		chunk := v.chunk(i)
+		out = append(out, chunk...)
+		i += len(chunk)
+	}
+	return out
+}
+
+func (v vector[T]) push(x T) vector[T] {
+	if len(v.tail) == vectorWidth {
+		v.flushTail()
+	}
+	tail := make([]T, len(v.tail)+1)
+	copy(tail, v.tail)
+	tail[len(v.tail)] = x
+	v.tail = tail
+	v.size++
+	return v
+}
+
+func (v vector[T]) set(i int, x T) vector[T] {
+	i += v.start
+	if off := v.size - len(v.tail); i >= off {
+		v.tail = slices.Clone(v.tail)
+		v.tail[i-off] = x
+		return v
+	}
+	v.root = setPath(v.root, v.shift, i, x)
+	return v
+}
+
+func (v vector[T]) rest() vector[T] {
+	v.start++
+	if v.start >= v.size {
+		return vector[T]{}
+	}
+	return v
+}
+
+// flushTail 把已满的 tail 作为叶子放入树中, 根节点满了时树增高一层
+func (v *vector[T]) flushTail() {
+	leaf := &vectorNode[T]{values: v.tail}
+	v.tail = nil
+	switch {
+	case v.root == nil:
+		v.root = &vectorNode[T]{children: []*vectorNode[T]{leaf}}
+		v.shift = vectorBits
+	case v.size>>vectorBits > 1<<v.shift:
+		v.root = &vectorNode[T]{children: []*vectorNode[T]{v.root, newPath(v.shift, leaf)}}
+		v.shift += vectorBits
+	default:
+		v.root = v.pushLeaf(v.root, v.shift, leaf)
+	}
+}
+
+// pushLeaf 返回在 parent 之下加入 leaf 之后的新节点, leaf 的位置由 size 决定
+func (v *vector[T]) pushLeaf(parent *vectorNode[T], level uint, leaf *vectorNode[T]) *vectorNode[T] {
+	i := ((v.size - 1) >> level) & vectorMask
+	node := &vectorNode[T]{children: slices.Clone(parent.children)}
+	switch {
+	case level == vectorBits:
+		node.children = append(node.children, leaf)
+	case i < len(node.children):
+		node.children[i] = v.pushLeaf(node.children[i], level-vectorBits, leaf)
+	default:
+		node.children = append(node.children, newPath(level-vectorBits, leaf))
+	}
+	return node
+}
+
+func newPath[T any](level uint, leaf *vectorNode[T]) *vectorNode[T] {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode[T]{children: []*vectorNode[T]{newPath(level-vectorBits, leaf)}}
+}
+
+func setPath[T any](node *vectorNode[T], level uint, i int, x T) *vectorNode[T] {
+	if level == 0 {
+		values := slices.Clone(node.values)
+		values[i&vectorMask] = x
+		return &vectorNode[T]{values: values}
+	}
+	children := slices.Clone(node.children)
+	j := (i >> level) & vectorMask
+	children[j] = setPath(children[j], level-vectorBits, i, x)
+	return &vectorNode[T]{children: children}
+}
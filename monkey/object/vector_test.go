@@ -0,0 +1,101 @@
+package object
+
+import "testing"
+
+func TestVector(t *testing.T) {
+	// 覆盖 tail 已满、根节点分裂 (32*32+32) 和三层树的情况
+	for _, n := range []int{0, 1, 32, 33, 1056, 1057, 40000} {
+		values := make([]int, n)
+		for i := range values {
+			values[i] = i
+		}
+		var pushed vector[int]
+		for _, x := range values {
+			pushed = pushed.push(x)
+		}
+		built := newVector(values)
+
+		for _, v := range []vector[int]{pushed, built} {
+			if v.len() != n {
+				t.Fatalf("n=%d: wrong len %d", n, v.len())
+			}
+			for i, x := range v.slice() {
+				if x != i || v.at(i) != i {
+					t.Fatalf("n=%d: wrong value at %d: %d %d", n, i, x, v.at(i))
+				}
+			}
+		}
+
+		if n < 2 {
+			continue
+		}
+		rest := built.rest()
+		set := rest.set(0, -1).set(n-2, -2)
+		if rest.len() != n-1 || rest.at(0) != 1 {
+			t.Errorf("n=%d: wrong rest", n)
+		}
+		if set.at(0) != -1 || set.at(n-2) != -2 {
+			t.Errorf("n=%d: set did not change value", n)
+		}
+		// 原来的版本不受影响
+		if built.at(0) != 0 || built.at(n-1) != n-1 || rest.at(n-2) != n-1 {
+			t.Errorf("n=%d: old version modified", n)
+		}
+	}
+}
+
+func TestArrayPersistence(t *testing.T) {
+	a := NewArray([]Object{&Integer{Value: 1}})
+	b := a.Push(&Integer{Value: 2})
+	c := a.Push(&Integer{Value: 3})
+	d := b.Rest()
+
+	tests := []struct {
+		array    *Array
+		expected string
+	}{
+		{a, "[1]"},
+		{b, "[1, 2]"},
+		{c, "[1, 3]"},
+		{d, "[2]"},
+		{d.Rest(), "[]"},
+		{d.Rest().Push(&Integer{Value: 4}), "[4]"},
+	}
+	for i, tt := range tests {
+		if got := tt.array.Inspect(); got != tt.expected {
+			t.Errorf("array %d: want=%s, got=%s", i, tt.expected, got)
+		}
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	var hashes []*Hash
+	h := &Hash{}
+	for i := 0; i < 2000; i++ {
+		key := &Integer{Value: int64(i)}
+		h = h.Set(key.HashKey(), HashPair{Key: key, Value: key})
+		hashes = append(hashes, h)
+	}
+	replaced := h.Set((&Integer{Value: 7}).HashKey(), HashPair{Key: &Integer{Value: 7}, Value: NULL})
+
+	for i := 0; i < 2000; i++ {
+		key := &Integer{Value: int64(i)}
+		pair, ok := h.Get(key.HashKey(), key)
+		if !ok || !Equal(pair.Value, key) {
+			t.Fatalf("key %d not found", i)
+		}
+		// 每个版本只包含当时已经写入的键
+		if _, ok := hashes[i/2].Get(key.HashKey(), key); ok != (i <= i/2) {
+			t.Fatalf("version %d: wrong lookup of key %d", i/2, i)
+		}
+	}
+	if pair, _ := replaced.Get((&Integer{Value: 7}).HashKey(), &Integer{Value: 7}); pair.Value != NULL {
+		t.Errorf("value not replaced: %s", pair.Value.Inspect())
+	}
+	if pair, _ := h.Get((&Integer{Value: 7}).HashKey(), &Integer{Value: 7}); pair.Value == NULL {
+		t.Errorf("old version modified")
+	}
+	if replaced.Len() != 2000 || replaced.Ordered()[7].Value != NULL {
+		t.Errorf("replaced value moved: len=%d", replaced.Len())
+	}
+}
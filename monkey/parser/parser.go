@@ -33,6 +33,16 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET: INDEX,
 }
 
+// ParseError 语法错误以及出错位置的词法单元
+type ParseError struct {
+	Message string
+	Token   token.Token
+}
+
+func (e ParseError) Error() string {
+	return e.Message
+}
+
 type prefixParseFn func() ast.Expression
 type infixParseFn func(ast.Expression) ast.Expression
 
@@ -40,10 +50,13 @@ type Parser struct {
 	l         *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []ParseError
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// 正在解析的函数字面量, yield 标记最内层的函数为生成器
+	functions []*ast.FunctionLiteral
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -57,7 +70,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:              l,
-		errors:         make([]string, 0),
+		errors:         make([]ParseError, 0),
 		prefixParseFns: make(map[token.TokenType]prefixParseFn),
 		infixParseFns:  make(map[token.TokenType]infixParseFn),
 	}
@@ -72,6 +85,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
@@ -95,12 +109,24 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// ParseErrors 与 Errors 相同, 但带有出错位置
+func (p *Parser) ParseErrors() []ParseError {
 	return p.errors
 }
 
+func (p *Parser) addError(tok token.Token, format string, a ...any) {
+	p.errors = append(p.errors, ParseError{Message: fmt.Sprintf(format, a...), Token: tok})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) nextToken() {
@@ -127,8 +153,7 @@ func (p *Parser) expectedPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for '%s' found.", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, "no prefix parse function for '%s' found.", t)
 }
 
 func (p *Parser) curPrecedence() int {
@@ -160,9 +185,23 @@ func (p *Parser) ParseProgram() *ast.Program {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		// 避免把 nil 的 *ast.LetStatement 包装成非 nil 的接口值
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.YIELD:
+		if stmt := p.parseYieldStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -175,6 +214,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.parseOptionalType(&stmt.Name.Type) {
+		return nil
+	}
 
 	if !p.expectedPeek(token.ASSIGN) {
 		return nil
@@ -187,7 +229,8 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		fl.Name = stmt.Name.Value
 	}
 
-	for !(p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.EOF)) {
+	// 分号可以省略, 不能跳过后面的 } 等记号
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -199,7 +242,51 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !(p.curTokenIs(token.SEMICOLON) || p.curTokenIs(token.EOF)) {
+	// 分号可以省略, 不能跳过后面的 } 等记号
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+	if len(p.functions) == 0 {
+		p.addError(p.curToken, "yield outside function")
+	} else {
+		p.functions[len(p.functions)-1].Generator = true
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectedPeek(token.LPAREN) || !p.expectedPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectedPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if stmt.Iterable == nil || !p.expectedPeek(token.RPAREN) || !p.expectedPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -243,8 +330,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -328,10 +414,15 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseOptionalType(&lit.ReturnType) {
+		return nil
+	}
 	if !p.expectedPeek(token.LBRACE) {
 		return nil
 	}
+	p.functions = append(p.functions, lit)
 	lit.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
 	return lit
 }
 
@@ -339,6 +430,28 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	tpl := &ast.TemplateLiteral{Token: p.curToken}
+
+	for {
+		if p.curToken.Literal != "" {
+			tpl.Parts = append(tpl.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		if p.curTokenIs(token.TEMPLATE_TAIL) {
+			return tpl
+		}
+
+		p.nextToken()
+		tpl.Parts = append(tpl.Parts, p.parseExpression(LOWEST))
+
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) {
+			p.nextToken()
+		} else if !p.expectedPeek(token.TEMPLATE_TAIL) {
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -359,6 +472,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectedPeek(token.COMMA) {
 			return nil
@@ -397,12 +511,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.parseOptionalType(&ident.Type) {
+		return nil
+	}
 	idents = append(idents, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 		ident = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.parseOptionalType(&ident.Type) {
+			return nil
+		}
 		idents = append(idents, ident)
 	}
 
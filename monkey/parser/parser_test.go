@@ -82,6 +82,25 @@ func TestReturnStatement(t *testing.T) {
 	}
 }
 
+// let 和 return 后面的分号可以省略, 语句在块的 } 之前结束
+func TestStatementsWithoutSemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { if (x) { return 1 } 2 }", "fn() ifx return 1;2"},
+		{"fn() { let a = 1 }; 3", "fn() let a = 1;3"},
+		{"fn() { for (x in xs) { return x } 0 }", "fn() for (x in xs) return x;0"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestExpression(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -419,6 +438,111 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestTemplateLiteralParsing(t *testing.T) {
+	input := `"hello ${name}, ${1 + 2}!"`
+	program := testParse(t, input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	tpl, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+	if len(tpl.Parts) != 5 {
+		t.Fatalf("len(tpl.Parts) not 5. got=%d", len(tpl.Parts))
+	}
+
+	for i, want := range map[int]string{0: "hello ", 2: ", ", 4: "!"} {
+		str, ok := tpl.Parts[i].(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("tpl.Parts[%d] not *ast.StringLiteral. got=%T", i, tpl.Parts[i])
+		}
+		if str.Value != want {
+			t.Errorf("tpl.Parts[%d].Value not %q. got=%q", i, want, str.Value)
+		}
+	}
+	testIdentifier(t, tpl.Parts[1], "name")
+	testInfixExpression(t, tpl.Parts[3], 1, "+", 2)
+
+	expected := `"hello ${name}, ${(1 + 2)}!"`
+	if tpl.String() != expected {
+		t.Errorf("tpl.String() wrong. want=%q, got=%q", expected, tpl.String())
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []string{
+		`"a ${1 2} b"`,
+		`"a ${} b"`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	p := New(lexer.New("let x = 1;\nlet = 2;"))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+	if errs[0].Message != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong error message. got=%q", errs[0].Message)
+	}
+	if errs[0].Token.Line != 2 || errs[0].Token.Column != 5 {
+		t.Errorf("wrong error position. want=2:5, got=%d:%d", errs[0].Token.Line, errs[0].Token.Column)
+	}
+	if p.Errors()[0] != errs[0].Message {
+		t.Errorf("Errors() and ParseErrors() disagree")
+	}
+}
+
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 1;", "let x: int = 1;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let h: {string: [bool]} = {};", "let h: {string: [bool]} = {};"},
+		{"let f: fn(int, any): null = g;", "let f: fn(int, any): null = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"fn(a: string, b): int { a }", "fn(a: string, b): int a"},
+		{"fn(g: fn(int): int) { g }", "fn(g: fn(int): int) g"},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []string{
+		"let x: = 1;",
+		"let x: [int = 1;",
+		"let x: {int} = 1;",
+		"fn(a: 1) { a }",
+		"fn(a): { a }",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestParsingEmptyArrayLiterals(t *testing.T) {
 	input := "[]"
 	program := testParse(t, input)
@@ -682,6 +806,63 @@ func TestMacroLiteral(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestForStatementParsing(t *testing.T) {
+	program := testParse(t, `for (x in xs) { x; }`)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not ast.ForStatement. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Variable, "x")
+	testIdentifier(t, stmt.Iterable, "xs")
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("stmt.Body.Statements has not 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if stmt.String() != "for (x in xs) x" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestYieldStatementParsing(t *testing.T) {
+	program := testParse(t, `fn(xs) { for (x in xs) { yield x * 2; } fn() { 1 } }`)
+	fl := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !fl.Generator {
+		t.Errorf("function containing yield is not a generator")
+	}
+	inner := fl.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if inner.Generator {
+		t.Errorf("nested function without yield is a generator")
+	}
+
+	loop := fl.Body.Statements[0].(*ast.ForStatement)
+	stmt, ok := loop.Body.Statements[0].(*ast.YieldStatement)
+	if !ok {
+		t.Fatalf("loop.Body.Statements[0] not ast.YieldStatement. got=%T", loop.Body.Statements[0])
+	}
+	testInfixExpression(t, stmt.Value, "x", "*", 2)
+}
+
+func TestForAndYieldErrors(t *testing.T) {
+	tests := []string{
+		`yield 1;`,
+		`macro() { yield 1; }`,
+		`for x in xs { x }`,
+		`for (x xs) { x }`,
+		`for (1 in xs) { x }`,
+		`for (x in xs) x`,
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func testParse(t *testing.T, input string) *ast.Program {
 	l := lexer.New(input)
 	p := New(l)
@@ -797,3 +978,28 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left any, operator st
 
 	return true
 }
+
+// FuzzParseProgram 检查任意输入都不会让语法分析 panic, 出错时要报告错误
+func FuzzParseProgram(f *testing.F) {
+	for _, seed := range []string{
+		"let add = fn(a, b) { return a + b; }; add(1, 2 * 3)",
+		`if (x < 1) { "a ${x} b" } else { [1, {"k": true}][0] }`,
+		"let g = fn(xs) { for (x in xs) { yield x } }; collect(g([1]))",
+		"let f: fn(int): [string] = fn(a: int): [string] { [] };",
+		"let m = macro(a) { quote(unquote(a)) }; m(1)",
+		"fn(,) { let = ; } ) ] } ${",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if program == nil {
+			t.Fatalf("ParseProgram() returned nil for %q", input)
+		}
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/token"
+)
+
+// parseOptionalType 在下一个 token 为 ':' 时解析类型注解并写入 dst
+func (p *Parser) parseOptionalType(dst *ast.TypeExpr) bool {
+	if !p.peekTokenIs(token.COLON) {
+		return true
+	}
+	p.nextToken()
+	p.nextToken()
+	t := p.parseType()
+	if t == nil {
+		return false
+	}
+	*dst = t
+	return true
+}
+
+// parseType 解析以 curToken 开头的类型:
+//
+//	int  string  bool  null  any  [T]  {K: V}  fn(T, ...): R
+func (p *Parser) parseType() ast.TypeExpr {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+	case token.LBRACKET:
+		t := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		if t.Elem = p.parseType(); t.Elem == nil {
+			return nil
+		}
+		if !p.expectedPeek(token.RBRACKET) {
+			return nil
+		}
+		return t
+	case token.LBRACE:
+		t := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		if t.Key = p.parseType(); t.Key == nil {
+			return nil
+		}
+		if !p.expectedPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if t.Value = p.parseType(); t.Value == nil {
+			return nil
+		}
+		if !p.expectedPeek(token.RBRACE) {
+			return nil
+		}
+		return t
+	case token.FUNCTION:
+		t := &ast.FunctionType{Token: p.curToken}
+		if !p.expectedPeek(token.LPAREN) {
+			return nil
+		}
+		if p.peekTokenIs(token.RPAREN) {
+			p.nextToken()
+		} else {
+			for {
+				p.nextToken()
+				param := p.parseType()
+				if param == nil {
+					return nil
+				}
+				t.Parameters = append(t.Parameters, param)
+				if !p.peekTokenIs(token.COMMA) {
+					break
+				}
+				p.nextToken()
+			}
+			if !p.expectedPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.parseOptionalType(&t.Return) {
+			return nil
+		}
+		return t
+	}
+
+	p.addError(p.curToken, "expected type, got %s instead", p.curToken.Type)
+	return nil
+}
@@ -0,0 +1,172 @@
+package repl
+
+import (
+	"fmt"
+	"go-example/monkey/session"
+	"os"
+	"strings"
+)
+
+type command struct {
+	usage string
+	doc   string
+	run   func(r *repl, arg string) bool // 返回 false 时退出
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"engine":   {":engine [vm|eval]", "show or switch the execution engine", (*repl).engineCommand},
+		"ast":      {":ast", "toggle printing the AST of each input", (*repl).astCommand},
+		"bytecode": {":bytecode", "toggle printing the bytecode of each input (vm engine)", (*repl).bytecodeCommand},
+		"env":      {":env", "list the global bindings of the current engine", (*repl).envCommand},
+		"load":     {":load file.mk", "run a file in the current session", (*repl).loadCommand},
+		"reset":    {":reset", "discard all bindings of both engines", (*repl).resetCommand},
+		"save":     {":save file", "write the vm session to a snapshot file", (*repl).saveCommand},
+		"restore":  {":restore file", "replace the vm session with a snapshot", (*repl).restoreCommand},
+		"help":     {":help", "show this help", (*repl).helpCommand},
+		"quit":     {":quit", "leave the REPL (same as exit)", func(*repl, string) bool { return false }},
+	}
+}
+
+// command 执行以 ':' 开头的元命令
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(r.out, "unknown command :%s (try :help)\n", name)
+		return true
+	}
+	return cmd.run(r, strings.TrimSpace(arg))
+}
+
+func (r *repl) engineCommand(arg string) bool {
+	switch arg {
+	case "":
+	case "vm", "eval":
+		r.engine = arg
+	default:
+		fmt.Fprintf(r.out, "unknown engine %q, want vm or eval\n", arg)
+		return true
+	}
+	fmt.Fprintf(r.out, "engine: %s\n", r.engine)
+	return true
+}
+
+func (r *repl) astCommand(string) bool {
+	r.showAST = !r.showAST
+	fmt.Fprintf(r.out, "ast: %s\n", onOff(r.showAST))
+	return true
+}
+
+func (r *repl) bytecodeCommand(string) bool {
+	r.showBytecode = !r.showBytecode
+	fmt.Fprintf(r.out, "bytecode: %s\n", onOff(r.showBytecode))
+	return true
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func (r *repl) envCommand(string) bool {
+	if r.engine == "eval" {
+		// 同名的 let 会占用新的下标, 只显示最后一次绑定
+		names := r.env.GlobalNames()
+		for i, name := range names {
+			if name == "" || lastIndex(names, name) != i {
+				continue
+			}
+			if value := r.env.Global(i); value != nil {
+				fmt.Fprintf(r.out, "%s = %s\n", name, value.Inspect())
+			}
+		}
+		return true
+	}
+
+	for _, binding := range r.session.Globals() {
+		fmt.Fprintf(r.out, "%s = %s\n", binding.Name, binding.Value.Inspect())
+	}
+	return true
+}
+
+func lastIndex(names []string, name string) int {
+	for i := len(names) - 1; i >= 0; i-- {
+		if names[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *repl) loadCommand(arg string) bool {
+	if arg == "" {
+		fmt.Fprintf(r.out, "usage: %s\n", commands["load"].usage)
+		return true
+	}
+	src, err := os.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return true
+	}
+	r.execute(string(src))
+	return true
+}
+
+func (r *repl) resetCommand(string) bool {
+	r.reset()
+	fmt.Fprintf(r.out, "session reset\n")
+	return true
+}
+
+func (r *repl) saveCommand(arg string) bool {
+	if arg == "" {
+		fmt.Fprintf(r.out, "usage: %s\n", commands["save"].usage)
+		return true
+	}
+	f, err := os.Create(arg)
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return true
+	}
+	defer f.Close()
+	if err := r.session.Snapshot(f); err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return true
+	}
+	fmt.Fprintf(r.out, "session saved to %s\n", arg)
+	return true
+}
+
+func (r *repl) restoreCommand(arg string) bool {
+	if arg == "" {
+		fmt.Fprintf(r.out, "usage: %s\n", commands["restore"].usage)
+		return true
+	}
+	f, err := os.Open(arg)
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return true
+	}
+	defer f.Close()
+	s, err := session.Restore(f)
+	if err != nil {
+		fmt.Fprintf(r.out, "%s\n", err)
+		return true
+	}
+	r.session = s
+	fmt.Fprintf(r.out, "session restored from %s\n", arg)
+	return true
+}
+
+func (r *repl) helpCommand(string) bool {
+	for _, name := range []string{"engine", "ast", "bytecode", "env", "load", "reset", "save", "restore", "help", "quit"} {
+		cmd := commands[name]
+		fmt.Fprintf(r.out, "  %-16s %s\n", cmd.usage, cmd.doc)
+	}
+	return true
+}
@@ -0,0 +1,244 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// 转义序列解析后得到的按键, 不与任何字符冲突
+const (
+	keyUp = utf8.MaxRune + 1 + iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// editor 是终端上的行编辑器, 支持光标移动、删除和历史记录
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+
+	// makeRaw 在读取一行期间把终端切换到 raw 模式, 返回恢复函数
+	makeRaw func() (func(), error)
+
+	line []rune
+	pos  int
+}
+
+func newTerminalEditor(f *os.File, out io.Writer, h *history) *editor {
+	fd := int(f.Fd())
+	return &editor{
+		in:      bufio.NewReader(f),
+		out:     out,
+		history: h,
+		makeRaw: func() (func(), error) {
+			state, err := term.MakeRaw(fd)
+			if err != nil {
+				return nil, err
+			}
+			return func() { term.Restore(fd, state) }, nil
+		},
+	}
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.makeRaw != nil {
+		restore, err := e.makeRaw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.line, e.pos = e.line[:0], 0
+	// index 为正在浏览的历史记录, 等于 len(entries) 时表示正在编辑的新行
+	index := len(e.history.entries)
+	pending := ""
+	e.refresh(prompt)
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			e.history.add(line)
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyBackspace, 8:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyDelete:
+			e.deleteAt(e.pos)
+		case keyCtrlA, keyHome:
+			e.pos = 0
+		case keyCtrlE, keyEnd:
+			e.pos = len(e.line)
+		case keyCtrlB, keyLeft:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyCtrlF, keyRight:
+			if e.pos < len(e.line) {
+				e.pos++
+			}
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+		case keyCtrlU:
+			e.line = append(e.line[:0], e.line[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+				start--
+			}
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp:
+			if index > 0 {
+				if index == len(e.history.entries) {
+					pending = string(e.line)
+				}
+				index--
+				e.setLine(e.history.entries[index])
+			}
+		case keyCtrlN, keyDown:
+			if index < len(e.history.entries) {
+				index++
+				if index == len(e.history.entries) {
+					e.setLine(pending)
+				} else {
+					e.setLine(e.history.entries[index])
+				}
+			}
+		default:
+			if unicode.IsPrint(key) {
+				e.line = append(e.line, 0)
+				copy(e.line[e.pos+1:], e.line[e.pos:])
+				e.line[e.pos] = key
+				e.pos++
+			}
+		}
+		e.refresh(prompt)
+	}
+}
+
+func (e *editor) setLine(s string) {
+	e.line = append(e.line[:0], []rune(s)...)
+	e.pos = len(e.line)
+}
+
+func (e *editor) deleteAt(pos int) {
+	if pos < len(e.line) {
+		e.line = append(e.line[:pos], e.line[pos+1:]...)
+	}
+}
+
+// refresh 重绘当前行并把光标移动到 pos
+func (e *editor) refresh(prompt string) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(e.line))
+	if back := len(e.line) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != '[' && b != 'O' {
+		return keyUnknown, nil
+	}
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch b {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	}
+
+	// ESC [ n ~ 形式的按键, 如 Delete(3)、Home(1/7)、End(4/8)
+	n := b
+	for b >= '0' && b <= '9' {
+		if b, err = e.in.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	if b != '~' {
+		return keyUnknown, nil
+	}
+	switch n {
+	case '3':
+		return keyDelete, nil
+	case '1', '7':
+		return keyHome, nil
+	case '4', '8':
+		return keyEnd, nil
+	}
+	return keyUnknown, nil
+}
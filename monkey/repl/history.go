@@ -0,0 +1,68 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+const maxHistory = 1000
+
+// history 是输入历史, path 不为空时每一行都会追加到文件中
+type history struct {
+	path    string
+	entries []string
+}
+
+// historyPath 默认为 ~/.monkey_history, 可以用 MONKEY_HISTORY 环境变量指定, 设为空则不保存
+func historyPath() string {
+	if path, ok := os.LookupEnv("MONKEY_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if n := len(h.entries); n > maxHistory {
+		h.entries = h.entries[n-maxHistory:]
+	}
+	return h
+}
+
+func (h *history) add(line string) {
+	if line == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if h.path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
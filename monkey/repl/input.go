@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errInterrupt 表示用户按下了 Ctrl-C, 放弃当前输入
+var errInterrupt = errors.New("interrupt")
+
+type lineReader interface {
+	// ReadLine 显示提示符并读取一行, 不包含换行符
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader 用于非终端输入(管道、文件和测试), 不做行编辑
+type plainReader struct {
+	r   *bufio.Reader
+	out io.Writer
+}
+
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	line, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// incomplete 判断输入是否还需要后续行: 括号未配对或字符串未闭合.
+// 字符串之外的 // 注释到行尾为止, 其中的括号和引号不计入
+func incomplete(src string) bool {
+	var stack []byte
+	inString := false
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			switch {
+			case c == '\\':
+				i++
+			case c == '"':
+				inString = false
+			case c == '$' && i+1 < len(src) && src[i+1] == '{':
+				// 插值表达式结束后回到字符串中
+				stack = append(stack, '$')
+				inString = false
+				i++
+			}
+			continue
+		}
+
+		switch c {
+		case '/':
+			if i+1 < len(src) && src[i+1] == '/' {
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			}
+		case '"':
+			inString = true
+		case '(', '[', '{':
+			stack = append(stack, c)
+		case ')', ']', '}':
+			if len(stack) == 0 {
+				// 多余的右括号交给语法分析报错
+				return false
+			}
+			if stack[len(stack)-1] == '$' && c == '}' {
+				inString = true
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return inString || len(stack) > 0
+}
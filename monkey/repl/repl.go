@@ -3,109 +3,187 @@ package repl
 import (
 	"bufio"
 	"fmt"
+	"go-example/monkey/ast"
 	"go-example/monkey/compiler"
 	"go-example/monkey/evaluator"
 	"go-example/monkey/lexer"
 	"go-example/monkey/object"
 	"go-example/monkey/parser"
+	"go-example/monkey/session"
 	"go-example/monkey/token"
-	"go-example/monkey/vm"
 	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
 )
 
 const PROMT = ">>"
 
+// CONTINUE_PROMT 是输入未结束(括号未配对)时的提示符
+const CONTINUE_PROMT = ".."
+
+// Start 运行交互式解释器. in 为终端时支持行编辑和历史记录, 否则逐行读取
 func Start(in io.Reader, out io.Writer) {
 	//startLexer(in, out)
 	//startParser(in, out)
-	//startEvaluator(in, out)
-	//startMacro(in, out)
-	startVM(in, out)
+	newREPL(newLineReader(in, out), out).run()
 }
 
-func startLexer(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return newTerminalEditor(f, out, loadHistory(historyPath()))
+	}
+	return &plainReader{r: bufio.NewReader(in), out: out}
+}
+
+type repl struct {
+	in  lineReader
+	out io.Writer
+
+	engine       string // "vm" 或 "eval"
+	showAST      bool
+	showBytecode bool
+
+	// vm 引擎的状态, 每次输入要么全部提交要么全部回滚
+	session *session.Session
+
+	// eval 引擎的状态
+	env      *object.Environment
+	macroEnv *object.Environment
+}
+
+func newREPL(in lineReader, out io.Writer) *repl {
+	r := &repl{in: in, out: out, engine: "vm"}
+	r.reset()
+	return r
+}
 
+func (r *repl) reset() {
+	r.session = session.New()
+
+	r.env = object.NewEnvironment()
+	r.macroEnv = object.NewEnvironment()
+}
+
+func (r *repl) run() {
 	for {
-		_, _ = fmt.Fprintf(out, PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		src, err := r.read()
+		if err == errInterrupt {
+			continue
 		}
-		line := scanner.Text()
-		if line == "exit" {
+		if err != nil {
 			return
 		}
-		l := lexer.New(line)
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			_, _ = fmt.Fprintf(out, "%+v\n", tok)
+		trimmed := strings.TrimSpace(src)
+		switch {
+		case trimmed == "":
+			continue
+		case trimmed == "exit":
+			return
+		case strings.HasPrefix(trimmed, ":"):
+			if !r.command(trimmed) {
+				return
+			}
+		default:
+			r.execute(src)
 		}
 	}
 }
 
-func startParser(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-
+// read 读取一条完整的输入, 括号未配对时继续读取后续行
+func (r *repl) read() (string, error) {
+	var lines []string
+	prompt := PROMT
 	for {
-		_, _ = fmt.Fprintf(out, PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-		line := scanner.Text()
-		if line == "exit" {
-			return
+		line, err := r.in.ReadLine(prompt)
+		if err != nil {
+			if err == io.EOF && len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
 		}
-		l := lexer.New(line)
-		p := parser.New(l)
-		prog := p.ParseProgram()
+		lines = append(lines, line)
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+		src := strings.Join(lines, "\n")
+		// 元命令只占一行
+		if len(lines) == 1 && strings.HasPrefix(strings.TrimSpace(line), ":") || !incomplete(src) {
+			return src, nil
 		}
+		prompt = CONTINUE_PROMT
+	}
+}
 
-		io.WriteString(out, prog.String())
-		io.WriteString(out, "\n")
+func (r *repl) execute(src string) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(r.out, p.Errors())
+		return
+	}
+	if r.showAST {
+		fmt.Fprintf(r.out, "%s\n", program.String())
+	}
+
+	if r.engine == "eval" {
+		r.evaluate(program)
+	} else {
+		r.runVM(program)
 	}
 }
 
-func startEvaluator(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+func (r *repl) runVM(program *ast.Program) {
+	tx, err := r.session.Compile(program)
+	if err != nil {
+		fmt.Fprintf(r.out, "Woops! Compiler failed:\n %s\n", err)
+		return
+	}
+	if r.showBytecode {
+		printBytecode(r.out, tx.Bytecode, tx.FirstConstant)
+	}
 
-	for {
-		_, _ = fmt.Fprintf(out, PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
-			return
-		}
-		line := scanner.Text()
-		if line == "exit" {
-			return
-		}
-		l := lexer.New(line)
-		p := parser.New(l)
+	stackTop, err := tx.Run()
+	if err != nil {
+		fmt.Fprintf(r.out, "Woops! Executing bytecode failed:\n %s\n", err)
+		return
+	}
+	if stackTop != nil {
+		io.WriteString(r.out, stackTop.Inspect())
+		io.WriteString(r.out, "\n")
+	}
+}
 
-		prog := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
-		}
+func (r *repl) evaluate(program *ast.Program) {
+	evaluator.DefineMacros(program, r.macroEnv)
+	expanded := evaluator.ExpandMacros(program, r.macroEnv)
+	// 出错时丢弃本次输入定义的全局变量
+	numGlobals := len(r.env.GlobalNames())
+	evaluated := evaluator.Eval(expanded, r.env)
+	if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
+		r.env.TruncateGlobals(numGlobals)
+	}
+	if evaluated != nil {
+		io.WriteString(r.out, evaluated.Inspect())
+		io.WriteString(r.out, "\n")
+	}
+}
 
-		evaluated := evaluator.Eval(prog, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+// printBytecode 打印主程序的指令和本次新增的函数常量
+func printBytecode(out io.Writer, bytecode *compiler.Bytecode, firstConstant int) {
+	fmt.Fprint(out, bytecode.Instructions.String())
+	for i := firstConstant; i < len(bytecode.Constants); i++ {
+		if fn, ok := bytecode.Constants[i].(*object.CompiledFunction); ok {
+			fmt.Fprintf(out, "constant %d:\n", i)
+			for _, line := range strings.Split(strings.TrimSuffix(fn.Instructions.String(), "\n"), "\n") {
+				fmt.Fprintf(out, "\t%s\n", line)
+			}
 		}
 	}
 }
 
-func startMacro(in io.Reader, out io.Writer) {
+func startLexer(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
 
 	for {
 		_, _ = fmt.Fprintf(out, PROMT)
@@ -118,34 +196,16 @@ func startMacro(in io.Reader, out io.Writer) {
 			return
 		}
 		l := lexer.New(line)
-		p := parser.New(l)
 
-		prog := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
-		}
-
-		evaluator.DefineMacros(prog, macroEnv)
-		expanded := evaluator.ExpandMacros(prog, macroEnv)
-		evaluated := evaluator.Eval(expanded, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			_, _ = fmt.Fprintf(out, "%+v\n", tok)
 		}
 	}
 }
 
-func startVM(in io.Reader, out io.Writer) {
+func startParser(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
-	var constants []object.Object
-	globals := make([]object.Object, vm.GlobalSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, builtin := range object.Builtins {
-		symbolTable.DefineBuiltin(i, builtin.Name)
-	}
-
 	for {
 		_, _ = fmt.Fprintf(out, PROMT)
 		scanned := scanner.Scan()
@@ -158,29 +218,14 @@ func startVM(in io.Reader, out io.Writer) {
 		}
 		l := lexer.New(line)
 		p := parser.New(l)
-
 		prog := p.ParseProgram()
+
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(prog)
-		if err != nil {
-			fmt.Fprintf(out, "Woops! Compiler failed:\n %s\n", err)
-			continue
-		}
-
-		machine := vm.NewWithGlobalStore(comp.Bytecode(), globals)
-		err = machine.Run()
-		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
-			continue
-		}
-
-		stackTop := machine.LastPoppedStackElem()
-		io.WriteString(out, stackTop.Inspect())
+		io.WriteString(out, prog.String())
 		io.WriteString(out, "\n")
 	}
 }
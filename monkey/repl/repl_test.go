@@ -0,0 +1,253 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runREPL(t *testing.T, input string) string {
+	t.Helper()
+	var out bytes.Buffer
+	in := &plainReader{r: bufio.NewReader(strings.NewReader(input)), out: &out}
+	newREPL(in, &out).run()
+	return out.String()
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n x\n}", false},
+		{"add(1,", true},
+		{"[1, [2]", true},
+		{`"abc`, true},
+		{`"a\"b"`, false},
+		{`"a ${ {"k": 1}["k"] } b"`, false},
+		{`"a ${ fn() {`, true},
+		{`"a ${1}`, true},
+		{"1)", false},
+		{"1 // (", false},
+		{`let s = "a"; // "`, false},
+		{"let f = fn() { // }\n", true},
+		{"let f = fn() { // }\n}", false},
+		{`"// ("`, false},
+		{"4 / 2", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	out := runREPL(t, "let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n")
+	if !strings.Contains(out, PROMT+CONTINUE_PROMT+CONTINUE_PROMT) {
+		t.Errorf("expected continuation prompts, got %q", out)
+	}
+	if !strings.HasSuffix(out, CONTINUE_PROMT+"3\n"+PROMT) {
+		t.Errorf("wrong output: %q", out)
+	}
+}
+
+func TestEngines(t *testing.T) {
+	input := `let x = 5;
+:engine eval
+x
+let y = 2; y * 3
+:engine
+:engine vm
+x * 2
+:engine wasm
+`
+	out := runREPL(t, input)
+	expected := []string{
+		"engine: eval",
+		// eval 引擎有自己的全局变量
+		"1:1: identifier not found: x",
+		"6",
+		"engine: eval",
+		"engine: vm",
+		"10",
+		`unknown engine "wasm", want vm or eval`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestEnvAndReset(t *testing.T) {
+	for _, engine := range []string{"vm", "eval"} {
+		input := ":engine " + engine + "\nlet a = 1;\nlet b = \"two\";\nlet a = [b];\n:env\n:reset\n:env\n"
+		out := runREPL(t, input)
+
+		if !strings.Contains(out, "a = [two]\n") || !strings.Contains(out, "b = two\n") {
+			t.Errorf("[%s] :env did not list globals:\n%s", engine, out)
+		}
+		if strings.Count(out, "a = ") != 1 {
+			t.Errorf("[%s] shadowed binding should be listed once:\n%s", engine, out)
+		}
+		_, afterReset, _ := strings.Cut(out, "session reset\n")
+		if strings.Contains(afterReset, " = ") {
+			t.Errorf("[%s] bindings survived :reset:\n%s", engine, afterReset)
+		}
+	}
+}
+
+func TestResolveErrorKeepsBindings(t *testing.T) {
+	out := runREPL(t, "let a = 1;\nlet b = a + c;\na + 1\n")
+	if !strings.Contains(out, "identifier not found: c") {
+		t.Errorf("expected resolve error, got %q", out)
+	}
+	if !strings.HasSuffix(out, "2\n"+PROMT) {
+		t.Errorf("previous bindings were lost: %q", out)
+	}
+}
+
+func TestFailedInputRollsBack(t *testing.T) {
+	for _, engine := range []string{"vm", "eval"} {
+		input := ":engine " + engine + "\nlet a = 1;\nlet b = 2; let c = a + true;\n:env\nlet d = 3; d + a\n"
+		out := runREPL(t, input)
+
+		if !strings.Contains(out, "a = 1\n") {
+			t.Errorf("[%s] committed binding lost:\n%s", engine, out)
+		}
+		if strings.Contains(out, "b = ") || strings.Contains(out, "c = ") {
+			t.Errorf("[%s] bindings of the failed input survived:\n%s", engine, out)
+		}
+		if !strings.HasSuffix(out, "4\n"+PROMT) {
+			t.Errorf("[%s] session unusable after failure:\n%s", engine, out)
+		}
+	}
+}
+
+func TestSaveAndRestore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.json")
+
+	out := runREPL(t, "let n = 20;\nlet inc = fn(x) { x + n + 1 };\n:save "+file+"\n")
+	if !strings.Contains(out, "session saved to "+file) {
+		t.Fatalf("session not saved:\n%s", out)
+	}
+
+	out = runREPL(t, "let n = 1;\n:restore "+file+"\ninc(n)\n:restore missing.json\n")
+	if !strings.Contains(out, "session restored from "+file+"\n"+PROMT+"41\n") {
+		t.Errorf("restored session not used:\n%s", out)
+	}
+	if !strings.Contains(out, "missing.json") {
+		t.Errorf("expected error for missing snapshot:\n%s", out)
+	}
+}
+
+func TestASTAndBytecode(t *testing.T) {
+	out := runREPL(t, ":ast\n:bytecode\nlet f = fn(x) { x * 2 };\n:ast\n1 + 2\n")
+	expected := []string{
+		"ast: on",
+		"bytecode: on",
+		"let f = fn<f>(x) (x * 2);",
+		"OpClosure",
+		"constant 1:\n\t0000 OpGetLocal0",
+		"ast: off",
+		"OpAddConstant",
+	}
+	for _, want := range expected {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "(1 + 2)") {
+		t.Errorf("AST printed after :ast was turned off:\n%s", out)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(file, []byte("let double = fn(x) {\n\tx * 2\n};\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runREPL(t, ":load "+file+"\ndouble(21)\n:load missing.mk\n")
+	if !strings.Contains(out, "42\n") {
+		t.Errorf("loaded definitions not available:\n%s", out)
+	}
+	if !strings.Contains(out, "missing.mk") {
+		t.Errorf("expected error for missing file:\n%s", out)
+	}
+}
+
+func TestCommandsAndExit(t *testing.T) {
+	out := runREPL(t, ":help\n:nope\n:quit\n1 + 1\n")
+	if !strings.Contains(out, ":engine [vm|eval]") {
+		t.Errorf("help not printed:\n%s", out)
+	}
+	if !strings.Contains(out, "unknown command :nope (try :help)") {
+		t.Errorf("unknown command not reported:\n%s", out)
+	}
+	if strings.Contains(out, "2\n") {
+		t.Errorf("input after :quit was evaluated:\n%s", out)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	h := &history{entries: []string{"old"}}
+	keys := strings.Join([]string{
+		"let x = 1\r",
+		// 左移两次后插入, 再用 Home/End 键
+		"ab\x1b[D\x1b[DX\x1b[Hh\x1b[F!\r",
+		// Ctrl-W 删除单词, Backspace, Ctrl-U 删除到行首
+		"foo bar\x17baz\x7f\r",
+		"junk\x15ok\r",
+		// 上箭头浏览历史
+		"\x1b[A\x1b[A\x1b[B\r",
+		"\x10\x10\x10\x10\r",
+		"\x03",
+		"\x04",
+	}, "")
+
+	e := &editor{in: bufio.NewReader(strings.NewReader(keys)), out: io.Discard, history: h}
+	expected := []string{"let x = 1", "hXab!", "foo ba", "ok", "ok", "let x = 1"}
+	for _, want := range expected {
+		got, err := e.ReadLine(PROMT)
+		if err != nil {
+			t.Fatalf("ReadLine error: %s", err)
+		}
+		if got != want {
+			t.Errorf("wrong line. want=%q, got=%q", want, got)
+		}
+	}
+	if _, err := e.ReadLine(PROMT); err != errInterrupt {
+		t.Errorf("expected interrupt, got %v", err)
+	}
+	if _, err := e.ReadLine(PROMT); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	want := []string{"old", "let x = 1", "hXab!", "foo ba", "ok", "let x = 1"}
+	if strings.Join(h.entries, "|") != strings.Join(want, "|") {
+		t.Errorf("wrong history. want=%q, got=%q", want, h.entries)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := loadHistory(path)
+	h.add("let a = 1;")
+	h.add("let a = 1;")
+	h.add("a")
+
+	reloaded := loadHistory(path)
+	if strings.Join(reloaded.entries, "|") != "let a = 1;|a" {
+		t.Errorf("wrong history entries: %q", reloaded.entries)
+	}
+}
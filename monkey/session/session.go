@@ -0,0 +1,115 @@
+package session
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/object"
+	"go-example/monkey/vm"
+	"io"
+)
+
+// Session 保存 vm 引擎在多次输入之间共享的状态: 符号表、常量和全局变量.
+// 每次输入要么完整提交, 要么在编译或运行失败时全部回滚.
+type Session struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []vm.Value
+}
+
+func New() *Session {
+	symbolTable := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
+	return &Session{
+		symbolTable: symbolTable,
+		globals:     make([]vm.Value, vm.GlobalSize),
+	}
+}
+
+// Transaction 是一次已编译但尚未提交的输入
+type Transaction struct {
+	session     *Session
+	symbolTable *compiler.SymbolTable
+	Bytecode    *compiler.Bytecode
+	// FirstConstant 是本次输入新增的第一个常量的下标
+	FirstConstant int
+
+	out io.Writer
+}
+
+// SetOutput 让本次输入中 print 的输出写入 out 而不是 object.Stdout
+func (tx *Transaction) SetOutput(out io.Writer) {
+	tx.out = out
+}
+
+// Compile 在会话状态的副本上编译程序, 失败时会话不受影响
+func (s *Session) Compile(program *ast.Program) (*Transaction, error) {
+	symbolTable := s.symbolTable.Clone()
+	// 限制容量, 保证编译器追加常量时不会写入会话的底层数组
+	constants := s.constants[:len(s.constants):len(s.constants)]
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return &Transaction{
+		session:       s,
+		symbolTable:   symbolTable,
+		Bytecode:      comp.Bytecode(),
+		FirstConstant: len(s.constants),
+	}, nil
+}
+
+// Run 运行编译好的输入, 成功时提交, 失败时把全局变量恢复到运行之前
+func (tx *Transaction) Run() (object.Object, error) {
+	s := tx.session
+	// 全局变量只会写入本次输入定义过的下标, 保存这一段即可回滚
+	saved := make([]vm.Value, tx.symbolTable.NumDefinitions())
+	copy(saved, s.globals)
+
+	machine := vm.NewWithGlobalStore(tx.Bytecode, s.globals)
+	machine.SetOutput(tx.out)
+	if err := machine.Run(); err != nil {
+		copy(s.globals, saved)
+		return nil, err
+	}
+
+	s.symbolTable = tx.symbolTable
+	s.constants = tx.Bytecode.Constants
+	return machine.LastPoppedStackElem(), nil
+}
+
+// Run 编译并运行程序
+func (s *Session) Run(program *ast.Program) (object.Object, error) {
+	tx, err := s.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Run()
+}
+
+// Binding 是一个全局变量及其当前的值
+type Binding struct {
+	Name  string
+	Value object.Object
+}
+
+// Globals 按定义顺序返回可见的全局变量, 被同名 let 覆盖的绑定不会列出
+func (s *Session) Globals() []Binding {
+	var bindings []Binding
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope != compiler.GlobalScope || isPlaceholder(symbol.Name) {
+			continue
+		}
+		if value := s.globals[symbol.Index].Object(); value != nil {
+			bindings = append(bindings, Binding{Name: symbol.Name, Value: value})
+		}
+	}
+	return bindings
+}
+
+// SymbolTable 返回已提交的符号表, 调用者不应修改
+func (s *Session) SymbolTable() *compiler.SymbolTable {
+	return s.symbolTable
+}
@@ -0,0 +1,209 @@
+package session
+
+import (
+	"bytes"
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func run(t *testing.T, s *Session, input string) (object.Object, error) {
+	t.Helper()
+	return s.Run(parse(t, input))
+}
+
+func mustRun(t *testing.T, s *Session, input string) object.Object {
+	t.Helper()
+	result, err := run(t, s, input)
+	if err != nil {
+		t.Fatalf("run %q failed: %s", input, err)
+	}
+	return result
+}
+
+func bindings(s *Session) string {
+	var out []string
+	for _, b := range s.Globals() {
+		out = append(out, b.Name+"="+b.Value.Inspect())
+	}
+	return strings.Join(out, " ")
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		// 编译失败: a 和 b 都不应该留在符号表中
+		{"let a = 10; let b = a + c;", "identifier not found: c"},
+		// 运行失败: 已经执行的 let 要撤销
+		{"let a = 10; let b = fn() { 1 }; let x = 1 + true;", "unsupported types for binary operation"},
+		{"let x = 99; x(1)", "calling non-function"},
+	}
+
+	for _, tt := range tests {
+		s := New()
+		mustRun(t, s, `let x = 1; let f = fn(n) { n + x };`)
+		numConstants := len(s.constants)
+		before := bindings(s)
+
+		_, err := run(t, s, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.err, err)
+			continue
+		}
+		if got := bindings(s); got != before {
+			t.Errorf("%q: bindings changed. want=%s, got=%s", tt.input, before, got)
+		}
+		if _, ok := s.symbolTable.Resolve("a"); ok {
+			t.Errorf("%q: symbol a survived the failed input", tt.input)
+		}
+		if len(s.constants) != numConstants {
+			t.Errorf("%q: constants changed. want=%d, got=%d", tt.input, numConstants, len(s.constants))
+		}
+		if global := s.globals[2].Object(); global != nil {
+			t.Errorf("%q: global 2 was not rolled back: %s", tt.input, global.Inspect())
+		}
+
+		// 失败之后会话依然可用, 下标从回滚后的位置继续分配
+		result := mustRun(t, s, "let a = f(2); a")
+		if result.Inspect() != "3" {
+			t.Errorf("%q: wrong result after rollback: %s", tt.input, result.Inspect())
+		}
+		if s.symbolTable.NumDefinitions() != 3 {
+			t.Errorf("%q: wrong number of globals: %d", tt.input, s.symbolTable.NumDefinitions())
+		}
+	}
+}
+
+func TestCompileDoesNotCommit(t *testing.T) {
+	s := New()
+	mustRun(t, s, "let a = 1;")
+
+	tx, err := s.Compile(parse(t, `let b = "x"; let g = fn() { b };`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.FirstConstant != 1 || len(tx.Bytecode.Constants) != 3 {
+		t.Errorf("wrong constants: first=%d, total=%d", tx.FirstConstant, len(tx.Bytecode.Constants))
+	}
+	if _, ok := s.symbolTable.Resolve("b"); ok {
+		t.Errorf("Compile committed symbol b")
+	}
+	if len(s.constants) != 1 {
+		t.Errorf("Compile committed constants: %d", len(s.constants))
+	}
+
+	if _, err := tx.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := bindings(s); !strings.HasPrefix(got, "a=1 b=x g=Closure") {
+		t.Errorf("wrong bindings after commit: %s", got)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := New()
+	mustRun(t, s, `
+let x = 1;
+let get = fn() { x };
+let x = 2;
+let adder = fn(a) { fn(b) { a + b } };
+let addFive = adder(5);
+let data = {"k": [1, true, if (false) { 1 }], 2: "two", false: len};
+let size = len;
+`)
+
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %s", err)
+	}
+	restored, err := Restore(&buf)
+	if err != nil {
+		t.Fatalf("Restore failed: %s", err)
+	}
+
+	var names []string
+	for _, b := range restored.Globals() {
+		names = append(names, b.Name)
+	}
+	if got := strings.Join(names, " "); got != "get x adder addFive data size" {
+		t.Errorf("wrong bindings after restore: %s", got)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// get 仍然引用被覆盖的 x
+		{"get()", "1"},
+		{"x", "2"},
+		{"addFive(10)", "15"},
+		{`data["k"][1] == true`, "true"},
+		{`data[false]([1, 2])`, "2"},
+		{`size(data["k"])`, "3"},
+		{`collect(data)`, "[k, 2, false]"},
+		{`{[1, "a"]: 1}[[1, "a"]]`, "1"},
+		{"let y = x * 10; y", "20"},
+	}
+	for _, tt := range tests {
+		result := mustRun(t, restored, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+	if restored.symbolTable.NumDefinitions() != s.symbolTable.NumDefinitions()+1 {
+		t.Errorf("restored session allocated wrong global index")
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"not json", "invalid snapshot"},
+		{`{"version": 9}`, "unsupported snapshot version 9"},
+		{`{"version": 1, "globals": [{"name": "f", "value": {"type": "closure", "fn": 3}}]}`, "global f: closure refers to unknown constant 3"},
+		{`{"version": 1, "globals": [{"value": {"type": "builtin", "name": "nope"}}]}`, `global $0: unknown builtin function "nope"`},
+		{`{"version": 1, "constants": [{"type": "macro"}]}`, `constant 0: cannot restore value of type "macro"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Restore(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("wrong error. want=%q, got=%v", tt.err, err)
+		}
+	}
+}
+
+func TestTransactionOutput(t *testing.T) {
+	s := New()
+	mustRun(t, s, `let greet = fn(name) { print("hi", name) };`)
+
+	tx, err := s.Compile(parse(t, `greet("a"); greet("b")`))
+	if err != nil {
+		t.Fatalf("compile failed: %s", err)
+	}
+	var out bytes.Buffer
+	tx.SetOutput(&out)
+	if _, err := tx.Run(); err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if got := out.String(); got != "hi\na\nhi\nb\n" {
+		t.Errorf("wrong output: %q", got)
+	}
+}
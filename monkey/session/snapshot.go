@@ -0,0 +1,301 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-example/monkey/code"
+	"go-example/monkey/compiler"
+	"go-example/monkey/object"
+	"go-example/monkey/vm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const snapshotVersion = 1
+
+// snapshot 是会话在磁盘上的 JSON 格式.
+// Globals 按下标排列, 被同名 let 覆盖的全局变量没有名字, 但闭包可能仍通过下标引用它们.
+type snapshot struct {
+	Version   int      `json:"version"`
+	Constants []*value `json:"constants"`
+	Globals   []global `json:"globals"`
+}
+
+type global struct {
+	Name  string `json:"name,omitempty"`
+	Value *value `json:"value,omitempty"`
+}
+
+type value struct {
+	Type string `json:"type"`
+
+	Int      int64    `json:"int,omitempty"`
+	Str      string   `json:"str,omitempty"`
+	Bool     bool     `json:"bool,omitempty"`
+	Elements []*value `json:"elements,omitempty"`
+	Pairs    []pair   `json:"pairs,omitempty"`
+
+	// 编译后的函数
+	Instructions  code.Instructions `json:"instructions,omitempty"`
+	NumLocals     int               `json:"num_locals,omitempty"`
+	NumParameters int               `json:"num_parameters,omitempty"`
+
+	// 闭包引用的常量下标和捕获的自由变量
+	Fn   int      `json:"fn,omitempty"`
+	Free []*value `json:"free,omitempty"`
+
+	// 内置函数的名字
+	Name string `json:"name,omitempty"`
+}
+
+type pair struct {
+	Key   *value `json:"key"`
+	Value *value `json:"value"`
+}
+
+// Snapshot 把已提交的会话状态写入 w
+func (s *Session) Snapshot(w io.Writer) error {
+	e := &encoder{functions: make(map[*object.CompiledFunction]int)}
+	snap := snapshot{Version: snapshotVersion}
+
+	for i, constant := range s.constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			e.functions[fn] = i
+		}
+	}
+	for _, constant := range s.constants {
+		v, err := e.encode(constant)
+		if err != nil {
+			return err
+		}
+		snap.Constants = append(snap.Constants, v)
+	}
+
+	snap.Globals = make([]global, s.symbolTable.NumDefinitions())
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope == compiler.GlobalScope && !isPlaceholder(symbol.Name) {
+			snap.Globals[symbol.Index].Name = symbol.Name
+		}
+	}
+	for i := range snap.Globals {
+		value := s.globals[i].Object()
+		if value == nil {
+			continue
+		}
+		v, err := e.encode(value)
+		if err != nil {
+			return fmt.Errorf("global %s: %w", globalName(snap.Globals[i].Name, i), err)
+		}
+		snap.Globals[i].Value = v
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snap)
+}
+
+// Restore 从 r 读取 Snapshot 写入的状态, 创建新的会话
+func Restore(r io.Reader) (*Session, error) {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+
+	s := New()
+	if len(snap.Globals) > len(s.globals) {
+		return nil, fmt.Errorf("too many globals in snapshot: %d", len(snap.Globals))
+	}
+
+	// 先解码所有编译后的函数, 闭包按下标引用它们
+	d := &decoder{constants: make([]object.Object, len(snap.Constants))}
+	for i, v := range snap.Constants {
+		if v != nil && v.Type == object.COMPILED_FUNCTION_OBJ {
+			d.constants[i] = &object.CompiledFunction{
+				Instructions:  v.Instructions,
+				NumLocals:     v.NumLocals,
+				NumParameters: v.NumParameters,
+			}
+		}
+	}
+	for i, v := range snap.Constants {
+		if d.constants[i] != nil {
+			continue
+		}
+		obj, err := d.decode(v)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		d.constants[i] = obj
+	}
+	s.constants = d.constants
+
+	for i, g := range snap.Globals {
+		s.symbolTable.Define(globalName(g.Name, i))
+		if g.Value == nil {
+			continue
+		}
+		obj, err := d.decode(g.Value)
+		if err != nil {
+			return nil, fmt.Errorf("global %s: %w", globalName(g.Name, i), err)
+		}
+		s.globals[i] = vm.ValueOf(obj)
+	}
+	return s, nil
+}
+
+// 被覆盖的全局变量恢复时使用占位名, '$' 不会出现在标识符中
+func globalName(name string, index int) string {
+	if name == "" {
+		return "$" + strconv.Itoa(index)
+	}
+	return name
+}
+
+func isPlaceholder(name string) bool {
+	return strings.HasPrefix(name, "$")
+}
+
+type encoder struct {
+	functions map[*object.CompiledFunction]int
+}
+
+func (e *encoder) encode(obj object.Object) (*value, error) {
+	v := &value{Type: string(obj.Type())}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		v.Int = obj.Value
+	case *object.String:
+		v.Str = obj.Value
+	case *object.Boolean:
+		v.Bool = obj.Value
+	case *object.Null:
+	case *object.Array:
+		for _, elem := range obj.Elements() {
+			ev, err := e.encode(elem)
+			if err != nil {
+				return nil, err
+			}
+			v.Elements = append(v.Elements, ev)
+		}
+	case *object.Hash:
+		// 按插入顺序保存, 恢复后的顺序不变
+		for _, p := range obj.Ordered() {
+			key, err := e.encode(p.Key)
+			if err != nil {
+				return nil, err
+			}
+			val, err := e.encode(p.Value)
+			if err != nil {
+				return nil, err
+			}
+			v.Pairs = append(v.Pairs, pair{Key: key, Value: val})
+		}
+	case *object.CompiledFunction:
+		v.Instructions = obj.Instructions
+		v.NumLocals = obj.NumLocals
+		v.NumParameters = obj.NumParameters
+	case *object.Closure:
+		index, ok := e.functions[obj.Fn]
+		if !ok {
+			return nil, fmt.Errorf("closure refers to an unknown function")
+		}
+		v.Fn = index
+		for _, free := range obj.Free {
+			fv, err := e.encode(free)
+			if err != nil {
+				return nil, err
+			}
+			v.Free = append(v.Free, fv)
+		}
+	case *object.Builtin:
+		for _, def := range object.Builtins {
+			if def.Builtin == obj {
+				v.Name = def.Name
+			}
+		}
+		if v.Name == "" {
+			return nil, fmt.Errorf("unknown builtin function")
+		}
+	default:
+		return nil, fmt.Errorf("cannot snapshot value of type %s", obj.Type())
+	}
+	return v, nil
+}
+
+type decoder struct {
+	constants []object.Object
+}
+
+func (d *decoder) decode(v *value) (object.Object, error) {
+	if v == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch v.Type {
+	case object.INTEGER_OBJ:
+		return &object.Integer{Value: v.Int}, nil
+	case object.STRING_OBJ:
+		return &object.String{Value: v.Str}, nil
+	case object.BOOLEAN_OBJ:
+		if v.Bool {
+			return object.True, nil
+		}
+		return object.False, nil
+	case object.NULL_OBJ:
+		return object.NULL, nil
+	case object.ARRAY_OBJ:
+		elements := make([]object.Object, 0, len(v.Elements))
+		for _, ev := range v.Elements {
+			elem, err := d.decode(ev)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, elem)
+		}
+		return object.NewArray(elements), nil
+	case object.HASH_OBJ:
+		hash := &object.Hash{}
+		for _, p := range v.Pairs {
+			key, err := d.decode(p.Key)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := object.HashKeyOf(key)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := d.decode(p.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash = hash.Set(hashKey, object.HashPair{Key: key, Value: val})
+		}
+		return hash, nil
+	case object.CLOSURE_OBJ:
+		if v.Fn < 0 || v.Fn >= len(d.constants) {
+			return nil, fmt.Errorf("closure refers to unknown constant %d", v.Fn)
+		}
+		fn, ok := d.constants[v.Fn].(*object.CompiledFunction)
+		if !ok {
+			return nil, fmt.Errorf("constant %d is not a function", v.Fn)
+		}
+		free := make([]object.Object, 0, len(v.Free))
+		for _, fv := range v.Free {
+			obj, err := d.decode(fv)
+			if err != nil {
+				return nil, err
+			}
+			free = append(free, obj)
+		}
+		return &object.Closure{Fn: fn, Free: free}, nil
+	case object.BUILTIN_OBJ:
+		if builtin, ok := object.BuiltinsMap[v.Name]; ok {
+			return builtin, nil
+		}
+		return nil, fmt.Errorf("unknown builtin function %q", v.Name)
+	}
+	return nil, fmt.Errorf("cannot restore value of type %q", v.Type)
+}
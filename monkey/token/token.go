@@ -5,6 +5,8 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 所在行, 从 1 开始
+	Column  int // 所在列(字节偏移), 从 1 开始
 }
 
 const (
@@ -51,6 +53,14 @@ const (
 	RETURN   TokenType = "RETURN"
 	STRING   TokenType = "STRING"
 	MACRO    TokenType = "MACRO"
+	FOR      TokenType = "FOR"
+	IN       TokenType = "IN"
+	YIELD    TokenType = "YIELD"
+
+	// 模板字符串 "a ${x} b ${y} c" 被切分为 HEAD("a ") MIDDLE(" b ") TAIL(" c")
+	TEMPLATE_HEAD   TokenType = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE TokenType = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   TokenType = "TEMPLATE_TAIL"
 )
 
 var keywords = map[string]TokenType{
@@ -62,6 +72,9 @@ var keywords = map[string]TokenType{
 	"true":   TRUE,
 	"false":  FALSE,
 	"macro":  MACRO,
+	"for":    FOR,
+	"in":     IN,
+	"yield":  YIELD,
 }
 
 func LookupIdent(ident string) TokenType {
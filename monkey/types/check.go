@@ -0,0 +1,448 @@
+package types
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/token"
+	"sort"
+)
+
+type Error struct {
+	Token   token.Token
+	Message string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Token.Line, e.Token.Column, e.Message)
+}
+
+// Check 对程序做渐进式类型检查.
+// 未注解的名字和参数为 any, let 的类型由右侧表达式推断, 函数的返回值类型由函数体推断,
+// 因此未注解的程序只会在类型确定冲突(如 1 + "a")时报错.
+func Check(program *ast.Program) []Error {
+	c := &checker{resolved: make(map[ast.TypeExpr]Type)}
+	c.statements(program.Statements, newScope(nil))
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		ti, tj := c.errors[i].Token, c.errors[j].Token
+		if ti.Line != tj.Line {
+			return ti.Line < tj.Line
+		}
+		return ti.Column < tj.Column
+	})
+	return c.errors
+}
+
+type scope struct {
+	types map[string]Type
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{types: make(map[string]Type), outer: outer}
+}
+
+func (s *scope) lookup(name string) Type {
+	for sc := s; sc != nil; sc = sc.outer {
+		if t, ok := sc.types[name]; ok {
+			return t
+		}
+	}
+	if t, ok := builtins[name]; ok {
+		return t
+	}
+	// 未定义的名字由编译器报告
+	return Any
+}
+
+// function 记录正在检查的函数的返回值类型
+type function struct {
+	declared Type // 注解的返回值类型, 未注解时为 nil
+	returns  Type // 推断出的返回值类型
+}
+
+type checker struct {
+	errors    []Error
+	functions []*function
+	resolved  map[ast.TypeExpr]Type
+}
+
+func (c *checker) errorf(tok token.Token, format string, a ...any) {
+	c.errors = append(c.errors, Error{Token: tok, Message: fmt.Sprintf(format, a...)})
+}
+
+// resolve 把类型注解转换为类型, 未知的类型名按 any 处理
+func (c *checker) resolve(t ast.TypeExpr) Type {
+	// 函数的注解会被 let 和函数字面量各解析一次, 缓存结果以免重复报错
+	if resolved, ok := c.resolved[t]; ok {
+		return resolved
+	}
+	resolved := c.resolveType(t)
+	c.resolved[t] = resolved
+	return resolved
+}
+
+func (c *checker) resolveType(t ast.TypeExpr) Type {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		if basic, ok := basics[t.Name]; ok {
+			return basic
+		}
+		c.errorf(t.Token, "unknown type %s", t.Name)
+	case *ast.ArrayType:
+		return &Array{Elem: c.resolve(t.Elem)}
+	case *ast.HashType:
+		key := c.resolve(t.Key)
+		if !isHashable(key) {
+			c.errorf(t.Token, "invalid hash key type %s", key)
+		}
+		return &Hash{Key: key, Value: c.resolve(t.Value)}
+	case *ast.FunctionType:
+		fn := &Function{Return: Any}
+		for _, p := range t.Parameters {
+			fn.Params = append(fn.Params, c.resolve(p))
+		}
+		if t.Return != nil {
+			fn.Return = c.resolve(t.Return)
+		}
+		return fn
+	}
+	return Any
+}
+
+// annotated 返回标识符注解的类型, 未注解时为 nil
+func (c *checker) annotated(ident *ast.Identifier) Type {
+	if ident.Type == nil {
+		return nil
+	}
+	return c.resolve(ident.Type)
+}
+
+func (c *checker) statements(stmts []ast.Statement, sc *scope) Type {
+	var result Type = Null
+	for _, stmt := range stmts {
+		result = c.statement(stmt, sc)
+	}
+	return result
+}
+
+// statement 返回语句作为块中最后一条语句时的值的类型
+func (c *checker) statement(stmt ast.Statement, sc *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.let(stmt, sc)
+	case *ast.ReturnStatement:
+		t := c.expression(stmt.ReturnValue, sc)
+		if n := len(c.functions); n > 0 {
+			c.returned(c.functions[n-1], stmt.ReturnValue, t, stmt.Token)
+		}
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression, sc)
+	case *ast.YieldStatement:
+		c.expression(stmt.Value, sc)
+	case *ast.ForStatement:
+		c.forStatement(stmt, sc)
+	}
+	return Null
+}
+
+// forStatement 检查可迭代对象, 循环变量的类型为数组的元素类型, 遍历字符串时为 string
+func (c *checker) forStatement(stmt *ast.ForStatement, sc *scope) {
+	t := c.expression(stmt.Iterable, sc)
+	var elem Type = Any
+	switch t := t.(type) {
+	case *Array:
+		elem = t.Elem
+	case *Hash:
+		// 与 object.Iterate 相同, 遍历哈希得到它的键
+		elem = t.Key
+	case *Basic:
+		if t == String {
+			elem = String
+		} else if t != Any {
+			c.errorf(stmt.Token, "cannot iterate over %s (type %s)", stmt.Iterable, t)
+		}
+	default:
+		c.errorf(stmt.Token, "cannot iterate over %s (type %s)", stmt.Iterable, t)
+	}
+	sc.types[stmt.Variable.Value] = elem
+	c.block(stmt.Body, sc)
+}
+
+func (c *checker) let(stmt *ast.LetStatement, sc *scope) {
+	name := stmt.Name.Value
+	declared := c.annotated(stmt.Name)
+
+	// 与编译器一致, 名字在右侧表达式之前定义, 以支持递归函数
+	switch {
+	case declared != nil:
+		sc.types[name] = declared
+	default:
+		if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			sc.types[name] = c.signature(fl)
+		} else {
+			sc.types[name] = Any
+		}
+	}
+
+	t := c.expression(stmt.Value, sc)
+	if declared == nil {
+		sc.types[name] = t
+		return
+	}
+	if !Consistent(t, declared) {
+		c.errorf(stmt.Name.Token, "cannot use %s (type %s) as %s in let %s", stmt.Value, t, declared, name)
+	}
+}
+
+// signature 只根据注解得到函数的类型, 返回值未注解时为 any
+func (c *checker) signature(fl *ast.FunctionLiteral) *Function {
+	fn := &Function{Return: Any}
+	for _, p := range fl.Parameters {
+		if t := c.annotated(p); t != nil {
+			fn.Params = append(fn.Params, t)
+		} else {
+			fn.Params = append(fn.Params, Any)
+		}
+	}
+	if fl.ReturnType != nil {
+		fn.Return = c.resolve(fl.ReturnType)
+	}
+	return fn
+}
+
+func (c *checker) returned(fn *function, exp ast.Expression, t Type, tok token.Token) {
+	if fn.declared != nil && !Consistent(t, fn.declared) {
+		c.errorf(tok, "cannot use %s (type %s) as %s in return", exp, t, fn.declared)
+	}
+	fn.returns = join(fn.returns, t)
+}
+
+func (c *checker) block(block *ast.BlockStatement, sc *scope) Type {
+	if block == nil {
+		return Null
+	}
+	return c.statements(block.Statements, sc)
+}
+
+func (c *checker) expression(exp ast.Expression, sc *scope) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.TemplateLiteral:
+		for _, part := range exp.Parts {
+			c.expression(part, sc)
+		}
+		return String
+	case *ast.Identifier:
+		return sc.lookup(exp.Value)
+	case *ast.PrefixExpression:
+		return c.prefix(exp, sc)
+	case *ast.InfixExpression:
+		return c.infix(exp, sc)
+	case *ast.IfExpression:
+		c.expression(exp.Condition, sc)
+		consequence := c.block(exp.Consequence, sc)
+		alternative := c.block(exp.Alternative, sc)
+		return join(consequence, alternative)
+	case *ast.FunctionLiteral:
+		return c.function(exp, sc)
+	case *ast.CallExpression:
+		return c.call(exp, sc)
+	case *ast.IndexExpression:
+		return c.index(exp, sc)
+	case *ast.ArrayLiteral:
+		var elem Type
+		for _, e := range exp.Elements {
+			elem = join(elem, c.expression(e, sc))
+		}
+		if elem == nil {
+			elem = Any
+		}
+		return &Array{Elem: elem}
+	case *ast.HashLiteral:
+		return c.hash(exp, sc)
+	case *ast.BlockStatement:
+		return c.block(exp, sc)
+	}
+	// 宏在展开前无法检查
+	return Any
+}
+
+func (c *checker) prefix(exp *ast.PrefixExpression, sc *scope) Type {
+	right := c.expression(exp.Right, sc)
+	switch exp.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if !Consistent(right, Int) {
+			c.errorf(exp.Token, "unknown operator: -%s", right)
+		}
+		return Int
+	}
+	return Any
+}
+
+func (c *checker) infix(exp *ast.InfixExpression, sc *scope) Type {
+	left := c.expression(exp.Left, sc)
+	right := c.expression(exp.Right, sc)
+
+	var result Type
+	switch exp.Operator {
+	case "<", ">", "==", "!=":
+		result = Bool
+	case "-", "*", "/":
+		result = Int
+	case "+":
+		result = join(left, right)
+		if left == Any {
+			result = right
+		} else if right == Any {
+			result = left
+		}
+	default:
+		return Any
+	}
+	// object.Equal 对任意两个值都有定义, 类型不同时结果为 false
+	if left == Any || right == Any || exp.Operator == "==" || exp.Operator == "!=" {
+		return result
+	}
+
+	if left.String() != right.String() {
+		c.errorf(exp.Token, "type mismatch: %s %s %s", left, exp.Operator, right)
+		return result
+	}
+	ok := false
+	switch left {
+	case Int:
+		ok = true
+	case String:
+		ok = exp.Operator == "+" || exp.Operator == "<" || exp.Operator == ">"
+	}
+	if !ok {
+		c.errorf(exp.Token, "unknown operator: %s %s %s", left, exp.Operator, right)
+	}
+	return result
+}
+
+func (c *checker) function(fl *ast.FunctionLiteral, sc *scope) Type {
+	sig := c.signature(fl)
+	inner := newScope(sc)
+	if fl.Name != "" {
+		inner.types[fl.Name] = sc.lookup(fl.Name)
+	}
+	for i, p := range fl.Parameters {
+		inner.types[p.Value] = sig.Params[i]
+	}
+
+	fn := &function{}
+	if fl.ReturnType != nil {
+		fn.declared = sig.Return
+	}
+	c.functions = append(c.functions, fn)
+	body := c.block(fl.Body, inner)
+	c.functions = c.functions[:len(c.functions)-1]
+
+	// 调用生成器函数得到迭代器, 函数体的值不是返回值
+	if fl.Generator {
+		if fn.declared == nil {
+			sig.Return = Any
+		}
+		return sig
+	}
+
+	// 最后一条语句的值也是返回值
+	if n := len(fl.Body.Statements); n > 0 {
+		switch last := fl.Body.Statements[n-1].(type) {
+		case *ast.ExpressionStatement:
+			c.returned(fn, last.Expression, body, last.Token)
+		case *ast.LetStatement:
+			c.returned(fn, last.Name, Null, last.Token)
+		}
+	} else {
+		c.returned(fn, fl, Null, fl.Token)
+	}
+
+	if fn.declared == nil {
+		sig.Return = fn.returns
+	}
+	return sig
+}
+
+func (c *checker) call(call *ast.CallExpression, sc *scope) Type {
+	if ident, ok := call.Function.(*ast.Identifier); ok && (ident.Value == "quote" || ident.Value == "unquote") {
+		return Any
+	}
+
+	callee := c.expression(call.Function, sc)
+	var args []Type
+	for _, arg := range call.Arguments {
+		args = append(args, c.expression(arg, sc))
+	}
+
+	switch fn := callee.(type) {
+	case *Function:
+		if !fn.Variadic {
+			if len(args) != len(fn.Params) {
+				c.errorf(call.Token, "wrong number of arguments in call to %s: want=%d, got=%d",
+					call.Function, len(fn.Params), len(args))
+				return fn.Return
+			}
+			for i, arg := range args {
+				if !Consistent(arg, fn.Params[i]) {
+					c.errorf(call.Token, "cannot use %s (type %s) as %s in argument %d to %s",
+						call.Arguments[i], arg, fn.Params[i], i+1, call.Function)
+				}
+			}
+		}
+		return fn.Return
+	}
+	if callee != Any {
+		c.errorf(call.Token, "cannot call non-function %s (type %s)", call.Function, callee)
+	}
+	return Any
+}
+
+func (c *checker) index(exp *ast.IndexExpression, sc *scope) Type {
+	left := c.expression(exp.Left, sc)
+	index := c.expression(exp.Index, sc)
+
+	// 越界或不存在的键在运行时得到 null, 这里与注解一样不区分
+	switch left := left.(type) {
+	case *Array:
+		if !Consistent(index, Int) {
+			c.errorf(exp.Token, "cannot index %s with %s", left, index)
+		}
+		return left.Elem
+	case *Hash:
+		if !Consistent(index, left.Key) {
+			c.errorf(exp.Token, "cannot index %s with %s", left, index)
+		}
+		return left.Value
+	}
+	if left != Any {
+		c.errorf(exp.Token, "index operator not supported: %s", left)
+	}
+	return Any
+}
+
+func (c *checker) hash(hash *ast.HashLiteral, sc *scope) Type {
+	var key, value Type
+	for _, k := range hash.Keys {
+		v := hash.Pairs[k]
+		kt := c.expression(k, sc)
+		if !isHashable(kt) {
+			c.errorf(hash.Token, "unusable as hash key: %s", kt)
+		}
+		key = join(key, kt)
+		value = join(value, c.expression(v, sc))
+	}
+	if key == nil {
+		key, value = Any, Any
+	}
+	return &Hash{Key: key, Value: value}
+}
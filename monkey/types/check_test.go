@@ -0,0 +1,158 @@
+package types
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// 未注解的程序只在类型确定冲突时报错
+		{`let add = fn(a, b) { a + b }; add(1, 2); add("a", "b");`, nil},
+		{`let x = 1; let y = "a"; x + y;`, []string{"1:27: type mismatch: int + string"}},
+		{`true + false; -"a"; "a" - "b"`, []string{
+			"1:6: unknown operator: bool + bool",
+			"1:15: unknown operator: -string",
+			"1:25: unknown operator: string - string",
+		}},
+		{`let f = fn(x) { if (x) { 1 } else { "a" } }; f(true) + 1;`, nil},
+		{`let f = fn() { 1 }; f() + "a";`, []string{"1:25: type mismatch: int + string"}},
+		{`let b: bool = [1] == [1]; let c: bool = 1 != "a"; let d: bool = "a" < "b";`, nil},
+		{`true > false; 1 < "a"`, []string{
+			"1:6: unknown operator: bool > bool",
+			"1:17: type mismatch: int < string",
+		}},
+
+		// let 注解
+		{`let x: int = 1; let s: string = "a"; let b: bool = 1 < 2;`, nil},
+		{`let x: int = "a";`, []string{`1:5: cannot use a (type string) as int in let x`}},
+		{`let xs: [int] = [1, 2]; let ys: [int] = [1, "a"]; let zs: [string] = [1];`, []string{
+			"1:55: cannot use [1] (type [int]) as [string] in let zs",
+		}},
+		{`let h: {string: int} = {"a": 1}; let g: {int: int} = {"a": 1};`, []string{
+			`1:38: cannot use {a:1} (type {string: int}) as {int: int} in let g`,
+		}},
+		{`let x: integer = 1; let h: {[fn()]: int} = {}; let ok: {[int]: int} = {};`, []string{
+			"1:8: unknown type integer",
+			"1:28: invalid hash key type [fn(): any]",
+		}},
+		{`let x: int = 1; x + "a";`, []string{`1:19: type mismatch: int + string`}},
+
+		// 函数注解
+		{`let f = fn(a: int, b: int): int { a + b }; f(1, 2); f(1, "b"); f(1);`, []string{
+			`1:54: cannot use b (type string) as int in argument 2 to f`,
+			`1:65: wrong number of arguments in call to f: want=2, got=1`,
+		}},
+		{`let f = fn(a: string): int { a };`, []string{
+			`1:30: cannot use a (type string) as int in return`,
+		}},
+		{`let f = fn(a): int { if (a) { return "x"; } 1 };`, []string{
+			`1:31: cannot use x (type string) as int in return`,
+		}},
+		{`let f = fn(a: int) { a }; let g: fn(string): int = f; let h: fn(int): int = f;`, []string{
+			`1:31: cannot use f (type fn(int): int) as fn(string): int in let g`,
+		}},
+		{`let apply = fn(g: fn(int): int, x: int): int { g(x) }; apply(fn(x) { x * 2 }, 1); apply(len, 1);`, nil},
+		{`let fact = fn(n: int): int { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact("a");`, []string{
+			`1:79: cannot use a (type string) as int in argument 1 to fact`,
+		}},
+
+		// 内置函数与调用
+		{`len(1, 2); print(1, "a"); let n: string = len("a");`, []string{
+			`1:4: wrong number of arguments in call to len: want=1, got=2`,
+			`1:31: cannot use len(a) (type int) as string in let n`,
+		}},
+		{`let ch = channel(1); let r: int = recv(spawn(len, "a")); let s: string = send(ch, 1); select(ch); select(1);`, []string{
+			`1:62: cannot use send(ch, 1) (type null) as string in let s`,
+			`1:105: cannot use 1 (type int) as [any] in argument 1 to select`,
+		}},
+		{`let one = 1; one(); [1](0);`, []string{
+			`1:17: cannot call non-function one (type int)`,
+			`1:24: cannot call non-function [1] (type [int])`,
+		}},
+
+		// 索引
+		{`let xs = [1, 2]; let x: int = xs[0]; xs["a"]; 1[0]; {"a": 1}[true];`, []string{
+			`1:40: cannot index [int] with string`,
+			`1:48: index operator not supported: int`,
+			`1:61: cannot index {string: int} with bool`,
+		}},
+		// 数组和哈希按结构作为键
+		{`{[1]: 2, {"a": [true]}: 3}; {[fn() { 1 }]: 2}`, []string{"1:29: unusable as hash key: [fn(): int]"}},
+
+		// 生成器和 for ... in
+		{`for (x in [1, 2]) { let s: string = x; } for (c in "ab") { let n: int = c; } for (b in true) {}`, []string{
+			`1:25: cannot use x (type int) as string in let s`,
+			`1:64: cannot use c (type string) as int in let n`,
+			`1:78: cannot iterate over true (type bool)`,
+		}},
+		{`for (k in {"a": 1}) { let n: int = k; } for (k in {1: "a"}) { let n: int = k; }`, []string{
+			`1:27: cannot use k (type string) as int in let n`,
+		}},
+		// 调用生成器函数得到的是迭代器, 不是函数体的值
+		{`let g = fn() { yield 1; "s" }; let xs: [int] = collect(g()); g() + 1;`, nil},
+
+		{`let s: int = json_stringify({"a": 1}, 2); let v: int = json_parse("1"); json_parse(1);`, []string{
+			`1:5: cannot use json_stringify({a:1}, 2) (type string) as int in let s`,
+			`1:83: cannot use 1 (type int) as string in argument 1 to json_parse`,
+		}},
+
+		// 宏在展开前不检查
+		{`let m = macro(a) { quote(unquote(a) + "x") }; m(1) + 1;`, nil},
+	}
+
+	for _, tt := range tests {
+		errs := Check(testParse(t, tt.input))
+		if len(errs) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%d, got=%d", tt.input, len(tt.expected), len(errs))
+			for _, err := range errs {
+				t.Logf("\t%s", err)
+			}
+			continue
+		}
+		for i, want := range tt.expected {
+			if got := errs[i].Error(); got != want {
+				t.Errorf("wrong error for %q.\nwant=%q\ngot=%q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	tests := []struct {
+		a, b     Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{Any, String, true},
+		{&Array{Int}, &Array{Any}, true},
+		{&Array{Int}, &Array{String}, false},
+		{&Hash{String, Int}, &Hash{String, Any}, true},
+		{&Function{Params: []Type{Int}, Return: Int}, &Function{Params: []Type{Any}, Return: Int}, true},
+		{&Function{Params: []Type{Int}, Return: Int}, &Function{Params: []Type{Int, Int}, Return: Int}, false},
+		{&Function{Return: Null, Variadic: true}, &Function{Params: []Type{Int}, Return: Null}, true},
+		{&Array{Int}, Int, false},
+	}
+
+	for _, tt := range tests {
+		if got := Consistent(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Consistent(%s, %s) wrong. want=%t, got=%t", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func testParse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
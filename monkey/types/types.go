@@ -0,0 +1,151 @@
+package types
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Type 是静态类型, Any 表示未知(动态)类型, 与任何类型都相容
+type Type interface {
+	String() string
+}
+
+type Basic struct {
+	name string
+}
+
+func (b *Basic) String() string { return b.name }
+
+var (
+	Int    = &Basic{"int"}
+	String = &Basic{"string"}
+	Bool   = &Basic{"bool"}
+	Null   = &Basic{"null"}
+	Any    = &Basic{"any"}
+)
+
+var basics = map[string]Type{
+	"int":    Int,
+	"string": String,
+	"bool":   Bool,
+	"null":   Null,
+	"any":    Any,
+}
+
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return "[" + a.Elem.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+type Function struct {
+	Params   []Type
+	Return   Type
+	Variadic bool // 为 true 时接受任意个参数, 如 print
+}
+
+func (f *Function) String() string {
+	var out bytes.Buffer
+
+	var params []string
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	if f.Variadic {
+		out.WriteString("...")
+	}
+	out.WriteString("): ")
+	out.WriteString(f.Return.String())
+
+	return out.String()
+}
+
+// Consistent 判断两个类型是否相容: Any 与任何类型相容, 其余按结构比较
+func Consistent(a, b Type) bool {
+	if a == Any || b == Any {
+		return true
+	}
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Consistent(a.Elem, b.Elem)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && Consistent(a.Key, b.Key) && Consistent(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok {
+			return false
+		}
+		if a.Variadic || b.Variadic {
+			return Consistent(a.Return, b.Return)
+		}
+		if len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !Consistent(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return Consistent(a.Return, b.Return)
+	}
+	return a == b
+}
+
+// join 返回两个类型的公共类型, 不相同时退化为 Any
+func join(a, b Type) Type {
+	if a == nil {
+		return b
+	}
+	if a.String() == b.String() {
+		return a
+	}
+	return Any
+}
+
+// 数组和哈希按结构作为键, 元素(值)也必须可以作为键
+func isHashable(t Type) bool {
+	switch t := t.(type) {
+	case *Array:
+		return isHashable(t.Elem)
+	case *Hash:
+		return isHashable(t.Value)
+	}
+	return t == Int || t == String || t == Bool || t == Any
+}
+
+// builtins 内置函数的类型, 接受多种参数类型的内置函数使用 any
+var builtins = map[string]Type{
+	"len":   &Function{Params: []Type{Any}, Return: Int},
+	"push":  &Function{Params: []Type{&Array{Any}, Any}, Return: &Array{Any}},
+	"first": &Function{Params: []Type{&Array{Any}}, Return: Any},
+	"last":  &Function{Params: []Type{&Array{Any}}, Return: Any},
+	"rest":  &Function{Params: []Type{&Array{Any}}, Return: &Array{Any}},
+	"print": &Function{Return: Null, Variadic: true},
+
+	// 通道没有单独的类型, 使用 any
+	"channel": &Function{Return: Any, Variadic: true},
+	"spawn":   &Function{Return: Any, Variadic: true},
+	"send":    &Function{Params: []Type{Any, Any}, Return: Null},
+	"recv":    &Function{Params: []Type{Any}, Return: Any},
+	"select":  &Function{Params: []Type{&Array{Any}}, Return: &Array{Any}},
+
+	// 迭代器和生成器同样使用 any
+	"iter":    &Function{Params: []Type{Any}, Return: Any},
+	"next":    &Function{Params: []Type{Any}, Return: Any},
+	"collect": &Function{Params: []Type{Any}, Return: &Array{Any}},
+
+	// json_parse 的结果取决于输入; json_stringify 的缩进可以省略
+	"json_parse":     &Function{Params: []Type{String}, Return: Any},
+	"json_stringify": &Function{Return: String, Variadic: true},
+}
@@ -0,0 +1,397 @@
+package vet
+
+import (
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/object"
+	"go-example/monkey/token"
+	"sort"
+	"strings"
+)
+
+type Rule struct {
+	Name string
+	Doc  string
+}
+
+var Rules = []Rule{
+	{"undefined", "reports identifiers that cannot be resolved"},
+	{"unused", "reports let bindings that are never referenced"},
+	{"shadow", "reports bindings that shadow an outer binding or a builtin"},
+	{"arity", "reports calls with the wrong number of arguments to builtins and known functions"},
+	{"unreachable", "reports statements following a return in the same block"},
+	{"duplicate-key", "reports hash literals with duplicate constant keys"},
+	{"func-compare", "reports == and != comparisons involving functions"},
+	{"not-callable", "reports calls of values known at compile time not to be functions"},
+}
+
+// builtinArity 内置函数的参数个数, 未列出的内置函数(如 print、spawn)接受的参数个数不固定
+var builtinArity = map[string]int{
+	"len":   1,
+	"push":  2,
+	"first": 1,
+	"last":  1,
+	"rest":  1,
+
+	"send":   2,
+	"recv":   1,
+	"select": 1,
+
+	"iter":    1,
+	"next":    1,
+	"collect": 1,
+
+	"json_parse": 1,
+}
+
+type Diagnostic struct {
+	Rule    string
+	Token   token.Token
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s [%s]", d.Token.Line, d.Token.Column, d.Message, d.Rule)
+}
+
+// Config 控制启用哪些规则, 默认全部启用
+type Config struct {
+	Disabled map[string]bool
+}
+
+// ParseRules 解析逗号分隔的规则名, 未知的规则名会返回错误
+func ParseRules(list string) (map[string]bool, error) {
+	rules := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isRule(name) {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules[name] = true
+	}
+	return rules, nil
+}
+
+func isRule(name string) bool {
+	for _, r := range Rules {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 对程序运行所有未禁用的规则, 结果按位置排序
+func Check(program *ast.Program, config Config) []Diagnostic {
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+
+	c := &checker{config: config}
+	global := newScope(table, nil)
+	c.statements(program.Statements, global)
+	c.leave(global)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		ti, tj := c.diagnostics[i].Token, c.diagnostics[j].Token
+		if ti.Line != tj.Line {
+			return ti.Line < tj.Line
+		}
+		return ti.Column < tj.Column
+	})
+	return c.diagnostics
+}
+
+type binding struct {
+	ident *ast.Identifier
+	value ast.Expression // let 绑定的值, 参数为 nil
+	used  bool
+}
+
+type scope struct {
+	table    *compiler.SymbolTable
+	bindings map[string]*binding
+	order    []*binding
+	outer    *scope
+}
+
+func newScope(table *compiler.SymbolTable, outer *scope) *scope {
+	return &scope{table: table, bindings: make(map[string]*binding), outer: outer}
+}
+
+func (s *scope) lookup(name string) *binding {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+type checker struct {
+	config      Config
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(rule string, tok token.Token, format string, a ...any) {
+	if c.config.Disabled[rule] {
+		return
+	}
+	c.diagnostics = append(c.diagnostics, Diagnostic{Rule: rule, Token: tok, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) define(ident *ast.Identifier, value ast.Expression, sc *scope) {
+	name := ident.Value
+	if outer := sc.outer.lookup(name); outer != nil {
+		c.report("shadow", ident.Token, "declaration of %s shadows declaration at %d:%d",
+			name, outer.ident.Token.Line, outer.ident.Token.Column)
+	} else if symbol, ok := sc.table.Resolve(name); ok && symbol.Scope == compiler.BuiltinScope {
+		c.report("shadow", ident.Token, "declaration of %s shadows builtin", name)
+	}
+
+	sc.table.Define(name)
+	b := &binding{ident: ident, value: value}
+	sc.bindings[name] = b
+	sc.order = append(sc.order, b)
+}
+
+// leave 在离开作用域时报告未使用的 let 绑定
+func (c *checker) leave(sc *scope) {
+	for _, b := range sc.order {
+		if !b.used && b.value != nil && !strings.HasPrefix(b.ident.Value, "_") {
+			c.report("unused", b.ident.Token, "%s declared and not used", b.ident.Value)
+		}
+	}
+}
+
+func (c *checker) statements(stmts []ast.Statement, sc *scope) {
+	returned := false
+	for _, stmt := range stmts {
+		if returned {
+			c.report("unreachable", statementToken(stmt), "unreachable code")
+			returned = false
+		}
+		c.statement(stmt, sc)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.YieldStatement:
+		return stmt.Token
+	case *ast.ForStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func (c *checker) statement(stmt ast.Statement, sc *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		// 与编译器一致, 名字在右侧表达式之前定义
+		c.define(stmt.Name, stmt.Value, sc)
+		c.expression(stmt.Value, sc)
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue, sc)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression, sc)
+	case *ast.YieldStatement:
+		c.expression(stmt.Value, sc)
+	case *ast.ForStatement:
+		// 循环变量与参数一样不报告未使用
+		c.expression(stmt.Iterable, sc)
+		c.define(stmt.Variable, nil, sc)
+		c.block(stmt.Body, sc)
+	}
+}
+
+func (c *checker) block(block *ast.BlockStatement, sc *scope) {
+	if block != nil {
+		c.statements(block.Statements, sc)
+	}
+}
+
+func (c *checker) expression(exp ast.Expression, sc *scope) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		c.identifier(exp, sc)
+	case *ast.PrefixExpression:
+		c.expression(exp.Right, sc)
+	case *ast.InfixExpression:
+		c.expression(exp.Left, sc)
+		c.expression(exp.Right, sc)
+		if exp.Operator == "==" || exp.Operator == "!=" {
+			if c.isFunction(exp.Left, sc) || c.isFunction(exp.Right, sc) {
+				c.report("func-compare", exp.Token, "comparison of functions with %s", exp.Operator)
+			}
+		}
+	case *ast.IfExpression:
+		c.expression(exp.Condition, sc)
+		c.block(exp.Consequence, sc)
+		c.block(exp.Alternative, sc)
+	case *ast.FunctionLiteral:
+		inner := newScope(compiler.NewEnclosedSymbolTable(sc.table), sc)
+		if exp.Name != "" {
+			inner.table.DefineFunctionName(exp.Name)
+			if b := sc.lookup(exp.Name); b != nil {
+				inner.bindings[exp.Name] = b
+			}
+		}
+		c.function(exp.Parameters, exp.Body, inner)
+	case *ast.MacroLiteral:
+		inner := newScope(compiler.NewEnclosedSymbolTable(sc.table), sc)
+		c.function(exp.Parameters, exp.Body, inner)
+	case *ast.CallExpression:
+		c.call(exp, sc)
+	case *ast.IndexExpression:
+		c.expression(exp.Left, sc)
+		c.expression(exp.Index, sc)
+	case *ast.ArrayLiteral:
+		for _, elem := range exp.Elements {
+			c.expression(elem, sc)
+		}
+	case *ast.HashLiteral:
+		c.hash(exp, sc)
+	case *ast.TemplateLiteral:
+		for _, part := range exp.Parts {
+			c.expression(part, sc)
+		}
+	case *ast.BlockStatement:
+		c.block(exp, sc)
+	}
+}
+
+func (c *checker) function(params []*ast.Identifier, body *ast.BlockStatement, sc *scope) {
+	for _, param := range params {
+		c.define(param, nil, sc)
+	}
+	c.block(body, sc)
+	c.leave(sc)
+}
+
+func (c *checker) identifier(ident *ast.Identifier, sc *scope) {
+	if b := sc.lookup(ident.Value); b != nil {
+		b.used = true
+	}
+	if _, ok := sc.table.Resolve(ident.Value); !ok {
+		c.report("undefined", ident.Token, "undefined: %s", ident.Value)
+	}
+}
+
+func (c *checker) call(call *ast.CallExpression, sc *scope) {
+	// quote/unquote 是宏展开使用的特殊形式
+	if ident, ok := call.Function.(*ast.Identifier); ok && (ident.Value == "quote" || ident.Value == "unquote") {
+		return
+	}
+
+	c.expression(call.Function, sc)
+	for _, arg := range call.Arguments {
+		c.expression(arg, sc)
+	}
+
+	callee := c.constant(call.Function, sc)
+	switch callee := callee.(type) {
+	case *ast.FunctionLiteral:
+		if len(call.Arguments) != len(callee.Parameters) {
+			c.report("arity", call.Token, "wrong number of arguments in call to %s: want=%d, got=%d",
+				call.Function.String(), len(callee.Parameters), len(call.Arguments))
+		}
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.TemplateLiteral, *ast.Boolean,
+		*ast.ArrayLiteral, *ast.HashLiteral:
+		c.report("not-callable", call.Token, "cannot call non-function %s", call.Function.String())
+	case nil:
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return
+		}
+		want, ok := builtinArity[ident.Value]
+		if ok && c.isBuiltin(ident, sc) && len(call.Arguments) != want {
+			c.report("arity", call.Token, "wrong number of arguments in call to %s: want=%d, got=%d",
+				ident.Value, want, len(call.Arguments))
+		}
+	}
+}
+
+func (c *checker) hash(hash *ast.HashLiteral, sc *scope) {
+	for _, key := range hash.Keys {
+		c.expression(key, sc)
+		c.expression(hash.Pairs[key], sc)
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range hash.Keys {
+		var id string
+		switch key := key.(type) {
+		case *ast.IntegerLiteral:
+			id = fmt.Sprintf("integer:%d", key.Value)
+		case *ast.StringLiteral:
+			id = "string:" + key.Value
+		case *ast.Boolean:
+			id = fmt.Sprintf("boolean:%t", key.Value)
+		default:
+			continue
+		}
+		if seen[id] {
+			c.report("duplicate-key", keyToken(key), "duplicate key %s in hash literal", key.String())
+		}
+		seen[id] = true
+	}
+}
+
+func keyToken(key ast.Expression) token.Token {
+	switch key := key.(type) {
+	case *ast.IntegerLiteral:
+		return key.Token
+	case *ast.StringLiteral:
+		return key.Token
+	case *ast.Boolean:
+		return key.Token
+	case *ast.Identifier:
+		return key.Token
+	}
+	return token.Token{}
+}
+
+// constant 返回表达式在编译期已知的值: 字面量本身, 或者绑定到字面量的 let 名字
+func (c *checker) constant(exp ast.Expression, sc *scope) ast.Expression {
+	if ident, ok := exp.(*ast.Identifier); ok {
+		b := sc.lookup(ident.Value)
+		if b == nil {
+			return nil
+		}
+		exp = b.value
+	}
+	switch exp.(type) {
+	case *ast.FunctionLiteral, *ast.IntegerLiteral, *ast.StringLiteral, *ast.TemplateLiteral,
+		*ast.Boolean, *ast.ArrayLiteral, *ast.HashLiteral:
+		return exp
+	}
+	return nil
+}
+
+func (c *checker) isFunction(exp ast.Expression, sc *scope) bool {
+	if _, ok := c.constant(exp, sc).(*ast.FunctionLiteral); ok {
+		return true
+	}
+	ident, ok := exp.(*ast.Identifier)
+	return ok && c.isBuiltin(ident, sc)
+}
+
+func (c *checker) isBuiltin(ident *ast.Identifier, sc *scope) bool {
+	symbol, ok := sc.table.Resolve(ident.Value)
+	return ok && symbol.Scope == compiler.BuiltinScope
+}
@@ -0,0 +1,155 @@
+package vet
+
+import (
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			`let x = 1; x;`,
+			nil,
+		},
+		{
+			`let x = 1; y;`,
+			[]string{
+				"1:5: x declared and not used [unused]",
+				"1:12: undefined: y [undefined]",
+			},
+		},
+		{
+			`let _x = 1; let f = fn(a, b) { let c = 1; a; }; f(1, 2);`,
+			[]string{"1:36: c declared and not used [unused]"},
+		},
+		{
+			`let x = 1; let f = fn(x) { let len = x; len }; f(x);`,
+			[]string{
+				"1:23: declaration of x shadows declaration at 1:5 [shadow]",
+				"1:32: declaration of len shadows builtin [shadow]",
+			},
+		},
+		{
+			`len(1, 2); push([1]); print(1, 2, 3); let len = fn(a, b) { a }; len(1, 2);`,
+			[]string{
+				"1:4: wrong number of arguments in call to len: want=1, got=2 [arity]",
+				"1:16: wrong number of arguments in call to push: want=2, got=1 [arity]",
+				"1:43: declaration of len shadows builtin [shadow]",
+			},
+		},
+		{
+			`let ch = channel(); spawn(fn(x) { send(ch) }, 1); recv(ch, 1); select([ch]);`,
+			[]string{
+				"1:39: wrong number of arguments in call to send: want=2, got=1 [arity]",
+				"1:55: wrong number of arguments in call to recv: want=1, got=2 [arity]",
+			},
+		},
+		{
+			`let add = fn(a, b) { a + b }; add(1); fn(x) { x }(1, 2);`,
+			[]string{
+				"1:34: wrong number of arguments in call to add: want=2, got=1 [arity]",
+				"1:50: wrong number of arguments in call to fn(x) x: want=1, got=2 [arity]",
+			},
+		},
+		{
+			`let f = fn() { return 1; 2; let y = 3; }; f(); return 0; f();`,
+			[]string{
+				"1:26: unreachable code [unreachable]",
+				"1:33: y declared and not used [unused]",
+				"1:58: unreachable code [unreachable]",
+			},
+		},
+		{
+			`{"a": 1, 2: 2, "a": 3, true: 4, 2: 5, false: 6}`,
+			[]string{
+				`1:16: duplicate key a in hash literal [duplicate-key]`,
+				`1:33: duplicate key 2 in hash literal [duplicate-key]`,
+			},
+		},
+		{
+			`let f = fn() { 1 }; f == f; len != 1; fn() {} == 1; 1 == 2;`,
+			[]string{
+				"1:23: comparison of functions with == [func-compare]",
+				"1:33: comparison of functions with != [func-compare]",
+				"1:47: comparison of functions with == [func-compare]",
+			},
+		},
+		{
+			`let one = 1; one(); "str"(); [1](0); let f = fn(g) { g() }; f(1);`,
+			[]string{
+				"1:17: cannot call non-function one [not-callable]",
+				"1:26: cannot call non-function str [not-callable]",
+				"1:33: cannot call non-function [1] [not-callable]",
+			},
+		},
+		{
+			`let countDown = fn(x) { countDown(x - 1) }; countDown(1);`,
+			nil,
+		},
+		{
+			`let m = macro(a) { quote(unquote(a) + 1) }; m(1);`,
+			nil,
+		},
+		{
+			`let g = fn(xs) { for (x in xs) { yield x; return 1; yield 2; } }; next(g([1]), 1); for (len in []) {}`,
+			[]string{
+				"1:53: unreachable code [unreachable]",
+				"1:71: wrong number of arguments in call to next: want=1, got=2 [arity]",
+				"1:89: declaration of len shadows builtin [shadow]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Check(testParse(t, tt.input), Config{})
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d", tt.input, len(tt.expected), len(diagnostics))
+			for _, d := range diagnostics {
+				t.Logf("\t%s", d)
+			}
+			continue
+		}
+		for i, want := range tt.expected {
+			if got := diagnostics[i].String(); got != want {
+				t.Errorf("wrong diagnostic for %q.\nwant=%q\ngot=%q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestDisableRules(t *testing.T) {
+	input := `let x = 1; let f = fn(x) { len(1, 2) }; y;`
+
+	all := Check(testParse(t, input), Config{})
+	if len(all) != 5 {
+		t.Fatalf("wrong number of diagnostics. want=5, got=%d", len(all))
+	}
+
+	disabled, err := ParseRules("unused, shadow,arity")
+	if err != nil {
+		t.Fatalf("ParseRules error: %s", err)
+	}
+	diagnostics := Check(testParse(t, input), Config{Disabled: disabled})
+	if len(diagnostics) != 1 || diagnostics[0].Rule != "undefined" {
+		t.Fatalf("expected only the undefined rule to report, got %v", diagnostics)
+	}
+
+	if _, err := ParseRules("unused,bogus"); err == nil {
+		t.Errorf("expected error for unknown rule")
+	}
+}
+
+func testParse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -9,6 +9,9 @@ type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+
+	// 寄存器指令集中调用者接收返回值的寄存器
+	ret int
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"go-example/monkey/object"
+)
+
+var errBlockInGenerator = errors.New("cannot block inside a generator")
+
+// generator 是调用生成器函数得到的迭代器, 拥有自己的栈和调用帧.
+// Next 在调用者的 VM 上恢复执行, 直到下一个 yield 或函数返回.
+type generator struct {
+	vm *VM
+
+	stack      []Value
+	sp         int
+	frames     []*Frame
+	frameIndex int
+
+	running bool
+	done    bool
+}
+
+func (g *generator) Type() object.ObjectType { return object.GENERATOR_OBJ }
+func (g *generator) Inspect() string         { return fmt.Sprintf("Generator[%p]", g) }
+
+// newGenerator 把被调用的闭包和参数移到生成器自己的栈上,
+// 第 0 帧是空的主函数, 闭包的帧返回后 run 随之结束
+func (vm *VM) newGenerator(cl *object.Closure, numArgs int) *generator {
+	g := &generator{
+		vm:         vm,
+		stack:      make([]Value, StackSize),
+		frames:     make([]*Frame, MaxFrames),
+		frameIndex: 2,
+	}
+	copy(g.stack, vm.stack[vm.sp-1-numArgs:vm.sp])
+	g.frames[0] = NewFrame(&object.Closure{Fn: &object.CompiledFunction{}}, 0)
+	g.frames[1] = NewFrame(cl, 1)
+	g.sp = 1 + cl.Fn.NumLocals
+	return g
+}
+
+func (g *generator) Next() (object.Object, bool, error) {
+	if g.done {
+		return nil, false, nil
+	}
+	if g.running {
+		return nil, false, fmt.Errorf("generator is already running")
+	}
+
+	vm := g.vm
+	stack, sp, frames, frameIndex := vm.stack, vm.sp, vm.frames, vm.frameIndex
+	vm.stack, vm.sp, vm.frames, vm.frameIndex = g.stack, g.sp, g.frames, g.frameIndex
+	g.running = true
+	vm.generators++
+	vm.yielded = false
+
+	err := vm.run()
+
+	g.sp, g.frameIndex = vm.sp, vm.frameIndex
+	vm.stack, vm.sp, vm.frames, vm.frameIndex = stack, sp, frames, frameIndex
+	g.running = false
+	vm.generators--
+
+	if err != nil {
+		g.done = true
+		return nil, false, err
+	}
+	if !vm.yielded {
+		g.done = true
+		return nil, false, nil
+	}
+	vm.yielded = false
+	return g.stack[g.sp].Object(), true, nil
+}
+
+// block 挂起当前任务. 生成器在调用者的任务中运行, 不能单独挂起
+func (vm *VM) block() error {
+	if vm.generators > 0 {
+		return errBlockInGenerator
+	}
+	return vm.schedule()
+}
+
+func (vm *VM) iterate(obj object.Object) error {
+	it, err := object.Iterate(obj)
+	if err != nil {
+		return err
+	}
+	return vm.push(Value{obj: it})
+}
+
+// iterNext 取栈顶迭代器的下一个值, 迭代结束时弹出迭代器并返回 false
+func (vm *VM) iterNext() (bool, error) {
+	it := vm.stack[vm.sp-1].obj.(object.Iterator)
+	value, ok, err := it.Next()
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		vm.pop()
+		return false, nil
+	}
+	return true, vm.pushObject(value)
+}
+
+// next 和 collect 与 object 中的实现相同, 但生成器中的运行时错误会中止整个程序
+func (vm *VM) next(args []object.Object) error {
+	if len(args) != 1 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=%d, want=1", len(args)))
+	}
+	it, ok := args[0].(object.Iterator)
+	if !ok {
+		return vm.pushObject(object.NewError("argument to `next` must be iterator, got %s", args[0].Type()))
+	}
+	value, ok, err := it.Next()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return vm.pushObject(object.NULL)
+	}
+	return vm.pushObject(value)
+}
+
+func (vm *VM) collect(args []object.Object) error {
+	if len(args) != 1 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=%d, want=1", len(args)))
+	}
+	it, err := object.Iterate(args[0])
+	if err != nil {
+		return vm.pushObject(object.NewError("argument to `collect` not supported, got %s", args[0].Type()))
+	}
+	array, err := object.Collect(it)
+	if err != nil {
+		return err
+	}
+	return vm.pushObject(array)
+}
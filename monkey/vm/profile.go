@@ -0,0 +1,37 @@
+package vm
+
+import "go-example/monkey/code"
+
+// OpcodeCounts 以操作码为下标记录执行次数
+type OpcodeCounts [256]uint64
+
+// CountOpcodes 让之后的 Run 把执行的每条指令累加到 counts 中, 传入 nil 停止统计.
+// 带 OpWide 前缀的指令计为 OpWide, 生成器和任务中执行的指令也计算在内
+func (vm *VM) CountOpcodes(counts *OpcodeCounts) {
+	vm.counts = counts
+}
+
+// Named 返回执行过的操作码的名称和次数
+func (c *OpcodeCounts) Named() map[string]uint64 {
+	named := map[string]uint64{}
+	for op, n := range c {
+		if n == 0 {
+			continue
+		}
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			continue
+		}
+		named[def.Name] = n
+	}
+	return named
+}
+
+// Total 返回执行的指令总数
+func (c *OpcodeCounts) Total() uint64 {
+	var total uint64
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
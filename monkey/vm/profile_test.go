@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"go-example/monkey/compiler"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func TestCountOpcodes(t *testing.T) {
+	input := `
+	let f = fn(x) { x };
+	let gen = fn() { yield f(1); yield f(2); };
+	collect(gen());
+	f(3);
+	`
+	// 每个目标上调用和产出指令的名称
+	calls := map[compiler.Target][]string{
+		compiler.StackTarget:    {"OpCall", "OpCall0", "OpCall1", "OpCall2"},
+		compiler.RegisterTarget: {"OpRCall"},
+	}
+	yields := map[compiler.Target]string{
+		compiler.StackTarget:    "OpYield",
+		compiler.RegisterTarget: "OpRYield",
+	}
+
+	for _, target := range targets {
+		comp := compiler.New()
+		comp.SetTarget(target)
+		if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var counts OpcodeCounts
+		vm := New(comp.Bytecode())
+		vm.CountOpcodes(&counts)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s vm error: %s", target, err)
+		}
+
+		named := counts.Named()
+		var sum, ncalls uint64
+		for _, n := range named {
+			sum += n
+		}
+		for _, name := range calls[target] {
+			ncalls += named[name]
+		}
+		if sum != counts.Total() {
+			t.Errorf("%s: Named sums to %d, Total is %d", target, sum, counts.Total())
+		}
+		// gen、collect 和三次 f
+		if ncalls != 5 {
+			t.Errorf("%s: wrong number of calls. want=5, got=%d (%v)", target, ncalls, named)
+		}
+		if n := named[yields[target]]; n != 2 {
+			t.Errorf("%s: wrong number of yields. want=2, got=%d", target, n)
+		}
+
+		// 多次运行累加到同一个计数中
+		total := counts.Total()
+		vm = New(comp.Bytecode())
+		vm.CountOpcodes(&counts)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s vm error: %s", target, err)
+		}
+		if counts.Total() != 2*total {
+			t.Errorf("%s: counts not accumulated. want=%d, got=%d", target, 2*total, counts.Total())
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package vm
+
+import (
+	"fmt"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+)
+
+// runRegisters 执行 compiler.RegisterTarget 生成的寄存器指令.
+// 每个帧的寄存器是栈上从 basePointer 开始的 NumLocals 个槽, 运行时 sp 始终指向当前帧的寄存器之后,
+// 内置函数、生成器和任务仍可以像栈指令一样在 sp 处压入值
+func (vm *VM) runRegisters() error {
+	// 切换到的任务可能停在 wake 压入返回值之后
+	vm.resetRegisters()
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+		ip := frame.ip
+		ins := frame.Instructions()
+		op := code.Opcode(ins[ip])
+		if vm.counts != nil {
+			vm.counts[op]++
+		}
+		r := vm.stack[frame.basePointer : frame.basePointer+frame.cl.Fn.NumLocals]
+
+		switch op {
+		case code.OpRConstant:
+			a, k := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			r[a] = vm.constants[k]
+		case code.OpRTrue:
+			r[code.ReadUint16(ins[ip+1:])] = Value{obj: object.True}
+			frame.ip += 2
+		case code.OpRFalse:
+			r[code.ReadUint16(ins[ip+1:])] = Value{obj: object.False}
+			frame.ip += 2
+		case code.OpRNull:
+			r[code.ReadUint16(ins[ip+1:])] = Value{obj: object.NULL}
+			frame.ip += 2
+		case code.OpRMove:
+			a, b := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			r[a] = r[b]
+		case code.OpRGetGlobal:
+			a, g := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			r[a] = vm.globals[g]
+		case code.OpRSetGlobal:
+			g, b := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			vm.globals[g] = r[b]
+		case code.OpRGetBuiltin:
+			a, i := code.ReadUint16(ins[ip+1:]), code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			r[a] = Value{obj: object.Builtins[i].Builtin}
+		case code.OpRGetFree:
+			a, i := code.ReadUint16(ins[ip+1:]), code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			r[a] = ValueOf(frame.cl.Free[i])
+		case code.OpRCurrentClosure:
+			r[code.ReadUint16(ins[ip+1:])] = Value{obj: frame.cl}
+			frame.ip += 2
+		case code.OpRAdd, code.OpRSub, code.OpRMul, code.OpRDiv,
+			code.OpREqual, code.OpRNotEqual, code.OpRGreaterThan:
+			a, b, c := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:]), code.ReadUint16(ins[ip+5:])
+			frame.ip += 6
+			result, err := registerOperation(op, r[b], r[c])
+			if err != nil {
+				return err
+			}
+			r[a] = result
+		case code.OpRMinus:
+			a, b := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			result, err := negate(r[b])
+			if err != nil {
+				return err
+			}
+			r[a] = result
+		case code.OpRBang:
+			a, b := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			r[a] = boolValue(!r[b].truthy())
+		case code.OpRJumpNotTruthy:
+			a, pos := code.ReadUint16(ins[ip+1:]), int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+			if !r[a].truthy() {
+				frame.ip = pos - 1
+			}
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+			if err := vm.preempt(); err != nil {
+				return err
+			}
+			vm.resetRegisters()
+		case code.OpRArray, code.OpRHash, code.OpRBuildString:
+			a, b, n := code.ReadUint16(ins[ip+1:]), int(code.ReadUint16(ins[ip+3:])), int(code.ReadUint16(ins[ip+5:]))
+			frame.ip += 6
+			elems := r[b : b+n]
+			switch op {
+			case code.OpRArray:
+				r[a] = buildArray(elems)
+			case code.OpRBuildString:
+				r[a] = buildString(elems)
+			default:
+				hash, err := buildHash(elems)
+				if err != nil {
+					return err
+				}
+				r[a] = hash
+			}
+		case code.OpRIndex:
+			a, b, c := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:]), code.ReadUint16(ins[ip+5:])
+			frame.ip += 6
+			result, err := indexExpression(r[b], r[c])
+			if err != nil {
+				return err
+			}
+			r[a] = result
+		case code.OpRCall:
+			a, b, n := int(code.ReadUint16(ins[ip+1:])), int(code.ReadUint16(ins[ip+3:])), int(code.ReadUint8(ins[ip+5:]))
+			frame.ip += 5
+			if err := vm.registerCall(a, b, n); err != nil {
+				return err
+			}
+			if err := vm.preempt(); err != nil {
+				return err
+			}
+			vm.resetRegisters()
+		case code.OpRReturnValue:
+			value := r[code.ReadUint16(ins[ip+1:])]
+			if done := vm.registerReturn(value); done {
+				return nil
+			}
+		case code.OpReturn:
+			if done := vm.registerReturn(Value{obj: object.NULL}); done {
+				return nil
+			}
+		case code.OpRClosure:
+			a, k := code.ReadUint16(ins[ip+1:]), int(code.ReadUint16(ins[ip+3:]))
+			b, n := int(code.ReadUint16(ins[ip+5:])), int(code.ReadUint8(ins[ip+7:]))
+			frame.ip += 7
+			closure, err := vm.newClosure(k, r[b:b+n])
+			if err != nil {
+				return err
+			}
+			r[a] = Value{obj: closure}
+		case code.OpRIter:
+			a, b := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+			it, err := object.Iterate(r[b].Object())
+			if err != nil {
+				return err
+			}
+			r[a] = Value{obj: it}
+		case code.OpRIterNext:
+			a, b, pos := code.ReadUint16(ins[ip+1:]), code.ReadUint16(ins[ip+3:]), int(code.ReadUint16(ins[ip+5:]))
+			frame.ip += 6
+			value, ok, err := r[a].obj.(object.Iterator).Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				frame.ip = pos - 1
+				continue
+			}
+			r[b] = ValueOf(value)
+		case code.OpRYield:
+			// 与 OpYield 相同, 值放在生成器的 sp 处由 Next 取走
+			if vm.sp >= StackSize {
+				return fmt.Errorf("stack overflow")
+			}
+			vm.stack[vm.sp] = r[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+			vm.yielded = true
+			return nil
+		case code.OpRResult:
+			vm.last = r[code.ReadUint16(ins[ip+1:])]
+			frame.ip += 2
+		default:
+			return fmt.Errorf("opcode %d not supported by register vm", op)
+		}
+	}
+	return nil
+}
+
+func registerOperation(op code.Opcode, left, right Value) (Value, error) {
+	switch op {
+	case code.OpRAdd:
+		return binaryOperation(code.OpAdd, left, right)
+	case code.OpRSub:
+		return binaryOperation(code.OpSub, left, right)
+	case code.OpRMul:
+		return binaryOperation(code.OpMul, left, right)
+	case code.OpRDiv:
+		return binaryOperation(code.OpDiv, left, right)
+	case code.OpREqual:
+		return comparison(code.OpEqual, left, right)
+	case code.OpRNotEqual:
+		return comparison(code.OpNotEqual, left, right)
+	default:
+		return comparison(code.OpGreaterThan, left, right)
+	}
+}
+
+// resetRegisters 在调用或任务切换之后把 sp 恢复到当前帧的寄存器之后
+func (vm *VM) resetRegisters() {
+	frame := vm.currentFrame()
+	vm.sp = frame.basePointer + frame.cl.Fn.NumLocals
+}
+
+// registerCall 执行 OpRCall, 被调用者在 R(b), 参数在 R(b+1) 到 R(b+n), 返回值写入 R(a)
+func (vm *VM) registerCall(a, b, n int) error {
+	base := vm.currentFrame().basePointer
+	callee := vm.stack[base+b].obj
+	args := vm.stack[base+b+1 : base+b+1+n]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if n != callee.Fn.NumParameters {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, n)
+		}
+		if callee.Fn.Generator {
+			vm.sp = base + b + 1 + n
+			vm.stack[base+a] = Value{obj: vm.newGenerator(callee, n)}
+			return nil
+		}
+		if vm.frameIndex >= MaxFrames {
+			return fmt.Errorf("stack overflow")
+		}
+		frame := NewFrame(callee, base+b+1)
+		frame.ret = a
+		if frame.basePointer+callee.Fn.NumLocals >= StackSize {
+			return fmt.Errorf("stack overflow")
+		}
+		vm.pushFrame(frame)
+		// 参数之后的寄存器可能残留调用者的临时值, 局部变量在赋值之前不会被读取
+		vm.sp = frame.basePointer + callee.Fn.NumLocals
+		return nil
+	case *object.Builtin:
+		if fn, ok := vmBuiltins[callee]; ok {
+			// 结果由 push 或 wake 写入 sp 处, 即 R(a)
+			args := objects(args)
+			vm.sp = base + a
+			return fn(vm, args)
+		}
+		result := callee.Call(vm.out, objects(args)...)
+		if result == nil {
+			result = object.NULL
+		}
+		vm.stack[base+a] = ValueOf(result)
+		return nil
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+// registerReturn 弹出当前帧并把 value 写入调用者的寄存器, 主程序返回时 done 为 true
+func (vm *VM) registerReturn(value Value) (done bool) {
+	if vm.frameIndex == 1 {
+		vm.last = value
+		return true
+	}
+	frame := vm.popFrame()
+	caller := vm.currentFrame()
+	vm.stack[caller.basePointer+frame.ret] = value
+	vm.sp = caller.basePointer + caller.cl.Fn.NumLocals
+	return false
+}
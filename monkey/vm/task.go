@@ -0,0 +1,391 @@
+package vm
+
+import (
+	"errors"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+	"math/rand"
+	"time"
+)
+
+var errDeadlock = errors.New("all tasks are blocked: deadlock")
+
+// timeSlice 是一个任务在被抢占之前最多经过的安全点(函数调用和跳转)个数
+const timeSlice = 100
+
+// task 是一个可以挂起的执行流, 拥有自己的栈和调用帧.
+// 正在运行的任务的状态保存在 VM 的 stack、sp、frames 和 frameIndex 中, 切换时再写回 task.
+type task struct {
+	id         int
+	stack      []Value
+	sp         int
+	frames     []*Frame
+	frameIndex int
+
+	// spawn 返回的通道, 任务结束时把返回值写入其中; 主任务为 nil
+	result *object.Channel
+}
+
+// scheduler 在单个线程上协作式地调度任务, 所有任务共享全局变量和常量
+type scheduler struct {
+	main     *task
+	current  *task
+	runnable []*task
+	budget   int
+	nextID   int
+
+	// rand 为 nil 时按固定顺序调度, 用于测试
+	rand *rand.Rand
+
+	queues map[*object.Channel]*waitQueue
+}
+
+// waiter 是阻塞在一个或多个通道上的任务, 被任意一个通道唤醒后 done 为 true
+type waiter struct {
+	task     *task
+	done     bool
+	isSelect bool
+}
+
+// pending 是 waiter 在某个通道上的一次发送或接收, index 为 select 中的分支下标
+type pending struct {
+	w     *waiter
+	index int
+	value object.Object
+}
+
+type waitQueue struct {
+	senders   []*pending
+	receivers []*pending
+}
+
+// SetDeterministic 让调度器按先进先出的顺序轮转任务, select 总是选择第一个就绪的分支,
+// 使同一个程序每次运行的交错顺序相同. 默认随机选择下一个任务和就绪的分支.
+func (vm *VM) SetDeterministic(on bool) {
+	vm.deterministic = on
+	if vm.sched != nil {
+		vm.sched.rand = newRand(on)
+	}
+}
+
+func newRand(deterministic bool) *rand.Rand {
+	if deterministic {
+		return nil
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+func (vm *VM) scheduler() *scheduler {
+	if vm.sched == nil {
+		main := &task{}
+		vm.sched = &scheduler{
+			main:    main,
+			current: main,
+			budget:  timeSlice,
+			nextID:  1,
+			rand:    newRand(vm.deterministic),
+			queues:  make(map[*object.Channel]*waitQueue),
+		}
+	}
+	return vm.sched
+}
+
+func (vm *VM) save(t *task) {
+	t.stack, t.sp, t.frames, t.frameIndex = vm.stack, vm.sp, vm.frames, vm.frameIndex
+}
+
+func (vm *VM) load(t *task) {
+	vm.stack, vm.sp, vm.frames, vm.frameIndex = t.stack, t.sp, t.frames, t.frameIndex
+	vm.sched.current = t
+	vm.sched.budget = timeSlice
+}
+
+// schedule 保存当前任务并切换到下一个可运行的任务, 当前任务是否重新排队由调用者决定
+func (vm *VM) schedule() error {
+	s := vm.sched
+	if len(s.runnable) == 0 {
+		return errDeadlock
+	}
+
+	i := 0
+	if s.rand != nil {
+		i = s.rand.Intn(len(s.runnable))
+	}
+	next := s.runnable[i]
+	s.runnable = append(s.runnable[:i], s.runnable[i+1:]...)
+
+	vm.save(s.current)
+	vm.load(next)
+	return nil
+}
+
+// preempt 在安全点消耗时间片, 用完后让出给其他任务
+func (vm *VM) preempt() error {
+	s := vm.sched
+	if s == nil || len(s.runnable) == 0 || vm.generators > 0 {
+		return nil
+	}
+	s.budget--
+	if s.budget > 0 {
+		return nil
+	}
+	s.runnable = append(s.runnable, s.current)
+	return vm.schedule()
+}
+
+// exitTask 结束当前的子任务, 把返回值写入它的结果通道
+func (vm *VM) exitTask() error {
+	t := vm.sched.current
+	result := vm.stack[vm.sp-1]
+	if vm.registers {
+		result = vm.stack[0]
+	}
+	vm.trySend(t.result, result.Object())
+	return vm.schedule()
+}
+
+// wake 把 value 作为阻塞调用的返回值压入任务的栈, 并让任务重新可运行
+func (vm *VM) wake(p *pending, value object.Object) {
+	p.w.done = true
+	if p.w.isSelect {
+		value = selected(p.index, value)
+	}
+	t := p.w.task
+	t.stack[t.sp] = ValueOf(value)
+	t.sp++
+	vm.sched.runnable = append(vm.sched.runnable, t)
+}
+
+// wait 把当前任务登记为 ch 上的发送者或接收者
+func (vm *VM) wait(ch *object.Channel, send bool, p *pending) {
+	s := vm.scheduler()
+	q, ok := s.queues[ch]
+	if !ok {
+		q = &waitQueue{}
+		s.queues[ch] = q
+	}
+	if send {
+		q.senders = append(q.senders, p)
+	} else {
+		q.receivers = append(q.receivers, p)
+	}
+}
+
+// dequeue 取出 ch 上第一个仍在等待的发送者或接收者, 已经被其他通道唤醒的 select 分支直接丢弃.
+// 队列清空后从调度器中删除, 不再使用的通道不会被一直引用
+func (vm *VM) dequeue(ch *object.Channel, send bool) *pending {
+	s := vm.scheduler()
+	q, ok := s.queues[ch]
+	if !ok {
+		return nil
+	}
+	list := &q.receivers
+	if send {
+		list = &q.senders
+	}
+
+	var found *pending
+	for len(*list) > 0 && found == nil {
+		p := (*list)[0]
+		*list = (*list)[1:]
+		if !p.w.done {
+			found = p
+		}
+	}
+	if len(q.senders) == 0 && len(q.receivers) == 0 {
+		delete(s.queues, ch)
+	}
+	return found
+}
+
+func (vm *VM) trySend(ch *object.Channel, value object.Object) bool {
+	if r := vm.dequeue(ch, false); r != nil {
+		vm.wake(r, value)
+		return true
+	}
+	if len(ch.Buffer) < ch.Capacity {
+		ch.Buffer = append(ch.Buffer, value)
+		return true
+	}
+	return false
+}
+
+func (vm *VM) tryRecv(ch *object.Channel) (object.Object, bool) {
+	if len(ch.Buffer) > 0 {
+		value := ch.Buffer[0]
+		ch.Buffer = ch.Buffer[1:]
+		// 缓冲区腾出了位置, 让一个等待的发送者写入
+		if s := vm.dequeue(ch, true); s != nil {
+			ch.Buffer = append(ch.Buffer, s.value)
+			vm.wake(s, object.NULL)
+		}
+		return value, true
+	}
+	if s := vm.dequeue(ch, true); s != nil {
+		vm.wake(s, object.NULL)
+		return s.value, true
+	}
+	return nil, false
+}
+
+// vmBuiltin 是需要访问 VM 状态的内置函数, 参数已经从栈上移走, 结果由函数自己压栈
+type vmBuiltin func(vm *VM, args []object.Object) error
+
+var vmBuiltins map[*object.Builtin]vmBuiltin
+
+func init() {
+	vmBuiltins = map[*object.Builtin]vmBuiltin{
+		object.BuiltinsMap["spawn"]:   (*VM).spawn,
+		object.BuiltinsMap["send"]:    (*VM).send,
+		object.BuiltinsMap["recv"]:    (*VM).recv,
+		object.BuiltinsMap["select"]:  (*VM).selectCases,
+		object.BuiltinsMap["next"]:    (*VM).next,
+		object.BuiltinsMap["collect"]: (*VM).collect,
+	}
+}
+
+// spawn(fn, args...) 在新任务中调用 fn, 返回一个接收其返回值的通道
+func (vm *VM) spawn(args []object.Object) error {
+	if len(args) == 0 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=0, want at least 1"))
+	}
+	switch args[0].(type) {
+	case *object.Closure, *object.Builtin:
+	default:
+		return vm.pushObject(object.NewError("argument to `spawn` must be a function, got %s", args[0].Type()))
+	}
+
+	s := vm.scheduler()
+	// 新任务从一段只包含 OpCall 的主函数开始, 调用结束时返回值留在栈顶
+	fn := &object.CompiledFunction{}
+	var err error
+	if vm.registers {
+		// 寄存器指令中被调用者和参数占用 R(0) 到 R(n), 返回值写回 R(0)
+		fn.Instructions, err = code.Make(code.OpRCall, 0, 0, len(args)-1)
+		fn.NumLocals = len(args)
+	} else {
+		fn.Instructions, err = code.Make(code.OpCall, len(args)-1)
+	}
+	if err != nil {
+		return vm.pushObject(object.NewError("too many arguments to `spawn`: %d", len(args)-1))
+	}
+	trampoline := &object.Closure{Fn: fn}
+	t := &task{
+		id:         s.nextID,
+		stack:      make([]Value, StackSize),
+		frames:     make([]*Frame, MaxFrames),
+		frameIndex: 1,
+		result:     &object.Channel{Capacity: 1},
+	}
+	s.nextID++
+	t.frames[0] = NewFrame(trampoline, 0)
+	t.sp = copy(t.stack, values(args))
+	s.runnable = append(s.runnable, t)
+
+	return vm.pushObject(t.result)
+}
+
+// send(ch, value) 向通道发送一个值, 通道已满时阻塞
+func (vm *VM) send(args []object.Object) error {
+	if len(args) != 2 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=%d, want=2", len(args)))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return vm.pushObject(object.NewError("argument to `send` must be channel, got %s", args[0].Type()))
+	}
+	if vm.trySend(ch, args[1]) {
+		return vm.pushObject(object.NULL)
+	}
+
+	vm.wait(ch, true, &pending{w: &waiter{task: vm.sched.current}, value: args[1]})
+	// 挂起当前任务, 在某个 pending 完成时被唤醒
+	return vm.block()
+}
+
+// recv(ch) 从通道接收一个值, 没有值时阻塞
+func (vm *VM) recv(args []object.Object) error {
+	if len(args) != 1 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=%d, want=1", len(args)))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return vm.pushObject(object.NewError("argument to `recv` must be channel, got %s", args[0].Type()))
+	}
+	if value, ok := vm.tryRecv(ch); ok {
+		return vm.pushObject(value)
+	}
+
+	vm.wait(ch, false, &pending{w: &waiter{task: vm.sched.current}})
+	// 挂起当前任务, 在某个 pending 完成时被唤醒
+	return vm.block()
+}
+
+type selectCase struct {
+	ch    *object.Channel
+	send  bool
+	value object.Object
+}
+
+// select(cases) 等待任意一个分支就绪. 分支为通道时接收, 为 [通道, 值] 时发送.
+// 返回 [分支下标, 接收到的值], 发送分支的值为 null
+func (vm *VM) selectCases(args []object.Object) error {
+	if len(args) != 1 {
+		return vm.pushObject(object.NewError("wrong number of arguments. got=%d, want=1", len(args)))
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok || array.Len() == 0 {
+		return vm.pushObject(object.NewError("argument to `select` must be a non-empty array, got %s", args[0].Inspect()))
+	}
+
+	cases := make([]selectCase, array.Len())
+	for i, elem := range array.Elements() {
+		switch elem := elem.(type) {
+		case *object.Channel:
+			cases[i] = selectCase{ch: elem}
+		case *object.Array:
+			var ch *object.Channel
+			if elem.Len() == 2 {
+				ch, _ = elem.At(0).(*object.Channel)
+			}
+			if ch == nil {
+				return vm.pushObject(object.NewError("select case %d must be channel or [channel, value], got %s", i, elem.Inspect()))
+			}
+			cases[i] = selectCase{ch: ch, send: true, value: elem.At(1)}
+		default:
+			return vm.pushObject(object.NewError("select case %d must be channel or [channel, value], got %s", i, elem.Inspect()))
+		}
+	}
+
+	s := vm.scheduler()
+	order := make([]int, len(cases))
+	for i := range order {
+		order[i] = i
+	}
+	if s.rand != nil {
+		s.rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	for _, i := range order {
+		c := cases[i]
+		if c.send && vm.trySend(c.ch, c.value) {
+			return vm.pushObject(selected(i, object.NULL))
+		}
+		if !c.send {
+			if value, ok := vm.tryRecv(c.ch); ok {
+				return vm.pushObject(selected(i, value))
+			}
+		}
+	}
+
+	w := &waiter{task: s.current, isSelect: true}
+	for i, c := range cases {
+		vm.wait(c.ch, c.send, &pending{w: w, index: i, value: c.value})
+	}
+	// 挂起当前任务, 在某个 pending 完成时被唤醒
+	return vm.block()
+}
+
+func selected(index int, value object.Object) object.Object {
+	return object.NewArray([]object.Object{&object.Integer{Value: int64(index)}, value})
+}
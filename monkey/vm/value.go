@@ -0,0 +1,55 @@
+package vm
+
+import "go-example/monkey/object"
+
+// Value 是 vm 的栈、寄存器、全局变量和常量中保存的值.
+// 整数直接保存在 Value 中, 算术运算不需要在堆上分配 *object.Integer;
+// 布尔值和 null 本身是单例, 与其他对象一样保存在 obj 中.
+// 零值对应 nil, 表示尚未赋值的全局变量
+type Value struct {
+	obj   object.Object
+	int   int64
+	isInt bool
+}
+
+func intValue(n int64) Value { return Value{int: n, isInt: true} }
+
+// ValueOf 把对象转换为 Value, *object.Integer 会被拆箱
+func ValueOf(obj object.Object) Value {
+	if i, ok := obj.(*object.Integer); ok {
+		return intValue(i.Value)
+	}
+	return Value{obj: obj}
+}
+
+// Object 返回对应的对象, 整数每次调用都会分配新的 *object.Integer
+func (v Value) Object() object.Object {
+	if v.isInt {
+		return &object.Integer{Value: v.int}
+	}
+	return v.obj
+}
+
+func (v Value) truthy() bool {
+	return v.isInt || object.IsTruthy(v.obj)
+}
+
+func boolValue(b bool) Value {
+	return Value{obj: nativeBool2Object(b)}
+}
+
+func objects(values []Value) []object.Object {
+	out := make([]object.Object, len(values))
+	for i, v := range values {
+		out[i] = v.Object()
+	}
+	return out
+}
+
+func values(objs []object.Object) []Value {
+	out := make([]Value, len(objs))
+	for i, obj := range objs {
+		out[i] = ValueOf(obj)
+	}
+	return out
+}
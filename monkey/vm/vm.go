@@ -1,31 +1,54 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
 	"go-example/monkey/code"
 	"go-example/monkey/compiler"
 	"go-example/monkey/object"
+	"io"
 )
 
 const (
 	StackSize  = 2048
-	GlobalSize = 65536
+	GlobalSize = compiler.MaxGlobals
 	MaxFrames  = 1024
 )
 
 type VM struct {
-	constants []object.Object
-	globals   []object.Object
+	constants []Value
+	globals   []Value
 
-	stack []object.Object
+	stack []Value
 	sp    int //始终指向栈中的下一个空闲槽
 
 	frames     []*Frame
 	frameIndex int
+
+	// 第一次使用任务或通道时创建
+	sched         *scheduler
+	deterministic bool
+
+	// 正在运行的生成器层数, yielded 表示 run 因 OpYield 返回
+	generators int
+	yielded    bool
+
+	// registers 表示运行寄存器指令, last 是最后一个 OpRResult 记录的值
+	registers bool
+	last      Value
+
+	// counts 不为 nil 时统计每个操作码的执行次数, 见 CountOpcodes
+	counts *OpcodeCounts
+	// out 不为 nil 时 print 的输出写入 out, 见 SetOutput
+	out io.Writer
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	registers := bytecode.Target == compiler.RegisterTarget
 	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	if registers {
+		mainFn.NumLocals = bytecode.NumRegisters
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -33,32 +56,47 @@ func New(bytecode *compiler.Bytecode) *VM {
 	frames[0] = mainFrame
 
 	return &VM{
-		constants: bytecode.Constants,
-		globals:   make([]object.Object, GlobalSize),
+		constants: values(bytecode.Constants),
+		globals:   make([]Value, GlobalSize),
 
-		stack: make([]object.Object, StackSize),
-		sp:    0,
+		stack: make([]Value, StackSize),
+		sp:    mainFn.NumLocals,
 
 		frames:     frames,
 		frameIndex: 1,
+
+		registers: registers,
 	}
 }
 
+// SetOutput 让 print 的输出写入 out 而不是 object.Stdout
+func (vm *VM) SetOutput(out io.Writer) {
+	vm.out = out
+}
+
 func (vm *VM) LastPoppedStackElem() object.Object {
-	return vm.stack[vm.sp]
+	if vm.registers {
+		return vm.last.Object()
+	}
+	return vm.stack[vm.sp].Object()
 }
 
-func (vm *VM) push(obj object.Object) error {
+func (vm *VM) push(v Value) error {
 	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
 	}
 
-	vm.stack[vm.sp] = obj
+	vm.stack[vm.sp] = v
 	vm.sp++
 	return nil
 }
 
-func (vm *VM) pop() object.Object {
+// pushObject 压入内置函数等返回的对象
+func (vm *VM) pushObject(obj object.Object) error {
+	return vm.push(ValueOf(obj))
+}
+
+func (vm *VM) pop() Value {
 	obj := vm.stack[vm.sp-1]
 	vm.sp--
 	return obj
@@ -78,7 +116,31 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.frameIndex]
 }
 
+// Run 运行主任务直到结束, 期间由 spawn 创建的任务与之交替执行.
+// 主任务结束时其他任务不再运行
 func (vm *VM) Run() error {
+	for {
+		if err := vm.run(); err != nil {
+			if s := vm.sched; s != nil && s.current != s.main && err != errDeadlock {
+				return fmt.Errorf("task %d: %w", s.current.id, err)
+			}
+			return err
+		}
+		if vm.sched == nil || vm.sched.current == vm.sched.main {
+			return nil
+		}
+		if err := vm.exitTask(); err != nil {
+			return err
+		}
+	}
+}
+
+// run 执行当前任务直到它结束, 阻塞和抢占会在循环内部切换到其他任务
+func (vm *VM) run() error {
+	if vm.registers {
+		return vm.runRegisters()
+	}
+
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
@@ -88,6 +150,9 @@ func (vm *VM) Run() error {
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
+		if vm.counts != nil {
+			vm.counts[op]++
+		}
 
 		switch op {
 		case code.OpConstant:
@@ -129,11 +194,17 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetLocal0, code.OpGetLocal1, code.OpGetLocal2, code.OpGetLocal3:
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(op-code.OpGetLocal0)])
+			if err != nil {
+				return err
+			}
 		case code.OpGetBuiltin:
 			btIdx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			definition := object.Builtins[btIdx]
-			err := vm.push(definition.Builtin)
+			err := vm.pushObject(definition.Builtin)
 			if err != nil {
 				return err
 			}
@@ -141,35 +212,53 @@ func (vm *VM) Run() error {
 			idx := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[idx])
+			err := vm.push(ValueOf(currentClosure.Free[idx]))
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
-			code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
 			}
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+		case code.OpAddConstant, code.OpSubConstant:
+			constIdx := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err := vm.executeConstantOperation(op, constIdx)
+			if err != nil {
+				return err
+			}
+		case code.OpJumpNotEqual, code.OpJumpEqual, code.OpJumpNotGreater:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err := vm.executeComparisonJump(op, pos)
+			if err != nil {
+				return err
+			}
 		case code.OpBang:
 			err := vm.executeBangOperator()
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpMinus:
 			err := vm.executeMinusOperator()
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpPop:
 			vm.pop()
 		case code.OpTrue:
-			err := vm.push(object.True)
+			err := vm.push(Value{obj: object.True})
 			if err != nil {
 				return err
 			}
 		case code.OpFalse:
-			err := vm.push(object.False)
+			err := vm.push(Value{obj: object.False})
 			if err != nil {
 				return err
 			}
@@ -178,30 +267,42 @@ func (vm *VM) Run() error {
 			vm.currentFrame().ip += 2
 
 			condition := vm.pop()
-			if !object.IsTruthy(condition) {
+			if !condition.truthy() {
 				vm.currentFrame().ip = pos - 1
 			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip = pos - 1
+			if err := vm.preempt(); err != nil {
+				return err
+			}
 		case code.OpNull:
-			err := vm.push(object.NULL)
+			err := vm.push(Value{obj: object.NULL})
 			if err != nil {
 				return err
 			}
 		case code.OpArray:
 			numElems := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			array := vm.buildArray(vm.sp-numElems, vm.sp)
+			array := buildArray(vm.stack[vm.sp-numElems : vm.sp])
 			vm.sp = vm.sp - numElems
 			err := vm.push(array)
 			if err != nil {
 				return err
 			}
+		case code.OpBuildString:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			str := buildString(vm.stack[vm.sp-numParts : vm.sp])
+			vm.sp = vm.sp - numParts
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
 		case code.OpHash:
 			numElems := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
-			hash, err := vm.buildHash(vm.sp-numElems, vm.sp)
+			hash, err := buildHash(vm.stack[vm.sp-numElems : vm.sp])
 			if err != nil {
 				return err
 			}
@@ -215,7 +316,7 @@ func (vm *VM) Run() error {
 			left := vm.pop()
 			err := vm.executeIndexExpression(left, index)
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
@@ -225,9 +326,46 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			if err := vm.preempt(); err != nil {
+				return err
+			}
+		case code.OpCall0, code.OpCall1, code.OpCall2:
+			err := vm.executeCall(int(op - code.OpCall0))
+			if err != nil {
+				return err
+			}
+			if err := vm.preempt(); err != nil {
+				return err
+			}
+		case code.OpIter:
+			err := vm.iterate(vm.pop().Object())
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			ok, err := vm.iterNext()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpWide:
+			err := vm.executeWide(ins, ip)
+			if err != nil {
+				return err
+			}
+		case code.OpYield:
+			// 值留在生成器的栈顶, 由 Next 取走
+			vm.pop()
+			vm.yielded = true
+			return nil
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure)
+			err := vm.push(Value{obj: currentClosure})
 			if err != nil {
 				return err
 			}
@@ -239,14 +377,14 @@ func (vm *VM) Run() error {
 
 			err := vm.push(retValue)
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpReturn:
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
-			err := vm.push(object.NULL)
+			err := vm.push(Value{obj: object.NULL})
 			if err != nil {
-				return nil
+				return err
 			}
 		}
 	}
@@ -254,24 +392,25 @@ func (vm *VM) Run() error {
 }
 
 func (vm *VM) pushClosure(index, numFree int) error {
-	constant := vm.constants[index]
-	fn, ok := constant.(*object.CompiledFunction)
-	if !ok {
-		return fmt.Errorf("not a function:%+v", constant)
-	}
-
-	free := make([]object.Object, numFree)
-	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+	closure, err := vm.newClosure(index, vm.stack[vm.sp-numFree:vm.sp])
+	if err != nil {
+		return err
 	}
 	vm.sp = vm.sp - numFree
+	return vm.push(Value{obj: closure})
+}
 
-	closure := &object.Closure{Fn: fn, Free: free}
-	return vm.push(closure)
+func (vm *VM) newClosure(index int, free []Value) (*object.Closure, error) {
+	constant := vm.constants[index].obj
+	fn, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return nil, fmt.Errorf("not a function:%+v", constant)
+	}
+	return &object.Closure{Fn: fn, Free: objects(free)}, nil
 }
 
 func (vm *VM) executeCall(numArgs int) error {
-	callee := vm.stack[vm.sp-1-numArgs]
+	callee := vm.stack[vm.sp-1-numArgs].obj
 	switch callee := callee.(type) {
 	case *object.Closure:
 		return vm.callClosure(callee, numArgs)
@@ -287,171 +426,250 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
+	if cl.Fn.Generator {
+		g := vm.newGenerator(cl, numArgs)
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(Value{obj: g})
+	}
+
+	// 与寄存器指令集相同, 调用层数或局部变量超出上限时报告 stack overflow
+	if vm.frameIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
 	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
-	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	if fn, ok := vmBuiltins[builtin]; ok {
+		// 调用可能挂起当前任务或运行生成器, 先把参数和被调用者从栈上移走
+		args := objects(vm.stack[vm.sp-numArgs : vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+		return fn(vm, args)
+	}
+
+	args := objects(vm.stack[vm.sp-numArgs : vm.sp])
+	result := builtin.Call(vm.out, args...)
+	vm.sp = vm.sp - numArgs - 1
 	if result != nil {
-		return vm.push(result)
+		return vm.pushObject(result)
 	} else {
-		return vm.push(object.NULL)
+		return vm.pushObject(object.NULL)
 	}
 }
 
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
+	result, err := binaryOperation(op, left, right)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
 
-	leftType := left.Type()
-	rightType := right.Type()
+// binaryOperation 计算 OpAdd、OpSub、OpMul 或 OpDiv, 栈指令和寄存器指令共用.
+// 两个整数的运算结果仍是拆箱的整数, 不分配内存
+func binaryOperation(op code.Opcode, left, right Value) (Value, error) {
+	if left.isInt && right.isInt {
+		return binaryIntegerOperation(op, left.int, right.int)
+	}
 
-	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
-		return vm.executeBinaryIntegerOperation(op, left, right)
-	case leftType == object.BOOLEAN_OBJ && rightType == object.BOOLEAN_OBJ:
-		return vm.executeBinaryBooleanOperation(op, left, right)
-	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
-		return vm.executeBinaryStringOperation(op, left, right)
-	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
+	leftType := left.Object().Type()
+	rightType := right.Object().Type()
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return binaryStringOperation(op, left.obj, right.obj)
 	}
+	return Value{}, fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
+func binaryIntegerOperation(op code.Opcode, leftVal, rightVal int64) (Value, error) {
 	switch op {
 	case code.OpAdd:
-		return vm.push(&object.Integer{Value: leftVal + rightVal})
+		return intValue(leftVal + rightVal), nil
 	case code.OpSub:
-		return vm.push(&object.Integer{Value: leftVal - rightVal})
+		return intValue(leftVal - rightVal), nil
 	case code.OpMul:
-		return vm.push(&object.Integer{Value: leftVal * rightVal})
+		return intValue(leftVal * rightVal), nil
 	case code.OpDiv:
-		return vm.push(&object.Integer{Value: leftVal / rightVal})
-	case code.OpEqual:
-		return vm.push(nativeBool2Object(leftVal == rightVal))
-	case code.OpNotEqual:
-		return vm.push(nativeBool2Object(leftVal != rightVal))
-	case code.OpGreaterThan:
-		return vm.push(&object.Boolean{Value: leftVal > rightVal})
+		return intValue(leftVal / rightVal), nil
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return Value{}, fmt.Errorf("unknown integer operator: %d", op)
 	}
 }
 
-func (vm *VM) executeBinaryBooleanOperation(op code.Opcode, left, right object.Object) error {
-	leftVal := left.(*object.Boolean).Value
-	rightVal := right.(*object.Boolean).Value
+func binaryStringOperation(op code.Opcode, left, right object.Object) (Value, error) {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
 
+	switch op {
+	case code.OpAdd:
+		return Value{obj: &object.String{Value: leftVal + rightVal}}, nil
+	default:
+		return Value{}, fmt.Errorf("unknown string operator: %d", op)
+	}
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+	result, err := comparison(op, left, right)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+// comparison 与求值器相同, 使用 object.Equal 和 object.Compare, 两个整数直接比较.
+// 编译器把 a < b 编译为 b > a, 这里只需要处理 OpGreaterThan
+func comparison(op code.Opcode, left, right Value) (Value, error) {
+	if left.isInt && right.isInt {
+		switch op {
+		case code.OpEqual:
+			return boolValue(left.int == right.int), nil
+		case code.OpNotEqual:
+			return boolValue(left.int != right.int), nil
+		default:
+			return boolValue(left.int > right.int), nil
+		}
+	}
+
+	l, r := left.Object(), right.Object()
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBool2Object(leftVal == rightVal))
+		return boolValue(object.Equal(l, r)), nil
 	case code.OpNotEqual:
-		return vm.push(nativeBool2Object(leftVal != rightVal))
+		return boolValue(!object.Equal(l, r)), nil
 	default:
-		return fmt.Errorf("unknown boolean operator: %d", op)
+		result, ok := object.Compare(l, r)
+		if !ok {
+			return Value{}, fmt.Errorf("unsupported types for binary operation: %s %s", l.Type(), r.Type())
+		}
+		return boolValue(result > 0), nil
 	}
 }
 
-func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
+// executeConstantOperation 执行 OpAddConstant 和 OpSubConstant, 结果直接替换栈顶
+func (vm *VM) executeConstantOperation(op code.Opcode, constIdx int) error {
+	binOp := code.OpAdd
+	if op == code.OpSubConstant {
+		binOp = code.OpSub
+	}
+	result, err := binaryOperation(binOp, vm.stack[vm.sp-1], vm.constants[constIdx])
+	if err != nil {
+		return err
+	}
+	vm.stack[vm.sp-1] = result
+	return nil
+}
 
+// executeComparisonJump 执行比较并跳转的指令, 比较结果不为真时跳转到 pos
+func (vm *VM) executeComparisonJump(op code.Opcode, pos int) error {
+	cmpOp := code.OpEqual
 	switch op {
-	case code.OpAdd:
-		return vm.push(&object.String{Value: leftVal + rightVal})
-	default:
-		return fmt.Errorf("unknown string operator: %d", op)
+	case code.OpJumpEqual:
+		cmpOp = code.OpNotEqual
+	case code.OpJumpNotGreater:
+		cmpOp = code.OpGreaterThan
+	}
+	right := vm.pop()
+	left := vm.pop()
+	result, err := comparison(cmpOp, left, right)
+	if err != nil {
+		return err
+	}
+	if !result.truthy() {
+		vm.currentFrame().ip = pos - 1
 	}
+	return nil
 }
 
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
-	switch operand {
-	case object.True:
-		return vm.push(object.False)
-	case object.False:
-		return vm.push(object.True)
-	case object.NULL:
-		return vm.push(object.True)
-	default:
-		return vm.push(object.False)
-	}
+	return vm.push(boolValue(!operand.truthy()))
 }
 
 func (vm *VM) executeMinusOperator() error {
-	operand := vm.pop()
+	result, err := negate(vm.pop())
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
 
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupport type for negation: %s", operand.Type())
+func negate(operand Value) (Value, error) {
+	if !operand.isInt {
+		return Value{}, fmt.Errorf("unsupport type for negation: %s", operand.obj.Type())
 	}
+	return intValue(-operand.int), nil
+}
 
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+func buildArray(elems []Value) Value {
+	return Value{obj: object.NewArray(objects(elems))}
 }
 
-func (vm *VM) buildArray(start, end int) object.Object {
-	elements := make([]object.Object, end-start)
-	for i := start; i < end; i++ {
-		elements[i-start] = vm.stack[i]
+func buildString(parts []Value) Value {
+	var out bytes.Buffer
+	for _, part := range parts {
+		out.WriteString(part.Object().Inspect())
 	}
-	return &object.Array{Elements: elements}
+	return Value{obj: &object.String{Value: out.String()}}
 }
 
-func (vm *VM) buildHash(start, end int) (object.Object, error) {
-	pairs := make(map[object.HashKey]object.HashPair)
-	for i := start; i < end; i += 2 {
-		key := vm.stack[i]
-		value := vm.stack[i+1]
+func buildHash(elems []Value) (Value, error) {
+	hash := &object.Hash{}
+	for i := 0; i < len(elems); i += 2 {
+		key := elems[i].Object()
+		value := elems[i+1].Object()
 		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(key)
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return Value{}, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
-		pairs[hashKey.HashKey()] = pair
+		hash = hash.Set(hashKey, pair)
 	}
-	return &object.Hash{Pairs: pairs}, nil
+	return Value{obj: hash}, nil
 }
 
-func (vm *VM) executeIndexExpression(left, index object.Object) error {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return vm.executeArrayIndex(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return vm.executeHashIndex(left, index)
-	default:
-		return fmt.Errorf("index operator not supported: %s", left.Type())
+func (vm *VM) executeIndexExpression(left, index Value) error {
+	result, err := indexExpression(left, index)
+	if err != nil {
+		return err
 	}
+	return vm.push(result)
 }
 
-func (vm *VM) executeArrayIndex(array, index object.Object) error {
-	arrayObj := array.(*object.Array)
-	i := index.(*object.Integer).Value
-	length := len(arrayObj.Elements) - 1
-	if i < 0 || i > int64(length) {
-		return vm.push(object.NULL)
+func indexExpression(left, index Value) (Value, error) {
+	switch left := left.obj.(type) {
+	case *object.Array:
+		if !index.isInt {
+			break
+		}
+		if index.int < 0 || index.int >= int64(left.Len()) {
+			return Value{obj: object.NULL}, nil
+		}
+		return ValueOf(left.At(int(index.int))), nil
+	case *object.Hash:
+		return hashIndex(left, index.Object())
 	}
-	return vm.push(arrayObj.Elements[i])
+	return Value{}, fmt.Errorf("index operator not supported: %s", left.Object().Type())
 }
 
-func (vm *VM) executeHashIndex(hash, index object.Object) error {
-	hashObj := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+func hashIndex(hash *object.Hash, index object.Object) (Value, error) {
+	key, ok := object.HashKeyOf(index)
 	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+		return Value{}, fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
-	pair, ok := hashObj.Pairs[key.HashKey()]
+	pair, ok := hash.Get(key, index)
 	if !ok {
-		return vm.push(object.NULL)
+		return Value{obj: object.NULL}, nil
 	}
-	return vm.push(pair.Value)
+	return ValueOf(pair.Value), nil
 }
 
 func nativeBool2Object(input bool) *object.Boolean {
@@ -462,7 +680,7 @@ func nativeBool2Object(input bool) *object.Boolean {
 	}
 }
 
-func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+func NewWithGlobalStore(bytecode *compiler.Bytecode, s []Value) *VM {
 	vm := New(bytecode)
 	vm.globals = s
 	return vm
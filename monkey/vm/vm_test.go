@@ -6,6 +6,7 @@ import (
 	"go-example/monkey/lexer"
 	"go-example/monkey/object"
 	"go-example/monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -63,6 +64,28 @@ func TestObjectArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestTemplateLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`"${1}"`, "1"},
+		{`let name = "monkey"; "hello ${name}!"`, "hello monkey!"},
+		{`let items = [1, 2]; "you have ${len(items)} items: ${items}"`, "you have 2 items: [1, 2]"},
+		{`"${true} ${if (false) { 1 }} ${"nested ${1 + 1}"}"`, "true null nested 2"},
+		{`let greet = fn(who) { "hi ${who}" }; greet("there")`, "hi there"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x: int = 5; x", 5},
+		{"let add = fn(a: int, b: int): int { a + b }; add(1, 2)", 3},
+		{`let apply: fn(fn(string): string, string): string = fn(f, s) { f(s) }; apply(fn(s) { s + "!" }, "hi")`, "hi!"},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -325,25 +348,29 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 		},
 	}
 
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := parser.New(l)
-		prog := p.ParseProgram()
+	for _, target := range targets {
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			prog := p.ParseProgram()
 
-		comp := compiler.New()
-		err := comp.Compile(prog)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
+			comp := compiler.New()
+			comp.SetTarget(target)
+			err := comp.Compile(prog)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err == nil {
-			t.Fatalf("expected VM error but resulted in none.")
-		}
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err == nil {
+				t.Fatalf("expected VM error but resulted in none.")
+			}
 
-		if err.Error() != tt.expected {
-			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+			if err.Error() != tt.expected {
+				t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+			}
+			checkWasm(t, tt.input, nil, err)
 		}
 	}
 }
@@ -389,11 +416,320 @@ func TestBuiltinFunctions(t *testing.T) {
 				Message: "argument to `push` must be array, got integer",
 			},
 		},
+		{`json_parse("[1, 2]")`, []int{1, 2}},
+		{`json_parse("{\"a\": [true]}")["a"][0] == true`, true},
+		{`if (json_parse("false")) { 1 } else { 2 }`, 2},
+		{`!json_parse("null")`, true},
+		{`!(1 > 2)`, true},
+		{`json_stringify({"b": [1, "x"], "a": if (false) { 1 }})`, `{"b":[1,"x"],"a":null}`},
+		{`json_stringify(fn() { 1 })`,
+			&object.Error{
+				Message: "json_stringify: cannot serialize value of type closure",
+			},
+		},
 	}
 
 	runVmTests(t, tests)
 }
 
+// 内置函数返回后, 函数本身和参数要从栈上移除, 否则反复调用会让栈不断增长直到溢出
+func TestBuiltinCallsDoNotGrowStack(t *testing.T) {
+	input := "let f = fn(x) { len(x) };"
+	for i := 0; i < StackSize; i++ {
+		input += `len("abc"); f([1, 2, 3]);`
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElem())
+	if vm.sp != 0 {
+		t.Errorf("stack not empty after run. sp=%d", vm.sp)
+	}
+}
+
+// 无限递归在调用层数达到 MaxFrames 时报错, 不会越界 panic
+func TestUnboundedRecursion(t *testing.T) {
+	tests := []string{
+		`let f = fn() { f() }; f()`,
+		`let f = fn(n) { 1 + f(n + 1) }; f(0)`,
+		`let f = fn(a, b) { let c = a + b; f(c, a) + c }; f(1, 1)`,
+		`let g = fn() { let f = fn(n) { f(n) }; f(1) }; g()`,
+		`let gen = fn() { let f = fn() { f() }; yield f(); }; next(gen())`,
+	}
+
+	for _, input := range tests {
+		for _, target := range targets {
+			_, err := runTaskTest(t, target, input, true)
+			if err == nil || err.Error() != "stack overflow" {
+				t.Errorf("%q on %s: expected stack overflow, got %v", input, target, err)
+			}
+		}
+	}
+}
+
+// 返回值放回调用者的栈上时同样要检查溢出. 正常调用时返回后的 sp 总是更小,
+// 这里手工构造一个帧, 让返回值正好落在栈外
+func TestReturnStackOverflow(t *testing.T) {
+	for _, input := range []string{"fn() { }", "fn() { 1 }"} {
+		comp := compiler.New()
+		if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		var fn *object.CompiledFunction
+		for _, c := range bytecode.Constants {
+			if c, ok := c.(*object.CompiledFunction); ok {
+				fn = c
+			}
+		}
+
+		vm := New(bytecode)
+		vm.pushFrame(NewFrame(&object.Closure{Fn: fn}, StackSize+1))
+		if err := vm.Run(); err == nil || err.Error() != "stack overflow" {
+			t.Errorf("%q: expected stack overflow, got %v", input, err)
+		}
+	}
+}
+
+func TestHashOrderAndStructuralKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, `{b: 1, a: 2, c: 3}`},
+		{`{3: 1, 1: 2, "b": 3, true: 4, 2: 5}`, `{3: 1, 1: 2, b: 3, true: 4, 2: 5}`},
+		{`{"x": 1, "y": 2, "x": 3}`, `{x: 3, y: 2}`},
+		{`collect({"z": 1, "a": 2, "m": 3})`, `[z, a, m]`},
+		{`{[1, "a"]: "x"}[[1, "a"]]`, `x`},
+		{`{[1, 2]: "x"}[[2, 1]]`, `null`},
+		{`{{"a": 1, "b": [2]}: "x"}[{"b": [2], "a": 1}]`, `x`},
+		{`{[fn() { 1 }]: 1}`, `unusable as hash key: array`},
+	}
+
+	for _, target := range targets {
+		for _, tt := range tests {
+			vm, err := runTaskTest(t, target, tt.input, true)
+			if err != nil {
+				if err.Error() != tt.expected {
+					t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+				}
+				checkWasm(t, tt.input, nil, err)
+				continue
+			}
+			if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+				t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+			}
+			checkWasm(t, tt.input, vm.LastPoppedStackElem(), nil)
+		}
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, `true`},
+		{`[1, 2] == [2, 1]`, `false`},
+		{`[1, 2] != [1, 2, 3]`, `true`},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, `true`},
+		{`{"a": 1} == {"a": 2}`, `false`},
+		{`if (false) { 1 } == if (false) { 2 }`, `true`},
+		{`if (false) { 1 } == 0`, `false`},
+		{`1 == "1"`, `false`},
+		{`1 != true`, `true`},
+		{`[1 > 0] == [true]`, `true`},
+		{`let f = fn() { 1 }; [f == f, f == fn() { 1 }]`, `[true, false]`},
+		{`["a" < "b", "b" < "a", "ab" > "a", "a" > "a"]`, `[true, false, true, false]`},
+		{`"a" < 1`, `unsupported types for binary operation: integer string`},
+		{`[1] < [2]`, `unsupported types for binary operation: array array`},
+	}
+
+	for _, target := range targets {
+		for _, tt := range tests {
+			vm, err := runTaskTest(t, target, tt.input, true)
+			if err != nil {
+				if err.Error() != tt.expected {
+					t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err)
+				}
+				checkWasm(t, tt.input, nil, err)
+				continue
+			}
+			if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+				t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+			}
+			checkWasm(t, tt.input, vm.LastPoppedStackElem(), nil)
+		}
+	}
+}
+
+func runTaskTest(t *testing.T, target compiler.Target, input string, deterministic bool) (*VM, error) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := compiler.New()
+	comp.SetTarget(target)
+	if err := comp.Compile(prog); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetDeterministic(deterministic)
+	return vm, vm.Run()
+}
+
+func TestTasksAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`recv(spawn(fn(x) { x * 2 }, 21))`, "42"},
+		{`recv(spawn(len, "four"))`, "4"},
+		{`let ch = channel(2); send(ch, 1); send(ch, 2); [recv(ch), recv(ch)]`, "[1, 2]"},
+		{`
+let ch = channel();
+let producer = fn(n) { send(ch, n); if (n > 0) { producer(n - 1) } };
+spawn(producer, 10);
+let sum = fn(acc) { let v = recv(ch); if (v == 0) { acc } else { sum(acc + v) } };
+sum(0)`, "55"},
+		// 任务之间通过全局变量共享同一个通道, 结果通道在任务结束后可以接收返回值
+		{`
+let results = channel(3);
+let worker = fn(n) { send(results, n * n); n };
+let a = spawn(worker, 2);
+let b = spawn(worker, 3);
+let c = spawn(worker, 4);
+let total = recv(results) + recv(results) + recv(results);
+[total, recv(a) + recv(b) + recv(c)]`, "[29, 9]"},
+		{`
+let a = channel();
+let b = channel();
+spawn(fn() { send(b, "hi") });
+select([a, b])`, "[1, hi]"},
+		{`let a = channel(1); let r = select([channel(), [a, 5]]); [r, recv(a)]`, "[[1, null], 5]"},
+		{`
+let req = channel();
+let done = channel();
+spawn(fn() { let r = select([[req, "ping"], done]); send(done, r[0]) });
+let got = recv(req);
+[got, recv(done)]`, "[ping, 0]"},
+		{`send(1, 2)`, "argument to `send` must be channel, got integer"},
+		{`select([])`, "argument to `select` must be a non-empty array, got []"},
+		{`spawn(1)`, "argument to `spawn` must be a function, got integer"},
+	}
+
+	for _, deterministic := range []bool{true, false} {
+		for _, target := range targets {
+			for _, tt := range tests {
+				vm, err := runTaskTest(t, target, tt.input, deterministic)
+				if err != nil {
+					t.Errorf("%q: vm error: %s", tt.input, err)
+					continue
+				}
+				result := vm.LastPoppedStackElem()
+				if errObj, ok := result.(*object.Error); ok {
+					if errObj.Message != tt.expected {
+						t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+					}
+					continue
+				}
+				if result.Inspect() != tt.expected {
+					t.Errorf("%q (deterministic=%t): wrong result. want=%s, got=%s",
+						tt.input, deterministic, tt.expected, result.Inspect())
+				}
+			}
+		}
+	}
+}
+
+func TestDeterministicScheduling(t *testing.T) {
+	// 两个任务争用同一个无缓冲通道, 交错顺序完全由调度器决定
+	input := `
+let log = channel();
+let worker = fn(name, n) { if (n > 0) { send(log, name); worker(name, n - 1) } };
+spawn(worker, "a", 3);
+spawn(worker, "b", 3);
+let drain = fn(acc, n) { if (n == 0) { acc } else { drain(acc + recv(log), n - 1) } };
+drain("", 6)`
+
+	for _, target := range targets {
+		for i := 0; i < 5; i++ {
+			vm, err := runTaskTest(t, target, input, true)
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			if got := vm.LastPoppedStackElem().Inspect(); got != "aababb" {
+				t.Errorf("wrong interleaving: %s", got)
+			}
+		}
+	}
+
+	for _, target := range targets {
+		for i := 0; i < 20; i++ {
+			vm, err := runTaskTest(t, target, input, false)
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			got := vm.LastPoppedStackElem().Inspect()
+			if strings.Count(got, "a") != 3 || strings.Count(got, "b") != 3 {
+				t.Errorf("lost messages: %s", got)
+			}
+		}
+	}
+}
+
+func TestPreemption(t *testing.T) {
+	// 主任务一直在计算而不阻塞, 子任务也要在时间片用完时得到运行
+	input := `
+let ch = channel(1);
+let spin = fn(n) { if (n > 0) { spin(n - 1) } else { 0 } };
+spawn(fn() { send(ch, 1) });
+spin(500);`
+
+	for _, target := range targets {
+		vm, err := runTaskTest(t, target, input, true)
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		ch := vm.globals[0].obj.(*object.Channel)
+		if len(ch.Buffer) != 1 {
+			t.Errorf("spawned task did not run before main finished")
+		}
+	}
+}
+
+func TestTaskErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`recv(channel())`, "all tasks are blocked: deadlock"},
+		{`let ch = channel(); spawn(fn() { recv(ch) }); recv(ch)`, "all tasks are blocked: deadlock"},
+		{`recv(spawn(fn() { 1 + true }))`, "task 1: unsupported types for binary operation: integer boolean"},
+		{`recv(spawn(fn(a) { a }))`, "task 1: wrong number of arguments: want=1, got=0"},
+	}
+
+	for _, target := range targets {
+		for _, tt := range tests {
+			_, err := runTaskTest(t, target, tt.input, true)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+				continue
+			}
+			checkWasm(t, tt.input, nil, err)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -542,27 +878,36 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// 每个用例都分别在栈指令和寄存器指令上运行
+var targets = []compiler.Target{compiler.StackTarget, compiler.RegisterTarget}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := parser.New(l)
-		prog := p.ParseProgram()
+	for _, target := range targets {
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			prog := p.ParseProgram()
 
-		comp := compiler.New()
-		err := comp.Compile(prog)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
+			comp := compiler.New()
+			comp.SetTarget(target)
+			err := comp.Compile(prog)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err != nil {
-			t.Fatalf("vm error: %s", err)
-		}
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("%s vm error: %s", target, err)
+			}
 
-		stackElem := vm.LastPoppedStackElem()
-		testExpectedObject(t, tt.expected, stackElem)
+			stackElem := vm.LastPoppedStackElem()
+			testExpectedObject(t, tt.expected, stackElem)
+			if target == compiler.StackTarget {
+				checkWasm(t, tt.input, stackElem, nil)
+			}
+		}
 	}
 }
 
@@ -594,11 +939,11 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 			t.Errorf("object is not Array: %T (%+v)", actual, actual)
 			return
 		}
-		if len(array.Elements) != len(expected) {
-			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		if array.Len() != len(expected) {
+			t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), array.Len())
 		}
 		for i, e := range expected {
-			err := testIntegerObject(int64(e), array.Elements[i])
+			err := testIntegerObject(int64(e), array.At(i))
 			if err != nil {
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
@@ -609,13 +954,14 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 			t.Errorf("object is not Hash: %T (%+v)", actual, actual)
 			return
 		}
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hash.Len())
 		}
-		for k, v := range expected {
-			pair, ok := hash.Pairs[k]
+		for _, pair := range hash.Ordered() {
+			k, _ := object.HashKeyOf(pair.Key)
+			v, ok := expected[k]
 			if !ok {
-				t.Errorf("no pair for given key in pairs")
+				t.Errorf("unexpected key %s in pairs", pair.Key.Inspect())
 			}
 			err := testIntegerObject(v, pair.Value)
 			if err != nil {
@@ -668,3 +1014,75 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestGenerators(t *testing.T) {
+	tests := []vmTestCase{
+		{`let gen = fn() { yield 1; yield 2; }; collect(gen())`, []int{1, 2}},
+		{`let squares = fn(xs) { for (x in xs) { yield x * x; } }; collect(squares([1, 2, 3]))`, []int{1, 4, 9}},
+		{`let gen = fn(a, b) { yield a; yield b; }; let it = gen(1, 2); next(it); next(it)`, 2},
+		{`let gen = fn() { yield 1; }; let it = gen(); next(it); next(it); next(it)`, object.NULL},
+		{`let gen = fn() { let x = 10; yield x; yield x + 1; }; let it = gen(); next(it) + next(it)`, 21},
+		// 递归的生成器
+		{`
+		let upTo = fn(n) {
+			if (n > 0) {
+				for (x in upTo(n - 1)) { yield x; }
+				yield n;
+			}
+		};
+		collect(upTo(4))
+		`, []int{1, 2, 3, 4}},
+		{`let it = iter([1, 2]); next(it); collect(it)`, []int{2}},
+		{`let it = iter("ab"); next(it)`, "a"},
+		{`let add = fn(x) { fn(y) { yield x + y; } }; collect(add(1)(2))`, []int{3}},
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()`, 20},
+		{`let f = fn() { for (x in []) { x } }; f()`, object.NULL},
+		{`if (true) { let a = 1; }`, object.NULL},
+		{`next(1)`, &object.Error{Message: "argument to `next` must be iterator, got integer"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	input := `
+	let ch = channel(10);
+	let gen = fn() { yield "a"; yield "b"; };
+	for (s in gen()) { send(ch, s); }
+	for (c in "cd") { send(ch, c); }
+	collect([recv(ch), recv(ch), recv(ch), recv(ch)])
+	`
+	for _, target := range targets {
+		vm, err := runTaskTest(t, target, input, true)
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != `[a, b, c, d]` {
+			t.Errorf("wrong result. got=%s", got)
+		}
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`for (x in 1) { x }`, "cannot iterate over integer"},
+		{`let gen = fn() { yield 1; 1 + true }; collect(gen())`, "unsupported types for binary operation: integer boolean"},
+		{`let gen = fn() { yield 1 + true; }; for (x in gen()) { x }`, "unsupported types for binary operation: integer boolean"},
+		{`let gen = fn() { yield recv(channel()); }; next(gen())`, "cannot block inside a generator"},
+		{`let gen = fn(a) { yield a; }; gen()`, "wrong number of arguments: want=1, got=0"},
+	}
+
+	for _, target := range targets {
+		for _, tt := range tests {
+			_, err := runTaskTest(t, target, tt.input, true)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+				continue
+			}
+			checkWasm(t, tt.input, nil, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package vm
+
+import (
+	"context"
+	"go-example/monkey/lexer"
+	"go-example/monkey/object"
+	"go-example/monkey/parser"
+	"go-example/monkey/wasm"
+	"strings"
+	"testing"
+)
+
+// checkWasm 把 input 编译为 wasm 模块, 在 wazero 中运行, 与 vm 的结果或错误对照.
+// 对照在名为 wasm 的子测试中进行, 用到 wasm 后端不支持的特性 (生成器、任务和通道等)
+// 或结果无法对照的程序跳过这个子测试, 并给出原因
+func checkWasm(t *testing.T, input string, result object.Object, vmErr error) {
+	t.Helper()
+	t.Run("wasm", func(t *testing.T) {
+		if result != nil {
+			switch result.Type() {
+			case object.CLOSURE_OBJ, object.ITERATOR_OBJ, object.GENERATOR_OBJ, object.CHANNEL_OBJ:
+				t.Skipf("%q: inspect of %s contains an address", input, result.Type())
+			}
+		}
+
+		module, err := wasm.Compile(parser.New(lexer.New(input)).ParseProgram())
+		if err != nil {
+			if strings.Contains(err.Error(), "not supported by the wasm backend") {
+				t.Skipf("%q: %s", input, err)
+			}
+			t.Fatalf("%q: wasm compile error: %s", input, err)
+		}
+		got, err := wasm.Run(context.Background(), module, nil)
+		switch {
+		case vmErr != nil:
+			if err == nil || err.Error() != vmErr.Error() {
+				t.Errorf("%q: wrong wasm error. vm=%q, wasm=%v", input, vmErr, err)
+			}
+		case err != nil:
+			t.Errorf("%q: wasm error: %s", input, err)
+		case got.IsError != (result.Type() == object.ERROR_OBJ):
+			t.Errorf("%q: wasm result %s has IsError=%t", input, got.Inspect, got.IsError)
+		case got.Inspect != result.Inspect():
+			t.Errorf("%q: wrong wasm result.\nvm:   %s\nwasm: %s", input, result.Inspect(), got.Inspect)
+		}
+	})
+}
+
+func TestWasmRuntimeErrors(t *testing.T) {
+	tests := []string{
+		`-"a"`,
+		`[1, 2]["a"]`,
+		`1[0]`,
+		`{}[[fn() { 1 }]]`,
+		`{fn() { 1 }: 1}`,
+		`let f = 1; f(1)`,
+		`"a" - "b"`,
+		`[1] + [2]`,
+		`for (x in true) { x }`,
+	}
+
+	for _, input := range tests {
+		for _, target := range targets {
+			_, err := runTaskTest(t, target, input, true)
+			if err == nil {
+				t.Fatalf("%q: expected vm error on %s", input, target)
+			}
+			checkWasm(t, input, nil, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package vm
+
+import (
+	"fmt"
+	"go-example/monkey/code"
+	"go-example/monkey/object"
+)
+
+// executeWide 执行 ip 处带 OpWide 前缀的指令. 语义与不带前缀时相同, 只是操作数更宽,
+// 编译器只在操作数放不下时使用前缀, 所以这里不考虑执行速度
+func (vm *VM) executeWide(ins code.Instructions, ip int) error {
+	op := code.Opcode(ins[ip+1])
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return err
+	}
+	operands, read := code.ReadOperands(code.Wide(def), ins[ip+2:])
+	frame := vm.currentFrame()
+	frame.ip += 1 + read
+
+	switch op {
+	case code.OpConstant:
+		return vm.push(vm.constants[operands[0]])
+	case code.OpGetGlobal:
+		return vm.push(vm.globals[operands[0]])
+	case code.OpSetGlobal:
+		vm.globals[operands[0]] = vm.pop()
+	case code.OpGetLocal:
+		return vm.push(vm.stack[frame.basePointer+operands[0]])
+	case code.OpSetLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.pop()
+	case code.OpGetBuiltin:
+		return vm.pushObject(object.Builtins[operands[0]].Builtin)
+	case code.OpGetFree:
+		return vm.push(ValueOf(frame.cl.Free[operands[0]]))
+	case code.OpClosure:
+		return vm.pushClosure(operands[0], operands[1])
+	case code.OpArray, code.OpBuildString, code.OpHash:
+		n := operands[0]
+		elems := vm.stack[vm.sp-n : vm.sp]
+		var result Value
+		switch op {
+		case code.OpArray:
+			result = buildArray(elems)
+		case code.OpBuildString:
+			result = buildString(elems)
+		default:
+			if result, err = buildHash(elems); err != nil {
+				return err
+			}
+		}
+		vm.sp = vm.sp - n
+		return vm.push(result)
+	case code.OpCall:
+		if err := vm.executeCall(operands[0]); err != nil {
+			return err
+		}
+		return vm.preempt()
+	case code.OpAddConstant, code.OpSubConstant:
+		return vm.executeConstantOperation(op, operands[0])
+	case code.OpJump:
+		frame.ip = operands[0] - 1
+		return vm.preempt()
+	case code.OpJumpNotTruthy:
+		if !vm.pop().truthy() {
+			frame.ip = operands[0] - 1
+		}
+	case code.OpJumpNotEqual, code.OpJumpEqual, code.OpJumpNotGreater:
+		return vm.executeComparisonJump(op, operands[0])
+	case code.OpIterNext:
+		ok, err := vm.iterNext()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			frame.ip = operands[0] - 1
+		}
+	default:
+		return fmt.Errorf("%s cannot be widened", def.Name)
+	}
+	return nil
+}
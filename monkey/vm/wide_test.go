@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"fmt"
+	"go-example/monkey/compiler"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestWideLocals(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&body, "let %s = %d; ", localName(i), i)
+	}
+	input := fmt.Sprintf(`
+	let f = fn(a) { %s let g = fn() { %s + a }; g() };
+	f(1)`, body.String(), localName(299))
+
+	runVmTests(t, []vmTestCase{{input, 300}})
+}
+
+func TestWideConstantsAndJumps(t *testing.T) {
+	// 65537 个常量使 OpConstant 需要 4 字节操作数, 分支的长度超过 64KiB 使跳转也需要加宽
+	input := fmt.Sprintf(`
+	let n = 0;
+	let x = if (n < 1) { %s n + 42 } else { 0 };
+	let ch = channel(3);
+	for (i in [1, 2, 3]) { if (i == 5) { %s } send(ch, i); }
+	[x, recv(ch) + recv(ch) + recv(ch)]`, strings.Repeat("1; ", 65537), strings.Repeat("2; ", 20000))
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := vm.LastPoppedStackElem().Inspect(); got != "[42, 6]" {
+		t.Errorf("wrong result. got=%s", got)
+	}
+
+	comp = compiler.New()
+	comp.SetTarget(compiler.RegisterTarget)
+	if err := comp.Compile(program); err == nil {
+		t.Errorf("expected register compiler to reject operands wider than 2 bytes")
+	}
+}
+
+func TestTooManyGlobals(t *testing.T) {
+	// 正好 MaxGlobals 个全局变量可以运行, 再多一个编译器就报错, 不会在虚拟机中越界
+	var lets strings.Builder
+	for i := 0; i < compiler.MaxGlobals; i++ {
+		fmt.Fprintf(&lets, "let %s = %d; ", globalName(i), i)
+	}
+	last := globalName(compiler.MaxGlobals - 1)
+	for _, target := range targets {
+		program := parser.New(lexer.New(lets.String() + last)).ParseProgram()
+		comp := compiler.New()
+		comp.SetTarget(target)
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%s: compiler error: %s", target, err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", target, err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != "65535" {
+			t.Errorf("%s: wrong result. got=%s", target, got)
+		}
+
+		for _, extra := range []string{"let extra = 1; extra", "for (extra in [1]) { extra }"} {
+			program = parser.New(lexer.New(lets.String() + extra)).ParseProgram()
+			comp = compiler.New()
+			comp.SetTarget(target)
+			err := comp.Compile(program)
+			if err == nil || !strings.Contains(err.Error(), "too many global variables") {
+				t.Errorf("%s: %q: expected too many global variables error, got %v", target, extra, err)
+			}
+		}
+	}
+}
+
+// globalName 返回第 i 个只由字母组成的变量名, 不会与关键字重复
+func globalName(i int) string {
+	name := ""
+	for ; i > 0 || name == ""; i /= 26 {
+		name = string(rune('a'+i%26)) + name
+	}
+	return "g" + name
+}
+
+// localName 返回第 i 个只由字母组成的变量名
+func localName(i int) string {
+	return "v" + string(rune('a'+i/26)) + string(rune('a'+i%26))
+}
@@ -0,0 +1,391 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// 二进制格式中用到的值类型和指令, 见 WebAssembly 核心规范第 5 章.
+// 只使用 MVP 的指令, 不依赖 bulk memory 等扩展
+const (
+	i32 byte = 0x7F
+	i64 byte = 0x7E
+
+	funcref   byte = 0x70
+	blockVoid byte = 0x40
+)
+
+const (
+	opUnreachable  byte = 0x00
+	opBlock        byte = 0x02
+	opLoop         byte = 0x03
+	opIf           byte = 0x04
+	opElse         byte = 0x05
+	opEnd          byte = 0x0B
+	opBr           byte = 0x0C
+	opBrIf         byte = 0x0D
+	opReturn       byte = 0x0F
+	opCall         byte = 0x10
+	opCallIndirect byte = 0x11
+	opDrop         byte = 0x1A
+	opSelect       byte = 0x1B
+	opLocalGet     byte = 0x20
+	opLocalSet     byte = 0x21
+	opLocalTee     byte = 0x22
+	opGlobalGet    byte = 0x23
+	opGlobalSet    byte = 0x24
+	opI32Load      byte = 0x28
+	opI64Load      byte = 0x29
+	opI32Load8U    byte = 0x2D
+	opI32Store     byte = 0x36
+	opI64Store     byte = 0x37
+	opI32Store8    byte = 0x3A
+	opMemorySize   byte = 0x3F
+	opMemoryGrow   byte = 0x40
+	opI32Const     byte = 0x41
+	opI64Const     byte = 0x42
+
+	opI32Eqz  byte = 0x45
+	opI32Eq   byte = 0x46
+	opI32Ne   byte = 0x47
+	opI32LtS  byte = 0x48
+	opI32LtU  byte = 0x49
+	opI32GtS  byte = 0x4A
+	opI32GtU  byte = 0x4B
+	opI32LeU  byte = 0x4D
+	opI32GeS  byte = 0x4E
+	opI32GeU  byte = 0x4F
+	opI64Eqz  byte = 0x50
+	opI64Eq   byte = 0x51
+	opI64LtS  byte = 0x53
+	opI64GtS  byte = 0x55
+	opI64GeS  byte = 0x59
+	opI32Add  byte = 0x6A
+	opI32Sub  byte = 0x6B
+	opI32Mul  byte = 0x6C
+	opI32DivU byte = 0x6E
+	opI32And  byte = 0x71
+	opI32Or   byte = 0x72
+	opI32Shl  byte = 0x74
+	opI32ShrU byte = 0x76
+	opI64Add  byte = 0x7C
+	opI64Sub  byte = 0x7D
+	opI64Mul  byte = 0x7E
+	opI64DivS byte = 0x7F
+	opI64DivU byte = 0x80
+	opI64RemU byte = 0x82
+
+	opI32WrapI64    byte = 0xA7
+	opI64ExtendI32U byte = 0xAD
+)
+
+const (
+	sectionType     byte = 1
+	sectionImport   byte = 2
+	sectionFunction byte = 3
+	sectionTable    byte = 4
+	sectionMemory   byte = 5
+	sectionGlobal   byte = 6
+	sectionExport   byte = 7
+	sectionElement  byte = 9
+	sectionCode     byte = 10
+	sectionData     byte = 11
+)
+
+func appendU32(buf []byte, v uint32) []byte {
+	for {
+		b := byte(v & 0x7F)
+		v >>= 7
+		if v == 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
+func appendS64(buf []byte, v int64) []byte {
+	for {
+		b := byte(v & 0x7F)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
+func appendName(buf []byte, name string) []byte {
+	buf = appendU32(buf, uint32(len(name)))
+	return append(buf, name...)
+}
+
+// instructions 是一个函数体的指令序列
+type instructions struct {
+	buf []byte
+}
+
+func (c *instructions) op(ops ...byte) { c.buf = append(c.buf, ops...) }
+
+func (c *instructions) i32(v int32) {
+	c.buf = append(c.buf, opI32Const)
+	c.buf = appendS64(c.buf, int64(v))
+}
+
+func (c *instructions) i64(v int64) {
+	c.buf = append(c.buf, opI64Const)
+	c.buf = appendS64(c.buf, v)
+}
+
+func (c *instructions) index(op byte, index uint32) {
+	c.buf = append(c.buf, op)
+	c.buf = appendU32(c.buf, index)
+}
+
+func (c *instructions) get(local uint32)  { c.index(opLocalGet, local) }
+func (c *instructions) set(local uint32)  { c.index(opLocalSet, local) }
+func (c *instructions) tee(local uint32)  { c.index(opLocalTee, local) }
+func (c *instructions) br(depth uint32)   { c.index(opBr, depth) }
+func (c *instructions) brIf(depth uint32) { c.index(opBrIf, depth) }
+
+// memory 生成访存指令, offset 是相对于栈顶地址的偏移
+func (c *instructions) memory(op byte, offset uint32) {
+	align := uint32(2)
+	switch op {
+	case opI64Load, opI64Store:
+		align = 3
+	case opI32Load8U, opI32Store8:
+		align = 0
+	}
+	c.buf = append(c.buf, op)
+	c.buf = appendU32(c.buf, align)
+	c.buf = appendU32(c.buf, offset)
+}
+
+func (c *instructions) load(offset uint32)  { c.memory(opI32Load, offset) }
+func (c *instructions) store(offset uint32) { c.memory(opI32Store, offset) }
+
+// block、loop 和 if 都以 end 结束, typ 为 blockVoid 或结果的值类型
+func (c *instructions) block(typ byte) { c.op(opBlock, typ) }
+func (c *instructions) loop()          { c.op(opLoop, blockVoid) }
+func (c *instructions) if_(typ byte)   { c.op(opIf, typ) }
+func (c *instructions) else_()         { c.op(opElse) }
+func (c *instructions) end()           { c.op(opEnd) }
+
+// funcType 是函数签名, 用作类型段的键
+type funcType struct {
+	params, results string
+}
+
+func sig(params []byte, results ...byte) funcType {
+	return funcType{params: string(params), results: string(results)}
+}
+
+// function 是模块中定义的函数, locals 是参数之后的局部变量
+type function struct {
+	name   string
+	typ    funcType
+	locals []byte
+	instructions
+}
+
+// local 增加一个局部变量, 返回它的下标
+func (f *function) local(typ byte) uint32 {
+	f.locals = append(f.locals, typ)
+	return uint32(len(f.typ.params) + len(f.locals) - 1)
+}
+
+type global struct {
+	typ     byte
+	mutable bool
+	init    int64
+}
+
+type imported struct {
+	module, name string
+	typ          funcType
+}
+
+type export struct {
+	name  string
+	kind  byte
+	index uint32
+}
+
+const (
+	exportFunc   byte = 0
+	exportMemory byte = 2
+	exportGlobal byte = 3
+)
+
+// module 是正在构造的模块. 函数的下标从导入的函数之后开始
+type module struct {
+	types     []funcType
+	typeIndex map[funcType]uint32
+
+	imports []imported
+	funcs   []*function
+	table   []uint32 // 表中的函数下标, call_indirect 用表的下标调用
+	globals []global
+	exports []export
+	data    []byte // 放在线性内存地址 0 开始的静态数据
+}
+
+func (m *module) typeOf(t funcType) uint32 {
+	if m.typeIndex == nil {
+		m.typeIndex = map[funcType]uint32{}
+	}
+	index, ok := m.typeIndex[t]
+	if !ok {
+		index = uint32(len(m.types))
+		m.types = append(m.types, t)
+		m.typeIndex[t] = index
+	}
+	return index
+}
+
+func (m *module) encode() []byte {
+	out := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	section := func(id byte, count int, body []byte) {
+		if count == 0 {
+			return
+		}
+		content := appendU32(nil, uint32(count))
+		content = append(content, body...)
+		out = append(out, id)
+		out = appendU32(out, uint32(len(content)))
+		out = append(out, content...)
+	}
+
+	// 先为所有函数登记类型, 类型段必须包含所有用到的签名
+	importTypes := make([]uint32, len(m.imports))
+	for i, imp := range m.imports {
+		importTypes[i] = m.typeOf(imp.typ)
+	}
+	funcTypes := make([]uint32, len(m.funcs))
+	for i, f := range m.funcs {
+		funcTypes[i] = m.typeOf(f.typ)
+	}
+
+	var body []byte
+	for _, t := range m.types {
+		body = append(body, 0x60)
+		body = appendName(body, t.params)
+		body = appendName(body, t.results)
+	}
+	section(sectionType, len(m.types), body)
+
+	body = nil
+	for i, imp := range m.imports {
+		body = appendName(body, imp.module)
+		body = appendName(body, imp.name)
+		body = append(body, exportFunc)
+		body = appendU32(body, importTypes[i])
+	}
+	section(sectionImport, len(m.imports), body)
+
+	body = nil
+	for _, t := range funcTypes {
+		body = appendU32(body, t)
+	}
+	section(sectionFunction, len(m.funcs), body)
+
+	// 表的大小固定为函数个数, 没有上限的 limits 为 0x00
+	body = []byte{funcref, 0x00}
+	body = appendU32(body, uint32(len(m.table)))
+	section(sectionTable, 1, body)
+
+	// 有上限的 limits 为 0x01, 之后是初始页数和最大页数
+	pages := uint32(len(m.data)+0xFFFF) / 0x10000
+	if pages == 0 {
+		pages = 1
+	}
+	section(sectionMemory, 1, appendU32(appendU32([]byte{0x01}, pages), max(pages, MaxMemory/0x10000)))
+
+	body = nil
+	for _, g := range m.globals {
+		body = append(body, g.typ)
+		if g.mutable {
+			body = append(body, 0x01)
+		} else {
+			body = append(body, 0x00)
+		}
+		if g.typ == i64 {
+			body = append(body, opI64Const)
+		} else {
+			body = append(body, opI32Const)
+		}
+		body = appendS64(body, g.init)
+		body = append(body, opEnd)
+	}
+	section(sectionGlobal, len(m.globals), body)
+
+	body = nil
+	for _, e := range m.exports {
+		body = appendName(body, e.name)
+		body = append(body, e.kind)
+		body = appendU32(body, e.index)
+	}
+	section(sectionExport, len(m.exports), body)
+
+	if len(m.table) > 0 {
+		body = []byte{0x00, opI32Const, 0x00, opEnd}
+		body = appendU32(body, uint32(len(m.table)))
+		for _, index := range m.table {
+			body = appendU32(body, index)
+		}
+		section(sectionElement, 1, body)
+	}
+
+	body = nil
+	for _, f := range m.funcs {
+		var fn []byte
+		// 相同类型的局部变量合并为一组
+		var groups [][2]uint32
+		for _, typ := range f.locals {
+			if n := len(groups); n > 0 && groups[n-1][1] == uint32(typ) {
+				groups[n-1][0]++
+				continue
+			}
+			groups = append(groups, [2]uint32{1, uint32(typ)})
+		}
+		fn = appendU32(fn, uint32(len(groups)))
+		for _, g := range groups {
+			fn = appendU32(fn, g[0])
+			fn = append(fn, byte(g[1]))
+		}
+		fn = append(fn, f.buf...)
+		fn = append(fn, opEnd)
+		body = appendU32(body, uint32(len(fn)))
+		body = append(body, fn...)
+	}
+	section(sectionCode, len(m.funcs), body)
+
+	if len(m.data) > 0 {
+		body = []byte{0x00, opI32Const, 0x00, opEnd}
+		body = appendU32(body, uint32(len(m.data)))
+		body = append(body, m.data...)
+		section(sectionData, 1, body)
+	}
+	return out
+}
+
+// static 是模块的静态数据, 对象按 8 字节对齐
+type static struct {
+	bytes.Buffer
+}
+
+func (h *static) align() {
+	for h.Len()%8 != 0 {
+		h.WriteByte(0)
+	}
+}
+
+// object 写入一个对象, 返回它的地址. words 是对象头部的若干 32 位字
+func (h *static) object(words ...uint32) uint32 {
+	h.align()
+	addr := uint32(h.Len())
+	for _, w := range words {
+		binary.Write(h, binary.LittleEndian, w)
+	}
+	return addr
+}
@@ -0,0 +1,91 @@
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Result 是最后一个顶层表达式语句的值
+type Result struct {
+	Inspect string
+	// IsError 表示值是错误对象, 例如内置函数返回的错误, Message 是它的错误信息
+	IsError bool
+	Message string
+}
+
+// Run 用纯 Go 实现的 wazero 运行 Compile 生成的模块, print 的输出写入 stdout.
+// 运行时错误的信息与 vm 相同
+func Run(ctx context.Context, binary []byte, stdout io.Writer) (Result, error) {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	_, err := r.NewHostModuleBuilder("monkey").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, n uint32) {
+			if buf, ok := m.Memory().Read(ptr, n); ok {
+				stdout.Write(buf)
+			}
+		}).
+		Export("write").
+		Instantiate(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	mod, err := r.Instantiate(ctx, binary)
+	if err != nil {
+		return Result{}, err
+	}
+	results, err := mod.ExportedFunction("run").Call(ctx)
+	if err != nil {
+		if addr := uint32(mod.ExportedGlobal("error").Get()); addr != 0 {
+			if msg, ok := readString(mod.Memory(), addr); ok {
+				return Result{}, errors.New(msg)
+			}
+		}
+		// 其他陷阱, 例如整数除以零, 只保留第一行, 去掉 wasm 的调用栈
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		return Result{}, errors.New(msg)
+	}
+
+	var result Result
+	value := uint32(results[0])
+	// 错误对象的布局为 [tag][message]
+	if tag, ok := mod.Memory().ReadUint32Le(value); ok && tag == tagError {
+		msg, _ := mod.Memory().ReadUint32Le(value + 4)
+		if result.Message, ok = readString(mod.Memory(), msg); !ok {
+			return Result{}, fmt.Errorf("wasm: invalid error object at %d", value)
+		}
+		result.IsError = true
+	}
+
+	results, err = mod.ExportedFunction("inspect").Call(ctx, results[0])
+	if err != nil {
+		return Result{}, err
+	}
+	s, ok := readString(mod.Memory(), uint32(results[0]))
+	if !ok {
+		return Result{}, fmt.Errorf("wasm: invalid string object at %d", results[0])
+	}
+	result.Inspect = s
+	return result, nil
+}
+
+func readString(mem api.Memory, addr uint32) (string, bool) {
+	header, ok := mem.Read(addr, 8)
+	if !ok {
+		return "", false
+	}
+	buf, ok := mem.Read(addr+8, binary.LittleEndian.Uint32(header[4:]))
+	return string(buf), ok
+}
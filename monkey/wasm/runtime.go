@@ -0,0 +1,1612 @@
+package wasm
+
+import (
+	"fmt"
+	"go-example/monkey/code"
+)
+
+// 对象保存在线性内存中, 值是对象的地址 (i32). 第一个字是类型标记, 布局如下:
+//
+//	integer   [tag][-][value i64]
+//	boolean   [tag][value]
+//	string    [tag][len][bytes...]
+//	array     [tag][len][elements...]
+//	hash      [tag][len][key, value...]  按插入顺序保存
+//	closure   [tag][table index][params][nfree][free...]
+//	builtin   [tag][id]                   id 为 object.Builtins 中的下标
+//	error     [tag][message]
+//	iterator  [tag][array][pos]
+//
+// null 位于地址 0, 还没有赋值的变量也就是 null. false 和 true 也是静态对象,
+// 比较布尔值只需要比较地址. 对象只分配不回收, 程序结束后整个实例一起释放,
+// 分配的总量超过 MaxMemory 时报告 out of memory 错误.
+const (
+	tagNull uint32 = iota
+	tagInteger
+	tagBoolean
+	tagString
+	tagArray
+	tagHash
+	tagClosure
+	tagBuiltin
+	tagError
+	tagIterator
+)
+
+var typeNames = []string{"null", "integer", "boolean", "string", "array", "hash", "closure", "builtin", "error", "iterator"}
+
+const (
+	addrNull  = 0
+	addrFalse = 8
+	addrTrue  = 16
+	// addrItoa 是 itoa 写入数字的缓冲区, int64 最多 20 个字符
+	addrItoa    = 24
+	addrItoaEnd = addrItoa + 24
+)
+
+// 运行时使用的全局变量, 脚本的全局变量排在它们之后
+const (
+	globalHeap uint32 = iota
+	globalDepth
+	globalError
+	numRuntimeGlobals
+)
+
+// MaxFrames 是调用的最大深度, 与 vm 相同
+const MaxFrames = 1024
+
+// MaxMemory 是线性内存的上限, 模块声明的最大页数与它一致
+const MaxMemory = 256 << 20
+
+// 参数的个数与 compiler.Resolve 给出的槽位一致, 脚本函数的签名都是 (closure, argv, argc) -> value
+var monkeyFunc = sig([]byte{i32, i32, i32}, i32)
+
+type runtimeFunc struct {
+	name    string
+	params  []byte
+	results []byte
+	gen     func(g *generator, f *function)
+}
+
+// builtins 是支持的内置函数, 其余的内置函数依赖 vm 的调度器或还没有实现
+var builtins = map[string]string{
+	"len":     "builtin_len",
+	"push":    "builtin_push",
+	"first":   "builtin_first",
+	"last":    "builtin_last",
+	"rest":    "builtin_rest",
+	"print":   "builtin_print",
+	"iter":    "builtin_iter",
+	"next":    "builtin_next",
+	"collect": "builtin_collect",
+}
+
+var (
+	one   = []byte{i32}
+	two   = []byte{i32, i32}
+	three = []byte{i32, i32, i32}
+)
+
+var runtimeFuncs = []runtimeFunc{
+	{"alloc", one, one, (*generator).rtAlloc},
+	{"copy", three, nil, (*generator).rtCopy},
+	{"fail", one, nil, (*generator).rtFail},
+	{"new_int", []byte{i64}, one, (*generator).rtNewInt},
+	{"new_string", one, one, newObject(tagString, 1)},
+	{"new_array", one, one, newObject(tagArray, 4)},
+	{"new_hash", one, one, (*generator).rtNewHash},
+	{"new_error", one, one, (*generator).rtNewError},
+	{"new_closure", three, one, (*generator).rtNewClosure},
+	{"new_iterator", one, one, (*generator).rtNewIterator},
+	{"boolean", one, one, (*generator).rtBoolean},
+	{"type_name", one, one, (*generator).rtTypeName},
+	{"concat", two, one, (*generator).rtConcat},
+	{"fail_types", two, nil, (*generator).rtFailTypes},
+	{"fail_unusable", one, nil, (*generator).rtFailUnusable},
+	{"itoa", []byte{i64}, one, (*generator).rtItoa},
+	{"inspect", one, one, (*generator).rtInspect},
+	{"template", one, one, (*generator).rtTemplate},
+	{"truthy", one, one, (*generator).rtTruthy},
+	{"bang", one, one, (*generator).rtBang},
+	{"negate", one, one, (*generator).rtNegate},
+	{"add", two, one, arithmetic(code.OpAdd, opI64Add)},
+	{"sub", two, one, arithmetic(code.OpSub, opI64Sub)},
+	{"mul", two, one, arithmetic(code.OpMul, opI64Mul)},
+	{"div", two, one, arithmetic(code.OpDiv, opI64DivS)},
+	{"equal", two, one, (*generator).rtEqual},
+	{"compare_strings", two, one, (*generator).rtCompareStrings},
+	{"greater", two, one, (*generator).rtGreater},
+	{"hashable", one, one, (*generator).rtHashable},
+	{"hash_find", two, one, (*generator).rtHashFind},
+	{"hash_set", three, nil, (*generator).rtHashSet},
+	{"build_hash", one, one, (*generator).rtBuildHash},
+	{"index", two, one, (*generator).rtIndex},
+	{"call", three, one, (*generator).rtCall},
+	{"runes", one, one, (*generator).rtRunes},
+	{"keys", one, one, (*generator).rtKeys},
+	{"iterable", one, one, (*generator).rtIterable},
+	{"iterate", one, one, (*generator).rtIterate},
+	{"iter_next", one, one, (*generator).rtIterNext},
+	{"wrong_args", two, one, (*generator).rtWrongArgs},
+	{"builtin", three, one, (*generator).rtBuiltin},
+	{"builtin_len", two, one, (*generator).rtLen},
+	{"builtin_push", two, one, (*generator).rtPush},
+	{"builtin_first", two, one, arrayElement("first", false)},
+	{"builtin_last", two, one, arrayElement("last", true)},
+	{"builtin_rest", two, one, (*generator).rtRest},
+	{"builtin_print", two, one, (*generator).rtPrint},
+	{"builtin_iter", two, one, (*generator).rtIter},
+	{"builtin_next", two, one, (*generator).rtNext},
+	{"builtin_collect", two, one, (*generator).rtCollect},
+}
+
+func (g *generator) call(f *function, name string) {
+	index, ok := g.funcIndex[name]
+	if !ok {
+		panic("wasm: unknown runtime function " + name)
+	}
+	f.index(opCall, index)
+}
+
+// trap 报告栈顶的错误信息, 之后的代码不可达
+func (g *generator) trap(f *function) {
+	g.call(f, "fail")
+	f.op(opUnreachable)
+}
+
+// trapWith 报告 msg 加上局部变量 v 的类型名
+func (g *generator) trapWith(f *function, msg string, v uint32) {
+	g.pushString(f, msg)
+	f.get(v)
+	g.call(f, "type_name")
+	g.call(f, "concat")
+	g.trap(f)
+}
+
+func (g *generator) pushString(f *function, s string) {
+	f.i32(int32(g.constString(s)))
+}
+
+func (f *function) tag(v uint32) {
+	f.get(v)
+	f.load(0)
+}
+
+// isTag 比较局部变量 v 的类型标记
+func (f *function) isTag(v uint32, tag uint32) {
+	f.tag(v)
+	f.i32(int32(tag))
+	f.op(opI32Eq)
+}
+
+// element 计算数组 arr 中下标为局部变量 i 的元素地址, size 为每个元素的字节数
+func (f *function) element(arr, i uint32, size int32) {
+	f.get(arr)
+	f.get(i)
+	f.i32(size)
+	f.op(opI32Mul, opI32Add)
+}
+
+// forRange 生成 for i := 0; i < n; i++ { body }, body 中的跳转深度要加 2
+func (f *function) forRange(i, n uint32, body func()) {
+	f.i32(0)
+	f.set(i)
+	f.block(blockVoid)
+	f.loop()
+	f.get(i)
+	f.get(n)
+	f.op(opI32GeS)
+	f.brIf(1)
+	body()
+	f.get(i)
+	f.i32(1)
+	f.op(opI32Add)
+	f.set(i)
+	f.br(0)
+	f.end()
+	f.end()
+}
+
+func (g *generator) rtAlloc(f *function) {
+	const size = 0
+	p := f.local(i32)
+	// 先按无符号数检查 size <= MaxMemory - heap, 之后的加法不会溢出
+	f.get(size)
+	f.i32(MaxMemory)
+	f.index(opGlobalGet, globalHeap)
+	f.op(opI32Sub, opI32GtU)
+	f.if_(blockVoid)
+	g.pushString(f, "out of memory")
+	g.trap(f)
+	f.end()
+
+	f.index(opGlobalGet, globalHeap)
+	f.tee(p)
+	f.get(size)
+	f.i32(7)
+	f.op(opI32Add)
+	f.i32(-8)
+	f.op(opI32And, opI32Add)
+	f.index(opGlobalSet, globalHeap)
+
+	// 内存不够时按缺少的页数增长
+	f.index(opGlobalGet, globalHeap)
+	f.op(opMemorySize, 0)
+	f.i32(16)
+	f.op(opI32Shl, opI32GtU)
+	f.if_(blockVoid)
+	f.index(opGlobalGet, globalHeap)
+	f.op(opMemorySize, 0)
+	f.i32(16)
+	f.op(opI32Shl, opI32Sub)
+	f.i32(16)
+	f.op(opI32ShrU)
+	f.i32(1)
+	f.op(opI32Add, opMemoryGrow, 0)
+	f.i32(-1)
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	g.pushString(f, "out of memory")
+	g.trap(f)
+	f.end()
+	f.end()
+	f.get(p)
+}
+
+// copy(dst, src, n) 复制 n 个字节, 先按 8 字节复制, 剩下的逐个字节复制
+func (g *generator) rtCopy(f *function) {
+	const dst, src, n = 0, 1, 2
+	for _, step := range []struct {
+		size        int32
+		load, store byte
+	}{{8, opI64Load, opI64Store}, {1, opI32Load8U, opI32Store8}} {
+		f.block(blockVoid)
+		f.loop()
+		f.get(n)
+		f.i32(step.size)
+		f.op(opI32LtU)
+		f.brIf(1)
+		f.get(dst)
+		f.get(src)
+		f.memory(step.load, 0)
+		f.memory(step.store, 0)
+		for _, v := range []uint32{dst, src} {
+			f.get(v)
+			f.i32(step.size)
+			f.op(opI32Add)
+			f.set(v)
+		}
+		f.get(n)
+		f.i32(step.size)
+		f.op(opI32Sub)
+		f.set(n)
+		f.br(0)
+		f.end()
+		f.end()
+	}
+}
+
+func (g *generator) rtFail(f *function) {
+	f.get(0)
+	f.index(opGlobalSet, globalError)
+	f.op(opUnreachable)
+}
+
+func (g *generator) rtNewInt(f *function) {
+	p := f.local(i32)
+	f.i32(16)
+	g.call(f, "alloc")
+	f.tee(p)
+	f.i32(int32(tagInteger))
+	f.store(0)
+	f.get(p)
+	f.get(0)
+	f.memory(opI64Store, 8)
+	f.get(p)
+}
+
+// newObject 生成 new_string 和 new_array, 参数是长度, size 为每个元素的字节数
+func newObject(tag uint32, size int32) func(g *generator, f *function) {
+	return func(g *generator, f *function) {
+		p := f.local(i32)
+		f.get(0)
+		f.i32(size)
+		f.op(opI32Mul)
+		f.i32(8)
+		f.op(opI32Add)
+		g.call(f, "alloc")
+		f.tee(p)
+		f.i32(int32(tag))
+		f.store(0)
+		f.get(p)
+		f.get(0)
+		f.store(4)
+		f.get(p)
+	}
+}
+
+// new_hash 的参数是容量, 新的哈希为空
+func (g *generator) rtNewHash(f *function) {
+	p := f.local(i32)
+	f.get(0)
+	f.i32(8)
+	f.op(opI32Mul)
+	f.i32(8)
+	f.op(opI32Add)
+	g.call(f, "alloc")
+	f.tee(p)
+	f.i32(int32(tagHash))
+	f.store(0)
+	f.get(p)
+}
+
+func (g *generator) rtNewError(f *function) {
+	p := f.local(i32)
+	f.i32(8)
+	g.call(f, "alloc")
+	f.tee(p)
+	f.i32(int32(tagError))
+	f.store(0)
+	f.get(p)
+	f.get(0)
+	f.store(4)
+	f.get(p)
+}
+
+// new_closure(table index, params, nfree), 自由变量由调用方写入
+func (g *generator) rtNewClosure(f *function) {
+	p := f.local(i32)
+	f.get(2)
+	f.i32(4)
+	f.op(opI32Mul)
+	f.i32(16)
+	f.op(opI32Add)
+	g.call(f, "alloc")
+	f.tee(p)
+	f.i32(int32(tagClosure))
+	f.store(0)
+	for i := uint32(0); i < 3; i++ {
+		f.get(p)
+		f.get(i)
+		f.store(4 + 4*i)
+	}
+	f.get(p)
+}
+
+func (g *generator) rtNewIterator(f *function) {
+	p := f.local(i32)
+	f.i32(16)
+	g.call(f, "alloc")
+	f.tee(p)
+	f.i32(int32(tagIterator))
+	f.store(0)
+	f.get(p)
+	f.get(0)
+	f.store(4)
+	f.get(p)
+}
+
+func (g *generator) rtBoolean(f *function) {
+	f.i32(addrTrue)
+	f.i32(addrFalse)
+	f.get(0)
+	f.op(opSelect)
+}
+
+func (g *generator) rtTypeName(f *function) {
+	f.get(0)
+	f.load(0)
+	f.i32(4)
+	f.op(opI32Mul)
+	f.load(g.typeNames)
+}
+
+func (g *generator) rtConcat(f *function) {
+	const a, b = 0, 1
+	s, n := f.local(i32), f.local(i32)
+	f.get(a)
+	f.load(4)
+	f.tee(n)
+	f.get(b)
+	f.load(4)
+	f.op(opI32Add)
+	g.call(f, "new_string")
+	f.set(s)
+
+	f.get(s)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(a)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(n)
+	g.call(f, "copy")
+
+	f.get(s)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(n)
+	f.op(opI32Add)
+	f.get(b)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(b)
+	f.load(4)
+	g.call(f, "copy")
+	f.get(s)
+}
+
+func (g *generator) rtFailTypes(f *function) {
+	g.pushString(f, "unsupported types for binary operation: ")
+	f.get(0)
+	g.call(f, "type_name")
+	g.call(f, "concat")
+	g.pushString(f, " ")
+	g.call(f, "concat")
+	f.get(1)
+	g.call(f, "type_name")
+	g.call(f, "concat")
+	g.trap(f)
+}
+
+func (g *generator) rtFailUnusable(f *function) {
+	g.trapWith(f, "unusable as hash key: ", 0)
+}
+
+// itoa 从缓冲区末尾向前写入十进制数字, 负数取绝对值时按无符号数处理最小的 int64
+func (g *generator) rtItoa(f *function) {
+	const v = 0
+	u, neg, pos, s := f.local(i64), f.local(i32), f.local(i32), f.local(i32)
+	f.i32(addrItoaEnd)
+	f.set(pos)
+	f.get(v)
+	f.i64(0)
+	f.op(opI64LtS)
+	f.set(neg)
+	f.i64(0)
+	f.get(v)
+	f.op(opI64Sub)
+	f.get(v)
+	f.get(neg)
+	f.op(opSelect)
+	f.set(u)
+
+	f.loop()
+	f.get(pos)
+	f.i32(1)
+	f.op(opI32Sub)
+	f.tee(pos)
+	f.get(u)
+	f.i64(10)
+	f.op(opI64RemU, opI32WrapI64)
+	f.i32('0')
+	f.op(opI32Add)
+	f.memory(opI32Store8, 0)
+	f.get(u)
+	f.i64(10)
+	f.op(opI64DivU)
+	f.tee(u)
+	f.op(opI64Eqz, opI32Eqz)
+	f.brIf(0)
+	f.end()
+
+	f.get(neg)
+	f.if_(blockVoid)
+	f.get(pos)
+	f.i32(1)
+	f.op(opI32Sub)
+	f.tee(pos)
+	f.i32('-')
+	f.memory(opI32Store8, 0)
+	f.end()
+
+	f.i32(addrItoaEnd)
+	f.get(pos)
+	f.op(opI32Sub)
+	g.call(f, "new_string")
+	f.tee(s)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(pos)
+	f.i32(addrItoaEnd)
+	f.get(pos)
+	f.op(opI32Sub)
+	g.call(f, "copy")
+	f.get(s)
+}
+
+// inspect 与 object.Object 的 Inspect 相同, 闭包和迭代器用地址代替 Go 的指针
+func (g *generator) rtInspect(f *function) {
+	const v = 0
+	t, i, n, s := f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	f.tag(v)
+	f.set(t)
+	is := func(tag uint32) {
+		f.get(t)
+		f.i32(int32(tag))
+		f.op(opI32Eq)
+		f.if_(blockVoid)
+	}
+	ret := func() {
+		f.op(opReturn)
+		f.end()
+	}
+	// addressed 生成 "prefix[地址]"
+	addressed := func(prefix string) {
+		g.pushString(f, prefix+"[")
+		f.get(v)
+		f.op(opI64ExtendI32U)
+		g.call(f, "itoa")
+		g.call(f, "concat")
+		g.pushString(f, "]")
+		g.call(f, "concat")
+	}
+	// join 依次拼接 count 个元素, 元素之间用 ", " 分隔
+	join := func(open, close string, count func(), each func()) {
+		g.pushString(f, open)
+		f.set(s)
+		count()
+		f.set(n)
+		f.forRange(i, n, func() {
+			f.get(i)
+			f.if_(blockVoid)
+			f.get(s)
+			g.pushString(f, ", ")
+			g.call(f, "concat")
+			f.set(s)
+			f.end()
+			each()
+		})
+		f.get(s)
+		g.pushString(f, close)
+		g.call(f, "concat")
+	}
+	appendInspect := func(addr func()) {
+		f.get(s)
+		addr()
+		f.load(0)
+		g.call(f, "inspect")
+		g.call(f, "concat")
+		f.set(s)
+	}
+
+	is(tagNull)
+	g.pushString(f, "null")
+	ret()
+	is(tagInteger)
+	f.get(v)
+	f.memory(opI64Load, 8)
+	g.call(f, "itoa")
+	ret()
+	is(tagBoolean)
+	g.pushString(f, "true")
+	g.pushString(f, "false")
+	f.get(v)
+	f.load(4)
+	f.op(opSelect)
+	ret()
+	is(tagString)
+	f.get(v)
+	ret()
+	is(tagArray)
+	join("[", "]", func() { f.get(v); f.load(4) }, func() {
+		appendInspect(func() {
+			f.element(v, i, 4)
+			f.i32(8)
+			f.op(opI32Add)
+		})
+	})
+	ret()
+	is(tagHash)
+	join("{", "}", func() { f.get(v); f.load(4) }, func() {
+		appendInspect(func() {
+			f.element(v, i, 8)
+			f.i32(8)
+			f.op(opI32Add)
+		})
+		f.get(s)
+		g.pushString(f, ": ")
+		g.call(f, "concat")
+		f.set(s)
+		appendInspect(func() {
+			f.element(v, i, 8)
+			f.i32(12)
+			f.op(opI32Add)
+		})
+	})
+	ret()
+	is(tagClosure)
+	addressed("Closure")
+	ret()
+	is(tagBuiltin)
+	g.pushString(f, "builtin function")
+	ret()
+	is(tagError)
+	g.pushString(f, "Message: ")
+	f.get(v)
+	f.load(4)
+	g.call(f, "concat")
+	ret()
+	addressed("Iterator")
+}
+
+// template 拼接数组中每个值的 inspect
+func (g *generator) rtTemplate(f *function) {
+	const parts = 0
+	i, n, s := f.local(i32), f.local(i32), f.local(i32)
+	g.pushString(f, "")
+	f.set(s)
+	f.get(parts)
+	f.load(4)
+	f.set(n)
+	f.forRange(i, n, func() {
+		f.get(s)
+		f.element(parts, i, 4)
+		f.load(8)
+		g.call(f, "inspect")
+		g.call(f, "concat")
+		f.set(s)
+	})
+	f.get(s)
+}
+
+// truthy 与 object.IsTruthy 相同, 只有 false 和 null 为假
+func (g *generator) rtTruthy(f *function) {
+	f.get(0)
+	f.i32(addrFalse)
+	f.op(opI32Ne)
+	f.get(0)
+	f.i32(addrNull)
+	f.op(opI32Ne)
+	f.op(opI32And)
+}
+
+func (g *generator) rtBang(f *function) {
+	f.get(0)
+	g.call(f, "truthy")
+	f.op(opI32Eqz)
+	g.call(f, "boolean")
+}
+
+func (g *generator) rtNegate(f *function) {
+	f.isTag(0, tagInteger)
+	f.if_(blockVoid)
+	f.i64(0)
+	f.get(0)
+	f.memory(opI64Load, 8)
+	f.op(opI64Sub)
+	g.call(f, "new_int")
+	f.op(opReturn)
+	f.end()
+	g.trapWith(f, "unsupport type for negation: ", 0)
+}
+
+// arithmetic 生成 add、sub、mul 和 div, 错误信息与 vm 的 binaryOperation 相同.
+// 与 vm 一样, 整数除以零是运行时错误, 在这里表现为 wasm 的陷阱
+func arithmetic(opcode code.Opcode, op byte) func(g *generator, f *function) {
+	return func(g *generator, f *function) {
+		const a, b = 0, 1
+		f.isTag(a, tagInteger)
+		f.isTag(b, tagInteger)
+		f.op(opI32And)
+		f.if_(blockVoid)
+		f.get(a)
+		f.memory(opI64Load, 8)
+		f.get(b)
+		f.memory(opI64Load, 8)
+		f.op(op)
+		g.call(f, "new_int")
+		f.op(opReturn)
+		f.end()
+		f.isTag(a, tagString)
+		f.isTag(b, tagString)
+		f.op(opI32And)
+		f.if_(blockVoid)
+		if opcode == code.OpAdd {
+			f.get(a)
+			f.get(b)
+			g.call(f, "concat")
+			f.op(opReturn)
+		} else {
+			g.pushString(f, fmt.Sprintf("unknown string operator: %d", opcode))
+			g.trap(f)
+		}
+		f.end()
+		f.get(a)
+		f.get(b)
+		g.call(f, "fail_types")
+		f.op(opUnreachable)
+	}
+}
+
+// equal 与 object.Equal 相同, 返回 0 或 1
+func (g *generator) rtEqual(f *function) {
+	const a, b = 0, 1
+	t, i, n, j := f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	returnIf := func(result int32) {
+		f.if_(blockVoid)
+		f.i32(result)
+		f.op(opReturn)
+		f.end()
+	}
+	f.get(a)
+	f.get(b)
+	f.op(opI32Eq)
+	returnIf(1)
+	f.tag(a)
+	f.tee(t)
+	f.tag(b)
+	f.op(opI32Ne)
+	returnIf(0)
+
+	f.get(t)
+	f.i32(int32(tagInteger))
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	f.get(a)
+	f.memory(opI64Load, 8)
+	f.get(b)
+	f.memory(opI64Load, 8)
+	f.op(opI64Eq, opReturn)
+	f.end()
+
+	// 字符串、数组和哈希先比较长度
+	f.get(t)
+	f.i32(int32(tagString))
+	f.op(opI32GeU)
+	f.get(t)
+	f.i32(int32(tagHash))
+	f.op(opI32LeU, opI32And)
+	f.if_(blockVoid)
+	f.get(a)
+	f.load(4)
+	f.tee(n)
+	f.get(b)
+	f.load(4)
+	f.op(opI32Ne)
+	returnIf(0)
+	f.end()
+
+	f.get(t)
+	f.i32(int32(tagString))
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	f.forRange(i, n, func() {
+		f.get(a)
+		f.get(i)
+		f.op(opI32Add)
+		f.memory(opI32Load8U, 8)
+		f.get(b)
+		f.get(i)
+		f.op(opI32Add)
+		f.memory(opI32Load8U, 8)
+		f.op(opI32Ne)
+		returnIf(0)
+	})
+	f.i32(1)
+	f.op(opReturn)
+	f.end()
+
+	f.get(t)
+	f.i32(int32(tagArray))
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	f.forRange(i, n, func() {
+		f.element(a, i, 4)
+		f.load(8)
+		f.element(b, i, 4)
+		f.load(8)
+		g.call(f, "equal")
+		f.op(opI32Eqz)
+		returnIf(0)
+	})
+	f.i32(1)
+	f.op(opReturn)
+	f.end()
+
+	// 哈希与插入顺序无关, 逐个在 b 中查找 a 的键
+	f.get(t)
+	f.i32(int32(tagHash))
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	f.forRange(i, n, func() {
+		f.get(b)
+		f.element(a, i, 8)
+		f.load(8)
+		g.call(f, "hash_find")
+		f.tee(j)
+		f.i32(0)
+		f.op(opI32LtS)
+		returnIf(0)
+		f.element(a, i, 8)
+		f.load(12)
+		f.element(b, j, 8)
+		f.load(12)
+		g.call(f, "equal")
+		f.op(opI32Eqz)
+		returnIf(0)
+	})
+	f.i32(1)
+	f.op(opReturn)
+	f.end()
+	f.i32(0)
+}
+
+// compare_strings 按字节比较, 返回 -1、0 或 1
+func (g *generator) rtCompareStrings(f *function) {
+	const a, b = 0, 1
+	i, n, x, y := f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	f.get(a)
+	f.load(4)
+	f.get(b)
+	f.load(4)
+	f.get(a)
+	f.load(4)
+	f.get(b)
+	f.load(4)
+	f.op(opI32LtU, opSelect)
+	f.set(n)
+	f.forRange(i, n, func() {
+		f.get(a)
+		f.get(i)
+		f.op(opI32Add)
+		f.memory(opI32Load8U, 8)
+		f.tee(x)
+		f.get(b)
+		f.get(i)
+		f.op(opI32Add)
+		f.memory(opI32Load8U, 8)
+		f.tee(y)
+		f.op(opI32Ne)
+		f.if_(blockVoid)
+		f.i32(1)
+		f.i32(-1)
+		f.get(x)
+		f.get(y)
+		f.op(opI32GtU, opSelect, opReturn)
+		f.end()
+	})
+	f.get(a)
+	f.load(4)
+	f.get(b)
+	f.load(4)
+	f.op(opI32GtU)
+	f.get(a)
+	f.load(4)
+	f.get(b)
+	f.load(4)
+	f.op(opI32LtU, opI32Sub)
+}
+
+// greater 与 object.Compare 相同, 只比较整数和字符串
+func (g *generator) rtGreater(f *function) {
+	const a, b = 0, 1
+	f.isTag(a, tagInteger)
+	f.isTag(b, tagInteger)
+	f.op(opI32And)
+	f.if_(blockVoid)
+	f.get(a)
+	f.memory(opI64Load, 8)
+	f.get(b)
+	f.memory(opI64Load, 8)
+	f.op(opI64GtS)
+	g.call(f, "boolean")
+	f.op(opReturn)
+	f.end()
+	f.isTag(a, tagString)
+	f.isTag(b, tagString)
+	f.op(opI32And)
+	f.if_(blockVoid)
+	f.get(a)
+	f.get(b)
+	g.call(f, "compare_strings")
+	f.i32(0)
+	f.op(opI32GtS)
+	g.call(f, "boolean")
+	f.op(opReturn)
+	f.end()
+	f.get(a)
+	f.get(b)
+	g.call(f, "fail_types")
+	f.op(opUnreachable)
+}
+
+// hashable 与 object.HashKeyOf 相同: 整数、布尔值和字符串可以作为键,
+// 数组的元素和哈希的值都可以作为键时, 数组和哈希也可以作为键
+func (g *generator) rtHashable(f *function) {
+	const v = 0
+	t, i, n := f.local(i32), f.local(i32), f.local(i32)
+	f.tag(v)
+	f.tee(t)
+	f.i32(int32(tagInteger))
+	f.op(opI32Sub)
+	f.i32(3)
+	f.op(opI32LtU)
+	f.if_(blockVoid)
+	f.i32(1)
+	f.op(opReturn)
+	f.end()
+	for _, tt := range []struct {
+		tag    uint32
+		size   int32
+		offset uint32
+	}{{tagArray, 4, 8}, {tagHash, 8, 12}} {
+		f.get(t)
+		f.i32(int32(tt.tag))
+		f.op(opI32Eq)
+		f.if_(blockVoid)
+		f.get(v)
+		f.load(4)
+		f.set(n)
+		f.forRange(i, n, func() {
+			f.element(v, i, tt.size)
+			f.load(tt.offset)
+			g.call(f, "hashable")
+			f.op(opI32Eqz)
+			f.if_(blockVoid)
+			f.i32(0)
+			f.op(opReturn)
+			f.end()
+		})
+		f.i32(1)
+		f.op(opReturn)
+		f.end()
+	}
+	f.i32(0)
+}
+
+// hash_find 返回键在哈希中的下标, 没有找到时返回 -1
+func (g *generator) rtHashFind(f *function) {
+	const h, key = 0, 1
+	i, n := f.local(i32), f.local(i32)
+	f.get(h)
+	f.load(4)
+	f.set(n)
+	f.forRange(i, n, func() {
+		f.element(h, i, 8)
+		f.load(8)
+		f.get(key)
+		g.call(f, "equal")
+		f.if_(blockVoid)
+		f.get(i)
+		f.op(opReturn)
+		f.end()
+	})
+	f.i32(-1)
+}
+
+// hash_set 与 object.Hash.Set 相同, 已有的键保持原来的位置, 只替换值.
+// 哈希必须还有空位, 只在构造哈希字面量时使用
+func (g *generator) rtHashSet(f *function) {
+	const h, key, value = 0, 1, 2
+	i := f.local(i32)
+	f.get(key)
+	g.call(f, "hashable")
+	f.op(opI32Eqz)
+	f.if_(blockVoid)
+	f.get(key)
+	g.call(f, "fail_unusable")
+	f.end()
+	f.get(h)
+	f.get(key)
+	g.call(f, "hash_find")
+	f.tee(i)
+	f.i32(0)
+	f.op(opI32LtS)
+	f.if_(blockVoid)
+	f.get(h)
+	f.load(4)
+	f.set(i)
+	f.element(h, i, 8)
+	f.get(key)
+	f.store(8)
+	f.get(h)
+	f.get(i)
+	f.i32(1)
+	f.op(opI32Add)
+	f.store(4)
+	f.end()
+	f.element(h, i, 8)
+	f.get(value)
+	f.store(12)
+}
+
+// build_hash 用数组中依次排列的键和值构造哈希
+func (g *generator) rtBuildHash(f *function) {
+	const elems = 0
+	h, i, n := f.local(i32), f.local(i32), f.local(i32)
+	f.get(elems)
+	f.load(4)
+	f.i32(1)
+	f.op(opI32ShrU)
+	f.tee(n)
+	g.call(f, "new_hash")
+	f.set(h)
+	f.forRange(i, n, func() {
+		f.get(h)
+		f.element(elems, i, 8)
+		f.load(8)
+		f.element(elems, i, 8)
+		f.load(12)
+		g.call(f, "hash_set")
+	})
+	f.get(h)
+}
+
+func (g *generator) rtIndex(f *function) {
+	const left, index = 0, 1
+	i := f.local(i32)
+	f.isTag(left, tagArray)
+	f.isTag(index, tagInteger)
+	f.op(opI32And)
+	f.if_(blockVoid)
+	f.get(index)
+	f.memory(opI64Load, 8)
+	f.i64(0)
+	f.op(opI64LtS)
+	f.get(index)
+	f.memory(opI64Load, 8)
+	f.get(left)
+	f.load(4)
+	f.op(opI64ExtendI32U, opI64GeS, opI32Or)
+	f.if_(blockVoid)
+	f.i32(addrNull)
+	f.op(opReturn)
+	f.end()
+	f.get(index)
+	f.memory(opI64Load, 8)
+	f.op(opI32WrapI64)
+	f.set(i)
+	f.element(left, i, 4)
+	f.load(8)
+	f.op(opReturn)
+	f.end()
+
+	f.isTag(left, tagHash)
+	f.if_(blockVoid)
+	f.get(index)
+	g.call(f, "hashable")
+	f.op(opI32Eqz)
+	f.if_(blockVoid)
+	f.get(index)
+	g.call(f, "fail_unusable")
+	f.end()
+	f.get(left)
+	f.get(index)
+	g.call(f, "hash_find")
+	f.tee(i)
+	f.i32(0)
+	f.op(opI32LtS)
+	f.if_(blockVoid)
+	f.i32(addrNull)
+	f.op(opReturn)
+	f.end()
+	f.element(left, i, 8)
+	f.load(12)
+	f.op(opReturn)
+	f.end()
+	g.trapWith(f, "index operator not supported: ", left)
+}
+
+// call 调用闭包或内置函数, argv 指向 argc 个参数
+func (g *generator) rtCall(f *function) {
+	const callee, argv, argc = 0, 1, 2
+	result := f.local(i32)
+	f.isTag(callee, tagClosure)
+	f.if_(blockVoid)
+	f.get(callee)
+	f.load(8)
+	f.get(argc)
+	f.op(opI32Ne)
+	f.if_(blockVoid)
+	g.pushString(f, "wrong number of arguments: want=")
+	f.get(callee)
+	f.load(8)
+	f.op(opI64ExtendI32U)
+	g.call(f, "itoa")
+	g.call(f, "concat")
+	g.pushString(f, ", got=")
+	g.call(f, "concat")
+	f.get(argc)
+	f.op(opI64ExtendI32U)
+	g.call(f, "itoa")
+	g.call(f, "concat")
+	g.trap(f)
+	f.end()
+
+	f.index(opGlobalGet, globalDepth)
+	f.i32(1)
+	f.op(opI32Add)
+	f.index(opGlobalSet, globalDepth)
+	f.index(opGlobalGet, globalDepth)
+	f.i32(MaxFrames)
+	f.op(opI32GtS)
+	f.if_(blockVoid)
+	g.pushString(f, "stack overflow")
+	g.trap(f)
+	f.end()
+	f.get(callee)
+	f.get(argv)
+	f.get(argc)
+	f.get(callee)
+	f.load(4)
+	f.index(opCallIndirect, g.m.typeOf(monkeyFunc))
+	f.op(0x00) // 表的下标
+	f.set(result)
+	f.index(opGlobalGet, globalDepth)
+	f.i32(1)
+	f.op(opI32Sub)
+	f.index(opGlobalSet, globalDepth)
+	f.get(result)
+	f.op(opReturn)
+	f.end()
+
+	f.isTag(callee, tagBuiltin)
+	f.if_(blockVoid)
+	f.get(callee)
+	f.load(4)
+	f.get(argv)
+	f.get(argc)
+	g.call(f, "builtin")
+	f.op(opReturn)
+	f.end()
+	g.pushString(f, "calling non-function")
+	g.trap(f)
+}
+
+// runes 与 for ... in 相同, 把字符串按 UTF-8 字符拆分为数组
+func (g *generator) rtRunes(f *function) {
+	const s = 0
+	i, n, count, arr, start, k, piece := f.local(i32), f.local(i32), f.local(i32), f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	// continuation 判断第 i 个字节是否是后续字节 10xxxxxx
+	continuation := func() {
+		f.get(s)
+		f.get(i)
+		f.op(opI32Add)
+		f.memory(opI32Load8U, 8)
+		f.i32(0xC0)
+		f.op(opI32And)
+		f.i32(0x80)
+		f.op(opI32Eq)
+	}
+	f.get(s)
+	f.load(4)
+	f.set(n)
+	f.forRange(i, n, func() {
+		continuation()
+		f.op(opI32Eqz)
+		f.get(count)
+		f.op(opI32Add)
+		f.set(count)
+	})
+	f.get(count)
+	g.call(f, "new_array")
+	f.set(arr)
+
+	f.i32(0)
+	f.set(i)
+	f.block(blockVoid)
+	f.loop()
+	f.get(i)
+	f.get(n)
+	f.op(opI32GeS)
+	f.brIf(1)
+	f.get(i)
+	f.tee(start)
+	f.i32(1)
+	f.op(opI32Add)
+	f.set(i)
+	f.block(blockVoid)
+	f.loop()
+	f.get(i)
+	f.get(n)
+	f.op(opI32GeS)
+	f.brIf(1)
+	continuation()
+	f.op(opI32Eqz)
+	f.brIf(1)
+	f.get(i)
+	f.i32(1)
+	f.op(opI32Add)
+	f.set(i)
+	f.br(0)
+	f.end()
+	f.end()
+
+	f.get(i)
+	f.get(start)
+	f.op(opI32Sub)
+	g.call(f, "new_string")
+	f.tee(piece)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(s)
+	f.get(start)
+	f.op(opI32Add)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(i)
+	f.get(start)
+	f.op(opI32Sub)
+	g.call(f, "copy")
+	f.element(arr, k, 4)
+	f.get(piece)
+	f.store(8)
+	f.get(k)
+	f.i32(1)
+	f.op(opI32Add)
+	f.set(k)
+	f.br(0)
+	f.end()
+	f.end()
+	f.get(arr)
+}
+
+func (g *generator) rtKeys(f *function) {
+	const h = 0
+	i, n, arr := f.local(i32), f.local(i32), f.local(i32)
+	f.get(h)
+	f.load(4)
+	f.tee(n)
+	g.call(f, "new_array")
+	f.set(arr)
+	f.forRange(i, n, func() {
+		f.element(arr, i, 4)
+		f.element(h, i, 8)
+		f.load(8)
+		f.store(8)
+	})
+	f.get(arr)
+}
+
+// iterable 与 object.Iterate 相同, 返回要遍历的值组成的数组, 不能遍历时返回 -1
+func (g *generator) rtIterable(f *function) {
+	const v = 0
+	for _, tt := range []struct {
+		tag uint32
+		fn  string
+	}{{tagArray, ""}, {tagString, "runes"}, {tagHash, "keys"}} {
+		f.isTag(v, tt.tag)
+		f.if_(blockVoid)
+		f.get(v)
+		if tt.fn != "" {
+			g.call(f, tt.fn)
+		}
+		f.op(opReturn)
+		f.end()
+	}
+	f.i32(-1)
+}
+
+// iterate 用于 for ... in, 迭代器原样返回
+func (g *generator) rtIterate(f *function) {
+	const v = 0
+	arr := f.local(i32)
+	f.isTag(v, tagIterator)
+	f.if_(blockVoid)
+	f.get(v)
+	f.op(opReturn)
+	f.end()
+	f.get(v)
+	g.call(f, "iterable")
+	f.tee(arr)
+	f.i32(-1)
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	g.trapWith(f, "cannot iterate over ", v)
+	f.end()
+	f.get(arr)
+	g.call(f, "new_iterator")
+}
+
+// iter_next 返回迭代器的下一个值, 没有更多值时返回 -1
+func (g *generator) rtIterNext(f *function) {
+	const it = 0
+	arr, pos := f.local(i32), f.local(i32)
+	f.get(it)
+	f.load(4)
+	f.set(arr)
+	f.get(it)
+	f.load(8)
+	f.tee(pos)
+	f.get(arr)
+	f.load(4)
+	f.op(opI32GeS)
+	f.if_(blockVoid)
+	f.i32(-1)
+	f.op(opReturn)
+	f.end()
+	f.get(it)
+	f.get(pos)
+	f.i32(1)
+	f.op(opI32Add)
+	f.store(8)
+	f.element(arr, pos, 4)
+	f.load(8)
+}
+
+// wrong_args(argc, want) 返回内置函数参数个数错误的 error 对象
+func (g *generator) rtWrongArgs(f *function) {
+	g.pushString(f, "wrong number of arguments. got=")
+	f.get(0)
+	f.op(opI64ExtendI32U)
+	g.call(f, "itoa")
+	g.call(f, "concat")
+	g.pushString(f, ", want=")
+	g.call(f, "concat")
+	f.get(1)
+	g.call(f, "concat")
+	g.call(f, "new_error")
+}
+
+// builtin(id, argv, argc) 按 id 调用内置函数
+func (g *generator) rtBuiltin(f *function) {
+	const id, argv, argc = 0, 1, 2
+	for _, name := range g.builtinOrder {
+		f.get(id)
+		f.i32(int32(g.builtinIDs[name]))
+		f.op(opI32Eq)
+		f.if_(blockVoid)
+		f.get(argv)
+		f.get(argc)
+		g.call(f, builtins[name])
+		f.op(opReturn)
+		f.end()
+	}
+	f.op(opUnreachable)
+}
+
+// checkArgs 在参数个数不是 want 时返回 error 对象
+func (g *generator) checkArgs(f *function, want int) {
+	const argc = 1
+	f.get(argc)
+	f.i32(int32(want))
+	f.op(opI32Ne)
+	f.if_(blockVoid)
+	f.get(argc)
+	g.pushString(f, string(rune('0'+want)))
+	g.call(f, "wrong_args")
+	f.op(opReturn)
+	f.end()
+}
+
+// returnError 返回 msg 加上局部变量 v 的类型名组成的 error 对象
+func (g *generator) returnError(f *function, msg string, v uint32) {
+	g.pushString(f, msg)
+	f.get(v)
+	g.call(f, "type_name")
+	g.call(f, "concat")
+	g.call(f, "new_error")
+	f.op(opReturn)
+}
+
+// checkArray 在第一个参数不是数组时返回 error 对象, 然后把数组保存在 arr 中
+func (g *generator) checkArray(f *function, name string, arr uint32) {
+	const argv = 0
+	f.get(argv)
+	f.load(0)
+	f.set(arr)
+	f.isTag(arr, tagArray)
+	f.op(opI32Eqz)
+	f.if_(blockVoid)
+	g.returnError(f, "argument to `"+name+"` must be array, got ", arr)
+	f.end()
+}
+
+func (g *generator) rtLen(f *function) {
+	const argv = 0
+	arg := f.local(i32)
+	g.checkArgs(f, 1)
+	f.get(argv)
+	f.load(0)
+	f.set(arg)
+	// 字符串和数组的长度都在第二个字, 字符串的长度是字节数
+	f.isTag(arg, tagString)
+	f.isTag(arg, tagArray)
+	f.op(opI32Or)
+	f.if_(blockVoid)
+	f.get(arg)
+	f.load(4)
+	f.op(opI64ExtendI32U)
+	g.call(f, "new_int")
+	f.op(opReturn)
+	f.end()
+	g.returnError(f, "argument to `len` not supported, got ", arg)
+}
+
+func (g *generator) rtPush(f *function) {
+	const argv = 0
+	arr, n, out := f.local(i32), f.local(i32), f.local(i32)
+	g.checkArgs(f, 2)
+	g.checkArray(f, "push", arr)
+	f.get(arr)
+	f.load(4)
+	f.tee(n)
+	f.i32(1)
+	f.op(opI32Add)
+	g.call(f, "new_array")
+	f.tee(out)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(arr)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(n)
+	f.i32(4)
+	f.op(opI32Mul)
+	g.call(f, "copy")
+	f.element(out, n, 4)
+	f.get(argv)
+	f.load(4)
+	f.store(8)
+	f.get(out)
+}
+
+// arrayElement 生成 first 和 last, 空数组返回 null
+func arrayElement(name string, last bool) func(g *generator, f *function) {
+	return func(g *generator, f *function) {
+		arr, i := f.local(i32), f.local(i32)
+		g.checkArgs(f, 1)
+		g.checkArray(f, name, arr)
+		f.get(arr)
+		f.load(4)
+		f.op(opI32Eqz)
+		f.if_(blockVoid)
+		f.i32(addrNull)
+		f.op(opReturn)
+		f.end()
+		if last {
+			f.get(arr)
+			f.load(4)
+			f.i32(1)
+			f.op(opI32Sub)
+			f.set(i)
+		}
+		f.element(arr, i, 4)
+		f.load(8)
+	}
+}
+
+func (g *generator) rtRest(f *function) {
+	arr, n, out := f.local(i32), f.local(i32), f.local(i32)
+	g.checkArgs(f, 1)
+	g.checkArray(f, "rest", arr)
+	f.get(arr)
+	f.load(4)
+	f.tee(n)
+	f.op(opI32Eqz)
+	f.if_(blockVoid)
+	f.i32(addrNull)
+	f.op(opReturn)
+	f.end()
+	f.get(n)
+	f.i32(1)
+	f.op(opI32Sub)
+	f.tee(n)
+	g.call(f, "new_array")
+	f.tee(out)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(arr)
+	f.i32(12)
+	f.op(opI32Add)
+	f.get(n)
+	f.i32(4)
+	f.op(opI32Mul)
+	g.call(f, "copy")
+	f.get(out)
+}
+
+// print 与 object.Builtins 中的 print 相同, 每个参数输出一行, 由宿主导入的 write 写出
+func (g *generator) rtPrint(f *function) {
+	const argv, argc = 0, 1
+	i, s := f.local(i32), f.local(i32)
+	f.forRange(i, argc, func() {
+		f.element(argv, i, 4)
+		f.load(0)
+		g.call(f, "inspect")
+		g.pushString(f, "\n")
+		g.call(f, "concat")
+		f.tee(s)
+		f.i32(8)
+		f.op(opI32Add)
+		f.get(s)
+		f.load(4)
+		f.index(opCall, importWrite)
+	})
+	f.i32(addrNull)
+}
+
+func (g *generator) rtIter(f *function) {
+	const argv = 0
+	v, arr := f.local(i32), f.local(i32)
+	g.checkArgs(f, 1)
+	f.get(argv)
+	f.load(0)
+	f.set(v)
+	f.isTag(v, tagIterator)
+	f.if_(blockVoid)
+	f.get(v)
+	f.op(opReturn)
+	f.end()
+	f.get(v)
+	g.call(f, "iterable")
+	f.tee(arr)
+	f.i32(-1)
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	g.returnError(f, "argument to `iter` not supported, got ", v)
+	f.end()
+	f.get(arr)
+	g.call(f, "new_iterator")
+}
+
+func (g *generator) rtNext(f *function) {
+	const argv = 0
+	it, v := f.local(i32), f.local(i32)
+	g.checkArgs(f, 1)
+	f.get(argv)
+	f.load(0)
+	f.set(it)
+	f.isTag(it, tagIterator)
+	f.op(opI32Eqz)
+	f.if_(blockVoid)
+	g.returnError(f, "argument to `next` must be iterator, got ", it)
+	f.end()
+	// 迭代结束后返回 null
+	f.get(it)
+	g.call(f, "iter_next")
+	f.tee(v)
+	f.i32(addrNull)
+	f.get(v)
+	f.i32(-1)
+	f.op(opI32Ne, opSelect)
+}
+
+// collect 取出迭代器中剩下的值, 数组、字符串和哈希与 iterable 相同
+func (g *generator) rtCollect(f *function) {
+	const argv = 0
+	v, arr, pos, n, out := f.local(i32), f.local(i32), f.local(i32), f.local(i32), f.local(i32)
+	g.checkArgs(f, 1)
+	f.get(argv)
+	f.load(0)
+	f.set(v)
+	f.isTag(v, tagIterator)
+	f.if_(blockVoid)
+	f.get(v)
+	f.load(4)
+	f.tee(arr)
+	f.load(4)
+	f.get(v)
+	f.load(8)
+	f.tee(pos)
+	f.op(opI32Sub)
+	f.tee(n)
+	g.call(f, "new_array")
+	f.tee(out)
+	f.i32(8)
+	f.op(opI32Add)
+	f.element(arr, pos, 4)
+	f.i32(8)
+	f.op(opI32Add)
+	f.get(n)
+	f.i32(4)
+	f.op(opI32Mul)
+	g.call(f, "copy")
+	f.get(v)
+	f.get(arr)
+	f.load(4)
+	f.store(8)
+	f.get(out)
+	f.op(opReturn)
+	f.end()
+	f.get(v)
+	g.call(f, "iterable")
+	f.tee(arr)
+	f.i32(-1)
+	f.op(opI32Eq)
+	f.if_(blockVoid)
+	g.returnError(f, "argument to `collect` not supported, got ", v)
+	f.end()
+	f.get(arr)
+}
@@ -0,0 +1,424 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"go-example/monkey/ast"
+	"go-example/monkey/compiler"
+	"go-example/monkey/object"
+	"go-example/monkey/token"
+)
+
+// importWrite 是宿主提供的 monkey.write(ptr, len), print 用它输出
+const importWrite uint32 = 0
+
+// Compile 把宏已经展开的程序编译为一个 WebAssembly 模块. 模块自带运行时,
+// 只导入 monkey.write 一个函数, 导出 memory、run、inspect 和 error:
+// run 运行程序并返回最后一个顶层表达式语句的值, inspect 把值转换为字符串对象,
+// 运行时错误使 run 陷入 unreachable, 错误信息的字符串对象保存在全局变量 error 中.
+//
+// 语义与 vm 相同: 求值顺序与栈指令一致, 闭包在创建时按值捕获自由变量,
+// 哈希按插入顺序保存键值对. 生成器以及任务和通道相关的内置函数不支持.
+func Compile(program *ast.Program) ([]byte, error) {
+	table := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		table.DefineBuiltin(i, builtin.Name)
+	}
+	if err := compiler.Resolve(program, table); err != nil {
+		return nil, err
+	}
+
+	g := newGenerator()
+	main := &function{name: "run", typ: sig(nil, i32)}
+	last := main.local(i32)
+	for _, stmt := range program.Statements {
+		if g.statement(main, stmt) {
+			main.set(last)
+		}
+	}
+	main.get(last)
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.module(main), nil
+}
+
+type generator struct {
+	m    module
+	data static
+
+	strings  map[string]uint32
+	integers map[int64]uint32
+	builtin  map[int]uint32
+	// typeNames 是类型名字符串地址组成的表, 按类型标记索引
+	typeNames uint32
+
+	funcIndex    map[string]uint32
+	builtinOrder []string
+	builtinIDs   map[string]int
+
+	numGlobals int
+	err        error
+}
+
+func newGenerator() *generator {
+	g := &generator{
+		strings:    map[string]uint32{},
+		integers:   map[int64]uint32{},
+		builtin:    map[int]uint32{},
+		funcIndex:  map[string]uint32{},
+		builtinIDs: map[string]int{},
+	}
+	g.m.imports = append(g.m.imports, imported{"monkey", "write", sig([]byte{i32, i32})})
+
+	g.data.object(tagNull, 0)
+	g.data.object(tagBoolean, 0)
+	g.data.object(tagBoolean, 1)
+	g.data.Write(make([]byte, addrItoaEnd-addrItoa))
+	names := make([]uint32, len(typeNames))
+	for i, name := range typeNames {
+		names[i] = g.constString(name)
+	}
+	g.typeNames = g.data.object(names...)
+
+	for i, b := range object.Builtins {
+		if _, ok := builtins[b.Name]; ok {
+			g.builtinOrder = append(g.builtinOrder, b.Name)
+			g.builtinIDs[b.Name] = i
+		}
+	}
+
+	// 先登记所有运行时函数的下标, 函数体之间可以互相调用
+	for _, rf := range runtimeFuncs {
+		g.funcIndex[rf.name] = uint32(len(g.m.imports) + len(g.m.funcs))
+		g.m.funcs = append(g.m.funcs, &function{name: rf.name, typ: sig(rf.params, rf.results...)})
+	}
+	for i, rf := range runtimeFuncs {
+		rf.gen(g, g.m.funcs[i])
+	}
+	return g
+}
+
+func (g *generator) fail(tok token.Token, format string, a ...any) {
+	if g.err == nil {
+		g.err = fmt.Errorf("%d:%d: %s", tok.Line, tok.Column, fmt.Sprintf(format, a...))
+	}
+}
+
+func (g *generator) constString(s string) uint32 {
+	addr, ok := g.strings[s]
+	if !ok {
+		addr = g.data.object(tagString, uint32(len(s)))
+		g.data.WriteString(s)
+		g.strings[s] = addr
+	}
+	return addr
+}
+
+func (g *generator) constInteger(v int64) uint32 {
+	addr, ok := g.integers[v]
+	if !ok {
+		addr = g.data.object(tagInteger, 0)
+		binary.Write(&g.data, binary.LittleEndian, v)
+		g.integers[v] = addr
+	}
+	return addr
+}
+
+func (g *generator) builtinObject(index int) uint32 {
+	addr, ok := g.builtin[index]
+	if !ok {
+		addr = g.data.object(tagBuiltin, uint32(index))
+		g.builtin[index] = addr
+	}
+	return addr
+}
+
+func (g *generator) module(main *function) []byte {
+	m := &g.m
+	g.funcIndex[main.name] = uint32(len(m.imports) + len(m.funcs))
+	m.funcs = append(m.funcs, main)
+
+	g.data.align()
+	m.data = g.data.Bytes()
+	m.globals = []global{
+		globalHeap:  {typ: i32, mutable: true, init: int64(len(m.data))},
+		globalDepth: {typ: i32, mutable: true},
+		globalError: {typ: i32, mutable: true},
+	}
+	for i := 0; i < g.numGlobals; i++ {
+		m.globals = append(m.globals, global{typ: i32, mutable: true, init: addrNull})
+	}
+	m.exports = []export{
+		{"memory", exportMemory, 0},
+		{"run", exportFunc, g.funcIndex["run"]},
+		{"inspect", exportFunc, g.funcIndex["inspect"]},
+		{"error", exportGlobal, globalError},
+	}
+	return m.encode()
+}
+
+// statements 生成一组语句, 在栈上留下最后一个语句的值. 与 blockValue 相同,
+// 最后一个语句不是表达式语句时值为 null
+func (g *generator) statements(f *function, stmts []ast.Statement) {
+	value := false
+	for i, stmt := range stmts {
+		value = g.statement(f, stmt)
+		if value && i != len(stmts)-1 {
+			f.op(opDrop)
+		}
+	}
+	if !value {
+		f.i32(addrNull)
+	}
+}
+
+// statement 生成一个语句, 表达式语句在栈上留下表达式的值并返回 true
+func (g *generator) statement(f *function, stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		g.expression(f, stmt.Expression)
+		return true
+	case *ast.LetStatement:
+		g.expression(f, stmt.Value)
+		g.store(f, stmt.Name)
+	case *ast.ReturnStatement:
+		g.expression(f, stmt.ReturnValue)
+		f.op(opReturn)
+	case *ast.YieldStatement:
+		g.fail(stmt.Token, "generators are not supported by the wasm backend")
+	case *ast.ForStatement:
+		it, value := f.local(i32), f.local(i32)
+		g.expression(f, stmt.Iterable)
+		g.call(f, "iterate")
+		f.set(it)
+		f.block(blockVoid)
+		f.loop()
+		f.get(it)
+		g.call(f, "iter_next")
+		f.tee(value)
+		f.i32(-1)
+		f.op(opI32Eq)
+		f.brIf(1)
+		f.get(value)
+		g.store(f, stmt.Variable)
+		for _, s := range stmt.Body.Statements {
+			if g.statement(f, s) {
+				f.op(opDrop)
+			}
+		}
+		f.br(0)
+		f.end()
+		f.end()
+	}
+	return false
+}
+
+// 脚本函数的前三个局部变量是参数 closure、argv 和 argc, 之后是 compiler.Resolve 给出的局部变量
+const (
+	localClosure uint32 = 0
+	localArgv    uint32 = 1
+	localBase    uint32 = 3
+)
+
+func (g *generator) store(f *function, ident *ast.Identifier) {
+	switch compiler.SymbolScope(ident.Slot.Scope) {
+	case compiler.GlobalScope:
+		if ident.Slot.Index >= g.numGlobals {
+			g.numGlobals = ident.Slot.Index + 1
+		}
+		f.index(opGlobalSet, numRuntimeGlobals+uint32(ident.Slot.Index))
+	default:
+		f.set(localBase + uint32(ident.Slot.Index))
+	}
+}
+
+func (g *generator) load(f *function, slot ast.Slot) {
+	switch compiler.SymbolScope(slot.Scope) {
+	case compiler.GlobalScope:
+		if slot.Index >= g.numGlobals {
+			g.numGlobals = slot.Index + 1
+		}
+		f.index(opGlobalGet, numRuntimeGlobals+uint32(slot.Index))
+	case compiler.LocalScope:
+		f.get(localBase + uint32(slot.Index))
+	case compiler.BuiltinScope:
+		f.i32(int32(g.builtinObject(slot.Index)))
+	case compiler.FreeScope:
+		f.get(localClosure)
+		f.load(16 + 4*uint32(slot.Index))
+	default:
+		f.get(localClosure)
+	}
+}
+
+var infixFuncs = map[string]string{
+	"+": "add",
+	"-": "sub",
+	"*": "mul",
+	"/": "div",
+	">": "greater",
+}
+
+// expression 生成计算 expr 的指令, 在栈上留下结果
+func (g *generator) expression(f *function, expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		f.i32(int32(g.constInteger(expr.Value)))
+	case *ast.StringLiteral:
+		f.i32(int32(g.constString(expr.Value)))
+	case *ast.Boolean:
+		if expr.Value {
+			f.i32(addrTrue)
+		} else {
+			f.i32(addrFalse)
+		}
+	case *ast.Identifier:
+		if expr.Slot == nil {
+			g.fail(expr.Token, "undefined variable %s", expr.Value)
+			f.i32(addrNull)
+			return
+		}
+		if _, ok := builtins[expr.Value]; !ok && expr.Slot.Scope == string(compiler.BuiltinScope) {
+			g.fail(expr.Token, "`%s` is not supported by the wasm backend", expr.Value)
+		}
+		g.load(f, *expr.Slot)
+	case *ast.PrefixExpression:
+		g.expression(f, expr.Right)
+		switch expr.Operator {
+		case "-":
+			g.call(f, "negate")
+		case "!":
+			g.call(f, "bang")
+		default:
+			g.fail(expr.Token, "unknown operator %s", expr.Operator)
+		}
+	case *ast.InfixExpression:
+		// 与编译器相同, a < b 先求值 b, 再求值 a, 然后比较 b > a
+		if expr.Operator == "<" {
+			g.expression(f, expr.Right)
+			g.expression(f, expr.Left)
+			g.call(f, "greater")
+			return
+		}
+		g.expression(f, expr.Left)
+		g.expression(f, expr.Right)
+		switch expr.Operator {
+		case "==":
+			g.call(f, "equal")
+			g.call(f, "boolean")
+		case "!=":
+			g.call(f, "equal")
+			f.op(opI32Eqz)
+			g.call(f, "boolean")
+		default:
+			name, ok := infixFuncs[expr.Operator]
+			if !ok {
+				g.fail(expr.Token, "unknown operator %s", expr.Operator)
+				return
+			}
+			g.call(f, name)
+		}
+	case *ast.IfExpression:
+		g.expression(f, expr.Condition)
+		g.call(f, "truthy")
+		f.if_(i32)
+		g.statements(f, expr.Consequence.Statements)
+		f.else_()
+		if expr.Alternative != nil {
+			g.statements(f, expr.Alternative.Statements)
+		} else {
+			f.i32(addrNull)
+		}
+		f.end()
+	case *ast.ArrayLiteral:
+		g.array(f, expr.Elements)
+	case *ast.HashLiteral:
+		// 与 vm 相同, 先求值所有的键和值, 再构造哈希
+		var elems []ast.Expression
+		for _, key := range expr.Keys {
+			elems = append(elems, key, expr.Pairs[key])
+		}
+		g.array(f, elems)
+		g.call(f, "build_hash")
+	case *ast.TemplateLiteral:
+		g.array(f, expr.Parts)
+		g.call(f, "template")
+	case *ast.IndexExpression:
+		g.expression(f, expr.Left)
+		g.expression(f, expr.Index)
+		g.call(f, "index")
+	case *ast.CallExpression:
+		g.expression(f, expr.Function)
+		if len(expr.Arguments) == 0 {
+			f.i32(0)
+		} else {
+			// 参数放在一个数组对象中, argv 指向它的元素
+			g.array(f, expr.Arguments)
+			f.i32(8)
+			f.op(opI32Add)
+		}
+		f.i32(int32(len(expr.Arguments)))
+		g.call(f, "call")
+	case *ast.FunctionLiteral:
+		if expr.Generator {
+			g.fail(expr.Token, "generators are not supported by the wasm backend")
+		}
+		f.i32(int32(g.function(expr)))
+		f.i32(int32(len(expr.Parameters)))
+		f.i32(int32(len(expr.Free)))
+		g.call(f, "new_closure")
+		if len(expr.Free) > 0 {
+			// 与 OpClosure 相同, 在外层函数中取出自由变量的值
+			cl := f.local(i32)
+			f.set(cl)
+			for i, slot := range expr.Free {
+				f.get(cl)
+				g.load(f, slot)
+				f.store(16 + 4*uint32(i))
+			}
+			f.get(cl)
+		}
+	case *ast.MacroLiteral:
+		g.fail(expr.Token, "macros must be expanded before compiling to wasm")
+		f.i32(addrNull)
+	default:
+		g.fail(token.Token{}, "unsupported expression %T", expr)
+		f.i32(addrNull)
+	}
+}
+
+// array 依次求值 exprs 并放入一个新的数组
+func (g *generator) array(f *function, exprs []ast.Expression) {
+	arr := f.local(i32)
+	f.i32(int32(len(exprs)))
+	g.call(f, "new_array")
+	f.set(arr)
+	for i, expr := range exprs {
+		f.get(arr)
+		g.expression(f, expr)
+		f.store(8 + 4*uint32(i))
+	}
+	f.get(arr)
+}
+
+// function 为函数字面量生成一个 wasm 函数并放入表中, 返回它在表中的下标
+func (g *generator) function(fl *ast.FunctionLiteral) uint32 {
+	f := &function{typ: monkeyFunc}
+	index := uint32(len(g.m.imports) + len(g.m.funcs))
+	g.m.funcs = append(g.m.funcs, f)
+	tableIndex := uint32(len(g.m.table))
+	g.m.table = append(g.m.table, index)
+
+	f.locals = make([]byte, fl.NumLocals)
+	for i := range f.locals {
+		f.locals[i] = i32
+	}
+	for i := range fl.Parameters {
+		f.get(localArgv)
+		f.load(4 * uint32(i))
+		f.set(localBase + uint32(i))
+	}
+	g.statements(f, fl.Body.Statements)
+	return tableIndex
+}
@@ -0,0 +1,116 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"go-example/monkey/ast"
+	"go-example/monkey/lexer"
+	"go-example/monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// 与 vm 的对照在 vm 包的测试中, 这里是 vm 的测试没有覆盖到的运行时行为
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`print(1, "a", [true, {"k": if (false) { 1 }}]); 2`, "2", "1\na\n[true, {k: null}]\n"},
+		{`let it = iter([1, 2, 3]); let a = next(it); [a, collect(it), next(it)]`, "[1, [2, 3], null]", ""},
+		{`let it = iter("hé!"); let a = next(it); for (c in it) { print(c) } a`, "h", "é\n!\n"},
+		{`[collect({"b": 1, "a": 2}), iter(1), collect(1), next(1)]`,
+			"[[b, a], Message: argument to `iter` not supported, got integer, " +
+				"Message: argument to `collect` not supported, got integer, " +
+				"Message: argument to `next` must be iterator, got integer]", ""},
+		{`[-9223372036854775807 - 1, 0 - 1 * 42, 7 / -2]`, "[-9223372036854775808, -42, -3]", ""},
+		{`let f = fn(x) { if (x == 0) { return 0; } f(x - 1) }; f(1000)`, "0", ""},
+		// 分配超过一页内存
+		{`let grow = fn(s, n) { if (n == 0) { len(s) } else { grow(s + "0123456789", n - 1) } }; grow("", 500)`, "5000", ""},
+		{`let f = fn() { f() }; f()`, "error: stack overflow", ""},
+		// 对象不回收, 分配的总量超过 MaxMemory 时报告错误而不是陷入
+		{`let double = fn(s) { double(s + s) }; double("0123456789")`, "error: out of memory", ""},
+		{`1 / 0`, "error: wasm error: integer divide by zero", ""},
+	}
+
+	for _, tt := range tests {
+		module, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		var out bytes.Buffer
+		result, err := Run(context.Background(), module, &out)
+		got := result.Inspect
+		if err != nil {
+			got = "error: " + err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+		if out.String() != tt.output {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+// 结果是错误对象时 Run 设置 IsError, 内容相同的字符串不是错误
+func TestRunErrorValue(t *testing.T) {
+	tests := []struct {
+		input   string
+		isError bool
+		message string
+	}{
+		{`len(1)`, true, "argument to `len` not supported, got integer"},
+		{`"Message: argument to ` + "`len`" + ` not supported, got integer"`, false, ""},
+		{`[len(1)]`, false, ""},
+	}
+
+	for _, tt := range tests {
+		module, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		result, err := Run(context.Background(), module, nil)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if result.IsError != tt.isError || result.Message != tt.message {
+			t.Errorf("%q: wrong result: %+v", tt.input, result)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let gen = fn() { yield 1; }; gen()`, "1:11: generators are not supported by the wasm backend"},
+		{`let ch = channel(); ch`, "1:10: `channel` is not supported by the wasm backend"},
+		{`spawn(fn() { 1 })`, "1:1: `spawn` is not supported by the wasm backend"},
+		{`json_parse("1")`, "1:1: `json_parse` is not supported by the wasm backend"},
+		{`let x = y;`, "1:9: identifier not found: y"},
+		{`let m = macro(a) { a };`, "1:9: macros must be expanded before compiling to wasm"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("%q: expected error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}